@@ -0,0 +1,164 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Age promotes each item which has waited in its priority level for at
+// least the AgingInterval the priority queue was opened with to the
+// tail of the next more important level, returning the number of items
+// promoted. Dequeue does the same before taking each item, so Age only
+// needs to be called to promote items without dequeuing any.
+//
+// A promoted item gets a new ID in its new level, and its wait starts
+// over, so an item keeps moving up one level per AgingInterval until
+// it is dequeued. Items are checked from the head of each level, which
+// holds the items that have waited longest, so a sweep costs
+// O(aged items) reads and writes, plus one read per level holding
+// items. All promotions are made using a single LevelDB write.
+//
+// Items added while AgingInterval was not set have no enqueue time and
+// are never promoted, and neither are the items behind them in the same
+// level until they have been dequeued. Age does nothing if
+// AgingInterval is not set.
+func (pq *PriorityQueue) Age() (int, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return pq.age(time.Now())
+}
+
+// ageDue promotes the items which have waited long enough if any item
+// may be due for promotion at the given time. The priority queue must
+// be locked by the caller.
+func (pq *PriorityQueue) ageDue(now time.Time) error {
+	if pq.aging <= 0 || now.Before(pq.nextAge) {
+		return nil
+	}
+
+	_, err := pq.age(now)
+	return err
+}
+
+// age promotes the items which have waited in their priority level for
+// at least the aging interval at the given time, and records when the
+// next item is due for promotion. The priority queue must be locked by
+// the caller.
+func (pq *PriorityQueue) age(now time.Time) (int, error) {
+	if pq.aging <= 0 {
+		return 0, nil
+	}
+
+	// Work on copies of the positions until the batch is written.
+	var heads, tails, holes [256]uint64
+	for i, level := range pq.levels {
+		heads[i], tails[i], holes[i] = level.head, level.tail, level.holes
+	}
+
+	batch := new(leveldb.Batch)
+	promoted := 0
+	next := now.Add(pq.aging)
+
+	// Check each level from the most important, so items promoted into
+	// a level are not checked again, skipping the most important level
+	// since its items can not be promoted.
+	for i := 1; i <= 255; i++ {
+		priority, dst := pq.levelAt(i), pq.levelAt(i-1)
+		if heads[priority] == tails[priority] {
+			continue
+		}
+
+		iter := pq.db.NewIterator(&util.Range{
+			Start: pq.generateKey(priority, heads[priority]+1),
+			Limit: pq.generateKey(priority, tails[priority]+1),
+		}, nil)
+		drained := true
+		for iter.Next() {
+			rec, err := pq.format.decode(iter.Value())
+			if err != nil {
+				iter.Release()
+				return 0, err
+			}
+
+			// Skip over any holes in front of the item.
+			id := keyToID(iter.Key()[2:])
+			holes[priority] -= id - heads[priority] - 1
+			heads[priority] = id - 1
+
+			// Stop at the first item which is not due yet.
+			due := rec.enqueuedAt.Add(pq.aging)
+			if rec.enqueuedAt.IsZero() || due.After(now) {
+				if !rec.enqueuedAt.IsZero() && due.Before(next) {
+					next = due
+				}
+				drained = false
+				break
+			}
+
+			// Move the item to the tail of the next level.
+			rec.enqueuedAt = now
+			b, err := pq.format.encode(rec)
+			if err != nil {
+				iter.Release()
+				return 0, err
+			}
+
+			tails[dst]++
+			batch.Delete(append([]byte(nil), iter.Key()...))
+			batch.Put(pq.generateKey(dst, tails[dst]), b)
+			heads[priority]++
+			promoted++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return 0, err
+		}
+
+		// Every item of the level was promoted.
+		if drained {
+			heads[priority], holes[priority] = tails[priority], 0
+		}
+	}
+
+	if promoted > 0 {
+		for i, level := range pq.levels {
+			if holes[i] != level.holes {
+				pq.putHoles(batch, uint8(i), holes[i])
+			}
+		}
+
+		if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+			return 0, err
+		}
+
+		// Update the positions of each priority level.
+		for i, level := range pq.levels {
+			level.head, level.tail, level.holes = heads[i], tails[i], holes[i]
+
+			// If this priority level is more important than the curLevel.
+			if level.length() > 0 && (pq.cmpAsc(uint8(i)) || pq.cmpDesc(uint8(i))) {
+				pq.curLevel = uint8(i)
+			}
+		}
+	}
+
+	pq.nextAge = next
+	return promoted, nil
+}
+
+// levelTime returns the time to store with an item added to a priority
+// level, which is only stored if the priority queue ages its items.
+func (pq *PriorityQueue) levelTime() time.Time {
+	if pq.aging <= 0 {
+		return time.Time{}
+	}
+	return time.Now()
+}
@@ -0,0 +1,172 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPriorityQueueAge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	opts := &Options{AgingInterval: 50 * time.Millisecond}
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, opts)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = pq.EnqueueString(2, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Nothing has waited long enough yet.
+	n, err := pq.Age()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 0 {
+		t.Errorf("Expected 0 items to be promoted, got %d", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	if _, err = pq.EnqueueString(2, "value for item 3"); err != nil {
+		t.Error(err)
+	}
+
+	// The first two items move up one level, in order.
+	n, err = pq.Age()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 items to be promoted, got %d", n)
+	}
+
+	if pq.LengthByLevel(1) != 2 || pq.LengthByLevel(2) != 1 {
+		t.Errorf("Expected level lengths of 2 and 1, got %d and %d", pq.LengthByLevel(1), pq.LengthByLevel(2))
+	}
+
+	item, err := pq.PeekByPriorityID(1, 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	// The wait of promoted items starts over, and is kept when the
+	// priority queue is reopened.
+	if err = pq.Close(); err != nil {
+		t.Error(err)
+	}
+	pq, err = OpenPriorityQueueWithOptions(file, ASC, opts)
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 1"
+
+	if deqItem.Priority != 0 || deqItem.ToString() != compStr {
+		t.Errorf("Expected item '%s' of level 0, got '%s' of level %d", compStr, deqItem.ToString(), deqItem.Priority)
+	}
+
+	if pq.LengthByLevel(0) != 1 || pq.LengthByLevel(1) != 1 || pq.LengthByLevel(2) != 0 {
+		t.Errorf("Expected level lengths of 1, 1 and 0, got %d, %d and %d", pq.LengthByLevel(0), pq.LengthByLevel(1), pq.LengthByLevel(2))
+	}
+}
+
+func TestPriorityQueueAgeDisabled(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString(1, "value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	n, err := pq.Age()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 0 {
+		t.Errorf("Expected 0 items to be promoted, got %d", n)
+	}
+
+	if pq.LengthByLevel(1) != 1 {
+		t.Errorf("Expected level length of 1, got %d", pq.LengthByLevel(1))
+	}
+}
+
+func TestPriorityQueueAgeHoles(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	opts := &Options{AgingInterval: 50 * time.Millisecond}
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, opts)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 4; i++ {
+		if _, err = pq.EnqueueString(2, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Moving an item leaves a hole, and keeps its wait.
+	if _, err = pq.UpdatePriority(2, 2, 5); err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	n, err := pq.Age()
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 4 {
+		t.Errorf("Expected 4 items to be promoted, got %d", n)
+	}
+
+	if pq.LengthByLevel(2) != 0 || pq.LengthByLevel(1) != 3 || pq.LengthByLevel(4) != 1 {
+		t.Errorf("Expected level lengths of 0, 3 and 1, got %d, %d and %d", pq.LengthByLevel(2), pq.LengthByLevel(1), pq.LengthByLevel(4))
+	}
+
+	pq.Close()
+	pq, err = OpenPriorityQueueWithOptions(file, ASC, opts)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", pq.Length())
+	}
+
+	for _, i := range []int{1, 3, 4, 2} {
+		item, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
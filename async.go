@@ -0,0 +1,113 @@
+package goque
+
+import "sync"
+
+// EnqueueResult is the result of an EnqueueAsync, holding the added
+// item or the error adding it.
+type EnqueueResult struct {
+	Item *Item
+	Err  error
+}
+
+// DequeueResult is the result of a DequeueAsync, holding the removed
+// item or the error removing it.
+type DequeueResult struct {
+	Item *Item
+	Err  error
+}
+
+// EnqueueAsync adds an item to the queue like Enqueue, but returns
+// straight away, delivering the result on the returned channel once the
+// item has been written. The channel is buffered, so the result does
+// not need to be received.
+//
+// Asynchronous operations of a queue are run one at a time by a worker
+// goroutine in the order they were submitted, so an EnqueueAsync
+// followed by a DequeueAsync sees the item enqueued. The worker only
+// runs while there are operations to run. Close waits for the
+// operations submitted before it to finish, and operations submitted
+// once the queue is closed deliver ErrDBClosed.
+func (q *Queue) EnqueueAsync(value []byte) <-chan EnqueueResult {
+	ch := make(chan EnqueueResult, 1)
+	q.async.submit(func() {
+		item, err := q.Enqueue(value)
+		ch <- EnqueueResult{Item: item, Err: err}
+	})
+	return ch
+}
+
+// DequeueAsync removes the next item in the queue like Dequeue, but
+// returns straight away, delivering the result on the returned channel.
+// See EnqueueAsync for how asynchronous operations are run.
+func (q *Queue) DequeueAsync() <-chan DequeueResult {
+	ch := make(chan DequeueResult, 1)
+	q.async.submit(func() {
+		item, err := q.Dequeue()
+		ch <- DequeueResult{Item: item, Err: err}
+	})
+	return ch
+}
+
+// asyncWorker runs the asynchronous operations of a queue in order. The
+// zero value is ready to use.
+type asyncWorker struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	ops     []func()
+	running bool
+
+	// submitted and finished count the operations submitted to and
+	// finished by the worker.
+	submitted uint64
+	finished  uint64
+}
+
+// submit adds the given operation to those the worker runs, starting
+// the worker goroutine if it is not running.
+func (w *asyncWorker) submit(op func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.ops = append(w.ops, op)
+	w.submitted++
+	if !w.running {
+		w.running = true
+		go w.run()
+	}
+}
+
+// run runs the submitted operations in order, stopping once there are
+// none left.
+func (w *asyncWorker) run() {
+	w.mu.Lock()
+	for len(w.ops) > 0 {
+		op := w.ops[0]
+		w.ops[0] = nil
+		w.ops = w.ops[1:]
+		w.mu.Unlock()
+
+		op()
+
+		w.mu.Lock()
+		w.finished++
+		if w.cond != nil {
+			w.cond.Broadcast()
+		}
+	}
+	w.running = false
+	w.mu.Unlock()
+}
+
+// wait blocks until every operation submitted so far has finished.
+// Operations submitted in the meantime are not waited for.
+func (w *asyncWorker) wait() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.cond == nil {
+		w.cond = sync.NewCond(&w.mu)
+	}
+	for target := w.submitted; w.finished < target; {
+		w.cond.Wait()
+	}
+}
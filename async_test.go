@@ -0,0 +1,83 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueAsync(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// Operations run in the order they were submitted.
+	var enqueued []<-chan EnqueueResult
+	for i := 1; i <= 10; i++ {
+		enqueued = append(enqueued, q.EnqueueAsync([]byte(fmt.Sprintf("value for item %d", i))))
+	}
+	var dequeued []<-chan DequeueResult
+	for i := 1; i <= 11; i++ {
+		dequeued = append(dequeued, q.DequeueAsync())
+	}
+
+	for i, ch := range enqueued {
+		res := <-ch
+		if res.Err != nil {
+			t.Error(res.Err)
+		} else if res.Item.ID != uint64(i+1) {
+			t.Errorf("Expected ID of %d, got %d", i+1, res.Item.ID)
+		}
+	}
+
+	for i, ch := range dequeued[:10] {
+		res := <-ch
+		if res.Err != nil {
+			t.Error(res.Err)
+			continue
+		}
+		if res.Item.ToString() != fmt.Sprintf("value for item %d", i+1) {
+			t.Errorf("Expected value for item %d, got %s", i+1, res.Item.ToString())
+		}
+	}
+
+	if res := <-dequeued[10]; res.Err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", res.Err)
+	}
+}
+
+func TestQueueAsyncClose(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	var enqueued []<-chan EnqueueResult
+	for i := 1; i <= 100; i++ {
+		enqueued = append(enqueued, q.EnqueueAsync([]byte("value")))
+	}
+
+	// Close waits for the operations submitted before it.
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+	for _, ch := range enqueued {
+		select {
+		case res := <-ch:
+			if res.Err != nil {
+				t.Error(res.Err)
+			}
+		default:
+			t.Error("Expected the result to be delivered before Close returned")
+		}
+	}
+
+	if res := <-q.EnqueueAsync([]byte("value")); res.Err != ErrDBClosed {
+		t.Errorf("Expected to get queue closed error, got %v", res.Err)
+	}
+}
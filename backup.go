@@ -0,0 +1,367 @@
+package goque
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// backupMagic starts every backup archive, followed by the archive
+// format version.
+var backupMagic = []byte("GOQUEBAK")
+
+// backupVersion is the version of the backup archive format.
+const backupVersion byte = 1
+
+// restoreBatchSize is the number of bytes of keys and values restored
+// using each LevelDB write.
+const restoreBatchSize = 4 << 20
+
+// A backup archive has the following layout:
+//
+//	[0:8]  backupMagic
+//	[8]    backupVersion
+//	[9]    Type of the backed up structure
+//	[10]   codec ID of the backed up structure
+//	[...]  entries, each holding the uvarint length of the key, the
+//	       key, the uvarint length of the value and the value
+//	[...]  a uvarint zero, marking the end of the entries
+//
+// Keys and values are stored exactly as found in the database, so a
+// backup restores every item along with the bookkeeping data of the
+// structure. As for Fork, recovery markers of moves and the type key of
+// a namespace are left out.
+
+// Backup writes a backup archive of the queue to w. The archive holds
+// the queue as it was when Backup was called, even if items are added
+// or removed while it is being written. Use RestoreQueue to restore
+// the archive.
+func (q *Queue) Backup(w io.Writer) error {
+	q.RLock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := q.db.GetSnapshot()
+	q.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, snap, TypeQueue, q.codec)
+}
+
+// Backup writes a backup archive of the stack to w. The archive holds
+// the stack as it was when Backup was called, even if items are pushed
+// or popped while it is being written. Use RestoreQueue to restore the
+// archive, as stacks and queues share the same format.
+func (s *Stack) Backup(w io.Writer) error {
+	s.RLock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		s.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := s.db.GetSnapshot()
+	s.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, snap, TypeStack, s.codec)
+}
+
+// Backup writes a backup archive of the priority queue to w. The
+// archive holds the priority queue as it was when Backup was called,
+// even if items are added or removed while it is being written. Use
+// RestorePriorityQueue to restore the archive.
+func (pq *PriorityQueue) Backup(w io.Writer) error {
+	pq.RLock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		pq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := pq.db.GetSnapshot()
+	pq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, snap, TypePriorityQueue, pq.codec)
+}
+
+// Backup writes a backup archive of the prefix queue to w. The archive
+// holds the prefix queue as it was when Backup was called, even if
+// items are added or removed while it is being written. Use
+// RestorePrefixQueue to restore the archive.
+func (pq *PrefixQueue) Backup(w io.Writer) error {
+	pq.RLock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		pq.RUnlock()
+		return ErrDBClosed
+	}
+
+	snap, err := pq.db.GetSnapshot()
+	pq.RUnlock()
+	if err != nil {
+		return err
+	}
+	defer snap.Release()
+
+	return writeBackup(w, snap, TypePrefixQueue, pq.codec)
+}
+
+// RestoreQueue creates a new queue at the given directory from a backup
+// archive written by Queue.Backup or Stack.Backup. The directory must
+// not exist yet or be empty. If restoring fails, anything written to
+// the directory is removed.
+//
+// The queue is opened using the codec stored in the archive. If that
+// is not one of the codecs of this package, the queue is restored but
+// ErrIncompatibleCodec is returned, and the queue can then be opened
+// using OpenQueueWithOptions with the same codec.
+func RestoreQueue(dataDir string, r io.Reader) (*Queue, error) {
+	codec, err := restore(dataDir, r, TypeQueue, TypeStack)
+	if err != nil {
+		return nil, err
+	}
+
+	return openQueue(context.Background(), dataDir, &Options{Codec: codec}, nil)
+}
+
+// RestorePriorityQueue creates a new priority queue at the given
+// directory from a backup archive written by PriorityQueue.Backup,
+// opening it using the given order. It handles the directory and codec
+// of the archive like RestoreQueue.
+func RestorePriorityQueue(dataDir string, order order, r io.Reader) (*PriorityQueue, error) {
+	codec, err := restore(dataDir, r, TypePriorityQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	return openPriorityQueue(context.Background(), dataDir, order, &Options{Codec: codec}, nil)
+}
+
+// RestorePrefixQueue creates a new prefix queue at the given directory
+// from a backup archive written by PrefixQueue.Backup. It handles the
+// directory and codec of the archive like RestoreQueue.
+func RestorePrefixQueue(dataDir string, r io.Reader) (*PrefixQueue, error) {
+	codec, err := restore(dataDir, r, TypePrefixQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	return openPrefixQueue(context.Background(), dataDir, &Options{Codec: codec}, nil)
+}
+
+// restore creates a new data directory from a backup archive read from
+// r, which must hold one of the given types, the first of which is
+// reported by the error for any other type. It returns the codec stored
+// in the archive, or ErrIncompatibleCodec once the directory is restored
+// if that is not one of the codecs of this package.
+func restore(dataDir string, r io.Reader, types ...Type) (Codec, error) {
+	br := bufio.NewReader(r)
+
+	// Read the archive header.
+	header := make([]byte, len(backupMagic)+3)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, ErrInvalidBackup
+	}
+	if !bytes.Equal(header[:len(backupMagic)], backupMagic) || header[len(backupMagic)] != backupVersion {
+		return nil, ErrInvalidBackup
+	}
+
+	gt := Type(header[len(backupMagic)+1])
+	codecID := header[len(backupMagic)+2]
+	compatible := false
+	for _, t := range types {
+		compatible = compatible || gt == t
+	}
+	if !compatible {
+		return nil, &IncompatibleTypeError{Stored: gt, Requested: types[0]}
+	}
+
+	// Make sure a fresh database is created.
+	existed, err := checkEmptyDir("restore", dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := restoreBackup(dataDir, br, gt, codecID); err != nil {
+		removeDir(dataDir, existed)
+		return nil, err
+	}
+
+	// Find the codec used by the archive.
+	for _, c := range []Codec{GobCodec, JSONCodec} {
+		if c.ID() == codecID {
+			return c, nil
+		}
+	}
+	return nil, ErrIncompatibleCodec
+}
+
+// writeBackup writes a backup archive of every key and value within the
+// given snapshot to w.
+func writeBackup(w io.Writer, snap snapshot, gt Type, codec Codec) error {
+	bw := bufio.NewWriter(w)
+
+	// Write the archive header.
+	header := append(append([]byte(nil), backupMagic...), backupVersion, byte(gt), codec.ID())
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	// Write every key and value.
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	for iter.Next() {
+		if !copiedKey(iter.Key()) {
+			continue
+		}
+
+		for _, b := range [][]byte{iter.Key(), iter.Value()} {
+			n := binary.PutUvarint(buf, uint64(len(b)))
+			if _, err := bw.Write(buf[:n]); err != nil {
+				return err
+			}
+			if _, err := bw.Write(b); err != nil {
+				return err
+			}
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Mark the end of the entries.
+	n := binary.PutUvarint(buf, 0)
+	if _, err := bw.Write(buf[:n]); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// restoreBackup writes the entries of a backup archive, read from r
+// after the header, to a new LevelDB database at the given directory
+// along with its GOQUE file.
+func restoreBackup(dataDir string, r *bufio.Reader, gt Type, codecID byte) error {
+	db, err := leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// readBytes reads a uvarint length followed by that many bytes.
+	readBytes := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, ErrInvalidBackup
+		}
+		// Read through a limited reader rather than allocating the
+		// whole length up front, so a corrupt length fails cleanly.
+		b, err := io.ReadAll(io.LimitReader(r, int64(n)))
+		if err != nil {
+			return nil, err
+		}
+		if uint64(len(b)) != n {
+			return nil, ErrInvalidBackup
+		}
+		return b, nil
+	}
+
+	batch := new(leveldb.Batch)
+	size := 0
+	for {
+		key, err := readBytes()
+		if err != nil {
+			return err
+		}
+
+		// An empty key marks the end of the entries.
+		if len(key) == 0 {
+			break
+		}
+
+		value, err := readBytes()
+		if err != nil {
+			return err
+		}
+
+		batch.Put(key, value)
+		if size += len(key) + len(value); size >= restoreBatchSize {
+			if err := db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+			size = 0
+		}
+	}
+
+	// Sync the last write, and so every entry, to disk.
+	if err := db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
+
+	// Write the GOQUE file of the backed up structure.
+	return writeGoqueFile(dataDir, gt, codecID, true)
+}
+
+// checkEmptyDir checks that the given directory does not exist yet or
+// is empty, returning whether it exists. The given operation is used
+// for the error returned otherwise.
+func checkEmptyDir(op, dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return true, &os.PathError{Op: op, Path: dir, Err: os.ErrExist}
+	} else if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	return err == nil, nil
+}
+
+// removeDir removes what was written to a directory checked using
+// checkEmptyDir, keeping the directory itself if it existed before.
+func removeDir(dir string, existed bool) {
+	if existed {
+		removeContents(dir)
+	} else {
+		os.RemoveAll(dir)
+	}
+}
+
+// removeContents removes everything within the given directory,
+// keeping the directory itself.
+func removeContents(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		os.RemoveAll(filepath.Join(dir, entry.Name()))
+	}
+}
@@ -0,0 +1,267 @@
+package goque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// Changes after the backup should not be restored.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	restoreFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rq, err := RestoreQueue(restoreFile, &buf)
+	if err != nil {
+		t.Error(err)
+	}
+	defer rq.Drop()
+
+	if rq.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", rq.Length())
+	}
+
+	for i := 2; i <= 10; i++ {
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		deqItem, err := rq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+}
+
+func TestQueueRestoreExisting(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+	q.Close()
+
+	if _, err = RestoreQueue(file, &buf); !os.IsExist(err) {
+		t.Errorf("Expected to get already exists error, got %v", err)
+	}
+}
+
+func TestQueueRestoreInvalid(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// Cut off the end of the archive.
+	truncated := bytes.NewReader(buf.Bytes()[:buf.Len()-3])
+
+	restoreFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if _, err = RestoreQueue(restoreFile, truncated); err != ErrInvalidBackup {
+		t.Errorf("Expected to get invalid backup error, got %v", err)
+	}
+
+	if _, err = os.Stat(restoreFile); !os.IsNotExist(err) {
+		t.Errorf("Expected directory for restored database to have been removed, got %v", err)
+	}
+}
+
+func TestPriorityQueueRestoreIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	var buf bytes.Buffer
+	if err = pq.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	restoreFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if _, err = RestoreQueue(restoreFile, &buf); !errors.Is(err, ErrIncompatibleType) {
+		t.Errorf("Expected to get incompatible type error, got %v", err)
+	}
+}
+
+func TestPriorityQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		if _, err = pq.EnqueueString(uint8(4-p), fmt.Sprintf("value for item %d", 4-p)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	restoreFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rpq, err := RestorePriorityQueue(restoreFile, ASC, &buf)
+	if err != nil {
+		t.Error(err)
+	}
+	defer rpq.Drop()
+
+	if rpq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", rpq.Length())
+	}
+
+	for p := 0; p <= 4; p++ {
+		compStr := fmt.Sprintf("value for item %d", p)
+
+		deqItem, err := rpq.Dequeue()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+}
+
+func TestPrefixQueueBackupRestore(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 3; i++ {
+		for _, prefix := range []string{"a", "b"} {
+			if _, err = pq.EnqueueString(prefix, fmt.Sprintf("%s value for item %d", prefix, i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	// A prefix queue archive is not a queue archive.
+	restoreFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if _, err = RestoreQueue(restoreFile, bytes.NewReader(buf.Bytes())); !errors.Is(err, ErrIncompatibleType) {
+		t.Errorf("Expected to get incompatible type error, got %v", err)
+	}
+
+	rpq, err := RestorePrefixQueue(restoreFile, &buf)
+	if err != nil {
+		t.Error(err)
+	}
+	defer rpq.Drop()
+
+	if rpq.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", rpq.Length())
+	}
+
+	for i := 1; i <= 3; i++ {
+		compStr := fmt.Sprintf("b value for item %d", i)
+
+		deqItem, err := rpq.DequeueString("b")
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+}
+
+func TestQueueBackupSkipsMoveMarkers(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value"); err != nil {
+		t.Error(err)
+	}
+
+	// A recovery marker left by a move into the queue.
+	marker := internalKey("move:other")
+	if err = q.db.Put(marker, []byte("marker"), nil); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.Backup(&buf); err != nil {
+		t.Error(err)
+	}
+
+	restoreFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	rq, err := RestoreQueue(restoreFile, &buf)
+	if err != nil {
+		t.Error(err)
+	}
+	defer rq.Drop()
+
+	if ok, err := rq.db.Has(marker, nil); err != nil || ok {
+		t.Errorf("Expected move marker to be left out of the backup, got %v, %v", ok, err)
+	}
+
+	if rq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", rq.Length())
+	}
+}
@@ -0,0 +1,153 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestQueueChecksum(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// Items stored without a checksum are read as they are.
+	if _, err = q.EnqueueString("legacy value"); err != nil {
+		t.Error(err)
+	}
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	q, err = OpenQueueWithOptions(file, &Options{Checksum: true})
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "legacy value" {
+		t.Errorf("Expected value of legacy value, got %s", item.ToString())
+	}
+
+	item, err = q.PeekByID(2)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected value of value for item 1, got %s", item.ToString())
+	}
+
+	// Corrupt the last byte of the stored value of the item.
+	b, err := q.db.Get(idToKey(2), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	b[len(b)-1] ^= 0xff
+	if err = q.db.Put(idToKey(2), b, nil); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Peek(); err != ErrChecksumMismatch {
+		t.Errorf("Expected to get checksum mismatch error, got %v", err)
+	}
+	if _, err = q.Dequeue(); err != ErrChecksumMismatch {
+		t.Errorf("Expected to get checksum mismatch error, got %v", err)
+	}
+
+	// Checksums are verified even without the option.
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = q.PeekByID(2); err != ErrChecksumMismatch {
+		t.Errorf("Expected to get checksum mismatch error, got %v", err)
+	}
+
+	item, err = q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 2" {
+		t.Errorf("Expected value of value for item 2, got %s", item.ToString())
+	}
+}
+
+func TestQueueChecksumStreamed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Checksum: true, Cipher: newTestCipher(t, 1)})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	value := bytes.Repeat([]byte("z"), chunkSize+1)
+	item, err := q.EnqueueReader(bytes.NewReader(value), int64(len(value)))
+	if err != nil {
+		t.Error(err)
+	}
+
+	b, err := io.ReadAll(item.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, value) {
+		t.Errorf("Expected value of %d bytes, got %d", len(value), len(b))
+	}
+
+	// Corrupt the first byte of the second chunk.
+	b, err = q.db.Get(chunkKey(item.chunks.stream, 1), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	b[0] ^= 0xff
+	if err = q.db.Put(chunkKey(item.chunks.stream, 1), b, nil); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = io.ReadAll(item.ValueReader()); err != ErrChecksumMismatch {
+		t.Errorf("Expected to get checksum mismatch error, got %v", err)
+	}
+}
+
+func TestStackChecksum(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStackWithOptions(file, &Options{Checksum: true})
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	if _, err = s.PushString("value"); err != nil {
+		t.Error(err)
+	}
+
+	b, err := s.db.Get(idToKey(1), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	b[len(b)-1] ^= 0xff
+	if err = s.db.Put(idToKey(1), b, nil); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = s.Pop(); err != ErrChecksumMismatch {
+		t.Errorf("Expected to get checksum mismatch error, got %v", err)
+	}
+}
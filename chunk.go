@@ -0,0 +1,430 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// chunkSize is the number of bytes of a streamed value stored in each
+// of its chunks. Only the last chunk of a value may be shorter.
+const chunkSize = 64 << 10
+
+// chunkPrefix starts the key of every chunk of a streamed value.
+//
+// A value added using Queue.EnqueueReader is stored as an item record
+// without a value, holding the stream ID, number of chunks and size of
+// the value, along with the chunks themselves under the keys
+//
+//	chunkPrefix + 8 byte stream ID + 4 byte chunk index
+//
+// each holding up to chunkSize bytes of the value, sealed using the
+// cipher of the queue if it has one. If the record has recordChecksum
+// set, each chunk is followed by the 4 byte big-endian CRC32C of the
+// bytes stored before it. Chunks are keyed by stream rather
+// than by item ID, so they stay in place when an item is moved to a
+// different ID within its queue.
+var chunkPrefix = internalKey("chunk:")
+
+// chunkRange is the key range holding the chunks of every streamed
+// value.
+var chunkRange = util.BytesPrefix(chunkPrefix)
+
+// chunkSeqKey holds the last stream ID given by a queue.
+var chunkSeqKey = internalKey("chunkseq")
+
+// detachedPrefix starts the key marking the chunks of a streamed value
+// whose item was removed from the queue, but which can still be read
+// using Item.ValueReader. The key is followed by the 8 byte stream ID,
+// and holds the 4 byte number of chunks of the value.
+var detachedPrefix = internalKey("detached:")
+
+// detachedRange is the key range holding the markers of every detached
+// streamed value.
+var detachedRange = util.BytesPrefix(detachedPrefix)
+
+// chunkKey returns the key of the chunk with the given index of the
+// streamed value with the given stream ID.
+func chunkKey(stream uint64, n uint32) []byte {
+	return appendUint32(appendUint64(append([]byte(nil), chunkPrefix...), stream), n)
+}
+
+// chunkSource is the part of a database or snapshot used to read the
+// chunks of a streamed value.
+type chunkSource interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+}
+
+// chunkRef refers to the chunks holding a streamed value.
+type chunkRef struct {
+	stream uint64
+	count  uint32
+	size   int64
+
+	// checksum is set if each chunk is stored with a checksum.
+	checksum bool
+
+	// src is the database or snapshot holding the chunks, and format
+	// the format they were sealed with.
+	src    chunkSource
+	format recordFormat
+
+	// release, if not nil, removes the chunks of a detached value.
+	release func() error
+}
+
+// chunk returns the given chunk of the streamed value.
+func (ref *chunkRef) chunk(n uint32) ([]byte, error) {
+	if ref.src == nil {
+		return nil, ErrValueUnavailable
+	}
+
+	b, err := ref.src.Get(chunkKey(ref.stream, n), nil)
+	switch err {
+	case nil:
+	case leveldb.ErrNotFound, leveldb.ErrSnapshotReleased, leveldb.ErrClosed:
+		return nil, ErrValueUnavailable
+	default:
+		return nil, err
+	}
+
+	if ref.checksum {
+		if len(b) < 4 {
+			return nil, ErrChecksumMismatch
+		}
+		sum := binary.BigEndian.Uint32(b[len(b)-4:])
+		b = b[:len(b)-4]
+		if crc32.Checksum(b, checksumTable) != sum {
+			return nil, ErrChecksumMismatch
+		}
+	}
+
+	if ref.format.cipher != nil {
+		return ref.format.open(b)
+	}
+	return b, nil
+}
+
+// EnqueueReader adds an item to the queue whose value of the given size
+// is read from r, without holding the whole value in memory. The value
+// is stored in chunks of 64 KiB under their own keys, so it can be read
+// back the same way using Item.ValueReader, while the Value field of
+// the item is left empty. If the queue was opened with the Cipher
+// option, each chunk is sealed using it. Values are not compressed.
+//
+// The chunks are written before the queue is locked, so reading a slow
+// r does not hold up other goroutines, and the item is then added using
+// a single write. If fewer than size bytes can be read from r,
+// io.ErrUnexpectedEOF is returned and nothing is added. Bytes beyond
+// size are not read. ErrItemTooLarge is returned if size is larger than
+// the MaxItemBytes option allows.
+//
+// Removing the item, such as by Dequeue, leaves its chunks in place
+// until the reader returned by Item.ValueReader is closed, or the queue
+// is closed or opened again. Streamed values can be moved using Move,
+// Merge and the DeadLetterQueue option, but are not supported by
+// stacks, priority queues or prefix queues.
+func (q *Queue) EnqueueReader(r io.Reader, size int64) (*Item, error) {
+	if size < 0 {
+		return nil, ErrInvalidSize
+	}
+
+	// Check if the value is too large.
+	if q.format.maxBytes > 0 && size > int64(q.format.maxBytes) {
+		return nil, ErrItemTooLarge
+	}
+
+	q.Lock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.unlock()
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		q.unlock()
+		return nil, ErrReadOnly
+	}
+
+	// Check if queue is full, before reading the value.
+	if q.maxLength > 0 && q.Length() >= q.maxLength {
+		q.unlock()
+		return nil, ErrFull
+	}
+
+	// Give the value a new stream ID, keeping its chunks from being
+	// removed by Purge until the item is added.
+	ref := q.newChunkRef()
+	if err := q.db.Put(chunkSeqKey, appendUint64(nil, ref.stream), nil); err != nil {
+		q.unlock()
+		return nil, err
+	}
+	q.streaming[ref.stream] = true
+	q.unlock()
+
+	count, err := q.writeChunks(ref.stream, r, size)
+	ref.count, ref.size = count, size
+
+	q.Lock()
+	defer q.unlock()
+	delete(q.streaming, ref.stream)
+
+	var item *Item
+	if err == nil {
+		item, err = q.enqueue(&record{chunks: ref})
+	}
+	if err != nil {
+		// Remove the chunks written so far, if the queue is still open.
+		if q.isOpen {
+			batch := new(leveldb.Batch)
+			dropChunks(batch, ref)
+			q.db.Write(batch, nil)
+		}
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// writeChunks writes the chunks of the streamed value of the given size
+// read from r, returning the number of chunks written. The chunks are
+// not synced, as the write adding their item syncs them if needed.
+func (q *Queue) writeChunks(stream uint64, r io.Reader, size int64) (uint32, error) {
+	buf := make([]byte, chunkSize)
+
+	var n uint32
+	for left := size; left > 0; left -= chunkSize {
+		b := buf
+		if left < chunkSize {
+			b = buf[:left]
+		}
+		if _, err := io.ReadFull(r, b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+
+		b, err := q.format.sealChunk(b)
+		if err != nil {
+			return n, err
+		}
+		if err := q.db.Put(chunkKey(stream, n), b, nil); err != nil {
+			return n, err
+		}
+		n++
+	}
+
+	return n, nil
+}
+
+// newChunkRef returns a reference to the chunks of a new streamed value
+// of the queue, with the next stream ID. The queue must be locked by the
+// caller, who must store the stream ID under chunkSeqKey.
+func (q *Queue) newChunkRef() *chunkRef {
+	q.streams++
+	return &chunkRef{stream: q.streams, checksum: q.format.checksum, src: q.db, format: q.format}
+}
+
+// sealChunk returns the stored representation of the given chunk of a
+// streamed value, sealed using the cipher of the format and followed by
+// its checksum, if the format has them.
+func (f recordFormat) sealChunk(b []byte) ([]byte, error) {
+	if f.cipher != nil {
+		sealed, err := f.seal(b)
+		if err != nil {
+			return nil, err
+		}
+		b = sealed
+	}
+
+	if f.checksum {
+		b = appendUint32(append([]byte(nil), b...), crc32.Checksum(b, checksumTable))
+	}
+	return b, nil
+}
+
+// copyChunks adds the chunks of the given streamed value, which is held
+// by another database, to the batch as a new streamed value of the
+// queue, sealed using its own cipher, and returns the reference to the
+// copy. The queue must be locked by the caller.
+func (q *Queue) copyChunks(batch *leveldb.Batch, ref *chunkRef) (*chunkRef, error) {
+	c := q.newChunkRef()
+	c.count, c.size = ref.count, ref.size
+	batch.Put(chunkSeqKey, appendUint64(nil, c.stream))
+
+	for n := uint32(0); n < ref.count; n++ {
+		b, err := ref.chunk(n)
+		if err != nil {
+			return nil, err
+		}
+		if b, err = q.format.sealChunk(b); err != nil {
+			return nil, err
+		}
+		batch.Put(chunkKey(c.stream, n), b)
+	}
+
+	return c, nil
+}
+
+// dropChunks adds the removal of the chunks of the given streamed value,
+// if any, to the batch.
+func dropChunks(batch *leveldb.Batch, ref *chunkRef) {
+	if ref == nil {
+		return
+	}
+
+	for n := uint32(0); n < ref.count; n++ {
+		batch.Delete(chunkKey(ref.stream, n))
+	}
+}
+
+// dropAllChunks adds the removal of every chunk stored by the queue to
+// the batch, except those of values still being read by EnqueueReader.
+// The queue must be locked by the caller.
+func (q *Queue) dropAllChunks(batch *leveldb.Batch) error {
+	if err := deleteRange(q.db, batch, detachedRange); err != nil {
+		return err
+	}
+
+	iter := q.db.NewIterator(chunkRange, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) >= len(chunkPrefix)+8 && q.streaming[binary.BigEndian.Uint64(key[len(chunkPrefix):])] {
+			continue
+		}
+		batch.Delete(key)
+	}
+
+	return iter.Error()
+}
+
+// detachChunks adds the marker of the streamed values of the given
+// items, which are about to be removed from the queue, to the batch
+// instead of removing their chunks, so they can still be read using
+// Item.ValueReader until the reader is closed. Items in flight keep
+// their chunks with their record. The queue must be locked by the
+// caller.
+func (q *Queue) detachChunks(batch *leveldb.Batch, items ...*Item) {
+	for _, item := range items {
+		if item.chunks == nil || item.inFlight {
+			continue
+		}
+		batch.Put(detachedKey(item.chunks.stream), appendUint32(nil, item.chunks.count))
+
+		ref := *item.chunks
+		db, wo := q.db, q.writeOpts
+		ref.release = func() error {
+			batch := new(leveldb.Batch)
+			dropChunks(batch, &ref)
+			batch.Delete(detachedKey(ref.stream))
+			err := db.Write(batch, wo)
+			if err == leveldb.ErrClosed {
+				// The queue removes the chunks when it opens.
+				err = nil
+			}
+			return err
+		}
+		item.chunks = &ref
+	}
+}
+
+// detachedKey returns the key marking the detached chunks of the
+// streamed value with the given stream ID.
+func detachedKey(stream uint64) []byte {
+	return appendUint64(append([]byte(nil), detachedPrefix...), stream)
+}
+
+// dropDetached removes the chunks of every detached streamed value,
+// along with their markers. The queue must be locked by the caller.
+func (q *Queue) dropDetached() error {
+	iter := q.db.NewIterator(detachedRange, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+
+	for iter.Next() {
+		key, value := iter.Key(), iter.Value()
+		if len(key) == len(detachedPrefix)+8 && len(value) == 4 {
+			dropChunks(batch, &chunkRef{
+				stream: binary.BigEndian.Uint64(key[len(detachedPrefix):]),
+				count:  binary.BigEndian.Uint32(value),
+			})
+		}
+		batch.Delete(key)
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+	return q.db.Write(batch, q.writeOpts)
+}
+
+// ValueReader returns a reader of the value of the item. For an item
+// added using Queue.EnqueueReader, the value is read from its chunks as
+// needed, and reading fails with ErrValueUnavailable if they are no
+// longer stored. Items removed from the queue, such as by Dequeue, keep
+// their chunks stored until the reader is closed, so ValueReader can
+// only be used once for such an item, and the reader should be closed
+// even if the value is not read. Otherwise the chunks are removed once
+// the queue is closed or opened again. For any other item, the reader
+// reads the Value field.
+func (i *Item) ValueReader() io.ReadCloser {
+	if i.chunks == nil {
+		return io.NopCloser(bytes.NewReader(i.Value))
+	}
+	return &chunkReader{ref: i.chunks}
+}
+
+// chunkReader reads a streamed value from its chunks.
+type chunkReader struct {
+	ref *chunkRef
+	n   uint32
+	buf []byte
+	err error
+}
+
+// Read reads the next bytes of the streamed value into p.
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.n >= r.ref.count {
+			r.err = io.EOF
+			continue
+		}
+
+		r.buf, r.err = r.ref.chunk(r.n)
+		r.n++
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Close closes the reader, removing the chunks it reads from if the
+// item was removed from the queue.
+func (r *chunkReader) Close() error {
+	r.buf, r.err = nil, ErrValueUnavailable
+	if r.ref.release == nil {
+		return nil
+	}
+
+	release := r.ref.release
+	r.ref.src, r.ref.release = nil, nil
+	return release()
+}
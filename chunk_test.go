@@ -0,0 +1,293 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// countChunks returns the number of chunks stored by the queue.
+func countChunks(t *testing.T, q *Queue) int {
+	iter := q.db.NewIterator(chunkRange, nil)
+	defer iter.Release()
+
+	n := 0
+	for iter.Next() {
+		n++
+	}
+	if err := iter.Error(); err != nil {
+		t.Error(err)
+	}
+	return n
+}
+
+func TestQueueEnqueueReader(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// A value spanning several chunks, with a shorter last one.
+	value := make([]byte, 3*chunkSize+100)
+	rand.New(rand.NewSource(1)).Read(value)
+
+	item, err := q.EnqueueReader(bytes.NewReader(value), int64(len(value)))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(item.Value) != 0 {
+		t.Errorf("Expected an empty value, got %d bytes", len(item.Value))
+	}
+	if n := countChunks(t, q); n != 4 {
+		t.Errorf("Expected 4 chunks, got %d", n)
+	}
+
+	if _, err = q.EnqueueString("plain"); err != nil {
+		t.Error(err)
+	}
+
+	// Peeked items read the chunks of the queue.
+	peeked, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := io.ReadAll(peeked.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, value) {
+		t.Errorf("Expected peeked value of %d bytes, got %d", len(value), len(b))
+	}
+
+	// Dequeued items still read their chunks once they are removed.
+	dequeued, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if n := countChunks(t, q); n != 4 {
+		t.Errorf("Expected 4 chunks until the reader is closed, got %d", n)
+	}
+
+	r := dequeued.ValueReader()
+	b, err = io.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, value) {
+		t.Errorf("Expected dequeued value of %d bytes, got %d", len(value), len(b))
+	}
+	if err = r.Close(); err != nil {
+		t.Error(err)
+	}
+	if n := countChunks(t, q); n != 0 {
+		t.Errorf("Expected no chunks left, got %d", n)
+	}
+
+	if _, err = io.ReadAll(dequeued.ValueReader()); err != ErrValueUnavailable {
+		t.Errorf("Expected to get value unavailable error, got %v", err)
+	}
+
+	// Items which were not streamed read their value.
+	plain, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	b, err = io.ReadAll(plain.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if string(b) != "plain" {
+		t.Errorf("Expected value of plain, got %q", b)
+	}
+}
+
+func TestQueueEnqueueReaderShort(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	value := bytes.Repeat([]byte("x"), chunkSize+10)
+	if _, err = q.EnqueueReader(bytes.NewReader(value), int64(len(value))+1); err != io.ErrUnexpectedEOF {
+		t.Errorf("Expected to get unexpected EOF error, got %v", err)
+	}
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+	if n := countChunks(t, q); n != 0 {
+		t.Errorf("Expected no chunks left, got %d", n)
+	}
+
+	if _, err = q.EnqueueReader(bytes.NewReader(value), -1); err != ErrInvalidSize {
+		t.Errorf("Expected to get invalid size error, got %v", err)
+	}
+
+	// An empty value has no chunks.
+	item, err := q.EnqueueReader(bytes.NewReader(nil), 0)
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := io.ReadAll(item.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if len(b) != 0 {
+		t.Errorf("Expected an empty value, got %d bytes", len(b))
+	}
+}
+
+func TestQueueEnqueueReaderReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Cipher: newTestCipher(t, 1)})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	value := bytes.Repeat([]byte("streamed value "), chunkSize/10)
+	if _, err = q.EnqueueReader(bytes.NewReader(value), int64(len(value))); err != nil {
+		t.Error(err)
+	}
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	q, err = OpenQueueWithOptions(file, &Options{Cipher: newTestCipher(t, 1)})
+	if err != nil {
+		t.Error(err)
+	}
+
+	// A second value gets a stream of its own after reopening.
+	if _, err = q.EnqueueReader(bytes.NewReader(value[:10]), 10); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := io.ReadAll(item.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, value) {
+		t.Errorf("Expected value of %d bytes, got %d", len(value), len(b))
+	}
+
+	item, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	b, err = io.ReadAll(item.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, value[:10]) {
+		t.Errorf("Expected value of %q, got %q", value[:10], b)
+	}
+}
+
+func TestQueueMoveStreamed(t *testing.T) {
+	file1 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(file1)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	file2 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file2)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	value := bytes.Repeat([]byte("y"), 2*chunkSize)
+	if _, err = src.EnqueueReader(bytes.NewReader(value), int64(len(value))); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Move(src, dst); err != nil {
+		t.Error(err)
+	}
+	if n := countChunks(t, src); n != 0 {
+		t.Errorf("Expected no chunks left in src, got %d", n)
+	}
+	if n := countChunks(t, dst); n != 2 {
+		t.Errorf("Expected 2 chunks in dst, got %d", n)
+	}
+
+	item, err := dst.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := io.ReadAll(item.ValueReader())
+	if err != nil {
+		t.Error(err)
+	}
+	if !bytes.Equal(b, value) {
+		t.Errorf("Expected value of %d bytes, got %d", len(value), len(b))
+	}
+}
+
+func TestQueueEnqueueReaderDetached(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	value := bytes.Repeat([]byte("z"), 2*chunkSize)
+	for i := 0; i < 2; i++ {
+		if _, err = q.EnqueueReader(bytes.NewReader(value), int64(len(value))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Closing the reader of a dequeued item removes its chunks, even if
+	// the value was not read.
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if err = item.ValueReader().Close(); err != nil {
+		t.Error(err)
+	}
+	if n := countChunks(t, q); n != 2 {
+		t.Errorf("Expected 2 chunks left, got %d", n)
+	}
+
+	// The chunks of items whose reader is never closed are removed when
+	// the queue is closed.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if n := countChunks(t, q); n != 2 {
+		t.Errorf("Expected 2 chunks left, got %d", n)
+	}
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if n := countChunks(t, q); n != 0 {
+		t.Errorf("Expected no chunks left, got %d", n)
+	}
+
+	iter := q.db.NewIterator(detachedRange, nil)
+	if iter.Next() {
+		t.Error("Expected no detached values left")
+	}
+	iter.Release()
+}
@@ -0,0 +1,101 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+)
+
+// Encoder encodes values into byte slices.
+type Encoder interface {
+	Encode(value interface{}) ([]byte, error)
+}
+
+// Decoder decodes byte slices into values.
+type Decoder interface {
+	Decode(data []byte, value interface{}) error
+}
+
+// Codec is an Encoder and Decoder pair used to store object values,
+// such as those given to EnqueueObject and read by Item.ToObject.
+//
+// The ID of the codec is stored within the data directory, so a
+// structure can not be reopened using a different codec. IDs 0 through
+// 127 are reserved for the codecs provided by this package, so custom
+// codecs should use an ID between 128 and 255.
+type Codec interface {
+	Encoder
+	Decoder
+	ID() uint8
+}
+
+// The codecs provided by this package.
+var (
+	// GobCodec encodes values using encoding/gob. This is the default
+	// codec.
+	//
+	// Objects containing pointers with zero values will decode to nil
+	// when using this codec. This is due to how the encoding/gob
+	// package works. Because of this, you should only use this codec
+	// to encode simple types.
+	GobCodec Codec = gobCodec{}
+
+	// JSONCodec encodes values using encoding/json.
+	JSONCodec Codec = jsonCodec{}
+)
+
+// RegisterType registers the concrete types of the given values with
+// encoding/gob using gob.Register, so objects holding them in interface
+// fields can be encoded by EnqueueObject and decoded by Item.ToObject.
+// It must be called for each such type before any object holding it
+// is encoded or decoded, such as from an init function, or by opening
+// the structure with the GobTypes option. Like gob.Register, it panics
+// if two types are registered under the same name.
+func RegisterType(values ...interface{}) {
+	for _, v := range values {
+		gob.Register(v)
+	}
+}
+
+// gobCodec is a Codec using encoding/gob.
+type gobCodec struct{}
+
+// Encode encodes the given value using encoding/gob.
+func (gobCodec) Encode(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// Decode decodes the given data into value using encoding/gob.
+func (gobCodec) Decode(data []byte, value interface{}) error {
+	buffer := bytes.NewBuffer(data)
+	dec := gob.NewDecoder(buffer)
+	return dec.Decode(value)
+}
+
+// ID returns the ID of the gob codec.
+func (gobCodec) ID() uint8 {
+	return 0
+}
+
+// jsonCodec is a Codec using encoding/json.
+type jsonCodec struct{}
+
+// Encode encodes the given value using encoding/json.
+func (jsonCodec) Encode(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+// Decode decodes the given data into value using encoding/json.
+func (jsonCodec) Decode(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// ID returns the ID of the JSON codec.
+func (jsonCodec) ID() uint8 {
+	return 1
+}
@@ -0,0 +1,146 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCodecJSON(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Codec: JSONCodec})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	type object struct {
+		Value int
+	}
+
+	if _, err = q.EnqueueObject(object{Value: 1}); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := `{"Value":1}`
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	var obj object
+	if err := item.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Value != 1 {
+		t.Errorf("Expected object value to be 1, got %d", obj.Value)
+	}
+}
+
+func TestCodecIncompatible(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Codec: JSONCodec})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+	q.Close()
+
+	if _, err = OpenQueue(file); err != ErrIncompatibleCodec {
+		t.Errorf("Expected to get incompatible codec error, got %v", err)
+	}
+}
+
+func TestCodecLegacyTypeFile(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+	q.Close()
+
+	// Rewrite the type file as written before codecs were stored.
+	if err := os.WriteFile(filepath.Join(file, "GOQUE"), []byte{byte(TypeQueue)}, 0644); err != nil {
+		t.Error(err)
+	}
+
+	if q, err = OpenQueue(file); err != nil {
+		t.Error(err)
+	}
+	q.Close()
+
+	if _, err = OpenQueueWithOptions(file, &Options{Codec: JSONCodec}); err != ErrIncompatibleCodec {
+		t.Errorf("Expected to get incompatible codec error, got %v", err)
+	}
+}
+
+type gobTypesShape interface {
+	Area() int
+}
+
+type gobTypesSquare struct {
+	Side int
+}
+
+func (s gobTypesSquare) Area() int { return s.Side * s.Side }
+
+type gobTypesRect struct {
+	W, H int
+}
+
+func (r gobTypesRect) Area() int { return r.W * r.H }
+
+type gobTypesJob struct {
+	Shape gobTypesShape
+}
+
+func TestQueueGobTypes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{GobTypes: []interface{}{gobTypesSquare{}}})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueObject(gobTypesJob{Shape: gobTypesSquare{Side: 3}}); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	var job gobTypesJob
+	if err = item.ToObject(&job); err != nil {
+		t.Error(err)
+	}
+	if job.Shape == nil || job.Shape.Area() != 9 {
+		t.Errorf("Expected shape with area of 9, got %v", job.Shape)
+	}
+}
+
+func TestRegisterType(t *testing.T) {
+	RegisterType(gobTypesRect{})
+
+	b, err := GobCodec.Encode(gobTypesJob{Shape: gobTypesRect{W: 2, H: 5}})
+	if err != nil {
+		t.Error(err)
+	}
+
+	var job gobTypesJob
+	if err = GobCodec.Decode(b, &job); err != nil {
+		t.Error(err)
+	}
+	if job.Shape == nil || job.Shape.Area() != 10 {
+		t.Errorf("Expected shape with area of 10, got %v", job.Shape)
+	}
+}
@@ -0,0 +1,179 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// CompactRange compacts the whole LevelDB database of the queue,
+// reclaiming the space held by removed items right away rather than
+// waiting for background compaction. This is useful after removing a
+// large number of items, such as using Purge or DequeueBatch.
+//
+// Compacting can take a while for a large database. The queue can be
+// used by other goroutines in the meantime.
+func (q *Queue) CompactRange() error {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	return compactDB(q.db)
+}
+
+// CompactRange compacts the whole LevelDB database of the stack. See
+// Queue.CompactRange for details.
+func (s *Stack) CompactRange() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	return compactDB(s.db)
+}
+
+// CompactRange compacts the whole LevelDB database of the priority
+// queue. See Queue.CompactRange for details.
+func (pq *PriorityQueue) CompactRange() error {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return compactDB(pq.db)
+}
+
+// CompactRange compacts the whole LevelDB database of the prefix
+// queue. See Queue.CompactRange for details.
+func (pq *PrefixQueue) CompactRange() error {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return compactDB(pq.db)
+}
+
+// compactDB compacts the full key space of the given database.
+func compactDB(db database) error {
+	return db.CompactRange(util.Range{})
+}
+
+// CompactIDs gives the items in the queue new IDs, starting again from
+// 1 at the head of the queue and leaving no holes, using a single
+// LevelDB write. This keeps IDs small in a long-lived queue and removes
+// the holes left by items deleted from its middle.
+//
+// Any ID kept from before compacting, such as one returned by Enqueue,
+// no longer refers to the same item afterwards. As every item is read
+// and rewritten within one write, compacting a large queue needs
+// memory for all of its items.
+func (q *Queue) CompactIDs() error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	iter := q.db.NewIterator(itemRange, nil)
+	defer iter.Release()
+
+	// Remove every item, then add them back under their new IDs. Later
+	// changes in a batch win, so new keys may reuse old ones.
+	var keys, values [][]byte
+	for iter.Next() {
+		keys = append(keys, append([]byte(nil), iter.Key()...))
+		values = append(values, append([]byte(nil), iter.Value()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete(key)
+	}
+
+	for i, value := range values {
+		id := uint64(i) + 1
+		batch.Put(idToKey(id), value)
+
+		// Point the deduplication key of the item at its new ID.
+		rec, err := q.format.decode(value)
+		if err != nil {
+			return err
+		}
+		q.reindexRecord(batch, rec, keyToID(keys[i]), id)
+		if rec.uniqueKey != nil {
+			current, err := q.db.Get(uniqueIndexKey(rec.uniqueKey), nil)
+			if err != nil && err != leveldb.ErrNotFound {
+				return err
+			}
+			if err == nil && keyToID(current) == keyToID(keys[i]) {
+				batch.Put(uniqueIndexKey(rec.uniqueKey), appendUint64(nil, id))
+			}
+		}
+	}
+
+	return q.writeState(batch, 0, uint64(len(keys)), 0)
+}
+
+// CompactIDs gives the items in the stack new IDs, starting again from
+// 1 at the bottom of the stack and leaving no holes, using a single
+// LevelDB write. See Queue.CompactIDs for details.
+func (s *Stack) CompactIDs() error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	iter := s.db.NewIterator(itemRange, nil)
+	defer iter.Release()
+
+	// Remove every item, then add them back under their new IDs.
+	var keys, values [][]byte
+	for iter.Next() {
+		keys = append(keys, append([]byte(nil), iter.Key()...))
+		values = append(values, append([]byte(nil), iter.Value()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	for _, key := range keys {
+		batch.Delete(key)
+	}
+	for i, value := range values {
+		batch.Put(idToKey(uint64(i)+1), value)
+	}
+
+	return s.writeState(batch, uint64(len(keys)), 0, 0)
+}
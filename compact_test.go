@@ -0,0 +1,191 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueCompactRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{NoSync: true})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	value := make([]byte, 1024)
+	for i := 0; i < 5000; i++ {
+		if _, err = q.Enqueue(value); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.DequeueBatch(4990); err != nil {
+		t.Error(err)
+	}
+
+	before, err := q.DiskSize()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = q.CompactRange(); err != nil {
+		t.Error(err)
+	}
+
+	after, err := q.DiskSize()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if after >= before {
+		t.Errorf("Expected disk size to shrink from %d, got %d", before, after)
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	q.Close()
+	if err = q.CompactRange(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestPriorityQueueCompactRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString(uint8(i%3), fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = pq.Purge(); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.CompactRange(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
+func TestQueueCompactIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, _, err = q.EnqueueUnique([]byte("key"), []byte("value for item 11")); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.DequeueBatch(4); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.DeleteByID(7); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.CompactIDs(); err != nil {
+		t.Error(err)
+	}
+
+	if head, tail := q.IDRange(); head != 1 || tail != 6 {
+		t.Errorf("Expected ID range of 1 to 6, got %d to %d", head, tail)
+	}
+
+	if q.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", q.Length())
+	}
+
+	// The deduplication key should follow the item to its new ID.
+	item, ok, err := q.EnqueueUnique([]byte("key"), []byte("other value"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ok || item.ID != 6 {
+		t.Errorf("Expected pending item 6, got %d", item.ID)
+	}
+
+	for i, comp := range []int{5, 6, 8, 9, 10, 11} {
+		item, err := q.PeekByID(uint64(i) + 1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", comp)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestStackCompactIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.DeleteByID(1); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.DeleteByID(3); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.CompactIDs(); err != nil {
+		t.Error(err)
+	}
+
+	if tail, head := s.IDRange(); tail != 1 || head != 3 {
+		t.Errorf("Expected ID range of 1 to 3, got %d to %d", tail, head)
+	}
+
+	for i, comp := range []int{2, 4, 5} {
+		item, err := s.PeekByID(uint64(i) + 1)
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", comp)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
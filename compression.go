@@ -0,0 +1,63 @@
+package goque
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+)
+
+// Compression defines how item values are compressed when stored.
+type Compression uint8
+
+// The supported compression algorithms.
+const (
+	CompressNone   Compression = iota // Store values uncompressed.
+	CompressSnappy                    // Compress values using Snappy.
+	CompressGzip                      // Compress values using gzip.
+)
+
+// compress returns the given value compressed using the compression
+// algorithm.
+func (c Compression) compress(value []byte) ([]byte, error) {
+	switch c {
+	case CompressNone:
+		return value, nil
+	case CompressSnappy:
+		return snappy.Encode(nil, value), nil
+	case CompressGzip:
+		var buffer bytes.Buffer
+		w := gzip.NewWriter(&buffer)
+		if _, err := w.Write(value); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("goque: Unknown compression %d", c)
+}
+
+// decompress returns the given value decompressed using the compression
+// algorithm.
+func (c Compression) decompress(value []byte) ([]byte, error) {
+	switch c {
+	case CompressNone:
+		return value, nil
+	case CompressSnappy:
+		return snappy.Decode(nil, value)
+	case CompressGzip:
+		r, err := gzip.NewReader(bytes.NewReader(value))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return io.ReadAll(r)
+	}
+
+	return nil, fmt.Errorf("goque: Unknown compression %d", c)
+}
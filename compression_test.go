@@ -0,0 +1,170 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestQueueCompression(t *testing.T) {
+	for _, compression := range []Compression{CompressSnappy, CompressGzip} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		q, err := OpenQueueWithOptions(file, &Options{Compression: compression})
+		if err != nil {
+			t.Error(err)
+		}
+		defer q.Drop()
+
+		value := bytes.Repeat([]byte("value for item "), 100)
+
+		item, err := q.Enqueue(value)
+		if err != nil {
+			t.Error(err)
+		}
+
+		stored, err := q.db.Get(item.Key, nil)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if len(stored) >= len(value) {
+			t.Errorf("Expected stored value to be compressed, got %d bytes for %d", len(stored), len(value))
+		}
+
+		if _, err = q.Update(item.ID, value[:1000]); err != nil {
+			t.Error(err)
+		}
+
+		peekItem, err := q.Peek()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !bytes.Equal(peekItem.Value, value[:1000]) {
+			t.Errorf("Expected updated value of %d bytes, got %d bytes", 1000, len(peekItem.Value))
+		}
+
+		if q.Length() != 1 {
+			t.Errorf("Expected queue length of 1, got %d", q.Length())
+		}
+
+		// Reopening without compression should still read the item.
+		q.Close()
+		q, err = OpenQueue(file)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if _, err = q.EnqueueString("uncompressed value"); err != nil {
+			t.Error(err)
+		}
+
+		deqItem, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !bytes.Equal(deqItem.Value, value[:1000]) {
+			t.Errorf("Expected dequeued value of %d bytes, got %d bytes", 1000, len(deqItem.Value))
+		}
+
+		deqItem, err = q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := "uncompressed value"
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+}
+
+func TestPriorityQueueCompression(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, &Options{Compression: CompressSnappy})
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	value := bytes.Repeat([]byte("value for item "), 100)
+
+	if _, err = pq.Enqueue(3, value); err != nil {
+		t.Error(err)
+	}
+
+	it := pq.NewIterator()
+	defer it.Release()
+
+	if !it.Next() || !bytes.Equal(it.Item().Value, value) {
+		t.Error("Expected iterator to return the decompressed value")
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(deqItem.Value, value) {
+		t.Errorf("Expected dequeued value of %d bytes, got %d bytes", len(value), len(deqItem.Value))
+	}
+}
+
+func TestQueueMaxItemBytes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{MaxItemBytes: 100, Compression: CompressSnappy})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	random := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	// A value which compresses well fits within the limit.
+	if _, err = q.Enqueue(bytes.Repeat([]byte("a"), 1000)); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Enqueue(random); err != ErrItemTooLarge {
+		t.Errorf("Expected to get item too large error, got %v", err)
+	}
+
+	if _, err = q.Update(1, random); err != ErrItemTooLarge {
+		t.Errorf("Expected to get item too large error, got %v", err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
+
+func TestStackMaxItemBytes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStackWithOptions(file, &Options{MaxItemBytes: 10})
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	if _, err = s.PushString("0123456789"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = s.PushString("value that is too large"); err != ErrItemTooLarge {
+		t.Errorf("Expected to get item too large error, got %v", err)
+	}
+
+	// The limit applies to the value as encoded by the codec.
+	if _, err = s.PushObject("0123456789"); err != ErrItemTooLarge {
+		t.Errorf("Expected to get item too large error, got %v", err)
+	}
+
+	if s.Length() != 1 {
+		t.Errorf("Expected stack length of 1, got %d", s.Length())
+	}
+}
@@ -0,0 +1,87 @@
+package goque
+
+// Contains returns whether the queue holds an item with the given ID,
+// without reading its value. Items which have expired count until they
+// are removed, as for Length.
+func (q *Queue) Contains(id uint64) (bool, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return false, ErrDBClosed
+	}
+
+	// Check if the ID is within the queue.
+	if id <= q.head || id > q.tail {
+		return false, nil
+	}
+
+	return q.db.Has(idToKey(id), nil)
+}
+
+// Contains returns whether the stack holds an item with the given ID,
+// without reading its value.
+func (s *Stack) Contains(id uint64) (bool, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return false, ErrDBClosed
+	}
+
+	// Check if the ID is within the stack.
+	if id <= s.tail || id > s.head {
+		return false, nil
+	}
+
+	return s.db.Has(idToKey(id), nil)
+}
+
+// Contains returns whether the given priority level of the priority
+// queue holds an item with the given ID, without reading its value.
+func (pq *PriorityQueue) Contains(priority uint8, id uint64) (bool, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return false, ErrDBClosed
+	}
+
+	// Check if the ID is within the priority level.
+	level := pq.levels[priority]
+	if id <= level.head || id > level.tail {
+		return false, nil
+	}
+
+	return pq.db.Has(pq.generateKey(priority, id), nil)
+}
+
+// Contains returns whether the queue with the given prefix holds an
+// item with the given ID, without reading its value.
+func (pq *PrefixQueue) Contains(prefix []byte, id uint64) (bool, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return false, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err == ErrEmpty {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// Check if the ID is within the queue.
+	if id <= q.Head || id > q.Tail {
+		return false, nil
+	}
+
+	return pq.db.Has(generateKeyPrefixID(prefix, id), nil)
+}
@@ -0,0 +1,115 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueContains(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.DeleteByID(3); err != nil {
+		t.Error(err)
+	}
+
+	for id, comp := range map[uint64]bool{0: false, 1: false, 2: true, 3: false, 5: true, 6: false} {
+		ok, err := q.Contains(id)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if ok != comp {
+			t.Errorf("Expected Contains(%d) to be %t, got %t", id, comp, ok)
+		}
+	}
+}
+
+func TestStackContains(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	for id, comp := range map[uint64]bool{0: false, 1: true, 4: true, 5: false} {
+		ok, err := s.Contains(id)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if ok != comp {
+			t.Errorf("Expected Contains(%d) to be %t, got %t", id, comp, ok)
+		}
+	}
+}
+
+func TestPriorityQueueContains(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(2, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if ok, err := pq.Contains(2, 3); err != nil || !ok {
+		t.Errorf("Expected item 3 to be found, got %v", err)
+	}
+
+	if ok, err := pq.Contains(1, 3); err != nil || ok {
+		t.Errorf("Expected item 3 not to be found at priority 1, got %v", err)
+	}
+}
+
+func TestPrefixQueueContains(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString("prefix", "value"); err != nil {
+		t.Error(err)
+	}
+
+	if ok, err := pq.Contains([]byte("prefix"), 1); err != nil || !ok {
+		t.Errorf("Expected item 1 to be found, got %v", err)
+	}
+
+	if ok, err := pq.Contains([]byte("other"), 1); err != nil || ok {
+		t.Errorf("Expected item 1 not to be found for another prefix, got %v", err)
+	}
+}
@@ -0,0 +1,56 @@
+package goque
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// ConvertType changes the type stored for the data structure in the
+// given data directory to the given type, so it is opened as that type
+// from then on, without touching its items. Only stacks and queues,
+// which share the same format, can be converted to each other, and any
+// other conversion returns ErrUnsupportedConversion. A queue converted
+// to a stack pops the items it would have dequeued last first.
+//
+// The data directory must not be open. Its LevelDB database is locked
+// while the type is rewritten, so converting a data directory which is
+// open returns the error opening the database.
+func ConvertType(dataDir string, to Type) error {
+	if to != TypeStack && to != TypeQueue {
+		return ErrUnsupportedConversion
+	}
+
+	// Hold the lock of the database while converting.
+	db, err := leveldb.OpenFile(dataDir, &opt.Options{ErrorIfMissing: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	// Check the type currently stored.
+	b, err := os.ReadFile(filepath.Join(dataDir, "GOQUE"))
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return ErrIncompatibleType
+	}
+	from := Type(b[0])
+	if from != TypeStack && from != TypeQueue {
+		return ErrUnsupportedConversion
+	}
+	if from == to {
+		return nil
+	}
+
+	// Rewrite the type, keeping the codec ID following it, which
+	// defaults to gob for older files.
+	codecID := GobCodec.ID()
+	if len(b) > 1 {
+		codecID = b[1]
+	}
+	return writeGoqueFile(dataDir, to, codecID, true)
+}
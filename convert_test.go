@@ -0,0 +1,83 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConvertType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// An open data directory can not be converted.
+	if err = ConvertType(file, TypeQueue); err == nil {
+		t.Error("Expected converting an open stack to fail")
+	}
+
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = ConvertType(file, TypePriorityQueue); err != ErrUnsupportedConversion {
+		t.Errorf("Expected to get unsupported conversion error, got %v", err)
+	}
+
+	if err = ConvertType(file, TypeQueue); err != nil {
+		t.Error(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(file, "GOQUE"))
+	if err != nil {
+		t.Error(err)
+	}
+	if len(b) != 2 || Type(b[0]) != TypeQueue || b[1] != GobCodec.ID() {
+		t.Errorf("Expected the queue type and gob codec to be stored, got %v", b)
+	}
+
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Close()
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestConvertTypePriorityQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if err = pq.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = ConvertType(file, TypeQueue); err != ErrUnsupportedConversion {
+		t.Errorf("Expected to get unsupported conversion error, got %v", err)
+	}
+}
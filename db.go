@@ -0,0 +1,529 @@
+package goque
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// database is the part of a LevelDB database used by the data
+// structures. It is implemented by levelDB, which uses a whole
+// database, and by namespace, which keeps its keys apart from those of
+// every other namespace within a shared database.
+type database interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Has(key []byte, ro *opt.ReadOptions) (bool, error)
+	Put(key, value []byte, wo *opt.WriteOptions) error
+	Delete(key []byte, wo *opt.WriteOptions) error
+	Write(batch *leveldb.Batch, wo *opt.WriteOptions) error
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	GetSnapshot() (snapshot, error)
+	CompactRange(r util.Range) error
+	Close() error
+}
+
+// snapshot is the part of a LevelDB snapshot used by the data
+// structures.
+type snapshot interface {
+	Get(key []byte, ro *opt.ReadOptions) ([]byte, error)
+	Has(key []byte, ro *opt.ReadOptions) (bool, error)
+	NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	Release()
+}
+
+// levelDB is a database using the whole of a LevelDB database.
+type levelDB struct {
+	*leveldb.DB
+}
+
+// GetSnapshot returns a snapshot of the database.
+func (db levelDB) GetSnapshot() (snapshot, error) {
+	snap, err := db.DB.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// DB is a single LevelDB database holding any number of queues and
+// stacks, each within its own namespace, so they share one set of
+// files, caches and file handles rather than needing a directory each.
+//
+// Each namespace holds one queue or stack, whose keys are prefixed with
+// a byte reserved for the type of the structure it was created as and
+// the name of the namespace, so its items, positions and counters are
+// kept apart from those of every other namespace. As for separate
+// directories, a namespace can be opened as either a queue or a stack.
+// The DataDir of each structure is that of the DB, so its DiskSize is
+// the size of the whole database.
+type DB struct {
+	sync.Mutex
+	DataDir string
+	db      *leveldb.DB
+	open    map[string]func() error
+	isOpen  bool
+
+	// types holds the types of the structures held by the namespaces,
+	// as recorded in the 'GOQUE' file.
+	types []Type
+}
+
+// OpenDB opens the shared database at the given directory, creating it
+// if it does not already exist.
+func OpenDB(dataDir string) (*DB, error) {
+	ldb, err := openDB(context.Background(), dataDir, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if this Goque type can open the requested data directory.
+	if err := checkGoqueType(dataDir, TypeDB, GobCodec, false, true); err != nil {
+		ldb.Close()
+		return nil, err
+	}
+
+	// Get the types of the structures held by the namespaces.
+	types, err := readGoqueTypes(dataDir)
+	if err != nil {
+		ldb.Close()
+		return nil, err
+	}
+
+	return &DB{
+		DataDir: dataDir,
+		db:      ldb,
+		open:    make(map[string]func() error),
+		isOpen:  true,
+		types:   types,
+	}, nil
+}
+
+// Queue opens the queue in the namespace with the given name, creating
+// it if the namespace does not exist yet. A namespace can only be open
+// once at a time, and opening it again before it is closed returns
+// ErrNamespaceOpen.
+//
+// Closing the queue leaves the database open. Dropping the queue
+// removes every key of its namespace, leaving the other namespaces
+// untouched.
+func (db *DB) Queue(name string) (*Queue, error) {
+	ns, err := db.namespace(name, TypeQueue)
+	if err != nil {
+		return nil, err
+	}
+
+	q := newQueue(db.DataDir, nil, false)
+	q.db = ns
+	if err := ns.register(q.Close); err != nil {
+		return nil, err
+	}
+
+	q.isOpen = true
+	if err := q.init(); err != nil {
+		ns.unregister()
+		return nil, err
+	}
+	return q, nil
+}
+
+// Stack opens the stack in the namespace with the given name, creating
+// it if the namespace does not exist yet. See Queue for how namespaces
+// are opened, closed and dropped.
+func (db *DB) Stack(name string) (*Stack, error) {
+	ns, err := db.namespace(name, TypeStack)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newStack(db.DataDir, nil)
+	s.db = ns
+	if err := ns.register(s.Close); err != nil {
+		return nil, err
+	}
+
+	s.isOpen = true
+	if err := s.init(); err != nil {
+		ns.unregister()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes every queue and stack opened from the database, and then
+// the LevelDB database itself.
+func (db *DB) Close() error {
+	db.Lock()
+	if !db.isOpen {
+		db.Unlock()
+		return nil
+	}
+	db.isOpen = false
+
+	closers := make([]func() error, 0, len(db.open))
+	for _, c := range db.open {
+		closers = append(closers, c)
+	}
+	db.Unlock()
+
+	// Closing each structure removes it from the open namespaces, so
+	// the database must be unlocked. Every structure is closed, along
+	// with the LevelDB database, even if one fails, returning the first
+	// error.
+	var firstErr error
+	for _, c := range closers {
+		if err := c(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if err := db.db.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// DropNamespace removes every key of the namespace with the given name,
+// along with the type stored for it, leaving every other namespace
+// untouched. Dropping a namespace which does not exist does nothing. The
+// namespace must not be open, otherwise ErrNamespaceOpen is returned,
+// so a structure can be torn down without opening it first.
+func (db *DB) DropNamespace(name string) error {
+	db.Lock()
+	defer db.Unlock()
+
+	// Check if database is closed.
+	if !db.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if namespace is in use.
+	if _, ok := db.open[name]; ok {
+		return ErrNamespaceOpen
+	}
+
+	ns, err := db.findNamespace(name)
+	if err != nil || ns == nil {
+		return err
+	}
+	return ns.drop(&opt.WriteOptions{Sync: true})
+}
+
+// namespace returns the namespace with the given name, after checking
+// that it can be opened as the given type.
+func (db *DB) namespace(name string, gt Type) (*namespace, error) {
+	db.Lock()
+	defer db.Unlock()
+
+	// Check if database is closed.
+	if !db.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Use the prefix of the type the namespace was created as, which
+	// is that of the given type for a new namespace.
+	ns, err := db.findNamespace(name)
+	if err != nil {
+		return nil, err
+	}
+	if ns == nil {
+		ns = &namespace{parent: db, name: name, prefix: namespacePrefix(gt, name)}
+	}
+
+	if err := checkNamespaceType(ns, gt, GobCodec, true); err != nil {
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+// findNamespace returns the namespace with the given name, looking for
+// it under the prefix of each type recorded for the database, or nil if
+// there is no such namespace. The database must be locked by the
+// caller.
+func (db *DB) findNamespace(name string) (*namespace, error) {
+	for _, t := range db.types {
+		ns := &namespace{parent: db, name: name, prefix: namespacePrefix(t, name)}
+		ok, err := ns.Has(namespaceTypeKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return ns, nil
+		}
+	}
+	return nil, nil
+}
+
+// recordType adds the given type to the types recorded in the 'GOQUE'
+// file of the database, unless it is already recorded. Types are kept
+// once recorded, even when every namespace of that type is dropped. The
+// database must be locked by the caller.
+func (db *DB) recordType(gt Type) error {
+	for _, t := range db.types {
+		if t == gt {
+			return nil
+		}
+	}
+
+	types := append(append([]Type(nil), db.types...), gt)
+	if err := writeGoqueFile(db.DataDir, TypeDB, GobCodec.ID(), true, types...); err != nil {
+		return err
+	}
+	db.types = types
+	return nil
+}
+
+// namespacePrefix returns the prefix of every key within the namespace
+// with the given name, created as the given type. Each type reserves the
+// first byte of the prefix, so the keys of structures of different
+// types never collide, and the name is length-prefixed, so no namespace
+// prefix is the start of another.
+func namespacePrefix(gt Type, name string) []byte {
+	prefix := append([]byte{namespaceTypeByte + byte(gt)}, appendUint32(nil, uint32(len(name)))...)
+	return append(prefix, name...)
+}
+
+// namespaceTypeByte is the first byte of the keys of namespaces holding
+// a stack, followed by the bytes reserved for the other types in the
+// order of their constants.
+const namespaceTypeByte = 0x80
+
+// namespace is a database holding the keys of a single namespace of a
+// shared DB, stored with the prefix of the namespace. Closing it leaves
+// the shared database open.
+type namespace struct {
+	parent *DB
+	name   string
+	prefix []byte
+}
+
+// register records the namespace as open, using the given function to
+// close the structure using it when the shared database is closed.
+func (ns *namespace) register(close func() error) error {
+	ns.parent.Lock()
+	defer ns.parent.Unlock()
+
+	// Check if database is closed.
+	if !ns.parent.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if namespace is in use.
+	if _, ok := ns.parent.open[ns.name]; ok {
+		return ErrNamespaceOpen
+	}
+
+	ns.parent.open[ns.name] = close
+	return nil
+}
+
+// unregister records the namespace as closed.
+func (ns *namespace) unregister() {
+	ns.parent.Lock()
+	defer ns.parent.Unlock()
+
+	delete(ns.parent.open, ns.name)
+}
+
+// key returns the given key within the namespace.
+func (ns *namespace) key(key []byte) []byte {
+	return append(append(make([]byte, 0, len(ns.prefix)+len(key)), ns.prefix...), key...)
+}
+
+// keyRange returns the given key range within the namespace. A nil
+// range covers the whole namespace.
+func (ns *namespace) keyRange(r *util.Range) *util.Range {
+	all := util.BytesPrefix(ns.prefix)
+	if r == nil {
+		return all
+	}
+
+	nr := &util.Range{Start: ns.key(r.Start), Limit: all.Limit}
+	if r.Limit != nil {
+		nr.Limit = ns.key(r.Limit)
+	}
+	return nr
+}
+
+// Get returns the value of the given key.
+func (ns *namespace) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	return ns.parent.db.Get(ns.key(key), ro)
+}
+
+// Has returns whether the given key is stored.
+func (ns *namespace) Has(key []byte, ro *opt.ReadOptions) (bool, error) {
+	return ns.parent.db.Has(ns.key(key), ro)
+}
+
+// Put stores the value of the given key.
+func (ns *namespace) Put(key, value []byte, wo *opt.WriteOptions) error {
+	return ns.parent.db.Put(ns.key(key), value, wo)
+}
+
+// Delete removes the given key.
+func (ns *namespace) Delete(key []byte, wo *opt.WriteOptions) error {
+	return ns.parent.db.Delete(ns.key(key), wo)
+}
+
+// Write applies the batch to the namespace.
+func (ns *namespace) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	nb := &namespaceBatch{ns: ns, batch: new(leveldb.Batch)}
+	if err := batch.Replay(nb); err != nil {
+		return err
+	}
+	return ns.parent.db.Write(nb.batch, wo)
+}
+
+// NewIterator returns an iterator over the given key range of the
+// namespace, whose keys do not include the namespace prefix.
+func (ns *namespace) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &namespaceIterator{Iterator: ns.parent.db.NewIterator(ns.keyRange(slice), ro), ns: ns}
+}
+
+// GetSnapshot returns a snapshot of the namespace.
+func (ns *namespace) GetSnapshot() (snapshot, error) {
+	snap, err := ns.parent.db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &namespaceSnapshot{snap: snap, ns: ns}, nil
+}
+
+// CompactRange compacts the given key range of the namespace.
+func (ns *namespace) CompactRange(r util.Range) error {
+	return ns.parent.db.CompactRange(*ns.keyRange(&r))
+}
+
+// Close records the namespace as closed, leaving the shared database
+// open.
+func (ns *namespace) Close() error {
+	ns.unregister()
+	return nil
+}
+
+// drop removes every key of the namespace, including its type, using
+// the given write options.
+func (ns *namespace) drop(wo *opt.WriteOptions) error {
+	batch := new(leveldb.Batch)
+	iter := ns.parent.db.NewIterator(util.BytesPrefix(ns.prefix), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte(nil), iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	return ns.parent.db.Write(batch, wo)
+}
+
+// namespaceBatch copies the operations of a batch into a new batch,
+// adding the namespace prefix to each key.
+type namespaceBatch struct {
+	ns    *namespace
+	batch *leveldb.Batch
+}
+
+// Put adds a prefixed put to the batch.
+func (nb *namespaceBatch) Put(key, value []byte) {
+	nb.batch.Put(nb.ns.key(key), value)
+}
+
+// Delete adds a prefixed delete to the batch.
+func (nb *namespaceBatch) Delete(key []byte) {
+	nb.batch.Delete(nb.ns.key(key))
+}
+
+// sharedDatabase returns whether the given databases are kept in the
+// same LevelDB database, either being the same database or namespaces
+// of the same DB, so they can be written to using a single write.
+func sharedDatabase(a, b database) bool {
+	if a == b {
+		return true
+	}
+
+	na, ok := a.(*namespace)
+	if !ok {
+		return false
+	}
+	nb, ok := b.(*namespace)
+	return ok && na.parent == nb.parent
+}
+
+// writeShared writes batch a to database a and batch b to database b,
+// which must be shared as reported by sharedDatabase, using a single
+// write.
+func writeShared(a database, ba *leveldb.Batch, b database, bb *leveldb.Batch, wo *opt.WriteOptions) error {
+	na, ok := a.(*namespace)
+	if !ok {
+		batch := new(leveldb.Batch)
+		if err := ba.Replay(batch); err != nil {
+			return err
+		}
+		if err := bb.Replay(batch); err != nil {
+			return err
+		}
+		return a.Write(batch, wo)
+	}
+
+	// Add the prefix of its namespace to each key of either batch.
+	batch := new(leveldb.Batch)
+	if err := ba.Replay(&namespaceBatch{ns: na, batch: batch}); err != nil {
+		return err
+	}
+	if err := bb.Replay(&namespaceBatch{ns: b.(*namespace), batch: batch}); err != nil {
+		return err
+	}
+	return na.parent.db.Write(batch, wo)
+}
+
+// namespaceIterator is an iterator over the keys of a namespace, which
+// removes the namespace prefix from each key.
+type namespaceIterator struct {
+	iterator.Iterator
+	ns *namespace
+}
+
+// Key returns the key of the current entry, without the namespace
+// prefix.
+func (it *namespaceIterator) Key() []byte {
+	return bytes.TrimPrefix(it.Iterator.Key(), it.ns.prefix)
+}
+
+// Seek moves to the first key at or after the given key within the
+// namespace.
+func (it *namespaceIterator) Seek(key []byte) bool {
+	return it.Iterator.Seek(it.ns.key(key))
+}
+
+// namespaceSnapshot is a snapshot of the keys of a namespace.
+type namespaceSnapshot struct {
+	snap *leveldb.Snapshot
+	ns   *namespace
+}
+
+// Get returns the value of the given key.
+func (s *namespaceSnapshot) Get(key []byte, ro *opt.ReadOptions) ([]byte, error) {
+	return s.snap.Get(s.ns.key(key), ro)
+}
+
+// Has returns whether the given key is stored.
+func (s *namespaceSnapshot) Has(key []byte, ro *opt.ReadOptions) (bool, error) {
+	return s.snap.Has(s.ns.key(key), ro)
+}
+
+// NewIterator returns an iterator over the given key range of the
+// namespace, whose keys do not include the namespace prefix.
+func (s *namespaceSnapshot) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &namespaceIterator{Iterator: s.snap.NewIterator(s.ns.keyRange(slice), ro), ns: s.ns}
+}
+
+// Release releases the snapshot.
+func (s *namespaceSnapshot) Release() {
+	s.snap.Release()
+}
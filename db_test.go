@@ -0,0 +1,370 @@
+package goque
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+func TestDBNamespaces(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+
+	q, err := db.Queue("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+
+	s, err := db.Stack("jobs2")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("queue item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = s.PushString("stack item 1"); err != nil {
+		t.Error(err)
+	}
+
+	// Each namespace keeps its own items and positions.
+	if q.Length() != 3 || s.Length() != 1 {
+		t.Errorf("Expected lengths of 3 and 1, got %d and %d", q.Length(), s.Length())
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 1 || item.ToString() != "stack item 1" {
+		t.Errorf("Expected stack item 1, got %d '%s'", item.ID, item.ToString())
+	}
+
+	// A namespace can only be open once.
+	if _, err = db.Queue("jobs"); err != ErrNamespaceOpen {
+		t.Errorf("Expected to get namespace open error, got %v", err)
+	}
+
+	// Closing the DB closes every structure opened from it.
+	if err = db.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+
+	// The items are kept when the DB is reopened.
+	db, err = OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+
+	q, err = db.Queue("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", q.Length())
+	}
+
+	item, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "queue item 1" {
+		t.Errorf("Expected string to be 'queue item 1', got '%s'", item.ToString())
+	}
+}
+
+func TestDBDropNamespace(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+	defer db.Close()
+
+	a, err := db.Queue("a")
+	if err != nil {
+		t.Error(err)
+	}
+	b, err := db.Queue("b")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = a.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+	if _, err = b.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	// Dropping a queue leaves the database and other namespaces alone.
+	if err = a.Drop(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = os.Stat(file); err != nil {
+		t.Error(err)
+	}
+
+	if b.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", b.Length())
+	}
+
+	a, err = db.Queue("a")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if a.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", a.Length())
+	}
+}
+
+func TestDBIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+
+	if err = db.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = OpenQueue(file); !errors.Is(err, ErrIncompatibleType) {
+		t.Errorf("Expected to get incompatible type error, got %v", err)
+	}
+}
+
+func TestDBIsolation(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+	defer db.Close()
+
+	// The name of one namespace is the start of the other.
+	q, err := db.Queue("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+	s, err := db.Stack("jobs2")
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("queue item %d", i)); err != nil {
+			t.Error(err)
+		}
+		if _, err = s.PushString(fmt.Sprintf("stack item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Every key of the database should belong to exactly one namespace,
+	// starting with the byte reserved for its type.
+	prefixes := [][]byte{namespacePrefix(TypeQueue, "jobs"), namespacePrefix(TypeStack, "jobs2")}
+	counts := make([]int, len(prefixes))
+	iter := db.db.NewIterator(nil, nil)
+	for iter.Next() {
+		matched := 0
+		for i, prefix := range prefixes {
+			if bytes.HasPrefix(iter.Key(), prefix) {
+				counts[i]++
+				matched++
+			}
+		}
+		if matched != 1 {
+			t.Errorf("Expected key %q to belong to one namespace, got %d", iter.Key(), matched)
+		}
+	}
+	iter.Release()
+
+	if counts[0] == 0 || counts[1] == 0 {
+		t.Errorf("Expected keys in both namespaces, got %v", counts)
+	}
+
+	if prefixes[0][0] == prefixes[1][0] {
+		t.Errorf("Expected queue and stack prefixes to start with different bytes")
+	}
+
+	// An open namespace can not be dropped.
+	if err = db.DropNamespace("jobs"); err != ErrNamespaceOpen {
+		t.Errorf("Expected to get namespace open error, got %v", err)
+	}
+
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if err = db.DropNamespace("jobs"); err != nil {
+		t.Error(err)
+	}
+
+	// Dropping a namespace which does not exist does nothing.
+	if err = db.DropNamespace("missing"); err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 5 {
+		t.Errorf("Expected stack length of 5, got %d", s.Length())
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "stack item 5" {
+		t.Errorf("Expected string to be 'stack item 5', got '%s'", item.ToString())
+	}
+
+	// The dropped namespace can be opened again as any type.
+	s2, err := db.Stack("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if s2.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s2.Length())
+	}
+}
+
+func TestDBTypes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+
+	q, err := db.Queue("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+	if _, err = db.Stack("undo"); err != nil {
+		t.Error(err)
+	}
+	if _, err = db.Queue("mail"); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = db.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// The GOQUE file records each type present once.
+	types, err := readGoqueTypes(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(types) != 2 || types[0] != TypeQueue || types[1] != TypeStack {
+		t.Errorf("Expected types [queue stack], got %v", types)
+	}
+
+	db, err = OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer db.Close()
+
+	// A queue namespace opened as a stack keeps the prefix of the queue.
+	s, err := db.Stack("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected stack length of 3, got %d", s.Length())
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value for item 3" {
+		t.Errorf("Expected string to be 'value for item 3', got '%s'", item.ToString())
+	}
+
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+
+	// The namespace is dropped using the prefix of its type.
+	if err = db.DropNamespace("jobs"); err != nil {
+		t.Error(err)
+	}
+
+	iter := db.db.NewIterator(util.BytesPrefix(namespacePrefix(TypeQueue, "jobs")), nil)
+	if iter.Next() {
+		t.Errorf("Expected no keys left in the dropped namespace, got %q", iter.Key())
+	}
+	iter.Release()
+}
+
+func TestDBCloseError(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+
+	q, err := db.Queue("jobs")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// A structure which fails to close, alongside one which closes.
+	closeErr := errors.New("close failed")
+	db.Lock()
+	db.open["broken"] = func() error { return closeErr }
+	db.Unlock()
+
+	if err = db.Close(); err != closeErr {
+		t.Errorf("Expected to get close error, got %v", err)
+	}
+
+	if _, err = q.EnqueueString("value"); err != ErrDBClosed {
+		t.Errorf("Expected to get closed error, got %v", err)
+	}
+
+	// The LevelDB database is closed, releasing its lock.
+	db, err = OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	} else {
+		db.Close()
+	}
+}
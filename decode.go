@@ -0,0 +1,95 @@
+package goque
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecodeError is returned by Item.ToObjectStrict when the value of an
+// item can not be decoded into the given type, such as when it was
+// encoded from a different type or is corrupt.
+type DecodeError struct {
+	// ID is the ID of the item which could not be decoded.
+	ID uint64
+
+	// Type is the type the value was decoded into.
+	Type string
+
+	// Hint suggests what may have gone wrong.
+	Hint string
+
+	// Err is the error returned by the codec, or describes the panic
+	// it recovered from.
+	Err error
+}
+
+// Error returns the description of the decode error.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("goque: Item %d could not be decoded into %s: %v (%s)", e.ID, e.Type, e.Err, e.Hint)
+}
+
+// Unwrap returns the error returned by the codec.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// ToObjectStrict decodes the item value into the given value type like
+// ToObject, but returns any failure as a *DecodeError carrying the ID
+// of the item and a hint at the cause. A panic raised by the codec on
+// malformed data is recovered and returned as a *DecodeError as well,
+// so a single corrupt item can not crash a consumer.
+func (i *Item) ToObjectStrict(value interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = i.decodeError(value, fmt.Errorf("panic: %v", r), "the value is malformed")
+		}
+	}()
+
+	if err := i.ToObject(value); err != nil {
+		return i.decodeError(value, err, decodeHint(err))
+	}
+	return nil
+}
+
+// decodeError returns the *DecodeError for decoding the item into the
+// given value.
+func (i *Item) decodeError(value interface{}, err error, hint string) *DecodeError {
+	return &DecodeError{ID: i.ID, Type: fmt.Sprintf("%T", value), Hint: hint, Err: err}
+}
+
+// decodeHint returns a hint at the cause of the given decode error.
+func decodeHint(err error) string {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not registered"):
+		return "register the concrete type using RegisterType"
+	case strings.Contains(msg, "type mismatch"), strings.Contains(msg, "cannot unmarshal"):
+		return "the item was encoded from a different type"
+	case strings.Contains(msg, "EOF"), strings.Contains(msg, "extra data"):
+		return "the value is truncated or malformed"
+	default:
+		return "the value may not have been encoded by this codec"
+	}
+}
+
+// SkipUndecodable decodes the next item in the queue into the given
+// value using Item.ToObjectStrict, leaving the item in the queue if it
+// can be decoded, in which case nil is returned for both the item and
+// the error. Otherwise the undecodable item is removed from the queue
+// and returned along with its *DecodeError, so a consumer can log it
+// and carry on instead of being stuck on it for good. The value is
+// decoded while the queue is locked.
+func (q *Queue) SkipUndecodable(value interface{}) (*Item, error) {
+	var decodeErr error
+	item, err := q.DequeueIf(func(item *Item) bool {
+		decodeErr = item.ToObjectStrict(value)
+		return decodeErr != nil
+	})
+	if err == ErrNotMatched {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return item, decodeErr
+}
@@ -0,0 +1,117 @@
+package goque
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type decodeTestJob struct {
+	Name string
+	Size int
+}
+
+// panicCodec is a codec whose decoder panics, as a decoder may on
+// malformed data.
+type panicCodec struct{}
+
+func (panicCodec) Encode(value interface{}) ([]byte, error)    { return GobCodec.Encode(value) }
+func (panicCodec) Decode(data []byte, value interface{}) error { panic("malformed data") }
+func (panicCodec) ID() uint8                                   { return 200 }
+
+func TestItemToObjectStrict(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueObject(decodeTestJob{Name: "job", Size: 3}); err != nil {
+		t.Error(err)
+	}
+	if _, err = q.EnqueueString("not gob"); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.PeekByID(1)
+	if err != nil {
+		t.Error(err)
+	}
+	var job decodeTestJob
+	if err = item.ToObjectStrict(&job); err != nil {
+		t.Error(err)
+	}
+	if job.Name != "job" || job.Size != 3 {
+		t.Errorf("Expected job of size 3, got %+v", job)
+	}
+
+	item, err = q.PeekByID(2)
+	if err != nil {
+		t.Error(err)
+	}
+	err = item.ToObjectStrict(&job)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Expected to get a decode error, got %v", err)
+	} else {
+		if decodeErr.ID != 2 {
+			t.Errorf("Expected ID of 2, got %d", decodeErr.ID)
+		}
+		if decodeErr.Type != "*goque.decodeTestJob" {
+			t.Errorf("Expected type of *goque.decodeTestJob, got %s", decodeErr.Type)
+		}
+	}
+
+	// A panic of the codec is returned as a decode error.
+	item.codec = panicCodec{}
+	if err = item.ToObjectStrict(&job); !errors.As(err, &decodeErr) {
+		t.Errorf("Expected to get a decode error, got %v", err)
+	}
+}
+
+func TestQueueSkipUndecodable(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("not gob"); err != nil {
+		t.Error(err)
+	}
+	if _, err = q.EnqueueObject(decodeTestJob{Name: "job", Size: 3}); err != nil {
+		t.Error(err)
+	}
+
+	var job decodeTestJob
+	item, err := q.SkipUndecodable(&job)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("Expected to get a decode error, got %v", err)
+	}
+	if item == nil || item.ID != 1 {
+		t.Errorf("Expected the undecodable item to be returned, got %v", item)
+	}
+
+	// The next item can be decoded, so it stays in the queue.
+	item, err = q.SkipUndecodable(&job)
+	if item != nil || err != nil {
+		t.Errorf("Expected nothing to be skipped, got %v, %v", item, err)
+	}
+	if job.Name != "job" {
+		t.Errorf("Expected job to be decoded, got %+v", job)
+	}
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if _, err = q.SkipUndecodable(&job); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
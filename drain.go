@@ -0,0 +1,128 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Drain removes every item from the queue using a single LevelDB write
+// and returns them in dequeue order, such as to hand the remaining work
+// elsewhere during a graceful shutdown. Items which are not visible yet
+// are returned as well, while expired items are removed without being
+// returned, and items in flight are left to be acknowledged. If an error
+// occurs nothing is removed. Items added afterwards start again from an
+// ID of 1.
+//
+// Every item is held in memory at once, so for very large queues
+// calling DequeueBatch until ErrEmpty is returned is the streaming
+// alternative.
+func (q *Queue) Drain() ([]*Item, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Return items whose visibility timeout passed to the queue first.
+	now := time.Now()
+	if err := q.reclaimDue(now); err != nil {
+		return nil, err
+	}
+
+	// Check if queue is empty.
+	if q.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	batch := new(leveldb.Batch)
+	items := make([]*Item, 0, q.Length())
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		rec, err := q.format.decode(append([]byte(nil), iter.Value()...))
+		if err != nil {
+			return nil, err
+		}
+		item := newItem(keyToID(iter.Key()), rec, q.codec)
+
+		// Removed items no longer hold their deduplication key.
+		if err := q.dropUniqueKey(batch, item.ID, item.uniqueKey); err != nil {
+			return nil, err
+		}
+		item.uniqueKey = nil
+
+		batch.Delete(item.Key)
+		q.unindexItem(batch, item)
+		if item.expired(now) {
+			dropChunks(batch, item.chunks)
+		} else {
+			items = append(items, item)
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	q.detachChunks(batch, items...)
+
+	// Remove the items and reset the head and tail positions.
+	if err := q.writeState(batch, 0, 0, 0); err != nil {
+		return nil, err
+	}
+	q.dequeued += uint64(len(items))
+	q.hooks.dequeued(items...)
+
+	return items, nil
+}
+
+// Drain removes every item from the stack using a single LevelDB write
+// and returns them in pop order. If an error occurs nothing is removed.
+// Items added afterwards start again from an ID of 1.
+//
+// Every item is held in memory at once, so for very large stacks
+// calling PopBatch until ErrEmpty is returned is the streaming
+// alternative.
+func (s *Stack) Drain() ([]*Item, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if stack is empty.
+	if s.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	batch := new(leveldb.Batch)
+	items := make([]*Item, 0, s.Length())
+	err := s.forEach(func(item *Item) bool {
+		items = append(items, item)
+		batch.Delete(item.Key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the items and reset the head and tail positions.
+	if err := s.writeState(batch, 0, 0, 0); err != nil {
+		return nil, err
+	}
+
+	// Increment popped count.
+	s.popped += uint64(len(items))
+
+	return items, nil
+}
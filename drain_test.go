@@ -0,0 +1,100 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueDrain(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.Drain(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	items, err := q.Drain()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 4 {
+		t.Errorf("Expected 4 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", i+2)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+
+	// Items added afterwards start again from an ID of 1.
+	item, err := q.EnqueueString("value for item 6")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 1 {
+		t.Errorf("Expected ID to be 1, got %d", item.ID)
+	}
+}
+
+func TestStackDrain(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := s.Drain()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 5 {
+		t.Errorf("Expected 5 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", 5-i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if s.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s.Length())
+	}
+
+	if _, err = s.Drain(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package goque
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Dump writes a human-readable line to w for every item in the queue,
+// in dequeue order, such as for debugging. Each line holds the ID of
+// the item, the length of its value, and a preview of up to preview
+// bytes of the value, both in hex and as ASCII with unprintable bytes
+// shown as dots. A negative preview shows the whole value. The items
+// are read from a snapshot, as for
+// ExportJSON, so Dump holds the queue as it was when it was called.
+func (q *Queue) Dump(w io.Writer, preview int) error {
+	it := q.NewIterator()
+	defer it.Release()
+
+	return dump(w, preview, it.Err, func() (string, []byte, bool) {
+		if !it.Next() {
+			return "", nil, false
+		}
+		item := it.Item()
+		return fmt.Sprintf("id=%d", item.ID), item.Value, true
+	})
+}
+
+// Dump writes a human-readable line to w for every item in the stack,
+// in pop order. See Queue.Dump for the format of each line.
+func (s *Stack) Dump(w io.Writer, preview int) error {
+	it := s.NewIterator()
+	defer it.Release()
+
+	return dump(w, preview, it.Err, func() (string, []byte, bool) {
+		if !it.Next() {
+			return "", nil, false
+		}
+		item := it.Item()
+		return fmt.Sprintf("id=%d", item.ID), item.Value, true
+	})
+}
+
+// Dump writes a human-readable line to w for every item in the priority
+// queue, in dequeue order. Each line also holds the priority level of
+// the item. See Queue.Dump for the format of each line.
+func (pq *PriorityQueue) Dump(w io.Writer, preview int) error {
+	it := pq.NewIterator()
+	defer it.Release()
+
+	return dump(w, preview, it.Err, func() (string, []byte, bool) {
+		if !it.Next() {
+			return "", nil, false
+		}
+		item := it.Item()
+		return fmt.Sprintf("id=%d priority=%d", item.ID, item.Priority), item.Value, true
+	})
+}
+
+// Dump writes a human-readable line to w for every item in the prefix
+// queue, grouped by prefix as by NewIterator. Each line also holds the
+// quoted prefix of the item. See Queue.Dump for the format of each
+// line.
+func (pq *PrefixQueue) Dump(w io.Writer, preview int) error {
+	it := pq.NewIterator()
+	defer it.Release()
+
+	return dump(w, preview, it.Err, func() (string, []byte, bool) {
+		if !it.Next() {
+			return "", nil, false
+		}
+		item := it.Item()
+		// prefix + prefixDelimiter + ID
+		prefix := item.Key[:len(item.Key)-9]
+		return fmt.Sprintf("id=%d prefix=%q", item.ID, prefix), item.Value, true
+	})
+}
+
+// dump writes a line to w for each item returned by next, until next
+// returns false, starting with the fields returned along with the value
+// of the item. The error returned by iterErr, if any, is returned once
+// next is done.
+func dump(w io.Writer, preview int, iterErr func() error, next func() (string, []byte, bool)) error {
+	bw := bufio.NewWriter(w)
+
+	for {
+		fields, value, ok := next()
+		if !ok {
+			break
+		}
+
+		// Only preview the start of long values.
+		shown, more := value, ""
+		if preview >= 0 && len(shown) > preview {
+			shown, more = shown[:preview], "..."
+		}
+
+		ascii := make([]byte, len(shown))
+		for i, b := range shown {
+			if b < ' ' || b > '~' {
+				b = '.'
+			}
+			ascii[i] = b
+		}
+
+		if _, err := fmt.Fprintf(bw, "%s len=%d hex=%x%s ascii=%s%s\n", fields, len(value), shown, more, ascii, more); err != nil {
+			return err
+		}
+	}
+
+	if err := iterErr(); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,101 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueDump(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+	if _, err = q.Enqueue([]byte{'a', 0, 'b'}); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.Dump(&buf, 5); err != nil {
+		t.Error(err)
+	}
+
+	expected := "id=1 len=16 hex=76616c7565... ascii=value...\n" +
+		"id=2 len=3 hex=610062 ascii=a.b\n"
+
+	if buf.String() != expected {
+		t.Errorf("Expected dump to be %q, got %q", expected, buf.String())
+	}
+
+	// A negative preview should show whole values.
+	buf.Reset()
+	if err = q.Dump(&buf, -1); err != nil {
+		t.Error(err)
+	}
+
+	expected = fmt.Sprintf("id=1 len=16 hex=%x ascii=value for item 1\n", "value for item 1") +
+		"id=2 len=3 hex=610062 ascii=a.b\n"
+
+	if buf.String() != expected {
+		t.Errorf("Expected dump to be %q, got %q", expected, buf.String())
+	}
+}
+
+func TestPriorityQueueDump(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString(3, "low"); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.EnqueueString(1, "high"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Dump(&buf, 8); err != nil {
+		t.Error(err)
+	}
+
+	expected := "id=1 priority=1 len=4 hex=68696768 ascii=high\n" +
+		"id=1 priority=3 len=3 hex=6c6f77 ascii=low\n"
+
+	if buf.String() != expected {
+		t.Errorf("Expected dump to be %q, got %q", expected, buf.String())
+	}
+}
+
+func TestPrefixQueueDump(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString("jobs", "value"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = pq.Dump(&buf, 0); err != nil {
+		t.Error(err)
+	}
+
+	expected := "id=1 prefix=\"jobs\" len=5 hex=... ascii=...\n"
+
+	if buf.String() != expected {
+		t.Errorf("Expected dump to be %q, got %q", expected, buf.String())
+	}
+}
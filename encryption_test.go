@@ -0,0 +1,198 @@
+package goque
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestCipher(t *testing.T, key byte) cipher.AEAD {
+	block, err := aes.NewCipher(bytes.Repeat([]byte{key}, 32))
+	if err != nil {
+		t.Error(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Error(err)
+	}
+	return aead
+}
+
+func TestQueueCipher(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Cipher: newTestCipher(t, 1)})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	value := []byte("secret item value")
+
+	item, err := q.Enqueue(value)
+	if err != nil {
+		t.Error(err)
+	}
+
+	stored, err := q.db.Get(item.Key, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if bytes.Contains(stored, value) {
+		t.Errorf("Expected stored value to be encrypted, got %q", stored)
+	}
+
+	if _, err = q.EnqueueString("second value"); err != nil {
+		t.Error(err)
+	}
+
+	peekItem, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(peekItem.Value, value) {
+		t.Errorf("Expected peeked value to be '%s', got '%s'", value, peekItem.Value)
+	}
+
+	// Reopening with a different key should fail to read the items.
+	q.Close()
+	q, err = OpenQueueWithOptions(file, &Options{Cipher: newTestCipher(t, 2)})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Peek(); err != ErrDecryption {
+		t.Errorf("Expected to get decryption error, got %v", err)
+	}
+
+	if _, err = q.Dequeue(); err != ErrDecryption {
+		t.Errorf("Expected to get decryption error, got %v", err)
+	}
+
+	// Reopening without a cipher should also fail to read the items.
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.PeekByID(item.ID); err != ErrDecryption {
+		t.Errorf("Expected to get decryption error, got %v", err)
+	}
+
+	// Reopening with the original key should read the items.
+	q.Close()
+	q, err = OpenQueueWithOptions(file, &Options{Cipher: newTestCipher(t, 1), Compression: CompressGzip})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(deqItem.Value, value) {
+		t.Errorf("Expected dequeued value to be '%s', got '%s'", value, deqItem.Value)
+	}
+
+	deqItem, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "second value" {
+		t.Errorf("Expected string to be '%s', got '%s'", "second value", deqItem.ToString())
+	}
+
+	// Values should be compressed before being encrypted.
+	value = bytes.Repeat([]byte("compressed secret value "), 100)
+	if _, err = q.Enqueue(value); err != nil {
+		t.Error(err)
+	}
+
+	deqItem, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !bytes.Equal(deqItem.Value, value) {
+		t.Errorf("Expected dequeued value of %d bytes, got %d bytes", len(value), len(deqItem.Value))
+	}
+}
+
+func TestQueueMoveCipher(t *testing.T) {
+	file1 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueueWithOptions(file1, &Options{Cipher: newTestCipher(t, 1)})
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	file2 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file2)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	if _, err = src.EnqueueString("moved value"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Move(src, dst); err != nil {
+		t.Error(err)
+	}
+
+	stored, err := dst.db.Get(idToKey(1), nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The stored record should not be flagged as encrypted, and should
+	// decode to the value without a cipher.
+	if len(stored) < 4 || !bytes.Equal(stored[:3], recordMagic) || uint16(stored[3])&recordEncrypted != 0 {
+		t.Errorf("Expected an unencrypted record to be stored in dst, got %q", stored)
+	}
+	rec, err := dst.format.decode(stored)
+	if err != nil {
+		t.Error(err)
+	} else if string(rec.value) != "moved value" {
+		t.Errorf("Expected value to be stored unencrypted in dst, got %q", rec.value)
+	}
+}
+
+func TestPriorityQueueCipher(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, &Options{Cipher: newTestCipher(t, 1)})
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString(5, "secret value"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = pq.UpdatePriority(5, 1, 2); err != nil {
+		t.Error(err)
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != "secret value" {
+		t.Errorf("Expected string to be '%s', got '%s'", "secret value", deqItem.ToString())
+	}
+}
@@ -6,12 +6,22 @@ import (
 
 var (
 	// ErrIncompatibleType is returned when the opener type is
-	// incompatible with the stored Goque type.
+	// incompatible with the stored Goque type. Opening a data structure
+	// returns an *IncompatibleTypeError naming both types, which
+	// matches ErrIncompatibleType using errors.Is.
 	ErrIncompatibleType = errors.New("goque: Opener type is incompatible with stored Goque type")
 
+	// ErrIncompatibleCodec is returned when the codec given when
+	// opening is different from the codec stored with the data.
+	ErrIncompatibleCodec = errors.New("goque: Opener codec is incompatible with stored codec")
+
 	// ErrEmpty is returned when the stack or queue is empty.
 	ErrEmpty = errors.New("goque: Stack or queue is empty")
 
+	// ErrFull is returned when adding an item to a queue which already
+	// holds its maximum number of items.
+	ErrFull = errors.New("goque: Queue is full")
+
 	// ErrOutOfBounds is returned when the ID used to lookup an item
 	// is outside of the range of the stack or queue.
 	ErrOutOfBounds = errors.New("goque: ID used is outside range of stack or queue")
@@ -20,4 +30,80 @@ var (
 	// been called, causing the stack or queue to close, as well as
 	// its underlying database.
 	ErrDBClosed = errors.New("goque: Database is closed")
+
+	// ErrInvalidBackup is returned when restoring from data which is
+	// not a valid backup archive.
+	ErrInvalidBackup = errors.New("goque: Invalid backup archive")
+
+	// ErrReadOnly is returned when trying to change a stack or queue
+	// which was opened read-only.
+	ErrReadOnly = errors.New("goque: Database is read-only")
+
+	// ErrUnknownReceipt is returned when acknowledging an item using a
+	// receipt which does not match any item in flight.
+	ErrUnknownReceipt = errors.New("goque: Receipt does not match an item in flight")
+
+	// ErrDecryption is returned when a stored item value can not be
+	// decrypted, because it was encrypted using a different cipher or
+	// key, no cipher was given, or the value was tampered with.
+	ErrDecryption = errors.New("goque: Item value could not be decrypted")
+
+	// ErrNotMatched is returned by Queue.DequeueIf when the next item
+	// does not match the given predicate.
+	ErrNotMatched = errors.New("goque: Item does not match")
+
+	// ErrConflict is returned by Queue.UpdateIf and UpdateObjectIf when
+	// the item does not hold the expected value.
+	ErrConflict = errors.New("goque: Item value does not match expected value")
+
+	// ErrNamespaceOpen is returned when opening a namespace of a DB
+	// which is already open.
+	ErrNamespaceOpen = errors.New("goque: Namespace is already open")
+
+	// ErrTxnDone is returned when using a transaction which has already
+	// been committed or rolled back.
+	ErrTxnDone = errors.New("goque: Transaction has already been committed or rolled back")
+
+	// ErrNotFound is returned by Queue.FindByValue when no item holds
+	// the given value.
+	ErrNotFound = errors.New("goque: Item not found")
+
+	// ErrUnsupportedConversion is returned by ConvertType when the data
+	// directory can not be converted to the requested type.
+	ErrUnsupportedConversion = errors.New("goque: Only stacks and queues can be converted to each other")
+
+	// ErrInvalidOrder is returned by PriorityQueue.SetOrder when the
+	// order is neither ASC nor DESC.
+	ErrInvalidOrder = errors.New("goque: Priority order must be ASC or DESC")
+
+	// ErrItemTooLarge is returned when the stored value of an item would
+	// be larger than the MaxItemBytes option allows.
+	ErrItemTooLarge = errors.New("goque: Item value is too large")
+
+	// ErrInvalidSize is returned by Queue.EnqueueReader when the given
+	// size of the value is negative.
+	ErrInvalidSize = errors.New("goque: Value size must not be negative")
+
+	// ErrValueUnavailable is returned when reading a streamed value
+	// whose chunks are no longer stored, such as once the item has been
+	// removed and its reader closed.
+	ErrValueUnavailable = errors.New("goque: Streamed value is no longer available")
+
+	// ErrChecksumMismatch is returned when the stored value of an item
+	// does not match the checksum stored along with it, such as when it
+	// was corrupted on disk.
+	ErrChecksumMismatch = errors.New("goque: Item value does not match its checksum")
+
+	// ErrPartitionMismatch is returned by DB.PartitionedQueue when the
+	// partitioned queue was created with a different number of
+	// partitions.
+	ErrPartitionMismatch = errors.New("goque: Partitioned queue has a different number of partitions")
+
+	// ErrDifferentDatabase is returned by Pipe when the queues do not
+	// share a database.
+	ErrDifferentDatabase = errors.New("goque: Queues do not share a database")
+
+	// ErrNotGoque is returned by Inspect when the directory does not
+	// hold a goque data structure.
+	ErrNotGoque = errors.New("goque: Directory is not a goque database")
 )
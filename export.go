@@ -0,0 +1,139 @@
+package goque
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+)
+
+// exportItem is the JSON form of an exported stack or queue item.
+type exportItem struct {
+	ID    uint64 `json:"id"`
+	Value []byte `json:"value"`
+}
+
+// exportPriorityItem is the JSON form of an exported priority queue
+// item.
+type exportPriorityItem struct {
+	ID       uint64 `json:"id"`
+	Priority uint8  `json:"priority"`
+	Value    []byte `json:"value"`
+}
+
+// exportPrefixItem is the JSON form of an exported prefix queue item.
+type exportPrefixItem struct {
+	ID     uint64 `json:"id"`
+	Prefix []byte `json:"prefix"`
+	Value  []byte `json:"value"`
+}
+
+// ExportJSON writes every item in the queue to w as a JSON array of
+// objects holding the ID and the base64 encoded value of each item, in
+// dequeue order. The items are read from a snapshot, so the export
+// holds the queue as it was when ExportJSON was called.
+func (q *Queue) ExportJSON(w io.Writer) error {
+	it := q.NewIterator()
+	defer it.Release()
+
+	return exportJSON(w, it.Err, func() (interface{}, bool) {
+		if !it.Next() {
+			return nil, false
+		}
+		return &exportItem{ID: it.Item().ID, Value: it.Item().Value}, true
+	})
+}
+
+// ExportJSON writes every item in the stack to w as a JSON array of
+// objects holding the ID and the base64 encoded value of each item, in
+// pop order. The items are read from a snapshot, so the export holds
+// the stack as it was when ExportJSON was called.
+func (s *Stack) ExportJSON(w io.Writer) error {
+	it := s.NewIterator()
+	defer it.Release()
+
+	return exportJSON(w, it.Err, func() (interface{}, bool) {
+		if !it.Next() {
+			return nil, false
+		}
+		return &exportItem{ID: it.Item().ID, Value: it.Item().Value}, true
+	})
+}
+
+// ExportJSON writes every item in the priority queue to w as a JSON
+// array of objects holding the ID, priority level and base64 encoded
+// value of each item, in dequeue order. The items are read from a
+// snapshot, so the export holds the priority queue as it was when
+// ExportJSON was called.
+func (pq *PriorityQueue) ExportJSON(w io.Writer) error {
+	it := pq.NewIterator()
+	defer it.Release()
+
+	return exportJSON(w, it.Err, func() (interface{}, bool) {
+		if !it.Next() {
+			return nil, false
+		}
+		item := it.Item()
+		return &exportPriorityItem{ID: item.ID, Priority: item.Priority, Value: item.Value}, true
+	})
+}
+
+// ExportJSON writes every item in the prefix queue to w as a JSON
+// array of objects holding the ID, base64 encoded prefix and base64
+// encoded value of each item, grouped by prefix as by NewIterator. The
+// items are read from a snapshot, so the export holds the prefix queue
+// as it was when ExportJSON was called.
+func (pq *PrefixQueue) ExportJSON(w io.Writer) error {
+	it := pq.NewIterator()
+	defer it.Release()
+
+	return exportJSON(w, it.Err, func() (interface{}, bool) {
+		if !it.Next() {
+			return nil, false
+		}
+		item := it.Item()
+		// prefix + prefixDelimiter + ID
+		prefix := item.Key[:len(item.Key)-9]
+		return &exportPrefixItem{ID: item.ID, Prefix: prefix, Value: item.Value}, true
+	})
+}
+
+// exportJSON writes a JSON array of the values returned by next to w,
+// until next returns false. The error returned by iterErr, if any, is
+// returned once next is done.
+func exportJSON(w io.Writer, iterErr func() error, next func() (interface{}, bool)) error {
+	bw := bufio.NewWriter(w)
+	if err := bw.WriteByte('['); err != nil {
+		return err
+	}
+
+	for i := 0; ; i++ {
+		v, ok := next()
+		if !ok {
+			break
+		}
+
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			if err := bw.WriteByte(','); err != nil {
+				return err
+			}
+		}
+		if _, err := bw.Write(b); err != nil {
+			return err
+		}
+	}
+
+	if err := iterErr(); err != nil {
+		return err
+	}
+
+	if err := bw.WriteByte(']'); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
@@ -0,0 +1,137 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueExportJSON(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = q.ExportJSON(&buf); err != nil {
+		t.Error(err)
+	}
+
+	var items []struct {
+		ID    uint64
+		Value []byte
+	}
+	if err = json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 9 {
+		t.Errorf("Expected 9 items, got %d", len(items))
+	} else if items[0].ID != 2 || string(items[0].Value) != "value for item 2" {
+		t.Errorf("Expected first item to be 2 'value for item 2', got %d '%s'", items[0].ID, items[0].Value)
+	}
+
+	if q.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", q.Length())
+	}
+}
+
+func TestQueueExportJSONEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	var buf bytes.Buffer
+	if err = q.ExportJSON(&buf); err != nil {
+		t.Error(err)
+	}
+
+	if buf.String() != "[]" {
+		t.Errorf("Expected export to be '[]', got '%s'", buf.String())
+	}
+}
+
+func TestPriorityQueueExportJSON(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for level %d", p)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = pq.ExportJSON(&buf); err != nil {
+		t.Error(err)
+	}
+
+	var items []struct {
+		ID       uint64
+		Priority uint8
+		Value    []byte
+	}
+	if err = json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 5 {
+		t.Errorf("Expected 5 items, got %d", len(items))
+	} else if items[0].Priority != 4 || items[4].Priority != 0 {
+		t.Errorf("Expected priority levels from 4 to 0, got %d to %d", items[0].Priority, items[4].Priority)
+	}
+}
+
+func TestPrefixQueueExportJSON(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString("prefix", "value"); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	if err = pq.ExportJSON(&buf); err != nil {
+		t.Error(err)
+	}
+
+	var items []struct {
+		ID     uint64
+		Prefix []byte
+		Value  []byte
+	}
+	if err = json.Unmarshal(buf.Bytes(), &items); err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 {
+		t.Errorf("Expected 1 item, got %d", len(items))
+	} else if string(items[0].Prefix) != "prefix" || string(items[0].Value) != "value" {
+		t.Errorf("Expected item with prefix 'prefix' and value 'value', got '%s' and '%s'", items[0].Prefix, items[0].Value)
+	}
+}
@@ -1,22 +1,88 @@
 package goque
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
-// goqueType defines the type of Goque data structure used.
-type goqueType uint8
+// Type defines the type of Goque data structure stored in a data
+// directory, as reported by Inspect.
+type Type uint8
 
 // The possible Goque types, used to determine compatibility when
-// one stored type is trying to be opened by a different type.
+// one stored type is trying to be opened by a different type. Each is
+// stored as a single byte, so the values must never change.
 const (
-	goqueStack goqueType = iota
-	goqueQueue
-	goquePriorityQueue
-	goquePrefixQueue
+	TypeStack Type = iota
+	TypeQueue
+	TypePriorityQueue
+	TypePrefixQueue
+	TypeDB
+	TypeKeyedPriorityQueue
 )
 
+// String returns the name of the type, such as "queue".
+func (t Type) String() string {
+	switch t {
+	case TypeStack:
+		return "stack"
+	case TypeQueue:
+		return "queue"
+	case TypePriorityQueue:
+		return "priority"
+	case TypePrefixQueue:
+		return "prefix"
+	case TypeDB:
+		return "db"
+	case TypeKeyedPriorityQueue:
+		return "keyed priority"
+	default:
+		return "Type(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// valid returns whether the type is one of the Goque types.
+func (t Type) valid() bool {
+	return t <= TypeKeyedPriorityQueue
+}
+
+// Type returns the type of the stack, TypeStack.
+func (s *Stack) Type() Type {
+	return TypeStack
+}
+
+// Type returns the type of the queue, TypeQueue.
+func (q *Queue) Type() Type {
+	return TypeQueue
+}
+
+// Type returns the type of the priority queue, TypePriorityQueue.
+func (pq *PriorityQueue) Type() Type {
+	return TypePriorityQueue
+}
+
+// Type returns the type of the prefix queue, TypePrefixQueue.
+func (pq *PrefixQueue) Type() Type {
+	return TypePrefixQueue
+}
+
+// Type returns the type of the keyed priority queue,
+// TypeKeyedPriorityQueue.
+func (kq *KeyedPriorityQueue) Type() Type {
+	return TypeKeyedPriorityQueue
+}
+
+// Type returns the type of the shared database, TypeDB.
+func (db *DB) Type() Type {
+	return TypeDB
+}
+
 // checkGoqueType checks if the type of Goque data structure
 // trying to be opened is compatible with the opener type.
 //
@@ -27,54 +93,204 @@ const (
 // Stacks and Queues are 100% compatible with each other, while
 // a PriorityQueue is incompatible with both.
 //
-// Returns true if types are compatible and false if incompatible.
-func checkGoqueType(dataDir string, gt goqueType) (bool, error) {
+// The file also stores the ID of the codec used to encode object
+// values, following the structure type. Files written before codecs
+// were configurable only hold the structure type and use GobCodec.
+//
+// If readOnly is true, a missing file is not created and the data
+// directory is assumed to be compatible. A missing file is created as
+// described for writeGoqueFile, using the given sync.
+//
+// Returns nil if the types are compatible, and otherwise an
+// *IncompatibleTypeError naming both types. If the types are compatible
+// but the codecs are not, ErrIncompatibleCodec is returned.
+func checkGoqueType(dataDir string, gt Type, codec Codec, readOnly, sync bool) error {
 	// Set the path to 'GOQUE' file.
 	path := filepath.Join(dataDir, "GOQUE")
 
 	// Read 'GOQUE' file for this directory.
 	f, err := os.OpenFile(path, os.O_RDONLY, 0)
+	if os.IsNotExist(err) && readOnly {
+		return nil
+	}
 	if os.IsNotExist(err) {
-		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
-		if err != nil {
-			return false, err
-		}
-		defer f.Close()
+		return writeGoqueFile(dataDir, gt, codec.ID(), sync)
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-		// Create byte slice of goqueType.
-		gtb := make([]byte, 1)
-		gtb[0] = byte(gt)
+	// Get the saved type and codec ID from the file.
+	fb := make([]byte, 2)
+	n, err := f.Read(fb)
+	if err != nil {
+		return err
+	}
 
-		_, err = f.Write(gtb)
-		if err != nil {
-			return false, err
-		}
+	return compatibleType(fb[:n], gt, codec)
+}
 
-		return true, nil
-	}
+// writeGoqueFile writes the 'GOQUE' file of the data directory, holding
+// the given structure type and codec ID, followed for a DB by the given
+// types of the structures held by its namespaces.
+//
+// The file is written to a temporary file first, which is synced and
+// then renamed into place, so the file is never seen partly written,
+// which would keep the data directory from being opened. If sync is
+// false, such as for structures opened with the NoSync option, the data
+// directory itself is not synced, saving an fsync on every new data
+// directory. A crash may then lose the file, which is simply created
+// again when the data directory is next opened.
+func writeGoqueFile(dataDir string, gt Type, codecID byte, sync bool, types ...Type) error {
+	path := filepath.Join(dataDir, "GOQUE")
+	tmp := path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return false, err
+		return err
+	}
+
+	b := []byte{byte(gt), codecID}
+	for _, t := range types {
+		b = append(b, byte(t))
 	}
-	defer f.Close()
 
-	// Get the saved type from the file.
-	fb := make([]byte, 1)
-	_, err = f.Read(fb)
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	// Make sure the rename survives a crash.
+	if sync {
+		return syncDir(dataDir)
+	}
+	return nil
+}
+
+// readGoqueTypes returns the types of the structures held by the
+// namespaces of the DB at the given data directory, which its 'GOQUE'
+// file records following the DB type and codec ID.
+func readGoqueTypes(dataDir string) ([]Type, error) {
+	b, err := os.ReadFile(filepath.Join(dataDir, "GOQUE"))
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	// Convert the file byte to its goqueType.
-	filegt := goqueType(fb[0])
+	var types []Type
+	for i := 2; i < len(b); i++ {
+		types = append(types, Type(b[i]))
+	}
+	return types, nil
+}
+
+// namespaceTypeKey is the key within a namespace of a DB storing the
+// type of the structure held by the namespace.
+var namespaceTypeKey = internalKey("goque")
+
+// checkNamespaceType checks if the type of Goque data structure trying
+// to be opened is compatible with the type stored in the given
+// namespace, like checkGoqueType does for a data directory. The type
+// and codec ID are stored within the namespace rather than in a file,
+// and are written when a new namespace is first opened, syncing the
+// write to disk if sync is true.
+//
+// The type of a new namespace is first added to the set of types
+// recorded in the 'GOQUE' file of the DB, so the namespace can always
+// be found under the prefix of its type once it exists.
+func checkNamespaceType(ns *namespace, gt Type, codec Codec, sync bool) error {
+	b, err := ns.Get(namespaceTypeKey, nil)
+	if err == leveldb.ErrNotFound {
+		if err := ns.parent.recordType(gt); err != nil {
+			return err
+		}
+		return ns.Put(namespaceTypeKey, []byte{byte(gt), codec.ID()}, &opt.WriteOptions{Sync: sync})
+	} else if err != nil {
+		return err
+	}
+
+	return compatibleType(b, gt, codec)
+}
+
+// compatibleType returns nil if the given stored type and codec ID,
+// which may be missing for older data, can be opened as the given type
+// using the given codec. If the types are incompatible, an
+// *IncompatibleTypeError is returned, or ErrIncompatibleType if no type
+// is stored. If the types are compatible but the codecs are not,
+// ErrIncompatibleCodec is returned.
+func compatibleType(stored []byte, gt Type, codec Codec) error {
+	if len(stored) == 0 {
+		return ErrIncompatibleType
+	}
+
+	// Convert the stored byte to its Type.
+	storedgt := Type(stored[0])
 
 	// Compare the types.
-	if filegt == gt {
-		return true, nil
-	} else if filegt == goqueStack && gt == goqueQueue {
-		return true, nil
-	} else if filegt == goqueQueue && gt == goqueStack {
-		return true, nil
+	if storedgt != gt &&
+		!(storedgt == TypeStack && gt == TypeQueue) &&
+		!(storedgt == TypeQueue && gt == TypeStack) {
+		return &IncompatibleTypeError{Stored: storedgt, Requested: gt}
+	}
+
+	// Compare the codecs, defaulting to gob for older files.
+	storedCodec := GobCodec.ID()
+	if len(stored) > 1 {
+		storedCodec = stored[1]
+	}
+	if storedCodec != codec.ID() {
+		return ErrIncompatibleCodec
+	}
+
+	return nil
+}
+
+// IncompatibleTypeError is returned when a data directory, or the
+// namespace of a DB, is opened as a type of data structure which is
+// incompatible with the type stored for it, such as opening a priority
+// queue as a queue. It matches ErrIncompatibleType using errors.Is.
+type IncompatibleTypeError struct {
+	// Stored is the type stored for the data directory or namespace.
+	Stored Type
+
+	// Requested is the type it was opened as.
+	Requested Type
+}
+
+// Error returns the description of the incompatible types.
+func (e *IncompatibleTypeError) Error() string {
+	return fmt.Sprintf("goque: Stored type %s is incompatible with opener type %s", e.Stored, e.Requested)
+}
+
+// Is returns whether target is ErrIncompatibleType.
+func (e *IncompatibleTypeError) Is(target error) bool {
+	return target == ErrIncompatibleType
+}
+
+// syncDir syncs the given directory, so the files created within it
+// survive a crash. Directories can not be synced on Windows, where
+// this does nothing.
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
 	}
+	defer d.Close()
 
-	return false, nil
+	return d.Sync()
 }
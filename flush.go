@@ -0,0 +1,214 @@
+package goque
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// syncKey is deleted using a synced write to force a sync point. The
+// key is never stored, so deleting it leaves no data behind.
+var syncKey = internalKey("sync")
+
+// Flush forces a sync point, returning once every write made to the
+// queue so far is on disk. This is only needed when the queue was
+// opened with the NoSync option, as otherwise every write is synced
+// before it returns.
+//
+// With NoSync, a machine crash or power loss may lose any writes made
+// since the last Flush, but never leaves a partially written batch.
+func (q *Queue) Flush() error {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// A read-only queue has no writes to sync.
+	if q.readOnly {
+		return nil
+	}
+
+	return syncDB(q.db)
+}
+
+// Flush forces a sync point, returning once every write made to the
+// stack so far is on disk. See Queue.Flush for details.
+func (s *Stack) Flush() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	return syncDB(s.db)
+}
+
+// Flush forces a sync point, returning once every write made to the
+// priority queue so far is on disk. See Queue.Flush for details.
+func (pq *PriorityQueue) Flush() error {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return syncDB(pq.db)
+}
+
+// Flush forces a sync point, returning once every write made to the
+// prefix queue so far is on disk. See Queue.Flush for details.
+func (pq *PrefixQueue) Flush() error {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	return syncDB(pq.db)
+}
+
+// flusher flushes a queue opened with the NoSync option in the
+// background, once a number of operations have been made or an
+// interval has passed since the last flush. A nil *flusher never
+// flushes.
+type flusher struct {
+	every    int
+	interval time.Duration
+
+	// ops counts the operations made since the last flush, guarded by
+	// the lock of the queue.
+	ops int
+
+	kick     chan struct{}
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// newFlusher returns the flusher to use for the options, or nil if the
+// options do not ask for background flushing.
+func newFlusher(opts *Options) *flusher {
+	if opts == nil || !opts.NoSync || opts.FlushEvery <= 0 && opts.FlushInterval <= 0 {
+		return nil
+	}
+	return &flusher{
+		every:    opts.FlushEvery,
+		interval: opts.FlushInterval,
+		kick:     make(chan struct{}, 1),
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// start starts the goroutine flushing the given queue.
+func (f *flusher) start(q *Queue) {
+	if f != nil {
+		go f.run(q)
+	}
+}
+
+// run flushes the queue whenever enough operations have been made or
+// the interval has passed, until the flusher is stopped.
+func (f *flusher) run(q *Queue) {
+	var timer *time.Timer
+	var timeout <-chan time.Time
+	if f.interval > 0 {
+		timer = time.NewTimer(f.interval)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		select {
+		case <-f.stopCh:
+			return
+		case <-f.kick:
+		case <-timeout:
+		}
+
+		// The queue may be closed in the meantime, in which case its
+		// writes were flushed by Close.
+		_ = q.Flush()
+
+		// Restart the interval from this flush.
+		if timer != nil {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(f.interval)
+		}
+	}
+}
+
+// count records an operation made on the queue, kicking off a flush
+// once FlushEvery operations have been made. The queue must be locked
+// by the caller.
+func (f *flusher) count() {
+	if f == nil || f.every <= 0 {
+		return
+	}
+
+	f.ops++
+	if f.ops < f.every {
+		return
+	}
+	f.ops = 0
+
+	select {
+	case f.kick <- struct{}{}:
+	default:
+	}
+}
+
+// stop stops the goroutine flushing the queue, without waiting for it
+// to return, as it may be waiting for the lock of the queue.
+func (f *flusher) stop() {
+	if f != nil {
+		f.stopOnce.Do(func() { close(f.stopCh) })
+	}
+}
+
+// flushContext syncs the given database to disk before it is closed,
+// unless synced is true because every write was already synced. If ctx
+// is done first, ctx.Err() is returned while the sync carries on in the
+// background.
+func flushContext(ctx context.Context, db database, synced bool) error {
+	if synced {
+		return nil
+	}
+
+	// Check if context is already done.
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- syncDB(db)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// syncDB syncs the journal of the given database, and so every write
+// made before it, to disk.
+func syncDB(db database) error {
+	return db.Delete(syncKey, &opt.WriteOptions{Sync: true})
+}
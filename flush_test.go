@@ -0,0 +1,223 @@
+package goque
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+func TestQueueNoSync(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{NoSync: true})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if q.writeOpts.Sync {
+		t.Error("Expected writes not to be synced")
+	}
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = q.Flush(); err != nil {
+		t.Error(err)
+	}
+
+	// Flushing should not add an item or change the length.
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	q.Close()
+	if err = q.Flush(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+
+	// Writes are synced by default.
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !q.writeOpts.Sync {
+		t.Error("Expected writes to be synced")
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+}
+
+// syncCountingDB counts the synced writes made to a database.
+type syncCountingDB struct {
+	database
+	syncs int64
+}
+
+func (db *syncCountingDB) Delete(key []byte, wo *opt.WriteOptions) error {
+	if wo.GetSync() {
+		atomic.AddInt64(&db.syncs, 1)
+	}
+	return db.database.Delete(key, wo)
+}
+
+// waitForSyncs waits up to a second for the database to count at least
+// n synced writes, returning the number counted.
+func waitForSyncs(db *syncCountingDB, n int64) int64 {
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt64(&db.syncs) < n && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return atomic.LoadInt64(&db.syncs)
+}
+
+func TestQueueFlushEvery(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{NoSync: true, FlushEvery: 5})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	q.Lock()
+	db := &syncCountingDB{database: q.db}
+	q.db = db
+	q.Unlock()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+		// Let each flush finish before the next can be kicked off.
+		if i%5 == 0 {
+			waitForSyncs(db, int64(i/5))
+		}
+	}
+
+	if syncs := waitForSyncs(db, 2); syncs != 2 {
+		t.Errorf("Expected 2 flushes, got %d", syncs)
+	}
+
+	q.Close()
+	select {
+	case <-q.flusher.stopCh:
+	default:
+		t.Error("Expected flusher to be stopped")
+	}
+}
+
+func TestQueueFlushInterval(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{NoSync: true, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	q.Lock()
+	db := &syncCountingDB{database: q.db}
+	q.db = db
+	q.Unlock()
+
+	if _, err = q.EnqueueString("value"); err != nil {
+		t.Error(err)
+	}
+
+	// The queue is flushed once every interval without any operations.
+	if syncs := waitForSyncs(db, 2); syncs < 2 {
+		t.Errorf("Expected at least 2 flushes, got %d", syncs)
+	}
+
+	// Options are ignored unless writes are not synced.
+	if f := newFlusher(&Options{FlushEvery: 1}); f != nil {
+		t.Error("Expected no flusher without NoSync")
+	}
+}
+
+func TestPrefixQueueFlush(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueueWithOptions(file, &Options{NoSync: true})
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString("prefix", "value"); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Flush(); err != nil {
+		t.Error(err)
+	}
+
+	// Flushing should not be seen as an item or prefix.
+	it := pq.NewIterator()
+	defer it.Release()
+
+	var count int
+	for it.Next() {
+		count++
+	}
+
+	if count != 1 {
+		t.Errorf("Expected to iterate over 1 item, got %d", count)
+	}
+}
+
+func TestQueueCloseContext(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{NoSync: true})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	// The queue stays open if the flush can not complete in time.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err = q.CloseContext(ctx); err != context.Canceled {
+		t.Errorf("Expected to get context canceled error, got %v", err)
+	}
+
+	if _, err = q.Peek(); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.CloseContext(context.Background()); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Peek(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
@@ -0,0 +1,109 @@
+package goque
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Fork copies the queue as it is now into a new queue at the given
+// directory and opens it. The directory must not exist yet or be empty.
+// If copying fails, anything written to the directory is removed.
+//
+// Unlike Backup, which writes an archive, the copy is a database of its
+// own which can be used right away, and which is fully independent of
+// the queue, so changes to either leave the other untouched. The copy
+// holds every item of the queue, including items which are delayed or
+// leased, along with their IDs, and is opened using the codec,
+// compression, encryption, indexer and limits of the queue, but none of
+// its hooks, tracer or dead letter queue.
+func (q *Queue) Fork(destDir string) (*Queue, error) {
+	// Make sure a fresh database is created.
+	existed, err := checkEmptyDir("fork", destDir)
+	if err != nil {
+		return nil, err
+	}
+
+	q.RLock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return nil, ErrDBClosed
+	}
+
+	snap, err := q.db.GetSnapshot()
+	q.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	if err := copySnapshot(destDir, snap, TypeQueue, q.codec); err != nil {
+		removeDir(destDir, existed)
+		return nil, err
+	}
+
+	return openQueue(context.Background(), destDir, &Options{
+		Codec:        q.codec,
+		Compression:  q.format.compression,
+		Cipher:       q.format.cipher,
+		MaxItemBytes: q.format.maxBytes,
+		Checksum:     q.format.checksum,
+		MaxLength:    q.maxLength,
+		Indexer:      q.indexer,
+	}, nil)
+}
+
+// copySnapshot writes every key and value within the given snapshot to a
+// new LevelDB database at the given directory, along with its GOQUE
+// file, leaving out the keys for which copiedKey returns false.
+func copySnapshot(dataDir string, snap snapshot, gt Type, codec Codec) error {
+	db, err := leveldb.OpenFile(dataDir, nil)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	iter := snap.NewIterator(nil, nil)
+	defer iter.Release()
+
+	batch := new(leveldb.Batch)
+	size := 0
+	for iter.Next() {
+		key := iter.Key()
+		if !copiedKey(key) {
+			continue
+		}
+
+		batch.Put(key, iter.Value())
+		if size += len(key) + len(iter.Value()); size >= restoreBatchSize {
+			if err := db.Write(batch, nil); err != nil {
+				return err
+			}
+			batch.Reset()
+			size = 0
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Sync the last write, and so every entry, to disk.
+	if err := db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return err
+	}
+
+	// Write the GOQUE file of the copied structure.
+	return writeGoqueFile(dataDir, gt, codec.ID(), true)
+}
+
+// copiedKey returns whether the given key of a structure is copied
+// along with it by Fork and Backup. Recovery markers of moves into the
+// structure are left out, as the source queue of the move only finishes
+// it with the original, and so is the type key of a namespace.
+func copiedKey(key []byte) bool {
+	return !bytes.HasPrefix(key, internalKey("move:")) && !bytes.Equal(key, namespaceTypeKey)
+}
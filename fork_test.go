@@ -0,0 +1,82 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestQueueFork(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	forkFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	fork, err := q.Fork(forkFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer fork.Drop()
+
+	if fork.Length() != 4 {
+		t.Errorf("Expected fork length of 4, got %d", fork.Length())
+	}
+
+	// Changing the fork should leave the queue untouched.
+	item, err := fork.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if _, err = fork.EnqueueString("value for fork item"); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", q.Length())
+	}
+
+	peekItem, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	// The fork should be a database of its own which can be reopened.
+	fork.Close()
+	fork, err = OpenQueue(forkFile)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if fork.Length() != 4 {
+		t.Errorf("Expected fork length of 4, got %d", fork.Length())
+	}
+
+	// Forking into a directory which is not empty should fail.
+	if _, err = q.Fork(forkFile); !os.IsExist(err) {
+		t.Errorf("Expected to get exist error, got %v", err)
+	}
+}
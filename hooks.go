@@ -0,0 +1,104 @@
+package goque
+
+import "sync"
+
+// hookEvent is a call to an event hook which has not been made yet.
+type hookEvent struct {
+	fn   func(*Item)
+	item *Item
+}
+
+// queueHooks holds the event hooks of a queue, along with the calls
+// waiting to be made once the queue is unlocked. A nil *queueHooks has
+// no hooks.
+type queueHooks struct {
+	onEnqueue func(*Item)
+	onDequeue func(*Item)
+
+	mu      sync.Mutex
+	pending []hookEvent
+	running bool
+}
+
+// newQueueHooks returns the event hooks to use for the options, or nil
+// if none are set.
+func newQueueHooks(opts *Options) *queueHooks {
+	if opts == nil || opts.OnEnqueue == nil && opts.OnDequeue == nil {
+		return nil
+	}
+	return &queueHooks{onEnqueue: opts.OnEnqueue, onDequeue: opts.OnDequeue}
+}
+
+// enqueued records calls to the OnEnqueue hook for the given items,
+// which have been written to the queue. The queue must be locked by
+// the caller.
+func (h *queueHooks) enqueued(items ...*Item) {
+	if h != nil {
+		h.add(h.onEnqueue, items)
+	}
+}
+
+// dequeued records calls to the OnDequeue hook for the given items,
+// which have been removed from the queue. The queue must be locked by
+// the caller.
+func (h *queueHooks) dequeued(items ...*Item) {
+	if h != nil {
+		h.add(h.onDequeue, items)
+	}
+}
+
+// add records calls to fn for the given items, if fn is not nil.
+func (h *queueHooks) add(fn func(*Item), items []*Item) {
+	if fn == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, item := range items {
+		h.pending = append(h.pending, hookEvent{fn: fn, item: item})
+	}
+}
+
+// run makes the recorded hook calls in the order they were recorded.
+// It must be called without holding the lock of the queue, so hooks
+// can use the queue. If another goroutine is already making the calls,
+// including a hook which used the queue, the calls recorded so far are
+// left for it to make, keeping them in order.
+func (h *queueHooks) run() {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	if h.running {
+		h.mu.Unlock()
+		return
+	}
+	h.running = true
+
+	for len(h.pending) > 0 {
+		events := h.pending
+		h.pending = nil
+		h.mu.Unlock()
+
+		for _, e := range events {
+			e.fn(e.item)
+		}
+
+		h.mu.Lock()
+	}
+
+	h.running = false
+	h.mu.Unlock()
+}
+
+// unlock unlocks the queue, and then makes any hook calls recorded
+// while it was locked. The operation is counted towards the FlushEvery
+// option.
+func (q *Queue) unlock() {
+	q.flusher.count()
+	q.Unlock()
+	q.hooks.run()
+}
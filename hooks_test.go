@@ -0,0 +1,96 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueHooks(t *testing.T) {
+	var events []string
+
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{
+		OnEnqueue: func(item *Item) {
+			events = append(events, "enqueue "+item.ToString())
+		},
+		OnDequeue: func(item *Item) {
+			events = append(events, "dequeue "+item.ToString())
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("a"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.EnqueueBatch([][]byte{[]byte("b"), []byte("c")}); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	_, receipt, err := q.DequeueWithReceipt()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Nack(receipt); err != nil {
+		t.Error(err)
+	}
+
+	compEvents := []string{"enqueue a", "enqueue b", "enqueue c", "dequeue a", "dequeue b", "enqueue b"}
+
+	if fmt.Sprint(events) != fmt.Sprint(compEvents) {
+		t.Errorf("Expected events %v, got %v", compEvents, events)
+	}
+}
+
+func TestQueueHooksReentrant(t *testing.T) {
+	var q *Queue
+	var events []string
+
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{
+		OnEnqueue: func(item *Item) {
+			events = append(events, "enqueue "+item.ToString())
+		},
+		OnDequeue: func(item *Item) {
+			events = append(events, "dequeue "+item.ToString())
+
+			// Using the queue from a hook should not deadlock.
+			if item.ToString() == "a" {
+				if _, err := q.EnqueueString("b"); err != nil {
+					t.Error(err)
+				}
+			}
+		},
+	})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("a"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	compEvents := []string{"enqueue a", "dequeue a", "enqueue b"}
+
+	if fmt.Sprint(events) != fmt.Sprint(compEvents) {
+		t.Errorf("Expected events %v, got %v", compEvents, events)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
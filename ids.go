@@ -0,0 +1,96 @@
+package goque
+
+// HeadID returns the ID of the item at the head of the queue, which is
+// the next to be dequeued, or 0 if the queue is empty or closed.
+func (q *Queue) HeadID() uint64 {
+	head, _ := q.IDRange()
+	return head
+}
+
+// TailID returns the ID of the item at the tail of the queue, which is
+// the last item added, or 0 if the queue is empty or closed.
+func (q *Queue) TailID() uint64 {
+	_, tail := q.IDRange()
+	return tail
+}
+
+// IDRange returns the IDs of the items at the head and tail of the
+// queue, or 0 for both if the queue is empty or closed. Every item in
+// the queue has an ID within this range, and IDs below it belong to
+// items which were already removed.
+func (q *Queue) IDRange() (uint64, uint64) {
+	q.RLock()
+	defer q.RUnlock()
+
+	if !q.isOpen || q.Length() == 0 {
+		return 0, 0
+	}
+	return q.head + 1, q.tail
+}
+
+// HeadID returns the ID of the item at the top of the stack, which is
+// the next to be popped, or 0 if the stack is empty or closed.
+func (s *Stack) HeadID() uint64 {
+	_, head := s.IDRange()
+	return head
+}
+
+// TailID returns the ID of the item at the bottom of the stack, or 0 if
+// the stack is empty or closed.
+func (s *Stack) TailID() uint64 {
+	tail, _ := s.IDRange()
+	return tail
+}
+
+// IDRange returns the IDs of the items at the bottom and top of the
+// stack, or 0 for both if the stack is empty or closed. Every item in
+// the stack has an ID within this range.
+func (s *Stack) IDRange() (uint64, uint64) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if !s.isOpen || s.Length() == 0 {
+		return 0, 0
+	}
+	return s.tail + 1, s.head
+}
+
+// IDRange returns the IDs of the items at the head and tail of the
+// given priority level, or 0 for both if the level is empty or the
+// queue is closed. Every item in the level has an ID within this
+// range.
+func (pq *PriorityQueue) IDRange(priority uint8) (uint64, uint64) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	if !pq.isOpen || pq.levels[priority].length() == 0 {
+		return 0, 0
+	}
+	return pq.levels[priority].head + 1, pq.levels[priority].tail
+}
+
+// IDRange returns the IDs of the items at the head and tail of the
+// queue with the given prefix, or 0 for both if that queue is empty.
+// Every item in the queue has an ID within this range.
+func (pq *PrefixQueue) IDRange(prefix []byte) (uint64, uint64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, 0, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err == ErrEmpty {
+		return 0, 0, nil
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	if q.Length() == 0 {
+		return 0, 0, nil
+	}
+	return q.Head + 1, q.Tail, nil
+}
@@ -0,0 +1,124 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueIDRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if head, tail := q.IDRange(); head != 0 || tail != 0 {
+		t.Errorf("Expected empty ID range, got %d to %d", head, tail)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if head, tail := q.IDRange(); head != 2 || tail != 5 {
+		t.Errorf("Expected ID range of 2 to 5, got %d to %d", head, tail)
+	}
+
+	if q.HeadID() != 2 {
+		t.Errorf("Expected head ID of 2, got %d", q.HeadID())
+	}
+
+	if q.TailID() != 5 {
+		t.Errorf("Expected tail ID of 5, got %d", q.TailID())
+	}
+}
+
+func TestStackIDRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	if tail, head := s.IDRange(); tail != 1 || head != 4 {
+		t.Errorf("Expected ID range of 1 to 4, got %d to %d", tail, head)
+	}
+
+	if s.HeadID() != 4 {
+		t.Errorf("Expected head ID of 4, got %d", s.HeadID())
+	}
+
+	if s.TailID() != 1 {
+		t.Errorf("Expected tail ID of 1, got %d", s.TailID())
+	}
+}
+
+func TestPriorityQueueIDRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString(4, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if head, tail := pq.IDRange(4); head != 1 || tail != 3 {
+		t.Errorf("Expected ID range of 1 to 3, got %d to %d", head, tail)
+	}
+
+	if head, tail := pq.IDRange(5); head != 0 || tail != 0 {
+		t.Errorf("Expected empty ID range, got %d to %d", head, tail)
+	}
+}
+
+func TestPrefixQueueIDRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString("prefix", fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = pq.DequeueString("prefix"); err != nil {
+		t.Error(err)
+	}
+
+	head, tail, err := pq.IDRange([]byte("prefix"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if head != 2 || tail != 3 {
+		t.Errorf("Expected ID range of 2 to 3, got %d to %d", head, tail)
+	}
+}
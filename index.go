@@ -0,0 +1,118 @@
+package goque
+
+import (
+	"bytes"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// indexPrefix starts the key of every entry in the secondary index of
+// a queue, followed by the length-prefixed index key and the 8 byte ID
+// of the item, with an empty value.
+var indexPrefix = internalKey("index:")
+
+// indexRange is the key range holding the secondary index.
+var indexRange = util.BytesPrefix(indexPrefix)
+
+// indexKeyPrefix returns the prefix of every index entry of the given
+// index key. The index key is length-prefixed, so no index key's
+// entries are a prefix of another's.
+func indexKeyPrefix(key []byte) []byte {
+	prefix := appendUint32(append([]byte(nil), indexPrefix...), uint32(len(key)))
+	return append(prefix, key...)
+}
+
+// indexEntryKey returns the key of the index entry of the item with the
+// given ID under the given index key.
+func indexEntryKey(key []byte, id uint64) []byte {
+	return appendUint64(indexKeyPrefix(key), id)
+}
+
+// LookupByIndex returns the items in the queue whose index key, as
+// returned by the Indexer the queue was opened with, equals the given
+// key, in dequeue order. An empty slice is returned if no item matches,
+// or if the queue has no Indexer. Expired items and items which are not
+// visible yet are returned as well, as for PeekByID.
+//
+// Index entries are kept in a sorted key range of the database, so a
+// lookup costs O(log n) plus one read per matching item, rather than
+// the linear scan of FindByValue.
+func (q *Queue) LookupByIndex(key []byte) ([]*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	items := []*Item{}
+	if q.indexer == nil {
+		return items, nil
+	}
+
+	iter := q.db.NewIterator(util.BytesPrefix(indexKeyPrefix(key)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		k := iter.Key()
+		id := keyToID(k[len(k)-8:])
+		if id <= q.head || id > q.tail {
+			continue
+		}
+
+		// Entries left pointing at an item which is gone or no longer
+		// has the key, such as ones added before the Indexer was set,
+		// are ignored.
+		item, err := q.getItem(id)
+		if err == ErrOutOfBounds {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(q.indexer(item), key) {
+			continue
+		}
+
+		items = append(items, item)
+	}
+
+	return items, iter.Error()
+}
+
+// indexItem adds the index entry of the given item to the batch, if
+// the queue has an Indexer and it returns a key for the item.
+func (q *Queue) indexItem(batch *leveldb.Batch, item *Item) {
+	if q.indexer == nil {
+		return
+	}
+
+	if key := q.indexer(item); key != nil {
+		batch.Put(indexEntryKey(key, item.ID), nil)
+	}
+}
+
+// unindexItem adds the removal of the index entry of the given item to
+// the batch, if the queue has an Indexer and it returns a key for the
+// item.
+func (q *Queue) unindexItem(batch *leveldb.Batch, item *Item) {
+	if q.indexer == nil {
+		return
+	}
+
+	if key := q.indexer(item); key != nil {
+		batch.Delete(indexEntryKey(key, item.ID))
+	}
+}
+
+// reindexRecord adds the changes moving the index entry of the item
+// stored as the given record from one ID to another to the batch.
+func (q *Queue) reindexRecord(batch *leveldb.Batch, rec *record, from, to uint64) {
+	if q.indexer == nil {
+		return
+	}
+
+	q.unindexItem(batch, newItem(from, rec, q.codec))
+	q.indexItem(batch, newItem(to, rec, q.codec))
+}
@@ -0,0 +1,96 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// indexByUser indexes items by the part of their value before a colon.
+func indexByUser(item *Item) []byte {
+	if i := bytes.IndexByte(item.Value, ':'); i >= 0 {
+		return item.Value[:i]
+	}
+	return nil
+}
+
+func TestQueueLookupByIndex(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Indexer: indexByUser})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for _, value := range []string{"alice:1", "bob:2", "alice:3", "none", "bob:4"} {
+		if _, err = q.EnqueueString(value); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := q.LookupByIndex([]byte("alice"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 || items[0].ToString() != "alice:1" || items[1].ToString() != "alice:3" {
+		t.Errorf("Expected items 'alice:1' and 'alice:3', got %v", items)
+	}
+
+	// Removed items are removed from the index.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if err = q.DeleteByID(5); err != nil {
+		t.Error(err)
+	}
+
+	items, err = q.LookupByIndex([]byte("alice"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 || items[0].ID != 3 {
+		t.Errorf("Expected item 3, got %v", items)
+	}
+
+	// Updated items move to their new index key.
+	if _, err = q.UpdateString(3, "bob:3"); err != nil {
+		t.Error(err)
+	}
+
+	items, err = q.LookupByIndex([]byte("alice"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 0 {
+		t.Errorf("Expected no items, got %d", len(items))
+	}
+
+	items, err = q.LookupByIndex([]byte("bob"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 || items[0].ID != 2 || items[1].ID != 3 {
+		t.Errorf("Expected items 2 and 3, got %v", items)
+	}
+
+	// The index entries are removed along with their items.
+	if _, err = q.Drain(); err != nil {
+		t.Error(err)
+	}
+
+	n := 0
+	iter := q.db.NewIterator(indexRange, nil)
+	for iter.Next() {
+		n++
+	}
+	iter.Release()
+
+	if n != 0 {
+		t.Errorf("Expected no index entries, got %d", n)
+	}
+}
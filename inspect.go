@@ -0,0 +1,97 @@
+package goque
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Inspect returns the type of the data structure stored in the given
+// data directory, along with the number of items it holds, so tools can
+// report on a directory without knowing what it contains. ErrNotGoque
+// is returned if the directory does not hold a goque data structure.
+//
+// The data structure is opened read-only to count its items, so any
+// number of processes can inspect it at the same time, but not while it
+// is opened for writing, in which case the error opening the database
+// is returned along with the type. Items are counted as by the Length
+// method of the structure, so expired items are included. The count is
+// always zero for a DB, as its namespaces are not known in advance.
+func Inspect(dataDir string) (Type, uint64, error) {
+	// Read the type and codec ID from the 'GOQUE' file.
+	b, err := os.ReadFile(filepath.Join(dataDir, "GOQUE"))
+	if os.IsNotExist(err) || err == nil && len(b) == 0 {
+		return 0, 0, ErrNotGoque
+	} else if err != nil {
+		return 0, 0, err
+	}
+	gt := Type(b[0])
+	if !gt.valid() {
+		return 0, 0, ErrNotGoque
+	}
+
+	// Values are never decoded, so open the structure claiming the
+	// codec it was stored with.
+	codecID := GobCodec.ID()
+	if len(b) > 1 {
+		codecID = b[1]
+	}
+	opts := &Options{Codec: storedCodec{Codec: GobCodec, id: codecID}}
+	lopts := &opt.Options{ReadOnly: true, ErrorIfMissing: true}
+	ctx := context.Background()
+
+	switch gt {
+	case TypeStack:
+		s, err := openStack(ctx, dataDir, opts, lopts)
+		if err != nil {
+			return gt, 0, err
+		}
+		defer s.Close()
+		return gt, s.Length(), nil
+	case TypeQueue:
+		q, err := openQueue(ctx, dataDir, opts, lopts)
+		if err != nil {
+			return gt, 0, err
+		}
+		defer q.Close()
+		return gt, q.Length(), nil
+	case TypePriorityQueue:
+		pq, err := openPriorityQueue(ctx, dataDir, ASC, opts, lopts)
+		if err != nil {
+			return gt, 0, err
+		}
+		defer pq.Close()
+		return gt, pq.Length(), nil
+	case TypePrefixQueue:
+		pq, err := openPrefixQueue(ctx, dataDir, opts, lopts)
+		if err != nil {
+			return gt, 0, err
+		}
+		defer pq.Close()
+		return gt, pq.Length(), nil
+	case TypeKeyedPriorityQueue:
+		kq, err := openKeyedPriorityQueue(dataDir, ASC, opts, lopts)
+		if err != nil {
+			return gt, 0, err
+		}
+		defer kq.Close()
+		return gt, kq.Length(), nil
+	default:
+		return gt, 0, nil
+	}
+}
+
+// storedCodec stands in for the codec a data structure was stored with
+// when it is opened by Inspect, carrying its ID. It is never used to
+// decode values.
+type storedCodec struct {
+	Codec
+	id uint8
+}
+
+// ID returns the ID of the stored codec.
+func (c storedCodec) ID() uint8 {
+	return c.id
+}
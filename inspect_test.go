@@ -0,0 +1,153 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	queueFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(queueFile, &Options{Codec: JSONCodec})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = q.DeleteByID(2); err != nil {
+		t.Error(err)
+	}
+
+	// The database is locked while the queue is open for writing.
+	if _, _, err = Inspect(queueFile); err == nil {
+		t.Error("Expected to get an error inspecting an open queue")
+	}
+	q.Close()
+
+	gt, n, err := Inspect(queueFile)
+	if err != nil {
+		t.Error(err)
+	}
+	if gt != TypeQueue || n != 2 {
+		t.Errorf("Expected queue of 2 items, got %s of %d items", gt, n)
+	}
+
+	pqFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(pqFile, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 0; i < 4; i++ {
+		if _, err = pq.EnqueueString(uint8(i), "value"); err != nil {
+			t.Error(err)
+		}
+	}
+	pq.Close()
+
+	gt, n, err = Inspect(pqFile)
+	if err != nil {
+		t.Error(err)
+	}
+	if gt != TypePriorityQueue || n != 4 {
+		t.Errorf("Expected priority queue of 4 items, got %s of %d items", gt, n)
+	}
+
+	prefixFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	prq, err := OpenPrefixQueue(prefixFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer prq.Drop()
+
+	if _, err = prq.EnqueueString("prefix", "value"); err != nil {
+		t.Error(err)
+	}
+	prq.Close()
+
+	gt, n, err = Inspect(prefixFile)
+	if err != nil {
+		t.Error(err)
+	}
+	if gt != TypePrefixQueue || n != 1 {
+		t.Errorf("Expected prefix queue of 1 item, got %s of %d items", gt, n)
+	}
+
+	// Inspecting a directory does not open it for writing.
+	q, err = OpenQueueWithOptions(queueFile, &Options{Codec: JSONCodec})
+	if err != nil {
+		t.Error(err)
+	}
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+}
+
+func TestInspectNotGoque(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	if _, _, err := Inspect(file); err != ErrNotGoque {
+		t.Errorf("Expected to get not goque error, got %v", err)
+	}
+
+	if err := os.Mkdir(file, 0755); err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+
+	if _, _, err := Inspect(file); err != ErrNotGoque {
+		t.Errorf("Expected to get not goque error, got %v", err)
+	}
+}
+
+func TestTypeString(t *testing.T) {
+	names := map[Type]string{
+		TypeStack:         "stack",
+		TypeQueue:         "queue",
+		TypePriorityQueue: "priority",
+		TypePrefixQueue:   "prefix",
+		Type(200):         "Type(200)",
+	}
+	for gt, name := range names {
+		if gt.String() != name {
+			t.Errorf("Expected type name '%s', got '%s'", name, gt.String())
+		}
+	}
+
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	if s.Type() != TypeStack {
+		t.Errorf("Expected stack type, got %s", s.Type())
+	}
+
+	// The type of each structure matches the type stored for it.
+	s.Close()
+	gt, _, err := Inspect(file)
+	if err != nil {
+		t.Error(err)
+	}
+	if gt != s.Type() {
+		t.Errorf("Expected inspected type %s, got %s", s.Type(), gt)
+	}
+
+	q, err := OpenQueueMemory()
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Close()
+
+	if q.Type() != TypeQueue {
+		t.Errorf("Expected queue type, got %s", q.Type())
+	}
+}
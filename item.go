@@ -1,17 +1,103 @@
 package goque
 
 import (
-	"bytes"
 	"encoding/binary"
-	"encoding/gob"
 	"encoding/json"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// internalKeyPrefix is the first byte of every key a stack or queue
+// uses to store its own bookkeeping data. Item keys are the 8 byte
+// big-endian item ID, so this prefix only overlaps with IDs far beyond
+// any realistic number of items.
+const internalKeyPrefix byte = 0xff
+
+// itemRange is the key range holding the items of a stack or queue,
+// excluding any internal keys.
+var itemRange = &util.Range{Limit: []byte{internalKeyPrefix}}
+
 // Item represents an entry in either a stack or queue.
 type Item struct {
 	ID    uint64
 	Key   []byte
 	Value []byte
+
+	// Attempts is the number of times the item has been delivered
+	// using Queue.DequeueWithReceipt, including this delivery.
+	Attempts uint32
+
+	// Meta holds the metadata the item was added with using
+	// Queue.EnqueueWithMeta. It is empty for items without metadata.
+	Meta map[string]string
+
+	// EnqueuedAt is the time the item was added to a Queue. It is zero
+	// for items of a Stack and for items added by versions of goque
+	// which did not record it.
+	EnqueuedAt time.Time
+
+	codec     Codec
+	expiresAt time.Time
+	visibleAt time.Time
+	uniqueKey []byte
+	chunks    *chunkRef
+
+	// inFlight is set on an item taken by DequeueWithReceipt, whose
+	// streamed value stays stored while the item is in flight.
+	inFlight bool
+}
+
+// newItem returns the item with the given ID from its decoded record,
+// using the given codec to decode objects.
+func newItem(id uint64, rec *record, codec Codec) *Item {
+	return &Item{
+		ID:         id,
+		Key:        idToKey(id),
+		Value:      rec.value,
+		Attempts:   rec.attempts,
+		Meta:       rec.meta,
+		EnqueuedAt: rec.enqueuedAt,
+		codec:      codec,
+		expiresAt:  rec.expiresAt,
+		visibleAt:  rec.visibleAt,
+		uniqueKey:  rec.uniqueKey,
+		chunks:     rec.chunks,
+	}
+}
+
+// record returns the record holding the value and record fields of
+// the item.
+func (i *Item) record() *record {
+	return &record{
+		value:      i.Value,
+		expiresAt:  i.expiresAt,
+		visibleAt:  i.visibleAt,
+		attempts:   i.Attempts,
+		uniqueKey:  i.uniqueKey,
+		enqueuedAt: i.EnqueuedAt,
+		meta:       i.Meta,
+		chunks:     i.chunks,
+	}
+}
+
+// expired returns whether the item has an expiry which is at or
+// before the given time.
+func (i *Item) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !i.expiresAt.After(now)
+}
+
+// visible returns whether the item can be dequeued at the given time,
+// which is once its visibility time, if any, has been reached.
+func (i *Item) visible(now time.Time) bool {
+	return !i.visibleAt.After(now)
+}
+
+// ready returns whether the item can be dequeued at the given time,
+// being visible and not expired.
+func (i *Item) ready(now time.Time) bool {
+	return i.visible(now) && !i.expired(now)
 }
 
 // ToString returns the item value as a string.
@@ -19,21 +105,23 @@ func (i *Item) ToString() string {
 	return string(i.Value)
 }
 
-// ToObject decodes the item value into the given value type using
-// encoding/gob.
+// ToObject decodes the item value into the given value type using the
+// codec of the stack or queue the item came from, which is
+// encoding/gob by default.
 //
 // The value passed to this method should be a pointer to a variable
 // of the type you wish to decode into. The variable pointed to will
 // hold the decoded object.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to decode simple types.
 func (i *Item) ToObject(value interface{}) error {
-	buffer := bytes.NewBuffer(i.Value)
-	dec := gob.NewDecoder(buffer)
-	return dec.Decode(value)
+	if i.codec == nil {
+		return GobCodec.Decode(i.Value, value)
+	}
+	return i.codec.Decode(i.Value, value)
 }
 
 // ToObjectFromJSON decodes the item value into the given value type
@@ -52,6 +140,9 @@ type PriorityItem struct {
 	Priority uint8
 	Key      []byte
 	Value    []byte
+
+	codec      Codec
+	enqueuedAt time.Time
 }
 
 // ToString returns the priority item value as a string.
@@ -59,21 +150,23 @@ func (pi *PriorityItem) ToString() string {
 	return string(pi.Value)
 }
 
-// ToObject decodes the item value into the given value type using
-// encoding/gob.
+// ToObject decodes the item value into the given value type using the
+// codec of the priority queue the item came from, which is
+// encoding/gob by default.
 //
 // The value passed to this method should be a pointer to a variable
 // of the type you wish to decode into. The variable pointed to will
 // hold the decoded object.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to decode simple types.
 func (pi *PriorityItem) ToObject(value interface{}) error {
-	buffer := bytes.NewBuffer(pi.Value)
-	dec := gob.NewDecoder(buffer)
-	return dec.Decode(value)
+	if pi.codec == nil {
+		return GobCodec.Decode(pi.Value, value)
+	}
+	return pi.codec.Decode(pi.Value, value)
 }
 
 // ToObjectFromJSON decodes the item value into the given value type
@@ -86,6 +179,51 @@ func (pi *PriorityItem) ToObjectFromJSON(value interface{}) error {
 	return json.Unmarshal(pi.Value, value)
 }
 
+// PrefixItem represents an entry in a prefix queue, along with the
+// prefix it was added with.
+type PrefixItem struct {
+	ID     uint64
+	Prefix []byte
+	Key    []byte
+	Value  []byte
+
+	codec Codec
+}
+
+// ToString returns the prefix item value as a string.
+func (pi *PrefixItem) ToString() string {
+	return string(pi.Value)
+}
+
+// ToObject decodes the item value into the given value type using the
+// codec of the prefix queue the item came from, which is encoding/gob
+// by default.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+//
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
+// package works. Because of this, you should only use this function
+// to decode simple types.
+func (pi *PrefixItem) ToObject(value interface{}) error {
+	if pi.codec == nil {
+		return GobCodec.Decode(pi.Value, value)
+	}
+	return pi.codec.Decode(pi.Value, value)
+}
+
+// ToObjectFromJSON decodes the item value into the given value type
+// using encoding/json.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (pi *PrefixItem) ToObjectFromJSON(value interface{}) error {
+	return json.Unmarshal(pi.Value, value)
+}
+
 // idToKey converts and returns the given ID to a key.
 func idToKey(id uint64) []byte {
 	key := make([]byte, 8)
@@ -97,3 +235,22 @@ func idToKey(id uint64) []byte {
 func keyToID(key []byte) uint64 {
 	return binary.BigEndian.Uint64(key)
 }
+
+// internalKey returns the key used by a stack or queue to store the
+// bookkeeping data with the given name.
+func internalKey(name string) []byte {
+	return append([]byte{internalKeyPrefix}, name...)
+}
+
+// deleteRange adds a delete of every key within the given range of the
+// database to the batch. A nil range covers the whole database.
+func deleteRange(db database, batch *leveldb.Batch, r *util.Range) error {
+	iter := db.NewIterator(r, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		batch.Delete(iter.Key())
+	}
+
+	return iter.Error()
+}
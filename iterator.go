@@ -0,0 +1,398 @@
+package goque
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// snapshotIterator walks the given key ranges of a LevelDB snapshot in
+// order, yielding each stored key and value.
+type snapshotIterator struct {
+	snap    snapshot
+	ranges  []*util.Range
+	reverse bool
+	iter    iterator.Iterator
+	err     error
+}
+
+// newSnapshotIterator returns a snapshotIterator over the given key
+// ranges of the database. If reverse is true, the keys within each
+// range are walked from last to first.
+func newSnapshotIterator(db database, ranges []*util.Range, reverse bool) *snapshotIterator {
+	snap, err := db.GetSnapshot()
+	return &snapshotIterator{
+		snap:    snap,
+		ranges:  ranges,
+		reverse: reverse,
+		err:     err,
+	}
+}
+
+// next moves to the next stored key, returning false once every range
+// has been walked or an error occurred.
+func (si *snapshotIterator) next() bool {
+	for si.err == nil {
+		if si.iter == nil {
+			if len(si.ranges) == 0 {
+				return false
+			}
+			si.iter = si.snap.NewIterator(si.ranges[0], nil)
+			si.ranges = si.ranges[1:]
+
+			if si.reverse && si.iter.Last() || !si.reverse && si.iter.First() {
+				return true
+			}
+		} else if si.reverse && si.iter.Prev() || !si.reverse && si.iter.Next() {
+			return true
+		}
+
+		// This range is done, move on to the next one.
+		si.err = si.iter.Error()
+		si.iter.Release()
+		si.iter = nil
+	}
+
+	return false
+}
+
+// key returns a copy of the current key.
+func (si *snapshotIterator) key() []byte {
+	return append([]byte(nil), si.iter.Key()...)
+}
+
+// value returns a copy of the current value.
+func (si *snapshotIterator) value() []byte {
+	return append([]byte(nil), si.iter.Value()...)
+}
+
+// release releases the snapshot and any open LevelDB iterator.
+func (si *snapshotIterator) release() {
+	if si.iter != nil {
+		si.iter.Release()
+		si.iter = nil
+	}
+	if si.snap != nil {
+		si.snap.Release()
+		si.snap = nil
+	}
+	si.ranges = nil
+}
+
+// Iterator iterates over the items of a stack, queue or prefix queue
+// in the order they would be removed, as they were when the iterator
+// was created. Changes made while iterating are not seen.
+//
+// An Iterator must be released using Release once it is no longer
+// needed.
+type Iterator struct {
+	si      *snapshotIterator
+	newItem func(key, value []byte) (*Item, error)
+	item    *Item
+}
+
+// Next moves the iterator to the next item, returning false once there
+// are no more items or an error occurred.
+func (it *Iterator) Next() bool {
+	it.item = nil
+	if it.si == nil {
+		return false
+	}
+
+	for it.si.next() {
+		item, err := it.newItem(it.si.key(), it.si.value())
+		if err != nil {
+			it.si.err = err
+			return false
+		}
+
+		if item != nil {
+			it.item = item
+			return true
+		}
+	}
+
+	return false
+}
+
+// Item returns the current item, or nil if there is none.
+func (it *Iterator) Item() *Item {
+	return it.item
+}
+
+// Err returns the error, if any, that occurred while iterating.
+func (it *Iterator) Err() error {
+	if it.si == nil {
+		return ErrDBClosed
+	}
+	return it.si.err
+}
+
+// Release releases the resources held by the iterator. Next returns
+// false once the iterator has been released.
+func (it *Iterator) Release() {
+	if it.si != nil {
+		it.si.release()
+	}
+	it.item = nil
+}
+
+// PriorityIterator iterates over the items of a priority queue in the
+// order they would be dequeued, as they were when the iterator was
+// created. Changes made while iterating are not seen.
+//
+// A PriorityIterator must be released using Release once it is no
+// longer needed.
+type PriorityIterator struct {
+	si     *snapshotIterator
+	codec  Codec
+	format recordFormat
+	item   *PriorityItem
+}
+
+// Next moves the iterator to the next item, returning false once there
+// are no more items or an error occurred.
+func (it *PriorityIterator) Next() bool {
+	it.item = nil
+	if it.si == nil || !it.si.next() {
+		return false
+	}
+
+	rec, err := it.format.decode(it.si.value())
+	if err != nil {
+		it.si.err = err
+		return false
+	}
+
+	key := it.si.key()
+	it.item = &PriorityItem{
+		ID:       keyToID(key[2:]),
+		Priority: key[0],
+		Key:      key,
+		Value:    rec.value,
+		codec:    it.codec,
+	}
+	return true
+}
+
+// Item returns the current item, or nil if there is none.
+func (it *PriorityIterator) Item() *PriorityItem {
+	return it.item
+}
+
+// Err returns the error, if any, that occurred while iterating.
+func (it *PriorityIterator) Err() error {
+	if it.si == nil {
+		return ErrDBClosed
+	}
+	return it.si.err
+}
+
+// Release releases the resources held by the iterator. Next returns
+// false once the iterator has been released.
+func (it *PriorityIterator) Release() {
+	if it.si != nil {
+		it.si.release()
+	}
+	it.item = nil
+}
+
+// NewIterator returns an Iterator over the items of the queue, from
+// head to tail. Items which have expired when the iterator is created
+// are skipped.
+func (q *Queue) NewIterator() *Iterator {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return &Iterator{}
+	}
+
+	now := time.Now()
+	codec, format := q.codec, q.format
+	ranges := []*util.Range{{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}}
+
+	return &Iterator{
+		si: newSnapshotIterator(q.db, ranges, false),
+		newItem: func(key, value []byte) (*Item, error) {
+			rec, err := format.decode(value)
+			if err != nil {
+				return nil, err
+			}
+
+			item := newItem(keyToID(key), rec, codec)
+			if item.expired(now) {
+				return nil, nil
+			}
+			return item, nil
+		},
+	}
+}
+
+// SnapshotLength returns the number of items in the queue as of a
+// LevelDB snapshot, which is exactly the number of items an Iterator
+// created at the same time yields. Unlike Length, which is read from
+// counters kept in memory, expired items are not counted, but counting
+// means reading every item of the queue.
+func (q *Queue) SnapshotLength() (uint64, error) {
+	it := q.NewIterator()
+	defer it.Release()
+
+	var n uint64
+	for it.Next() {
+		n++
+	}
+
+	return n, it.Err()
+}
+
+// NewIterator returns an Iterator over the items of the stack, from
+// the top of the stack down.
+func (s *Stack) NewIterator() *Iterator {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return &Iterator{}
+	}
+
+	codec, format := s.codec, s.format
+	ranges := []*util.Range{{Start: idToKey(s.tail + 1), Limit: idToKey(s.head + 1)}}
+
+	return &Iterator{
+		si: newSnapshotIterator(s.db, ranges, true),
+		newItem: func(key, value []byte) (*Item, error) {
+			rec, err := format.decode(value)
+			if err != nil {
+				return nil, err
+			}
+			return newItem(keyToID(key), rec, codec), nil
+		},
+	}
+}
+
+// NewIterator returns a PriorityIterator over the items of the priority
+// queue, from the most important priority level to the least.
+func (pq *PriorityQueue) NewIterator() *PriorityIterator {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return &PriorityIterator{}
+	}
+
+	// Walk the non-empty priority levels in priority order.
+	var ranges []*util.Range
+	for i := 0; i <= 255; i++ {
+		priority := uint8(i)
+		if pq.order == DESC {
+			priority = uint8(255 - i)
+		}
+
+		level := pq.levels[priority]
+		if level.length() > 0 {
+			ranges = append(ranges, &util.Range{
+				Start: pq.generateKey(priority, level.head+1),
+				Limit: pq.generateKey(priority, level.tail+1),
+			})
+		}
+	}
+
+	return &PriorityIterator{
+		si:     newSnapshotIterator(pq.db, ranges, false),
+		codec:  pq.codec,
+		format: pq.format,
+	}
+}
+
+// NewIterator returns an Iterator over the items of the prefix queue.
+// Items are grouped by prefix, with prefixes in byte order, and appear
+// in dequeue order within each prefix. The Key of each item holds its
+// prefix followed by the prefix delimiter and its ID.
+func (pq *PrefixQueue) NewIterator() *Iterator {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return &Iterator{}
+	}
+
+	codec, format := pq.codec, pq.format
+	dataKey := pq.getDataKey()
+
+	return &Iterator{
+		si: newSnapshotIterator(pq.db, []*util.Range{nil}, false),
+		newItem: func(key, value []byte) (*Item, error) {
+			// Skip the prefix queue and per prefix queue data.
+			if len(key) < 9 || key[len(key)-9] != prefixDelimiter ||
+				bytes.Equal(key, dataKey) || bytes.HasSuffix(key, []byte(":data")) {
+				return nil, nil
+			}
+
+			rec, err := format.decode(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return &Item{
+				ID:    keyToID(key[len(key)-8:]),
+				Key:   key,
+				Value: rec.value,
+				codec: codec,
+			}, nil
+		},
+	}
+}
+
+// NewPrefixIterator returns an Iterator over the items of the queue
+// with the given prefix, in the order they would be dequeued. The Key
+// of each item holds the prefix followed by the prefix delimiter and
+// its ID.
+func (pq *PrefixQueue) NewPrefixIterator(prefix []byte) *Iterator {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return &Iterator{}
+	}
+
+	codec, format := pq.codec, pq.format
+	prefix = append([]byte(nil), prefix...)
+
+	// Walk the stored items of the prefix, if it has any.
+	var ranges []*util.Range
+	q, err := pq.getQueue(prefix)
+	if err != nil && err != ErrEmpty {
+		return &Iterator{si: &snapshotIterator{err: err}}
+	}
+	if err == nil && q.Length() > 0 {
+		ranges = append(ranges, &util.Range{
+			Start: generateKeyPrefixID(append([]byte(nil), prefix...), q.Head+1),
+			Limit: generateKeyPrefixID(append([]byte(nil), prefix...), q.Tail+1),
+		})
+	}
+
+	return &Iterator{
+		si: newSnapshotIterator(pq.db, ranges, false),
+		newItem: func(key, value []byte) (*Item, error) {
+			rec, err := format.decode(value)
+			if err != nil {
+				return nil, err
+			}
+
+			return &Item{
+				ID:    keyToID(key[len(key)-8:]),
+				Key:   key,
+				Value: rec.value,
+				codec: codec,
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,310 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	it := q.NewIterator()
+	defer it.Release()
+
+	// Changes after creating the iterator should not be seen.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if _, err = q.EnqueueString("value for item 11"); err != nil {
+		t.Error(err)
+	}
+
+	i := 2
+	for it.Next() {
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if it.Item().ID != uint64(i) {
+			t.Errorf("Expected ID to be %d, got %d", i, it.Item().ID)
+		}
+
+		if it.Item().ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, it.Item().ToString())
+		}
+
+		i++
+	}
+
+	if err = it.Err(); err != nil {
+		t.Error(err)
+	}
+
+	if i != 11 {
+		t.Errorf("Expected to iterate over 9 items, got %d", i-2)
+	}
+
+	if q.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", q.Length())
+	}
+}
+
+func TestQueueIteratorClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	q.Close()
+
+	it := q.NewIterator()
+	defer it.Release()
+
+	if it.Next() {
+		t.Error("Expected iterator of closed queue to have no items")
+	}
+
+	if err = it.Err(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestStackIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	it := s.NewIterator()
+	defer it.Release()
+
+	i := 10
+	for it.Next() {
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if it.Item().ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, it.Item().ToString())
+		}
+
+		i--
+	}
+
+	if err = it.Err(); err != nil {
+		t.Error(err)
+	}
+
+	if i != 0 {
+		t.Errorf("Expected to iterate over 10 items, got %d", 10-i)
+	}
+}
+
+func TestPriorityQueueIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	it := pq.NewIterator()
+	defer it.Release()
+
+	var count uint64
+	for it.Next() {
+		item, err := pq.PeekByOffset(count)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if it.Item().Priority != item.Priority || it.Item().ID != item.ID {
+			t.Errorf("Expected item %d:%d, got %d:%d", item.Priority, item.ID, it.Item().Priority, it.Item().ID)
+		}
+
+		if it.Item().ToString() != item.ToString() {
+			t.Errorf("Expected string to be '%s', got '%s'", item.ToString(), it.Item().ToString())
+		}
+
+		count++
+	}
+
+	if err = it.Err(); err != nil {
+		t.Error(err)
+	}
+
+	if count != 50 {
+		t.Errorf("Expected to iterate over 50 items, got %d", count)
+	}
+}
+
+func TestPrefixQueueIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for _, prefix := range []string{"b", "a"} {
+		for i := 1; i <= 5; i++ {
+			if _, err = pq.EnqueueString(prefix, fmt.Sprintf("%s value for item %d", prefix, i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if _, err = pq.DequeueString("a"); err != nil {
+		t.Error(err)
+	}
+
+	it := pq.NewIterator()
+	defer it.Release()
+
+	var values []string
+	for it.Next() {
+		values = append(values, it.Item().ToString())
+	}
+
+	if err = it.Err(); err != nil {
+		t.Error(err)
+	}
+
+	if len(values) != 9 {
+		t.Errorf("Expected to iterate over 9 items, got %d", len(values))
+	} else {
+		if values[0] != "a value for item 2" {
+			t.Errorf("Expected string to be 'a value for item 2', got '%s'", values[0])
+		}
+
+		if values[8] != "b value for item 5" {
+			t.Errorf("Expected string to be 'b value for item 5', got '%s'", values[8])
+		}
+	}
+}
+
+func TestPrefixQueuePrefixIterator(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	// The "ab" prefix sorts right after "a", so it must not be included.
+	for _, prefix := range []string{"a", "ab"} {
+		for i := 1; i <= 5; i++ {
+			if _, err = pq.EnqueueString(prefix, fmt.Sprintf("%s value for item %d", prefix, i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if _, err = pq.DequeueString("a"); err != nil {
+		t.Error(err)
+	}
+
+	it := pq.NewPrefixIterator([]byte("a"))
+	defer it.Release()
+
+	var values []string
+	for it.Next() {
+		values = append(values, it.Item().ToString())
+	}
+
+	if err = it.Err(); err != nil {
+		t.Error(err)
+	}
+
+	if len(values) != 4 {
+		t.Errorf("Expected to iterate over 4 items, got %d", len(values))
+	} else {
+		for i, value := range values {
+			compStr := fmt.Sprintf("a value for item %d", i+2)
+			if value != compStr {
+				t.Errorf("Expected string to be '%s', got '%s'", compStr, value)
+			}
+		}
+	}
+
+	// An unknown prefix should have no items.
+	it = pq.NewPrefixIterator([]byte("c"))
+	defer it.Release()
+
+	if it.Next() {
+		t.Error("Expected no items for an unknown prefix")
+	}
+
+	if err = it.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueueSnapshotLength(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.EnqueueWithTTL([]byte("expired"), time.Nanosecond); err != nil {
+		t.Error(err)
+	}
+	if err = q.DeleteByID(3); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	// Expired items are counted by Length, but not by SnapshotLength.
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+	length, err := q.SnapshotLength()
+	if err != nil {
+		t.Error(err)
+	}
+	if length != 4 {
+		t.Errorf("Expected snapshot length of 4, got %d", length)
+	}
+
+	q.Close()
+	if _, err = q.SnapshotLength(); err != ErrDBClosed {
+		t.Errorf("Expected to get queue closed error, got %v", err)
+	}
+}
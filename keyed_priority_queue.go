@@ -0,0 +1,413 @@
+package goque
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// keyedItemPrefix is the prefix of the key of each item of a keyed
+// priority queue, keeping items apart from the internal keys.
+var keyedItemPrefix = []byte("i:")
+
+// keyedStateKey holds the next sequence number and the length of a
+// keyed priority queue.
+var keyedStateKey = internalKey("state")
+
+// KeyedPriorityQueue is a priority queue whose items are ordered by a
+// priority key of any length, such as a millisecond deadline, rather
+// than by one of 256 priority levels. Priority keys are compared byte
+// by byte, so a shorter key which is a prefix of a longer one sorts
+// first, and is dequeued first in ASC order and last in DESC order.
+// EnqueueUint64 encodes numbers so they compare numerically.
+//
+// Items with the same priority key are dequeued in FIFO order. Each
+// item is stored under its full priority key followed by a sequence
+// number, so Dequeue takes a single LevelDB seek however many distinct
+// priorities the queue holds.
+type KeyedPriorityQueue struct {
+	sync.RWMutex
+	DataDir   string
+	db        database
+	order     order
+	seq       uint64
+	length    uint64
+	isOpen    bool
+	codec     Codec
+	format    recordFormat
+	writeOpts *opt.WriteOptions
+}
+
+// OpenKeyedPriorityQueue opens a keyed priority queue if one exists at
+// the given directory. If one does not already exist, a new keyed
+// priority queue is created. With ASC order the item with the lowest
+// priority key is dequeued first, and with DESC order the item with
+// the highest one. As for a PriorityQueue, the order is not stored.
+func OpenKeyedPriorityQueue(dataDir string, order order) (*KeyedPriorityQueue, error) {
+	return OpenKeyedPriorityQueueWithOptions(dataDir, order, nil)
+}
+
+// OpenKeyedPriorityQueueWithOptions opens a keyed priority queue if one
+// exists at the given directory using the given options. If one does
+// not already exist, a new keyed priority queue is created.
+func OpenKeyedPriorityQueueWithOptions(dataDir string, order order, opts *Options) (*KeyedPriorityQueue, error) {
+	return openKeyedPriorityQueue(dataDir, order, opts, nil)
+}
+
+// openKeyedPriorityQueue opens a keyed priority queue using the given
+// options and LevelDB options, which may be nil.
+func openKeyedPriorityQueue(dataDir string, order order, opts *Options, lopts *opt.Options) (*KeyedPriorityQueue, error) {
+	var err error
+	opts.registerGobTypes()
+
+	// Check if the order is valid.
+	if order != ASC && order != DESC {
+		return nil, ErrInvalidOrder
+	}
+
+	// Create a new KeyedPriorityQueue.
+	kq := &KeyedPriorityQueue{
+		DataDir:   dataDir,
+		db:        levelDB{&leveldb.DB{}},
+		order:     order,
+		isOpen:    false,
+		codec:     opts.codec(),
+		format:    newRecordFormat(opts),
+		writeOpts: opts.writeOptions(),
+	}
+
+	// Open database for the keyed priority queue.
+	db, err := openDB(context.Background(), dataDir, lopts)
+	if err != nil {
+		return kq, err
+	}
+	kq.db = levelDB{db}
+
+	// Check if this Goque type can open the requested data directory.
+	if err = checkGoqueType(dataDir, TypeKeyedPriorityQueue, kq.codec, false, kq.writeOpts.Sync); err != nil {
+		return kq, err
+	}
+
+	// Set isOpen and return.
+	kq.isOpen = true
+	return kq, kq.init()
+}
+
+// Enqueue adds an item with the given priority key to the keyed
+// priority queue, behind any items holding the same priority key.
+func (kq *KeyedPriorityQueue) Enqueue(priority, value []byte) (*KeyedPriorityItem, error) {
+	kq.Lock()
+	defer kq.Unlock()
+
+	// Check if queue is closed.
+	if !kq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Create new KeyedPriorityItem.
+	item := &KeyedPriorityItem{
+		ID:       kq.seq + 1,
+		Priority: append([]byte(nil), priority...),
+		Key:      generateKeyedPriorityKey(priority, kq.seq+1),
+		Value:    value,
+		codec:    kq.codec,
+	}
+
+	// Add it to the keyed priority queue along with the new state.
+	b, err := kq.format.encode(&record{value: item.Value})
+	if err != nil {
+		return nil, err
+	}
+	batch := new(leveldb.Batch)
+	batch.Put(item.Key, b)
+	batch.Put(keyedStateKey, keyedState(kq.seq+1, kq.length+1))
+	if err := kq.db.Write(batch, kq.writeOpts); err != nil {
+		return nil, err
+	}
+
+	// Increment sequence number and length.
+	kq.seq++
+	kq.length++
+
+	return item, nil
+}
+
+// EnqueueUint64 is a helper function for Enqueue that accepts the
+// priority as a number, which is encoded in big-endian byte order so
+// priorities compare numerically.
+func (kq *KeyedPriorityQueue) EnqueueUint64(priority uint64, value []byte) (*KeyedPriorityItem, error) {
+	return kq.Enqueue(idToKey(priority), value)
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a value
+// as a string rather than a byte slice.
+func (kq *KeyedPriorityQueue) EnqueueString(priority []byte, value string) (*KeyedPriorityItem, error) {
+	return kq.Enqueue(priority, []byte(value))
+}
+
+// EnqueueObject is a helper function for Enqueue that accepts any
+// value type, which is then encoded into a byte slice using the codec
+// of the keyed priority queue, which is encoding/gob by default.
+func (kq *KeyedPriorityQueue) EnqueueObject(priority []byte, value interface{}) (*KeyedPriorityItem, error) {
+	b, err := kq.codec.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return kq.Enqueue(priority, b)
+}
+
+// Dequeue removes the most important item in the keyed priority queue
+// and returns it.
+func (kq *KeyedPriorityQueue) Dequeue() (*KeyedPriorityItem, error) {
+	kq.Lock()
+	defer kq.Unlock()
+
+	// Check if queue is closed.
+	if !kq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Try to get the next item.
+	item, err := kq.getNextItem()
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove this item from the keyed priority queue.
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	batch.Put(keyedStateKey, keyedState(kq.seq, kq.length-1))
+	if err := kq.db.Write(batch, kq.writeOpts); err != nil {
+		return nil, err
+	}
+
+	// Decrement length.
+	kq.length--
+
+	return item, nil
+}
+
+// Peek returns the most important item in the keyed priority queue
+// without removing it.
+func (kq *KeyedPriorityQueue) Peek() (*KeyedPriorityItem, error) {
+	kq.RLock()
+	defer kq.RUnlock()
+
+	// Check if queue is closed.
+	if !kq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return kq.getNextItem()
+}
+
+// Length returns the total number of items in the keyed priority queue.
+func (kq *KeyedPriorityQueue) Length() uint64 {
+	kq.RLock()
+	defer kq.RUnlock()
+
+	return kq.length
+}
+
+// Close closes the LevelDB database of the keyed priority queue,
+// flushing its writes to disk first if it was opened with the NoSync
+// option.
+func (kq *KeyedPriorityQueue) Close() error {
+	kq.Lock()
+	defer kq.Unlock()
+
+	// Check if queue is already closed.
+	if !kq.isOpen {
+		return nil
+	}
+
+	// Flush any writes which were not synced.
+	if err := flushContext(context.Background(), kq.db, kq.writeOpts.Sync); err != nil {
+		return err
+	}
+
+	// Close the LevelDB database.
+	if err := kq.db.Close(); err != nil {
+		return err
+	}
+
+	// Reset the state and set isOpen to false.
+	kq.seq = 0
+	kq.length = 0
+	kq.isOpen = false
+
+	return nil
+}
+
+// Drop closes and deletes the LevelDB database of the keyed priority
+// queue.
+func (kq *KeyedPriorityQueue) Drop() error {
+	if err := kq.Close(); err != nil {
+		return err
+	}
+
+	return os.RemoveAll(kq.DataDir)
+}
+
+// getNextItem returns the most important item in the keyed priority
+// queue. The queue must be locked by the caller.
+func (kq *KeyedPriorityQueue) getNextItem() (*KeyedPriorityItem, error) {
+	iter := kq.db.NewIterator(util.BytesPrefix(keyedItemPrefix), nil)
+	defer iter.Release()
+
+	var ok bool
+	if kq.order == ASC {
+		ok = iter.First()
+	} else if ok = iter.Last(); ok {
+		// The last key holds the highest priority, but the newest item
+		// with it, so seek back to the oldest item with that priority.
+		priority, _ := parseKeyedPriorityKey(iter.Key())
+		ok = iter.Seek(generateKeyedPriorityKey(priority, 0))
+	}
+	if !ok {
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		return nil, ErrEmpty
+	}
+
+	return kq.itemAt(iter)
+}
+
+// itemAt returns the item the given iterator is positioned at.
+func (kq *KeyedPriorityQueue) itemAt(iter iterator.Iterator) (*KeyedPriorityItem, error) {
+	key := append([]byte(nil), iter.Key()...)
+	priority, id := parseKeyedPriorityKey(key)
+
+	rec, err := kq.format.decode(iter.Value())
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyedPriorityItem{
+		ID:       id,
+		Priority: priority,
+		Key:      key,
+		Value:    rec.value,
+		codec:    kq.codec,
+	}, nil
+}
+
+// init initializes the keyed priority queue data.
+func (kq *KeyedPriorityQueue) init() error {
+	val, err := kq.db.Get(keyedStateKey, nil)
+	if err == errors.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	kq.seq = binary.BigEndian.Uint64(val[:8])
+	kq.length = binary.BigEndian.Uint64(val[8:])
+	return nil
+}
+
+// keyedState encodes the sequence number and length of a keyed
+// priority queue.
+func keyedState(seq, length uint64) []byte {
+	return appendUint64(appendUint64(nil, seq), length)
+}
+
+// generateKeyedPriorityKey creates the key of the item with the given
+// priority key and sequence number. Each zero byte of the priority is
+// escaped as 0x00 0xff and the priority is terminated by 0x00 0x01, so
+// keys sort by priority byte by byte, and then by sequence number.
+func generateKeyedPriorityKey(priority []byte, id uint64) []byte {
+	// prefix + priority + terminator + id = 2 + n + 2 + 8
+	key := make([]byte, 0, len(keyedItemPrefix)+len(priority)+12)
+	key = append(key, keyedItemPrefix...)
+	for _, c := range priority {
+		key = append(key, c)
+		if c == 0x00 {
+			key = append(key, 0xff)
+		}
+	}
+	key = append(key, 0x00, 0x01)
+	return append(key, idToKey(id)...)
+}
+
+// parseKeyedPriorityKey returns the priority key and sequence number
+// of the given item key.
+func parseKeyedPriorityKey(key []byte) ([]byte, uint64) {
+	key = key[len(keyedItemPrefix):]
+
+	priority := make([]byte, 0, len(key))
+	for i := 0; i < len(key)-1; i++ {
+		if key[i] == 0x00 {
+			if key[i+1] == 0x01 {
+				return priority, keyToID(key[i+2:])
+			}
+
+			// Skip the escape following a zero byte.
+			i++
+			priority = append(priority, 0x00)
+			continue
+		}
+		priority = append(priority, key[i])
+	}
+	return priority, 0
+}
+
+// KeyedPriorityItem represents an entry in a keyed priority queue. ID
+// is the sequence number of the item, which orders items holding the
+// same priority key.
+type KeyedPriorityItem struct {
+	ID       uint64
+	Priority []byte
+	Key      []byte
+	Value    []byte
+
+	codec Codec
+}
+
+// PriorityUint64 returns the priority of an item added using
+// EnqueueUint64, or zero if its priority key is not 8 bytes long.
+func (ki *KeyedPriorityItem) PriorityUint64() uint64 {
+	if len(ki.Priority) != 8 {
+		return 0
+	}
+	return keyToID(ki.Priority)
+}
+
+// ToString returns the keyed priority item value as a string.
+func (ki *KeyedPriorityItem) ToString() string {
+	return string(ki.Value)
+}
+
+// ToObject decodes the item value into the given value type using the
+// codec of the keyed priority queue the item came from, which is
+// encoding/gob by default.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (ki *KeyedPriorityItem) ToObject(value interface{}) error {
+	if ki.codec == nil {
+		return GobCodec.Decode(ki.Value, value)
+	}
+	return ki.codec.Decode(ki.Value, value)
+}
+
+// ToObjectFromJSON decodes the item value into the given value type
+// using encoding/json.
+//
+// The value passed to this method should be a pointer to a variable
+// of the type you wish to decode into. The variable pointed to will
+// hold the decoded object.
+func (ki *KeyedPriorityItem) ToObjectFromJSON(value interface{}) error {
+	return json.Unmarshal(ki.Value, value)
+}
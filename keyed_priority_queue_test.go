@@ -0,0 +1,197 @@
+package goque
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKeyedPriorityQueueAsc(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	kq, err := OpenKeyedPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kq.Drop()
+
+	// Priorities beyond 256 levels, with ties.
+	priorities := []uint64{1700000000300, 1700000000100, 1700000000200, 1700000000100, 5}
+	for i, p := range priorities {
+		if _, err = kq.EnqueueUint64(p, []byte(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if kq.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", kq.Length())
+	}
+
+	item, err := kq.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.PriorityUint64() != 5 {
+		t.Errorf("Expected peeked priority to be 5, got %d", item.PriorityUint64())
+	}
+
+	// Items with the same priority are dequeued in FIFO order.
+	for _, i := range []int{4, 1, 3, 2, 0} {
+		item, err := kq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+		if item.PriorityUint64() != priorities[i] {
+			t.Errorf("Expected priority to be %d, got %d", priorities[i], item.PriorityUint64())
+		}
+	}
+
+	if _, err = kq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestKeyedPriorityQueueDesc(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	kq, err := OpenKeyedPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kq.Drop()
+
+	// Byte keys, including zero bytes and keys prefixing others.
+	priorities := [][]byte{[]byte("b"), []byte("a\x00"), []byte("b"), []byte("a"), []byte("ab"), []byte("b")}
+	for i, p := range priorities {
+		if _, err = kq.EnqueueString(p, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, i := range []int{0, 2, 5, 4, 1, 3} {
+		item, err := kq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+		if string(item.Priority) != string(priorities[i]) {
+			t.Errorf("Expected priority to be %q, got %q", priorities[i], item.Priority)
+		}
+	}
+
+	if kq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", kq.Length())
+	}
+}
+
+func TestKeyedPriorityQueuePrefixKeys(t *testing.T) {
+	// Keys prefixing others sort first, so they are dequeued first in
+	// ASC order and last in DESC order.
+	priorities := [][]byte{[]byte("abc"), []byte("a"), []byte("ab")}
+	for _, tc := range []struct {
+		order order
+		want  []string
+	}{
+		{ASC, []string{"a", "ab", "abc"}},
+		{DESC, []string{"abc", "ab", "a"}},
+	} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		kq, err := OpenKeyedPriorityQueue(file, tc.order)
+		if err != nil {
+			t.Error(err)
+		}
+
+		for _, p := range priorities {
+			if _, err = kq.EnqueueString(p, "value"); err != nil {
+				t.Error(err)
+			}
+		}
+
+		for _, want := range tc.want {
+			item, err := kq.Dequeue()
+			if err != nil {
+				t.Error(err)
+				continue
+			}
+			if string(item.Priority) != want {
+				t.Errorf("Expected priority to be %q, got %q", want, item.Priority)
+			}
+		}
+
+		kq.Drop()
+	}
+}
+
+func TestKeyedPriorityQueueReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	kq, err := OpenKeyedPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer kq.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = kq.EnqueueUint64(7, []byte(fmt.Sprintf("value for item %d", i))); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = kq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	kq.Close()
+	kq, err = OpenKeyedPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if kq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", kq.Length())
+	}
+
+	// New items keep following the old ones with the same priority.
+	item, err := kq.EnqueueUint64(7, []byte("value for item 4"))
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ID != 4 {
+		t.Errorf("Expected ID to be 4, got %d", item.ID)
+	}
+
+	for i := 2; i <= 4; i++ {
+		item, err := kq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestKeyedPriorityQueueIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+	pq.Close()
+
+	if _, err = OpenKeyedPriorityQueue(file, ASC); !errors.Is(err, ErrIncompatibleType) {
+		t.Errorf("Expected to get incompatible type error, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package goque
+
+import (
+	"context"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// The delays between attempts to open a locked database, doubling from
+// the minimum up to the maximum.
+const (
+	minLockRetryDelay = 10 * time.Millisecond
+	maxLockRetryDelay = time.Second
+)
+
+// openDB opens the LevelDB database in the given directory using the
+// given LevelDB options, which may be nil. If the database is locked by
+// another process, opening is retried with backoff until the context is
+// done. A context which can never be done, such as context.Background,
+// fails right away like leveldb.OpenFile.
+func openDB(ctx context.Context, dataDir string, o *opt.Options) (*leveldb.DB, error) {
+	delay := minLockRetryDelay
+	for {
+		db, err := leveldb.OpenFile(dataDir, o)
+		if err == nil || ctx.Done() == nil || !isLockError(err) {
+			return db, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		case <-timer.C:
+		}
+
+		if delay *= 2; delay > maxLockRetryDelay {
+			delay = maxLockRetryDelay
+		}
+	}
+}
+
+// isLockError returns whether the given error from opening a LevelDB
+// database means the database is locked by someone else.
+func isLockError(err error) bool {
+	return err == storage.ErrLocked || isFileLockError(err)
+}
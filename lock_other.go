@@ -0,0 +1,14 @@
+//go:build !windows && !plan9
+
+package goque
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isFileLockError returns whether the given error is from failing to
+// lock a file held by another process.
+func isFileLockError(err error) bool {
+	return errors.Is(err, syscall.EWOULDBLOCK) || errors.Is(err, syscall.EAGAIN)
+}
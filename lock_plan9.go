@@ -0,0 +1,12 @@
+//go:build plan9
+
+package goque
+
+import "strings"
+
+// isFileLockError returns whether the given error is from failing to
+// lock a file held by another process. Plan 9 reports exclusive use
+// files that are already open as a plain error string.
+func isFileLockError(err error) bool {
+	return strings.Contains(err.Error(), "exclusive use file already open")
+}
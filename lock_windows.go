@@ -0,0 +1,18 @@
+//go:build windows
+
+package goque
+
+import (
+	"errors"
+	"syscall"
+)
+
+// errorSharingViolation is the ERROR_SHARING_VIOLATION error, returned
+// when opening a file held open by another process.
+const errorSharingViolation syscall.Errno = 32
+
+// isFileLockError returns whether the given error is from failing to
+// lock a file held by another process.
+func isFileLockError(err error) bool {
+	return errors.Is(err, errorSharingViolation)
+}
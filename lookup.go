@@ -0,0 +1,237 @@
+package goque
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// GetByIDs returns the items with the given IDs without removing them,
+// reading all of them from a single LevelDB snapshot. The returned
+// slice is in the same order as ids and has the same length, holding
+// nil for each ID which does not match an item in the queue, such as
+// one already dequeued. As for PeekByID, items which have expired or
+// are not visible yet are returned as well.
+func (q *Queue) GetByIDs(ids []uint64) ([]*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return getByIDs(q.db, q.format, q.codec, ids, func(id uint64) bool {
+		return id > q.head && id <= q.tail
+	})
+}
+
+// GetByIDs returns the items with the given IDs without removing them,
+// reading all of them from a single LevelDB snapshot. The returned
+// slice is in the same order as ids and has the same length, holding
+// nil for each ID which does not match an item in the stack.
+func (s *Stack) GetByIDs(ids []uint64) ([]*Item, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return getByIDs(s.db, s.format, s.codec, ids, func(id uint64) bool {
+		return id > s.tail && id <= s.head
+	})
+}
+
+// Range returns the items with IDs from startID through endID without
+// removing them, in order of their IDs, which is the order they would
+// be dequeued in, reading them from a single LevelDB snapshot. IDs in
+// the range which do not match an item, such as those of items already
+// dequeued, are skipped, so fewer items than the size of the range may
+// be returned. As for PeekByID, items which have expired or are not
+// visible yet are returned as well.
+func (q *Queue) Range(startID, endID uint64) ([]*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return rangeIDs(q.db, q.format, q.codec, startID, endID, q.head+1, q.tail)
+}
+
+// RangeByTime returns the items in the queue enqueued at or after from
+// and before to, in dequeue order, without removing them, reading them
+// from a single LevelDB snapshot. Items without an enqueue time, which
+// were added by versions of goque which did not record it, are never
+// included. As for PeekByID, items which have expired or are not
+// visible yet are returned as well.
+//
+// Items added to the front of the queue, such as by RequeueFront or by
+// a visibility timeout passing, keep the time they were first enqueued
+// at, so enqueue times do not always increase with IDs. RangeByTime
+// therefore walks every item of the queue, costing O(n) reads and
+// decodes for a queue of n items.
+func (q *Queue) RangeByTime(from, to time.Time) ([]*Item, error) {
+	q.RLock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return nil, ErrDBClosed
+	}
+
+	codec, format := q.codec, q.format
+	si := newSnapshotIterator(q.db, []*util.Range{{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}}, false)
+	q.RUnlock()
+	defer si.release()
+
+	items := []*Item{}
+	for si.next() {
+		rec, err := format.decode(si.value())
+		if err != nil {
+			return nil, err
+		}
+
+		if rec.enqueuedAt.IsZero() || rec.enqueuedAt.Before(from) || !rec.enqueuedAt.Before(to) {
+			continue
+		}
+		items = append(items, newItem(keyToID(si.key()), rec, codec))
+	}
+	if si.err != nil {
+		return nil, si.err
+	}
+
+	return items, nil
+}
+
+// Range returns the items with IDs from startID through endID without
+// removing them, in order of their IDs, which is from the bottom of the
+// stack upwards, reading them from a single LevelDB snapshot. IDs in
+// the range which do not match an item are skipped.
+func (s *Stack) Range(startID, endID uint64) ([]*Item, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return rangeIDs(s.db, s.format, s.codec, startID, endID, s.tail+1, s.head)
+}
+
+// FindByValue returns the first item in the queue, from the head,
+// whose value equals the given value, or ErrNotFound if none does. The
+// values compared are those returned in Item.Value, so compressed or
+// encrypted items are found by their original value. As for PeekByID,
+// items which have expired or are not visible yet are found as well.
+//
+// FindByValue walks the items in order, one at a time, from a single
+// LevelDB snapshot, so it costs O(n) reads and decodes for a queue of
+// n items. It is meant for debugging and tooling rather than hot paths.
+func (q *Queue) FindByValue(value []byte) (*Item, error) {
+	q.RLock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return nil, ErrDBClosed
+	}
+
+	codec, format := q.codec, q.format
+	si := newSnapshotIterator(q.db, []*util.Range{{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}}, false)
+	q.RUnlock()
+	defer si.release()
+
+	for si.next() {
+		rec, err := format.decode(si.value())
+		if err != nil {
+			return nil, err
+		}
+
+		item := newItem(keyToID(si.key()), rec, codec)
+		if bytes.Equal(item.Value, value) {
+			return item, nil
+		}
+	}
+	if si.err != nil {
+		return nil, si.err
+	}
+
+	return nil, ErrNotFound
+}
+
+// rangeIDs reads the items with IDs from start through end, limited to
+// the IDs from first through last, from a snapshot of the database.
+func rangeIDs(db database, format recordFormat, codec Codec, start, end, first, last uint64) ([]*Item, error) {
+	if start < first {
+		start = first
+	}
+	if end > last {
+		end = last
+	}
+
+	items := []*Item{}
+	if start > end {
+		return items, nil
+	}
+
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	iter := snap.NewIterator(&util.Range{Start: idToKey(start), Limit: idToKey(end + 1)}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		value := append([]byte(nil), iter.Value()...)
+		rec, err := format.decode(value)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, newItem(keyToID(iter.Key()), rec, codec))
+	}
+
+	return items, iter.Error()
+}
+
+// getByIDs reads the items with the given IDs from a snapshot of the
+// database, leaving nil for each ID which is outside the bounds given
+// by inRange or is not stored.
+func getByIDs(db database, format recordFormat, codec Codec, ids []uint64, inRange func(uint64) bool) ([]*Item, error) {
+	snap, err := db.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	items := make([]*Item, len(ids))
+	for i, id := range ids {
+		if !inRange(id) {
+			continue
+		}
+
+		value, err := snap.Get(idToKey(id), nil)
+		if err == leveldb.ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		rec, err := format.decode(value)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = newItem(id, rec, codec)
+	}
+
+	return items, nil
+}
@@ -0,0 +1,268 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueGetByIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if err = q.DeleteByID(3); err != nil {
+		t.Error(err)
+	}
+
+	items, err := q.GetByIDs([]uint64{4, 1, 3, 2, 9})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 5 {
+		t.Errorf("Expected 5 items, got %d", len(items))
+	}
+
+	expected := []string{"value for item 4", "", "", "value for item 2", ""}
+	for i, compStr := range expected {
+		if compStr == "" {
+			if items[i] != nil {
+				t.Errorf("Expected item %d to be nil, got '%s'", i, items[i].ToString())
+			}
+			continue
+		}
+
+		if items[i] == nil || items[i].ToString() != compStr {
+			t.Errorf("Expected item %d to be '%s', got %+v", i, compStr, items[i])
+		}
+	}
+}
+
+func TestStackGetByIDs(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	items, err := s.GetByIDs([]uint64{3, 2, 1})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 3 || items[0] != nil {
+		t.Errorf("Expected 3 items with the first nil, got %v", items)
+	}
+
+	for i, compStr := range []string{"value for item 2", "value for item 1"} {
+		if items[i+1] == nil || items[i+1].ToString() != compStr {
+			t.Errorf("Expected item %d to be '%s', got %+v", i+1, compStr, items[i+1])
+		}
+	}
+}
+
+func TestQueueRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 6; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if err = q.DeleteByID(3); err != nil {
+		t.Error(err)
+	}
+
+	items, err := q.Range(1, 5)
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := []uint64{2, 4, 5}
+	if len(items) != len(expected) {
+		t.Errorf("Expected %d items, got %d", len(expected), len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", expected[i])
+		if item.ID != expected[i] || item.ToString() != compStr {
+			t.Errorf("Expected item %d to be '%s', got '%s'", expected[i], compStr, item.ToString())
+		}
+	}
+
+	// The end of the range may be past the tail, but an empty range
+	// holds no items.
+	items, err = q.Range(6, 100)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 || items[0].ID != 6 {
+		t.Errorf("Expected only item 6, got %v", items)
+	}
+
+	items, err = q.Range(5, 4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 0 {
+		t.Errorf("Expected no items, got %d", len(items))
+	}
+}
+
+func TestStackRange(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 4; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	items, err := s.Range(2, 4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 {
+		t.Errorf("Expected 2 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", i+2)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestQueueFindByValue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i%3)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The first of several matching items is returned.
+	item, err := q.FindByValue([]byte("value for item 2"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 2 {
+		t.Errorf("Expected ID to be 2, got %d", item.ID)
+	}
+
+	if _, err = q.FindByValue([]byte("value for item 3")); err != ErrNotFound {
+		t.Errorf("Expected to get not found error, got %v", err)
+	}
+}
+
+func TestQueueRangeByTime(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// An item stored without an enqueue time is never included.
+	if err = q.db.Put(idToKey(1), []byte("value for item 1"), nil); err != nil {
+		t.Error(err)
+	}
+	q.tail = 1
+
+	start := time.Now()
+	for i := 2; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	middle := time.Now()
+	if _, err = q.EnqueueString("value for item 4"); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.PeekByID(1)
+	if err != nil {
+		t.Error(err)
+	}
+	if !item.EnqueuedAt.IsZero() {
+		t.Errorf("Expected zero enqueue time, got %v", item.EnqueuedAt)
+	}
+
+	items, err := q.RangeByTime(time.Time{}, middle)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 || items[0].ID != 2 || items[1].ID != 3 {
+		t.Errorf("Expected items 2 and 3, got %v", items)
+	}
+
+	for _, item := range items {
+		if item.EnqueuedAt.Before(start) {
+			t.Errorf("Expected enqueue time after %v, got %v", start, item.EnqueuedAt)
+		}
+	}
+
+	items, err = q.RangeByTime(middle, time.Now().Add(time.Second))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 1 || items[0].ID != 4 {
+		t.Errorf("Expected item 4, got %v", items)
+	}
+}
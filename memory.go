@@ -0,0 +1,46 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+)
+
+// OpenQueueMemory opens a new, empty queue which keeps its whole
+// LevelDB database in memory rather than on disk, for tests and
+// short-lived processes. It has the same API as a queue opened using
+// OpenQueue, but its DataDir is empty, its DiskSize is always zero, and
+// its items are lost once it is closed or dropped, which frees the
+// memory holding them.
+func OpenQueueMemory() (*Queue, error) {
+	// Create a new Queue.
+	q := newQueue("", nil, false)
+	q.mem = storage.NewMemStorage()
+
+	// Open database for the queue.
+	db, err := leveldb.Open(q.mem, nil)
+	if err != nil {
+		return q, err
+	}
+	q.db = levelDB{db}
+
+	// Set isOpen and return.
+	q.isOpen = true
+	return q, q.init()
+}
+
+// dropStorage removes every file from the given in-memory storage and
+// closes it, so the memory holding them can be freed.
+func dropStorage(s storage.Storage) error {
+	fds, err := s.List(storage.TypeAll)
+	if err != nil {
+		return err
+	}
+
+	for _, fd := range fds {
+		if err := s.Remove(fd); err != nil {
+			return err
+		}
+	}
+
+	return s.Close()
+}
@@ -0,0 +1,89 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestQueueMemory(t *testing.T) {
+	q, err := OpenQueueMemory()
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	size, err := q.DiskSize()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if size != 0 {
+		t.Errorf("Expected disk size of 0, got %d", size)
+	}
+
+	// Separate in-memory queues do not share their items.
+	other, err := OpenQueueMemory()
+	if err != nil {
+		t.Error(err)
+	}
+	defer other.Drop()
+
+	if other.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", other.Length())
+	}
+
+	if _, err = Move(q, other); err != nil {
+		t.Error(err)
+	}
+	if _, err = Move(other, q); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 9 || other.Length() != 0 {
+		t.Errorf("Expected queue lengths of 9 and 0, got %d and %d", q.Length(), other.Length())
+	}
+}
+
+func TestQueueMemoryClose(t *testing.T) {
+	q, err := OpenQueueMemory()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+
+	if err = q.Drop(); err != nil {
+		t.Error(err)
+	}
+}
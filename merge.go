@@ -0,0 +1,276 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// mergeBatchSize is the number of items Merge moves using each write.
+const mergeBatchSize = 1000
+
+// Merge moves every item of the src queue to the tail of the dst queue,
+// keeping their order, and returns the number of items moved, leaving
+// src empty, such as to consolidate shards. Items which have expired
+// are removed from src rather than moved, while items which are not
+// visible yet are moved keeping their visibility time. Items in flight
+// in src stay there to be acknowledged.
+//
+// Items are moved in batches of up to 1000, as for Move: each batch is
+// first written to dst along with a recovery marker, then removed from
+// src, and finally the marker is removed. If the process stops before a
+// batch is removed from src, the next Merge, Move or MoveItem between
+// the same queues finishes removing it, so Merge can be called again to
+// resume. If an error occurs, the number of items moved so far is
+// returned along with it. If the positions of src have drifted from
+// its stored items, they are derived again using Rebuild along the way.
+//
+// Both queues must use the same codec, or ErrIncompatibleCodec is
+// returned, and ErrFull is returned if dst does not have room for every
+// item of src. Merging a queue into itself does nothing.
+func Merge(dst, src *Queue) (int, error) {
+	if src == dst {
+		return 0, nil
+	}
+
+	unlock := lockQueues(src, dst)
+	defer unlock()
+
+	// Check if either queue is closed.
+	if !src.isOpen || !dst.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	// Check if either queue is read-only.
+	if src.readOnly || dst.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	// Check if the queues hold compatible values.
+	if src.codec.ID() != dst.codec.ID() {
+		return 0, ErrIncompatibleCodec
+	}
+
+	// Finish any move between these queues that was interrupted.
+	if err := recoverMove(src, dst); err != nil {
+		return 0, err
+	}
+
+	// Check if dst has room for every item.
+	if dst.maxLength > 0 && dst.Length()+src.Length() > dst.maxLength {
+		return 0, ErrFull
+	}
+
+	moved := 0
+	rebuilt := false
+	for src.Length() > 0 {
+		length := src.Length()
+		n, err := mergeBatch(dst, src)
+		moved += n
+		if err != nil {
+			return moved, err
+		}
+
+		// A batch removing nothing means the positions of src have
+		// drifted from its stored items, so derive them again once,
+		// rather than trying the same batch forever.
+		if src.Length() == length {
+			if rebuilt {
+				break
+			}
+			if err := src.rebuild(); err != nil {
+				return moved, err
+			}
+			rebuilt = true
+		}
+	}
+
+	return moved, nil
+}
+
+// mergeBatch moves up to mergeBatchSize items from the head of src to
+// the tail of dst, returning the number of items moved. Both queues
+// must be locked by the caller.
+func mergeBatch(dst, src *Queue) (int, error) {
+	iter := src.db.NewIterator(&util.Range{Start: idToKey(src.head + 1), Limit: idToKey(src.tail + 1)}, nil)
+	defer iter.Release()
+
+	// Add the next items of src to dst, stamped with their new IDs.
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	tail := dst.tail
+	var items []*Item
+	var first, last uint64
+	for n := 0; n < mergeBatchSize && iter.Next(); n++ {
+		id := keyToID(iter.Key())
+		if n == 0 {
+			first = id
+		}
+		last = id
+
+		rec, err := src.format.decode(append([]byte(nil), iter.Value()...))
+		if err != nil {
+			return 0, err
+		}
+		if newItem(id, rec, src.codec).expired(now) {
+			continue
+		}
+
+		// The deduplication key of the item stays behind in src, while
+		// the chunks of a streamed value are copied to dst.
+		rec.uniqueKey = nil
+		if rec.chunks != nil {
+			if rec.chunks, err = dst.copyChunks(batch, rec.chunks); err != nil {
+				return 0, err
+			}
+		}
+		item := newItem(tail+1, rec, dst.codec)
+
+		// Store the value using the format of dst, which may compress
+		// or encrypt it differently.
+		b, err := dst.format.encode(rec)
+		if err != nil {
+			return 0, err
+		}
+		batch.Put(item.Key, b)
+		dst.indexItem(batch, item)
+
+		tail++
+		items = append(items, item)
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	// Write the items to dst along with a recovery marker holding the
+	// range of IDs to remove from src.
+	if keepsMoveMarker(src) {
+		batch.Put(moveMarkerKey(src), appendUint64(appendUint64(nil, first), last))
+	}
+	if err := dst.db.Write(batch, dst.writeOpts); err != nil {
+		return 0, err
+	}
+
+	dst.tail = tail
+	dst.enqueued += uint64(len(items))
+	dst.added(items...)
+	dst.notifyWaiters()
+
+	// Remove the items from src.
+	if _, err := src.removeRange(first, last); err != nil {
+		return len(items), err
+	}
+
+	// Remove the recovery marker.
+	if keepsMoveMarker(src) {
+		if err := dst.db.Delete(moveMarkerKey(src), dst.writeOpts); err != nil {
+			return len(items), err
+		}
+	}
+
+	return len(items), nil
+}
+
+// removeRange removes the stored items with IDs from first through last
+// from the queue using a single write, counting those which had not
+// expired as dequeued, and returns the number of items removed. The
+// queue must be locked by the caller.
+func (q *Queue) removeRange(first, last uint64) (int, error) {
+	if first <= q.head {
+		first = q.head + 1
+	}
+	if last > q.tail {
+		last = q.tail
+	}
+	if first > last {
+		return 0, nil
+	}
+
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(first), Limit: idToKey(last + 1)}, nil)
+	defer iter.Release()
+
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	var removed []*Item
+	var n uint64
+	for iter.Next() {
+		rec, err := q.format.decode(append([]byte(nil), iter.Value()...))
+		if err != nil {
+			return 0, err
+		}
+		item := newItem(keyToID(iter.Key()), rec, q.codec)
+
+		batch.Delete(item.Key)
+		q.unindexItem(batch, item)
+		dropChunks(batch, item.chunks)
+		if err := q.dropUniqueKey(batch, item.ID, item.uniqueKey); err != nil {
+			return 0, err
+		}
+		item.uniqueKey = nil
+
+		if !item.expired(now) {
+			removed = append(removed, item)
+		}
+		n++
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	// Move the head and tail in past the removed items, to the nearest
+	// items left, which are always stored.
+	head, tail, holes := q.tail, q.tail, uint64(0)
+	if remaining := q.Length() - n; remaining > 0 {
+		head, tail = q.head, q.tail
+		if first == q.head+1 {
+			next, err := q.nearestID(last+1, false)
+			if err != nil {
+				return 0, err
+			}
+			head = next - 1
+		}
+		if last == q.tail {
+			prev, err := q.nearestID(first-1, true)
+			if err != nil {
+				return 0, err
+			}
+			tail = prev
+		}
+		holes = tail - head - remaining
+	}
+
+	if err := q.writeState(batch, head, tail, holes); err != nil {
+		return 0, err
+	}
+	q.dequeued += uint64(len(removed))
+	q.hooks.dequeued(removed...)
+
+	return int(n), nil
+}
+
+// nearestID returns the ID of the first stored item at or after the
+// given ID, or with reverse set, at or before it. Such an item must
+// exist. The queue must be locked by the caller.
+func (q *Queue) nearestID(id uint64, reverse bool) (uint64, error) {
+	r := &util.Range{Start: idToKey(id), Limit: itemRange.Limit}
+	if reverse {
+		r = &util.Range{Limit: idToKey(id + 1)}
+	}
+
+	iter := q.db.NewIterator(r, nil)
+	defer iter.Release()
+
+	ok := iter.First()
+	if reverse {
+		ok = iter.Last()
+	}
+	if !ok {
+		if err := iter.Error(); err != nil {
+			return 0, err
+		}
+		return 0, ErrOutOfBounds
+	}
+
+	return keyToID(iter.Key()), nil
+}
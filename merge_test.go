@@ -0,0 +1,170 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	file1 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(file1)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	file2 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file2)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	if _, err = dst.EnqueueString("value for item 0"); err != nil {
+		t.Error(err)
+	}
+
+	// Move more items than fit in a single batch.
+	values := make([][]byte, 1500)
+	for i := range values {
+		values[i] = []byte(fmt.Sprintf("value for item %d", i+1))
+	}
+	if _, err = src.EnqueueBatch(values); err != nil {
+		t.Error(err)
+	}
+
+	n, err := Merge(dst, src)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 1500 {
+		t.Errorf("Expected 1500 items to be moved, got %d", n)
+	}
+
+	if src.Length() != 0 {
+		t.Errorf("Expected src length of 0, got %d", src.Length())
+	}
+
+	if dst.Length() != 1501 {
+		t.Errorf("Expected dst length of 1501, got %d", dst.Length())
+	}
+
+	for i := 0; i <= 1500; i++ {
+		item, err := dst.Dequeue()
+		if err != nil {
+			t.Error(err)
+			break
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+			break
+		}
+	}
+}
+
+func TestMergeRecover(t *testing.T) {
+	file1 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(file1)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	file2 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file2)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = src.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Leave items 1 through 3 in both queues, as if a merge stopped
+	// before removing them from src.
+	for i := 1; i <= 3; i++ {
+		if _, err = dst.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = dst.db.Put(moveMarkerKey(src), appendUint64(appendUint64(nil, 1), 3), nil); err != nil {
+		t.Error(err)
+	}
+
+	n, err := Merge(dst, src)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 2 {
+		t.Errorf("Expected 2 items to be moved, got %d", n)
+	}
+
+	if src.Length() != 0 || dst.Length() != 5 {
+		t.Errorf("Expected lengths of 0 and 5, got %d and %d", src.Length(), dst.Length())
+	}
+
+	item, err := dst.PeekTail()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 5"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestMergeDrift(t *testing.T) {
+	file1 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(file1)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	file2 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file2)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = src.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Remove the items behind the back of the queue, so its length no
+	// longer matches the stored items.
+	for id := uint64(1); id <= 3; id++ {
+		if err = src.db.Delete(idToKey(id), nil); err != nil {
+			t.Error(err)
+		}
+	}
+
+	moved, err := Merge(dst, src)
+	if err != nil {
+		t.Error(err)
+	}
+	if moved != 0 {
+		t.Errorf("Expected no items to be moved, got %d", moved)
+	}
+
+	if src.Length() != 0 {
+		t.Errorf("Expected source queue length of 0, got %d", src.Length())
+	}
+	if dst.Length() != 0 {
+		t.Errorf("Expected destination queue length of 0, got %d", dst.Length())
+	}
+}
@@ -0,0 +1,38 @@
+package goque
+
+// EnqueueWithMeta adds an item to the queue along with the given
+// metadata, such as a content type or trace ID, which is stored with
+// the value and returned in the Meta field of the item whenever it is
+// read. The metadata is copied, so the map can be reused by the caller.
+func (q *Queue) EnqueueWithMeta(value []byte, meta map[string]string) (*Item, error) {
+	q.Lock()
+	defer q.unlock()
+
+	return q.enqueue(&record{value: value, meta: copyMeta(meta)})
+}
+
+// UpdateWithMeta updates an item in the queue without changing its
+// position, replacing both its value and its metadata. A nil or empty
+// meta removes the metadata of the item. Update and its helpers keep
+// the metadata of the item as it is.
+func (q *Queue) UpdateWithMeta(id uint64, newValue []byte, meta map[string]string) (*Item, error) {
+	_, item, err := q.update(id, func(item *Item) error {
+		item.Value = newValue
+		item.Meta = copyMeta(meta)
+		return nil
+	})
+	return item, err
+}
+
+// copyMeta returns a copy of the given metadata, or nil if it is empty.
+func copyMeta(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(meta))
+	for k, v := range meta {
+		c[k] = v
+	}
+	return c
+}
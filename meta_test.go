@@ -0,0 +1,113 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueEnqueueWithMeta(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	meta := map[string]string{"content-type": "text/plain", "trace-id": "abc"}
+	if _, err = q.EnqueueWithMeta([]byte("value for item 1"), meta); err != nil {
+		t.Error(err)
+	}
+	if _, err = q.EnqueueString("value for item 2"); err != nil {
+		t.Error(err)
+	}
+
+	// Changing the map afterwards does not change the item.
+	meta["trace-id"] = "def"
+
+	// The metadata is kept when the queue is reopened.
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "value for item 1" {
+		t.Errorf("Expected string to be 'value for item 1', got '%s'", item.ToString())
+	}
+
+	if len(item.Meta) != 2 || item.Meta["content-type"] != "text/plain" || item.Meta["trace-id"] != "abc" {
+		t.Errorf("Expected metadata of item to be kept, got %v", item.Meta)
+	}
+
+	item, err = q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(item.Meta) != 0 {
+		t.Errorf("Expected item without metadata to have empty metadata, got %v", item.Meta)
+	}
+}
+
+func TestQueueUpdateWithMeta(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueWithMeta([]byte("value for item 1"), map[string]string{"a": "1"}); err != nil {
+		t.Error(err)
+	}
+
+	// Update keeps the metadata.
+	if _, err = q.UpdateString(1, "new value"); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.PeekByID(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "new value" || item.Meta["a"] != "1" {
+		t.Errorf("Expected updated value with kept metadata, got '%s' and %v", item.ToString(), item.Meta)
+	}
+
+	// UpdateWithMeta replaces it.
+	if _, err = q.UpdateWithMeta(1, []byte("newer value"), map[string]string{"b": "2"}); err != nil {
+		t.Error(err)
+	}
+
+	item, err = q.PeekByID(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "newer value" || len(item.Meta) != 1 || item.Meta["b"] != "2" {
+		t.Errorf("Expected updated value with replaced metadata, got '%s' and %v", item.ToString(), item.Meta)
+	}
+
+	// A nil map removes it.
+	if _, err = q.UpdateWithMeta(1, []byte("newest value"), nil); err != nil {
+		t.Error(err)
+	}
+
+	item, err = q.PeekByID(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(item.Meta) != 0 {
+		t.Errorf("Expected metadata to be removed, got %v", item.Meta)
+	}
+}
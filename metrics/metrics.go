@@ -0,0 +1,113 @@
+// Package metrics exports the stats of goque structures as Prometheus
+// metrics.
+//
+// It is a separate module, so programs using goque without Prometheus
+// do not depend on the Prometheus client.
+package metrics
+
+import (
+	"sync"
+
+	"github.com/beeker1121/goque"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Source is a structure whose stats can be collected, such as a
+// *goque.Queue, *goque.Stack, *goque.PriorityQueue or
+// *goque.PrefixQueue.
+type Source interface {
+	Stats() goque.Stats
+}
+
+// Collector is a prometheus.Collector exporting the length, the total
+// number of items enqueued and dequeued, and the disk size of each
+// registered structure, labelled with the name it was registered with.
+//
+// The metrics are taken from the Stats method of each structure when
+// collected, which only holds a read lock on the structure. The totals
+// count the items added and removed since the structure was opened, so
+// they start from zero again when it is reopened.
+type Collector struct {
+	sync.Mutex
+	sources map[string]Source
+
+	length   *prometheus.Desc
+	enqueued *prometheus.Desc
+	dequeued *prometheus.Desc
+	diskSize *prometheus.Desc
+}
+
+// NewCollector creates a new Collector without any structures. The
+// given namespace is used as the prefix of each metric name, such as
+// goque in goque_length.
+func NewCollector(namespace string) *Collector {
+	labels := []string{"name"}
+
+	return &Collector{
+		sources: make(map[string]Source),
+		length: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "length"),
+			"Number of items currently held.",
+			labels, nil,
+		),
+		enqueued: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "enqueued_total"),
+			"Number of items added since the structure was opened.",
+			labels, nil,
+		),
+		dequeued: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "dequeued_total"),
+			"Number of items removed since the structure was opened.",
+			labels, nil,
+		),
+		diskSize: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "disk_size_bytes"),
+			"Approximate size of the files within the data directory.",
+			labels, nil,
+		),
+	}
+}
+
+// Add registers the given structure with the collector under the given
+// name, replacing any structure already registered under it.
+func (c *Collector) Add(name string, s Source) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.sources[name] = s
+}
+
+// Remove unregisters the structure with the given name.
+func (c *Collector) Remove(name string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.sources, name)
+}
+
+// Describe sends the descriptions of the metrics of the collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.length
+	ch <- c.enqueued
+	ch <- c.dequeued
+	ch <- c.diskSize
+}
+
+// Collect sends the metrics of each registered structure.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	sources := make(map[string]Source, len(c.sources))
+	for name, s := range c.sources {
+		sources[name] = s
+	}
+	c.Unlock()
+
+	for name, s := range sources {
+		stats := s.Stats()
+
+		ch <- prometheus.MustNewConstMetric(c.length, prometheus.GaugeValue, float64(stats.Length), name)
+		ch <- prometheus.MustNewConstMetric(c.enqueued, prometheus.CounterValue, float64(stats.EnqueuedCount), name)
+		ch <- prometheus.MustNewConstMetric(c.dequeued, prometheus.CounterValue, float64(stats.DequeuedCount), name)
+		ch <- prometheus.MustNewConstMetric(c.diskSize, prometheus.GaugeValue, float64(stats.DiskSize), name)
+	}
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	file = fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := goque.OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if _, err = s.PushString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	c := NewCollector("goque")
+	c.Add("queue", q)
+	c.Add("stack", s)
+
+	reg := prometheus.NewPedanticRegistry()
+	if err = reg.Register(c); err != nil {
+		t.Error(err)
+	}
+
+	expected := `
+# HELP goque_dequeued_total Number of items removed since the structure was opened.
+# TYPE goque_dequeued_total counter
+goque_dequeued_total{name="queue"} 1
+goque_dequeued_total{name="stack"} 0
+# HELP goque_enqueued_total Number of items added since the structure was opened.
+# TYPE goque_enqueued_total counter
+goque_enqueued_total{name="queue"} 3
+goque_enqueued_total{name="stack"} 1
+# HELP goque_length Number of items currently held.
+# TYPE goque_length gauge
+goque_length{name="queue"} 2
+goque_length{name="stack"} 1
+`
+	err = testutil.GatherAndCompare(reg, strings.NewReader(expected), "goque_length", "goque_enqueued_total", "goque_dequeued_total")
+	if err != nil {
+		t.Error(err)
+	}
+
+	c.Remove("stack")
+
+	if n := testutil.CollectAndCount(c, "goque_length"); n != 1 {
+		t.Errorf("Expected 1 length metric, got %d", n)
+	}
+}
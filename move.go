@@ -0,0 +1,375 @@
+package goque
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Move removes the next item in the src queue and adds it to the tail
+// of the dst queue, returning the item as stored in dst.
+//
+// If both queues share the same database, including queues in the
+// namespaces of the same DB, the item is moved using a single LevelDB
+// write. Otherwise the item is first written to dst
+// along with a recovery marker, then removed from src, and finally the
+// marker is removed. If the process stops before the item is removed
+// from src, the next Move or MoveItem between the same queues finishes
+// removing it. Until then, the item can be found in both queues.
+//
+// ErrEmpty is returned if src is empty, and ErrFull if dst is full.
+func Move(src, dst *Queue) (*Item, error) {
+	return moveItem(src, dst, 0)
+}
+
+// Pipe removes the next item in the from queue and adds it to the tail
+// of the to queue like Move, for building processing stages out of
+// queues sharing a database, such as queues in the namespaces of the
+// same DB. The item is always moved using a single LevelDB write, so
+// across a crash it is never lost nor found in both queues.
+//
+// ErrEmpty is returned if from is empty, ErrFull if to is full, and
+// ErrDifferentDatabase if the queues do not share a database.
+func Pipe(from, to *Queue) (*Item, error) {
+	if !sharedDatabase(from.db, to.db) {
+		return nil, ErrDifferentDatabase
+	}
+
+	return moveItem(from, to, 0)
+}
+
+// MoveItem removes the item with the given ID from the src queue and
+// adds it to the tail of the dst queue, returning the item as stored in
+// dst. See Move for how the item is moved.
+//
+// ErrOutOfBounds is returned if src does not contain the item.
+func MoveItem(src, dst *Queue, id uint64) (*Item, error) {
+	if id == 0 {
+		return nil, ErrOutOfBounds
+	}
+
+	return moveItem(src, dst, id)
+}
+
+// moveItem moves the item with the given ID from src to dst. An ID of 0
+// moves the next live item in src.
+func moveItem(src, dst *Queue, id uint64) (*Item, error) {
+	unlock := lockQueues(src, dst)
+	defer unlock()
+
+	// Check if either queue is closed.
+	if !src.isOpen || !dst.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if either queue is read-only.
+	if src.readOnly || dst.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Check if dst is full.
+	if src != dst && dst.maxLength > 0 && dst.Length() >= dst.maxLength {
+		return nil, ErrFull
+	}
+
+	// Finish any move between these queues that was interrupted.
+	if err := recoverMove(src, dst); err != nil {
+		return nil, err
+	}
+
+	// Find the item to move.
+	if id == 0 {
+		next, err := src.nextLiveItem()
+		if err != nil {
+			return nil, err
+		}
+		id = next.ID
+	}
+
+	if id <= src.head || id > src.tail {
+		return nil, ErrOutOfBounds
+	}
+
+	// Get the stored value of the item, keeping any record fields.
+	value, err := src.db.Get(idToKey(id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrOutOfBounds
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Determine the state of src once the item is removed. When moving
+	// within a single queue, the tail stays in place since the item is
+	// added right after it.
+	head, tail, holes, err := src.removalState(id)
+	if err != nil {
+		return nil, err
+	}
+	if src == dst && id != src.head+1 {
+		tail, holes = src.tail, src.holes+1
+	}
+
+	// Create the new Item in dst.
+	dstTail := dst.tail
+	if src == dst {
+		dstTail = tail
+	}
+	rec, err := src.format.decode(value)
+	if err != nil {
+		return nil, err
+	}
+	// The deduplication key of the item stays behind in src.
+	removed := newItem(id, rec, src.codec)
+	uniqueKey := rec.uniqueKey
+	rec.uniqueKey = nil
+	item := newItem(dstTail+1, rec, dst.codec)
+
+	// Store the value using the format of dst, which may compress or
+	// encrypt it differently.
+	value, err = dst.format.encode(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Within a single database, move the item using one write, keeping
+	// the chunks of a streamed value in place.
+	if src.db == dst.db {
+		batch := new(leveldb.Batch)
+		batch.Delete(idToKey(id))
+		src.unindexItem(batch, removed)
+		batch.Put(item.Key, value)
+		dst.indexItem(batch, item)
+		if err := src.dropUniqueKey(batch, id, uniqueKey); err != nil {
+			return nil, err
+		}
+
+		if err := src.writeState(batch, head, tail, holes); err != nil {
+			return nil, err
+		}
+
+		dst.tail = item.ID
+		dst.enqueued++
+		src.dequeued++
+		src.hooks.dequeued(removed)
+		dst.added(item)
+		dst.notifyWaiters()
+
+		return item, nil
+	}
+
+	// Within the namespaces of a single DB, move the item using one
+	// write as well, moving the chunks of a streamed value along.
+	if sharedDatabase(src.db, dst.db) {
+		srcBatch, dstBatch := new(leveldb.Batch), new(leveldb.Batch)
+		if rec.chunks != nil {
+			ref, err := dst.copyChunks(dstBatch, rec.chunks)
+			if err != nil {
+				return nil, err
+			}
+			item.chunks = ref
+			if value, err = dst.format.encode(item.record()); err != nil {
+				return nil, err
+			}
+			dropChunks(srcBatch, removed.chunks)
+		}
+		srcBatch.Delete(idToKey(id))
+		src.unindexItem(srcBatch, removed)
+		dstBatch.Put(item.Key, value)
+		dst.indexItem(dstBatch, item)
+		if err := src.dropUniqueKey(srcBatch, id, uniqueKey); err != nil {
+			return nil, err
+		}
+		if holes != src.holes {
+			src.putHoles(srcBatch, holes)
+		}
+
+		if err := writeShared(src.db, srcBatch, dst.db, dstBatch, src.writeOpts); err != nil {
+			return nil, err
+		}
+		src.setState(head, tail, holes)
+
+		dst.tail = item.ID
+		dst.enqueued++
+		src.dequeued++
+		src.hooks.dequeued(removed)
+		dst.added(item)
+		dst.notifyWaiters()
+
+		return item, nil
+	}
+
+	// Otherwise add the item to dst along with a recovery marker, and
+	// a copy of the chunks of a streamed value.
+	batch := new(leveldb.Batch)
+	if rec.chunks != nil {
+		ref, err := dst.copyChunks(batch, rec.chunks)
+		if err != nil {
+			return nil, err
+		}
+		item.chunks = ref
+		if value, err = dst.format.encode(item.record()); err != nil {
+			return nil, err
+		}
+	}
+	batch.Put(item.Key, value)
+	dst.indexItem(batch, item)
+	if keepsMoveMarker(src) {
+		batch.Put(moveMarkerKey(src), appendUint64(nil, id))
+	}
+	if err := dst.db.Write(batch, dst.writeOpts); err != nil {
+		return nil, err
+	}
+
+	dst.tail++
+	dst.enqueued++
+	dst.added(item)
+	dst.notifyWaiters()
+
+	// Remove the item from src.
+	batch = new(leveldb.Batch)
+	batch.Delete(idToKey(id))
+	src.unindexItem(batch, removed)
+	dropChunks(batch, removed.chunks)
+	if err := src.dropUniqueKey(batch, id, uniqueKey); err != nil {
+		return nil, err
+	}
+	if err := src.writeState(batch, head, tail, holes); err != nil {
+		return nil, err
+	}
+	src.dequeued++
+	src.hooks.dequeued(removed)
+
+	// Remove the recovery marker.
+	if keepsMoveMarker(src) {
+		if err := dst.db.Delete(moveMarkerKey(src), dst.writeOpts); err != nil {
+			return nil, err
+		}
+	}
+
+	return item, nil
+}
+
+// recoverMove finishes a move from src to dst which was interrupted
+// after the item was added to dst but before it was removed from src.
+func recoverMove(src, dst *Queue) error {
+	if sharedDatabase(src.db, dst.db) || !keepsMoveMarker(src) {
+		return nil
+	}
+
+	// Check for a recovery marker.
+	marker, err := dst.db.Get(moveMarkerKey(src), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// A marker left by Merge holds the range of IDs to remove.
+	if len(marker) == 16 {
+		if _, err := src.removeRange(binary.BigEndian.Uint64(marker), binary.BigEndian.Uint64(marker[8:])); err != nil {
+			return err
+		}
+		return dst.db.Delete(moveMarkerKey(src), dst.writeOpts)
+	}
+
+	// Remove the item from src if it is still there.
+	id := binary.BigEndian.Uint64(marker)
+	if id > src.head && id <= src.tail {
+		item, err := src.getItem(id)
+		if err != nil && err != ErrOutOfBounds {
+			return err
+		}
+
+		if err == nil {
+			head, tail, holes, err := src.removalState(id)
+			if err != nil {
+				return err
+			}
+
+			batch := new(leveldb.Batch)
+			batch.Delete(idToKey(id))
+			src.unindexItem(batch, item)
+			dropChunks(batch, item.chunks)
+			if err := src.writeState(batch, head, tail, holes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return dst.db.Delete(moveMarkerKey(src), dst.writeOpts)
+}
+
+// keepsMoveMarker returns whether moves out of the given source queue
+// into a queue with a different database keep a recovery marker. A
+// queue in memory does not survive a crash, so there is nothing to
+// recover, and its empty DataDir would give it the marker of a queue
+// in the working directory.
+func keepsMoveMarker(src *Queue) bool {
+	return src.mem == nil
+}
+
+// moveMarkerKey returns the key of the recovery marker stored in the
+// destination queue of a move from the given source queue.
+func moveMarkerKey(src *Queue) []byte {
+	dir, err := filepath.Abs(src.DataDir)
+	if err != nil {
+		dir = src.DataDir
+	}
+	if ns, ok := src.db.(*namespace); ok {
+		dir += ":" + ns.name
+	}
+	return internalKey("move:" + dir)
+}
+
+// lockQueues locks the given queues in a consistent order, so moves in
+// opposite directions can not deadlock, and returns a function
+// unlocking them.
+func lockQueues(a, b *Queue) func() {
+	if a == b {
+		a.Lock()
+		return a.unlock
+	}
+
+	// Queues in memory or within the namespaces of a DB share their
+	// data directory, so order them by when they were opened instead.
+	if b.DataDir < a.DataDir || (b.DataDir == a.DataDir && b.seq < a.seq) {
+		a, b = b, a
+	}
+
+	a.Lock()
+	b.Lock()
+	return func() {
+		b.Unlock()
+		a.Unlock()
+		a.hooks.run()
+		b.hooks.run()
+	}
+}
+
+// nextLiveItem returns the first item in the queue that has not
+// expired and is visible. The queue must be locked by the caller.
+func (q *Queue) nextLiveItem() (*Item, error) {
+	if q.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	var item *Item
+	now := time.Now()
+	err := q.forEach(q.head+1, func(i *Item) bool {
+		if !i.ready(now) {
+			return true
+		}
+		item = i
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrEmpty
+	}
+
+	return item, nil
+}
@@ -0,0 +1,369 @@
+package goque
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMove(t *testing.T) {
+	srcFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(srcFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	dstFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(dstFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = src.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	movedItem, err := Move(src, dst)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if movedItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, movedItem.ToString())
+	}
+
+	if src.Length() != 9 {
+		t.Errorf("Expected source queue length of 9, got %d", src.Length())
+	}
+
+	if dst.Length() != 1 {
+		t.Errorf("Expected destination queue length of 1, got %d", dst.Length())
+	}
+
+	deqItem, err := dst.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	peekItem, err := src.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 2"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+}
+
+func TestMoveEmpty(t *testing.T) {
+	srcFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(srcFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	dstFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(dstFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	if _, err = Move(src, dst); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %s", err)
+	}
+
+	if _, err = MoveItem(src, dst, 1); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %s", err)
+	}
+}
+
+func TestMoveItem(t *testing.T) {
+	srcFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(srcFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	dstFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(dstFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = src.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	movedItem, err := MoveItem(src, dst, 5)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 5"
+
+	if movedItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, movedItem.ToString())
+	}
+
+	if _, err = MoveItem(src, dst, 5); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %s", err)
+	}
+
+	if src.Length() != 9 {
+		t.Errorf("Expected source queue length of 9, got %d", src.Length())
+	}
+
+	peekItem, err := src.PeekByOffset(4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 6"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	for i := 1; i <= 10; i++ {
+		if i == 5 {
+			continue
+		}
+
+		deqItem, err := src.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+
+	if src.Length() != 0 {
+		t.Errorf("Expected source queue length of 0, got %d", src.Length())
+	}
+}
+
+func TestMoveRecover(t *testing.T) {
+	srcFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	src, err := OpenQueue(srcFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	dstFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(dstFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = src.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Simulate a move interrupted after writing to the destination.
+	if _, err = dst.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+	if err = dst.db.Put(moveMarkerKey(src), appendUint64(nil, 1), nil); err != nil {
+		t.Error(err)
+	}
+
+	movedItem, err := Move(src, dst)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+
+	if movedItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, movedItem.ToString())
+	}
+
+	if src.Length() != 8 {
+		t.Errorf("Expected source queue length of 8, got %d", src.Length())
+	}
+
+	if dst.Length() != 2 {
+		t.Errorf("Expected destination queue length of 2, got %d", dst.Length())
+	}
+
+	if ok, err := dst.db.Has(moveMarkerKey(src), nil); err != nil || ok {
+		t.Errorf("Expected recovery marker to be removed, got %t, %v", ok, err)
+	}
+}
+
+func TestQueueMoveMemoryMarker(t *testing.T) {
+	src, err := OpenQueueMemory()
+	if err != nil {
+		t.Error(err)
+	}
+	defer src.Drop()
+
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dst, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dst.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = src.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// A marker left by a move from a queue in the working directory,
+	// which a queue in memory must not pick up as its own.
+	dir, err := filepath.Abs("")
+	if err != nil {
+		t.Error(err)
+	}
+	marker := internalKey("move:" + dir)
+	if err = dst.db.Put(marker, appendUint64(nil, 1), nil); err != nil {
+		t.Error(err)
+	}
+
+	movedItem, err := Move(src, dst)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if movedItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, movedItem.ToString())
+	}
+
+	if src.Length() != 2 {
+		t.Errorf("Expected source queue length of 2, got %d", src.Length())
+	}
+
+	if ok, err := dst.db.Has(marker, nil); err != nil || !ok {
+		t.Errorf("Expected the other recovery marker to be kept, got %t, %v", ok, err)
+	}
+}
+
+func TestPipe(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+	defer db.Close()
+
+	from, err := db.Queue("input")
+	if err != nil {
+		t.Error(err)
+	}
+
+	to, err := db.Queue("output")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Pipe(from, to); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if _, err = from.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+	value := bytes.Repeat([]byte("x"), chunkSize+1)
+	if _, err = from.EnqueueReader(bytes.NewReader(value), int64(len(value))); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err = Pipe(from, to); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if from.Length() != 0 || to.Length() != 2 {
+		t.Errorf("Expected lengths of 0 and 2, got %d and %d", from.Length(), to.Length())
+	}
+
+	item, err := to.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	// The chunks of a streamed value move along with it.
+	item, err = to.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	r := item.ValueReader()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Error(err)
+	}
+	r.Close()
+	if !bytes.Equal(b, value) {
+		t.Errorf("Expected streamed value of %d bytes, got %d", len(value), len(b))
+	}
+}
+
+func TestPipeDifferentDatabase(t *testing.T) {
+	fromFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	from, err := OpenQueue(fromFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer from.Drop()
+
+	toFile := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	to, err := OpenQueue(toFile)
+	if err != nil {
+		t.Error(err)
+	}
+	defer to.Drop()
+
+	if _, err = from.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = Pipe(from, to); err != ErrDifferentDatabase {
+		t.Errorf("Expected to get different database error, got %v", err)
+	}
+
+	if from.Length() != 1 {
+		t.Errorf("Expected source queue length of 1, got %d", from.Length())
+	}
+}
@@ -0,0 +1,222 @@
+package goque
+
+import (
+	"crypto/cipher"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/opt"
+)
+
+// Options defines the options used when opening a stack or queue.
+//
+// A nil *Options is equivalent to the zero value, which uses the
+// default for every option.
+type Options struct {
+	// Codec is used to encode and decode object values, such as those
+	// given to EnqueueObject and read by Item.ToObject.
+	//
+	// The codec is stored within the data directory when it is first
+	// created, and opening it with a different codec returns
+	// ErrIncompatibleCodec. Defaults to GobCodec.
+	Codec Codec
+
+	// MaxLength is the maximum number of items a Queue can hold. Once
+	// a queue is full, Enqueue returns ErrFull and EnqueueWait blocks
+	// until there is room. Expired items count towards the length
+	// until they are removed. Zero means no limit, which is the
+	// default. Other structures ignore this option.
+	MaxLength uint64
+
+	// MaxRetries is the number of times an item taken from a Queue
+	// using DequeueWithReceipt can be returned using Nack before it is
+	// given up on. Once an item is nacked more than MaxRetries times,
+	// it is moved to DeadLetterQueue, or removed if that is not set.
+	// Zero means items are retried forever, which is the default.
+	// Other structures ignore this option.
+	MaxRetries uint32
+
+	// DeadLetterQueue is the queue that items which were nacked more
+	// than MaxRetries times are moved to. Other structures ignore this
+	// option.
+	DeadLetterQueue *Queue
+
+	// Compression sets how item values are compressed when stored.
+	// Values are only stored compressed when that makes them smaller.
+	// Each stored value records how it was compressed, so items stored
+	// using a different compression, or none, can still be read.
+	// Defaults to CompressNone.
+	Compression Compression
+
+	// Cipher, if set, is used to encrypt item values when stored, each
+	// using a random nonce which is stored along with it. Keys, and
+	// so the order of items, are not encrypted. Reading an item which
+	// can not be decrypted using the cipher returns ErrDecryption.
+	// Defaults to storing values unencrypted.
+	Cipher cipher.AEAD
+
+	// MaxItemBytes, if set, is the largest number of bytes the value of
+	// an item may take up when stored, once it has been encoded by the
+	// codec, compressed and encrypted. Adding or updating an item whose
+	// stored value would be larger returns ErrItemTooLarge. Zero means
+	// no limit, which is the default.
+	MaxItemBytes int
+
+	// Checksum, if set, stores a CRC32C checksum along with the value
+	// of each item, including each chunk of a streamed value, which is
+	// verified whenever the item is read, so reading a value corrupted
+	// on disk returns ErrChecksumMismatch rather than the bad data.
+	// Items stored with a checksum are always verified, while items
+	// stored without one, such as by older versions of goque, are read
+	// as they are. Defaults to storing no checksums.
+	Checksum bool
+
+	// NoSync disables syncing each write to disk before it returns,
+	// which greatly increases throughput at the cost of durability.
+	// Writes are still handed to the operating system, so they
+	// survive the process crashing, but the most recent writes may be
+	// lost if the machine crashes or loses power. Call Flush to force
+	// a sync point. Defaults to syncing every write.
+	NoSync bool
+
+	// FlushEvery and FlushInterval bound the writes a Queue opened with
+	// NoSync may lose on a crash, by calling Flush from a background
+	// goroutine after every FlushEvery operations locking the queue for
+	// writing, such as Enqueue and Dequeue, or once FlushInterval has
+	// passed since the last flush, whichever comes first. Zero disables
+	// either, which is the default. The goroutine stops when the queue
+	// is closed. Both are ignored without NoSync, and other structures
+	// ignore these options.
+	FlushEvery    int
+	FlushInterval time.Duration
+
+	// OnEnqueue, if set, is called with each item added to a Queue,
+	// including items returned to it using Nack, by a visibility
+	// timeout or moved into it. OnDequeue, if set, is called with each
+	// item taken from a Queue, including items taken using a receipt
+	// or moved out of it. Expired items which are removed do not count
+	// as dequeued.
+	//
+	// Hooks are called only once the write changing the queue has
+	// been committed, in the order the changes were made. They are
+	// called after the lock of the queue has been released, so they
+	// can use the queue themselves, but may be called by the goroutine
+	// of a later operation rather than the one making the change.
+	// Other structures ignore these options.
+	OnEnqueue func(*Item)
+	OnDequeue func(*Item)
+
+	// Scheduler chooses which priority level each Dequeue of a
+	// PriorityQueue takes its item from, such as a WeightedScheduler.
+	// Defaults to always taking the item from the most important
+	// level holding items. Other structures ignore this option.
+	Scheduler Scheduler
+
+	// AgingInterval, if set, promotes each item of a PriorityQueue
+	// which has waited in its priority level for at least this long
+	// to the next more important level, so less important items are
+	// never starved. Items are promoted by Dequeue and Age. Defaults
+	// to never promoting items. Other structures ignore this option.
+	AgingInterval time.Duration
+
+	// Indexer, if set, returns the secondary index key of each item of
+	// a Queue, such as a field of its value, which is stored along with
+	// the item so LookupByIndex can find it. A nil key leaves the item
+	// out of the index. Index entries are added and removed using the
+	// same writes as their items, so the Indexer must return the same
+	// key for an item every time. Items added while no Indexer was set
+	// are not indexed. Other structures ignore this option.
+	Indexer func(*Item) []byte
+
+	// Tracer, if set, starts a span around each Enqueue, EnqueueWait,
+	// EnqueueWithTTL, EnqueueAt, Dequeue, DequeueIf, DequeueIfID and
+	// DequeueWait of a Queue. Spans are started before the queue is
+	// locked and ended once it is unlocked. Other structures ignore
+	// this option.
+	Tracer Tracer
+
+	// GobTypes holds a value of each concrete type stored in an
+	// interface field of the objects encoded using encoding/gob, which
+	// are registered using RegisterType when the structure is opened.
+	// Registration is global to the process, so the types are also
+	// registered for every other structure.
+	GobTypes []interface{}
+}
+
+// registerGobTypes registers the gob types of the options.
+func (o *Options) registerGobTypes() {
+	if o == nil {
+		return
+	}
+	RegisterType(o.GobTypes...)
+}
+
+// codec returns the codec to use for the options.
+func (o *Options) codec() Codec {
+	if o == nil || o.Codec == nil {
+		return GobCodec
+	}
+	return o.Codec
+}
+
+// agingInterval returns the priority aging interval to use for the
+// options.
+func (o *Options) agingInterval() time.Duration {
+	if o == nil {
+		return 0
+	}
+	return o.AgingInterval
+}
+
+// indexer returns the secondary index function to use for the options.
+func (o *Options) indexer() func(*Item) []byte {
+	if o == nil {
+		return nil
+	}
+	return o.Indexer
+}
+
+// tracer returns the tracer to use for the options.
+func (o *Options) tracer() Tracer {
+	if o == nil {
+		return nil
+	}
+	return o.Tracer
+}
+
+// maxLength returns the maximum queue length to use for the options.
+func (o *Options) maxLength() uint64 {
+	if o == nil {
+		return 0
+	}
+	return o.MaxLength
+}
+
+// writeOptions returns the LevelDB write options to use for the options.
+func (o *Options) writeOptions() *opt.WriteOptions {
+	return &opt.WriteOptions{Sync: o == nil || !o.NoSync}
+}
+
+// deadLetter returns the maximum number of retries and the dead-letter
+// queue to use for the options.
+func (o *Options) deadLetter() (uint32, *Queue) {
+	if o == nil {
+		return 0, nil
+	}
+	return o.MaxRetries, o.DeadLetterQueue
+}
+
+// levelOptions returns a copy of the given LevelDB options, which may be
+// nil, with the options goque relies on for correctness enforced. The
+// default byte-wise comparer is always used, as items are ordered by
+// their keys, and the database is never opened read-only, which is
+// only done by OpenQueueReadOnly.
+func levelOptions(o *opt.Options) *opt.Options {
+	lo := &opt.Options{}
+	if o != nil {
+		*lo = *o
+	}
+
+	lo.Comparer = nil
+	lo.ReadOnly = false
+	return lo
+}
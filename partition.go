@@ -0,0 +1,155 @@
+package goque
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"strconv"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// partitionsKey holds the number of partitions of a partitioned queue,
+// stored by its first partition.
+var partitionsKey = internalKey("partitions")
+
+// PartitionedQueue spreads items across a fixed number of queues, its
+// partitions, choosing the partition of each item from its key. Items
+// with the same key always go to the same partition, and each partition
+// keeps its own FIFO order, so a consumer bound to a partition sees the
+// items of each of its keys in order, while the partitions are consumed
+// in parallel.
+//
+// The partitions are queues in namespaces of a DB, so they share its
+// LevelDB database.
+type PartitionedQueue struct {
+	partitions []*Queue
+}
+
+// PartitionedQueue opens the partitioned queue with the given name and
+// number of partitions, creating it if it does not exist yet. Partition
+// i is the queue in the namespace named name + "/" + i.
+//
+// The partition of a key depends on the number of partitions, so once
+// created, a partitioned queue must always be opened with the same
+// number, otherwise ErrPartitionMismatch is returned. ErrOutOfBounds is
+// returned if n is less than 1.
+func (db *DB) PartitionedQueue(name string, n int) (*PartitionedQueue, error) {
+	if n < 1 {
+		return nil, ErrOutOfBounds
+	}
+
+	pq := &PartitionedQueue{partitions: make([]*Queue, 0, n)}
+	for i := 0; i < n; i++ {
+		q, err := db.Queue(name + "/" + strconv.Itoa(i))
+		if err != nil {
+			pq.Close()
+			return nil, err
+		}
+		pq.partitions = append(pq.partitions, q)
+	}
+
+	// Check the number of partitions the queue was created with.
+	first := pq.partitions[0]
+	b, err := first.db.Get(partitionsKey, nil)
+	switch {
+	case err == leveldb.ErrNotFound:
+		err = first.db.Put(partitionsKey, appendUint64(nil, uint64(n)), first.writeOpts)
+	case err == nil && binary.BigEndian.Uint64(b) != uint64(n):
+		err = ErrPartitionMismatch
+	}
+	if err != nil {
+		pq.Close()
+		return nil, err
+	}
+
+	return pq, nil
+}
+
+// Partitions returns the number of partitions of the queue.
+func (pq *PartitionedQueue) Partitions() int {
+	return len(pq.partitions)
+}
+
+// PartitionFor returns the partition items with the given key are added
+// to, which is the FNV-1a hash of the key modulo the number of
+// partitions.
+func (pq *PartitionedQueue) PartitionFor(key []byte) int {
+	h := fnv.New32a()
+	h.Write(key)
+	return int(h.Sum32() % uint32(len(pq.partitions)))
+}
+
+// Partition returns the queue of the given partition, such as to use
+// DequeueWait or DequeueWithReceipt on it, or nil if there is no such
+// partition.
+func (pq *PartitionedQueue) Partition(i int) *Queue {
+	if i < 0 || i >= len(pq.partitions) {
+		return nil
+	}
+	return pq.partitions[i]
+}
+
+// Enqueue adds an item to the tail of the partition of the given key.
+// The ID of the item is that within its partition.
+func (pq *PartitionedQueue) Enqueue(key, value []byte) (*Item, error) {
+	return pq.partitions[pq.PartitionFor(key)].Enqueue(value)
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a value
+// as a string rather than a byte slice.
+func (pq *PartitionedQueue) EnqueueString(key []byte, value string) (*Item, error) {
+	return pq.Enqueue(key, []byte(value))
+}
+
+// DequeuePartition removes the next item in the given partition and
+// returns it. ErrOutOfBounds is returned if there is no such partition.
+func (pq *PartitionedQueue) DequeuePartition(i int) (*Item, error) {
+	q := pq.Partition(i)
+	if q == nil {
+		return nil, ErrOutOfBounds
+	}
+	return q.Dequeue()
+}
+
+// PeekPartition returns the next item in the given partition without
+// removing it. ErrOutOfBounds is returned if there is no such partition.
+func (pq *PartitionedQueue) PeekPartition(i int) (*Item, error) {
+	q := pq.Partition(i)
+	if q == nil {
+		return nil, ErrOutOfBounds
+	}
+	return q.Peek()
+}
+
+// Length returns the total number of items in every partition.
+func (pq *PartitionedQueue) Length() uint64 {
+	var length uint64
+	for _, q := range pq.partitions {
+		q.RLock()
+		length += q.Length()
+		q.RUnlock()
+	}
+	return length
+}
+
+// Close closes every partition, leaving the DB open.
+func (pq *PartitionedQueue) Close() error {
+	var firstErr error
+	for _, q := range pq.partitions {
+		if err := q.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Drop closes every partition and removes all of their keys, leaving
+// the other namespaces of the DB untouched.
+func (pq *PartitionedQueue) Drop() error {
+	for _, q := range pq.partitions {
+		if err := q.Drop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
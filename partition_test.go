@@ -0,0 +1,83 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPartitionedQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	db, err := OpenDB(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.RemoveAll(file)
+	defer db.Close()
+
+	pq, err := db.PartitionedQueue("jobs", 4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	keys := []string{"alice", "bob", "carol", "dave", "erin"}
+	for i := 1; i <= 3; i++ {
+		for _, key := range keys {
+			if _, err = pq.EnqueueString([]byte(key), fmt.Sprintf("%s %d", key, i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if pq.Length() != 15 {
+		t.Errorf("Expected length of 15, got %d", pq.Length())
+	}
+
+	// Each key keeps its order within its partition.
+	for p := 0; p < pq.Partitions(); p++ {
+		next := make(map[string]int)
+		for {
+			item, err := pq.DequeuePartition(p)
+			if err == ErrEmpty {
+				break
+			} else if err != nil {
+				t.Error(err)
+				break
+			}
+
+			var key string
+			var i int
+			if _, err = fmt.Sscanf(item.ToString(), "%s %d", &key, &i); err != nil {
+				t.Error(err)
+			}
+			if pq.PartitionFor([]byte(key)) != p {
+				t.Errorf("Expected %s in partition %d, got %d", key, pq.PartitionFor([]byte(key)), p)
+			}
+			if i != next[key]+1 {
+				t.Errorf("Expected item %d of %s, got %d", next[key]+1, key, i)
+			}
+			next[key] = i
+		}
+	}
+
+	if _, err = pq.DequeuePartition(4); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	// The number of partitions can not change.
+	if err = pq.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, err = db.PartitionedQueue("jobs", 3); err != ErrPartitionMismatch {
+		t.Errorf("Expected to get partition mismatch error, got %v", err)
+	}
+
+	pq, err = db.PartitionedQueue("jobs", 4)
+	if err != nil {
+		t.Error(err)
+	}
+	if err = pq.Drop(); err != nil {
+		t.Error(err)
+	}
+}
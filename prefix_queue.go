@@ -2,14 +2,18 @@ package goque
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/gob"
 	"encoding/json"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // prefixDelimiter defines the delimiter used to separate a prefix from an
@@ -32,38 +36,76 @@ func (q *queue) Length() uint64 {
 // each given prefix into its own queue.
 type PrefixQueue struct {
 	sync.RWMutex
-	DataDir string
-	db      *leveldb.DB
-	size    uint64
-	isOpen  bool
+	DataDir   string
+	db        database
+	size      uint64
+	enqueued  uint64
+	dequeued  uint64
+	counted   time.Time
+	isOpen    bool
+	codec     Codec
+	format    recordFormat
+	writeOpts *opt.WriteOptions
+	rr        *roundRobin
 }
 
 // OpenPrefixQueue opens a prefix queue if one exists at the given directory.
 // If one does not already exist, a new prefix queue is created.
 func OpenPrefixQueue(dataDir string) (*PrefixQueue, error) {
+	return OpenPrefixQueueWithOptions(dataDir, nil)
+}
+
+// OpenPrefixQueueWithOptions opens a prefix queue if one exists at the given
+// directory using the given options. If one does not already exist, a new
+// prefix queue is created.
+func OpenPrefixQueueWithOptions(dataDir string, opts *Options) (*PrefixQueue, error) {
+	return openPrefixQueue(context.Background(), dataDir, opts, nil)
+}
+
+// OpenPrefixQueueContext opens a prefix queue like OpenPrefixQueue. If
+// the data directory is locked by another process, opening is retried
+// with backoff until the context is done, at which point the lock error
+// is returned.
+func OpenPrefixQueueContext(ctx context.Context, dataDir string) (*PrefixQueue, error) {
+	return openPrefixQueue(ctx, dataDir, nil, nil)
+}
+
+// OpenPrefixQueueWithLevelOptions opens a prefix queue like
+// OpenPrefixQueue, using the given LevelDB options to tune the
+// underlying database. As for OpenQueueWithLevelOptions, the Comparer
+// and ReadOnly options can not be overridden.
+func OpenPrefixQueueWithLevelOptions(dataDir string, lopts *opt.Options) (*PrefixQueue, error) {
+	return openPrefixQueue(context.Background(), dataDir, nil, levelOptions(lopts))
+}
+
+// openPrefixQueue opens a prefix queue using the given context,
+// options and LevelDB options, which may be nil.
+func openPrefixQueue(ctx context.Context, dataDir string, opts *Options, lopts *opt.Options) (*PrefixQueue, error) {
 	var err error
+	opts.registerGobTypes()
 
 	// Create a new Queue.
 	pq := &PrefixQueue{
-		DataDir: dataDir,
-		db:      &leveldb.DB{},
-		isOpen:  false,
+		DataDir:   dataDir,
+		db:        levelDB{&leveldb.DB{}},
+		counted:   time.Now(),
+		isOpen:    false,
+		codec:     opts.codec(),
+		format:    newRecordFormat(opts),
+		writeOpts: opts.writeOptions(),
 	}
 
 	// Open database for the prefix queue.
-	pq.db, err = leveldb.OpenFile(dataDir, nil)
+	db, err := openDB(ctx, dataDir, lopts)
 	if err != nil {
 		return nil, err
 	}
+	pq.db = levelDB{db}
 
 	// Check if this Goque type can open the requested data directory.
-	ok, err := checkGoqueType(dataDir, goquePrefixQueue)
-	if err != nil {
+	if err = checkGoqueType(dataDir, TypePrefixQueue, pq.codec, false, pq.writeOpts.Sync); err != nil {
 		return nil, err
 	}
-	if !ok {
-		return nil, ErrIncompatibleType
-	}
 
 	// Set isOpen and return.
 	pq.isOpen = true
@@ -91,16 +133,23 @@ func (pq *PrefixQueue) Enqueue(prefix, value []byte) (*Item, error) {
 		ID:    q.Tail + 1,
 		Key:   generateKeyPrefixID(prefix, q.Tail+1),
 		Value: value,
+		codec: pq.codec,
 	}
 
 	// Add it to the queue.
-	if err := pq.db.Put(item.Key, item.Value, nil); err != nil {
+	b, err := pq.format.encode(&record{value: item.Value})
+	if err != nil {
+		return nil, err
+	}
+	if err := pq.db.Put(item.Key, b, pq.writeOpts); err != nil {
 		return nil, err
 	}
 
-	// Increment tail position and prefix queue size.
+	// Increment tail position, prefix queue size and enqueued count.
 	q.Tail++
 	pq.size++
+	pq.enqueued++
+	pq.rr.add(prefix)
 
 	// Save the queue.
 	if err := pq.saveQueue(prefix, q); err != nil {
@@ -122,21 +171,20 @@ func (pq *PrefixQueue) EnqueueString(prefix, value string) (*Item, error) {
 }
 
 // EnqueueObject is a helper function for Enqueue that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the prefix queue, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (pq *PrefixQueue) EnqueueObject(prefix []byte, value interface{}) (*Item, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(value); err != nil {
+	b, err := pq.codec.Encode(value)
+	if err != nil {
 		return nil, err
 	}
 
-	return pq.Enqueue(prefix, buffer.Bytes())
+	return pq.Enqueue(prefix, b)
 }
 
 // EnqueueObjectAsJSON is a helper function for Enqueue that accepts
@@ -163,6 +211,12 @@ func (pq *PrefixQueue) Dequeue(prefix []byte) (*Item, error) {
 		return nil, ErrDBClosed
 	}
 
+	return pq.dequeue(prefix)
+}
+
+// dequeue removes the next item in the queue with the given prefix and
+// returns it. The prefix queue must be locked by the caller.
+func (pq *PrefixQueue) dequeue(prefix []byte) (*Item, error) {
 	// Get the queue for this prefix.
 	q, err := pq.getQueue(prefix)
 	if err != nil {
@@ -176,13 +230,15 @@ func (pq *PrefixQueue) Dequeue(prefix []byte) (*Item, error) {
 	}
 
 	// Remove this item from the queue.
-	if err := pq.db.Delete(item.Key, nil); err != nil {
+	if err := pq.db.Delete(item.Key, pq.writeOpts); err != nil {
 		return nil, err
 	}
 
-	// Increment head position and decrement prefix queue size.
+	// Increment head position, decrement prefix queue size and
+	// increment dequeued count.
 	q.Head++
 	pq.size--
+	pq.dequeued++
 
 	// Save the queue.
 	if err := pq.saveQueue(prefix, q); err != nil {
@@ -203,6 +259,96 @@ func (pq *PrefixQueue) DequeueString(prefix string) (*Item, error) {
 	return pq.Dequeue([]byte(prefix))
 }
 
+// DequeueBatch removes up to max items from the head of the queue for
+// the given prefix using a single LevelDB write and returns them in
+// dequeue order.
+//
+// Fewer than max items are returned if the prefix does not hold that
+// many, and ErrEmpty is returned if it holds no items. If max is less
+// than 1, no items are returned and nothing is written.
+func (pq *PrefixQueue) DequeueBatch(prefix []byte, max int) ([]*PrefixItem, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the queue for this prefix is empty.
+	if q.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Nothing is removed if no items are asked for.
+	if max < 1 {
+		return []*PrefixItem{}, nil
+	}
+	n := q.Length()
+	if uint64(max) < n {
+		n = uint64(max)
+	}
+
+	// Remove the items from the head of the queue.
+	batch := new(leveldb.Batch)
+	items := make([]*PrefixItem, 0, n)
+	iter := pq.db.NewIterator(&util.Range{
+		Start: generateKeyPrefixID(append([]byte(nil), prefix...), q.Head+1),
+		Limit: generateKeyPrefixID(append([]byte(nil), prefix...), q.Head+n+1),
+	}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		rec, err := pq.format.decode(append([]byte(nil), iter.Value()...))
+		if err != nil {
+			return nil, err
+		}
+		key := append([]byte(nil), iter.Key()...)
+		batch.Delete(key)
+
+		items = append(items, &PrefixItem{
+			ID:     keyToID(key[len(key)-8:]),
+			Prefix: prefix,
+			Key:    key,
+			Value:  rec.value,
+			codec:  pq.codec,
+		})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	// Every item between the head and tail of the queue is stored.
+	if uint64(len(items)) != n {
+		return nil, errors.ErrNotFound
+	}
+
+	// Save the queue and main prefix queue data in the same write.
+	nq := &queue{Head: q.Head + n, Tail: q.Tail}
+	qval, err := encodeQueue(nq)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(generateKeyPrefixData(prefix), qval)
+	batch.Put(pq.getDataKey(), appendUint64(nil, pq.size-n))
+
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return nil, err
+	}
+
+	// Decrement prefix queue size and increment dequeued count.
+	pq.size -= n
+	pq.dequeued += n
+
+	return items, nil
+}
+
 // Peek returns the next item in the given queue without removing it.
 func (pq *PrefixQueue) Peek(prefix []byte) (*Item, error) {
 	pq.RLock()
@@ -247,6 +393,45 @@ func (pq *PrefixQueue) PeekByIDString(prefix string, id uint64) (*Item, error) {
 	return pq.PeekByID([]byte(prefix), id)
 }
 
+// PeekByOffset returns the item located at the given offset from the
+// head of the queue for the given prefix, in FIFO order, without
+// removing it, such as to page through the items of a prefix. The item
+// is looked up directly from the head position of the prefix.
+// ErrOutOfBounds is returned if the offset is past the tail.
+func (pq *PrefixQueue) PeekByOffset(prefix []byte, offset uint64) (*PrefixItem, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the queue for this prefix.
+	q, err := pq.getQueue(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if the offset is out of bounds.
+	if offset >= q.Length() {
+		return nil, ErrOutOfBounds
+	}
+
+	item, err := pq.getItemByPrefixID(prefix, q.Head+offset+1)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrefixItem{
+		ID:     item.ID,
+		Prefix: prefix,
+		Key:    item.Key,
+		Value:  item.Value,
+		codec:  pq.codec,
+	}, nil
+}
+
 // Update updates an item in the given queue without changing its position.
 func (pq *PrefixQueue) Update(prefix []byte, id uint64, newValue []byte) (*Item, error) {
 	pq.Lock()
@@ -273,10 +458,15 @@ func (pq *PrefixQueue) Update(prefix []byte, id uint64, newValue []byte) (*Item,
 		ID:    id,
 		Key:   generateKeyPrefixID(prefix, id),
 		Value: newValue,
+		codec: pq.codec,
 	}
 
 	// Update this item in the queue.
-	if err := pq.db.Put(item.Key, item.Value, nil); err != nil {
+	b, err := pq.format.encode(&record{value: item.Value})
+	if err != nil {
+		return nil, err
+	}
+	if err := pq.db.Put(item.Key, b, pq.writeOpts); err != nil {
 		return nil, err
 	}
 
@@ -290,20 +480,19 @@ func (pq *PrefixQueue) UpdateString(prefix string, id uint64, value string) (*It
 }
 
 // UpdateObject is a helper function for Update that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the prefix queue, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (pq *PrefixQueue) UpdateObject(prefix []byte, id uint64, newValue interface{}) (*Item, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(newValue); err != nil {
+	b, err := pq.codec.Encode(newValue)
+	if err != nil {
 		return nil, err
 	}
-	return pq.Update(prefix, id, buffer.Bytes())
+	return pq.Update(prefix, id, b)
 }
 
 // UpdateObjectAsJSON is a helper function for Update that accepts
@@ -325,8 +514,70 @@ func (pq *PrefixQueue) Length() uint64 {
 	return pq.size
 }
 
-// Close closes the LevelDB database of the prefix queue.
+// Prefixes returns every prefix which currently holds items, in byte
+// order. Prefixes whose items have all been dequeued are left out.
+func (pq *PrefixQueue) Prefixes() ([][]byte, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	var prefixes [][]byte
+	err := pq.forEachQueue(func(prefix []byte, q *queue) error {
+		if q.Length() > 0 {
+			prefixes = append(prefixes, prefix)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return prefixes, nil
+}
+
+// Purge removes every item and prefix from the prefix queue using a
+// single LevelDB write, keeping the prefix queue open. Items added
+// afterwards start again from an ID of 1 for each prefix.
+func (pq *PrefixQueue) Purge() error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Remove every item along with the queue data of each prefix and
+	// the main prefix queue data.
+	batch := new(leveldb.Batch)
+	if err := deleteRange(pq.db, batch, nil); err != nil {
+		return err
+	}
+
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return err
+	}
+
+	// Reset the prefix queue size and round-robin order.
+	pq.size = 0
+	pq.rr = nil
+
+	return nil
+}
+
+// Close closes the LevelDB database of the prefix queue, flushing its
+// writes to disk first if it was opened with the NoSync option.
 func (pq *PrefixQueue) Close() error {
+	return pq.CloseContext(context.Background())
+}
+
+// CloseContext closes the LevelDB database of the prefix queue. See
+// Queue.CloseContext for how writes are flushed first.
+func (pq *PrefixQueue) CloseContext(ctx context.Context) error {
 	pq.Lock()
 	defer pq.Unlock()
 
@@ -335,6 +586,11 @@ func (pq *PrefixQueue) Close() error {
 		return nil
 	}
 
+	// Flush any writes which were not synced.
+	if err := flushContext(ctx, pq.db, pq.writeOpts.Sync); err != nil {
+		return err
+	}
+
 	// Close the LevelDB database.
 	if err := pq.db.Close(); err != nil {
 		return err
@@ -342,6 +598,7 @@ func (pq *PrefixQueue) Close() error {
 
 	// Reset size and set isOpen to false.
 	pq.size = 0
+	pq.rr = nil
 	pq.isOpen = false
 
 	return nil
@@ -391,24 +648,70 @@ func (pq *PrefixQueue) getOrCreateQueue(prefix []byte) (*queue, error) {
 	return q, dec.Decode(q)
 }
 
+// forEachQueue calls fn with each prefix and its unique queue, in byte
+// order of the prefixes, stopping at the first error.
+//
+// The items of a prefix are keyed by the prefix and the delimiter, so
+// they sort just before the queue data of the prefix. Only the queue
+// data keys are read, seeking past the items of each prefix.
+func (pq *PrefixQueue) forEachQueue(fn func(prefix []byte, q *queue) error) error {
+	iter := pq.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	dataKey := pq.getDataKey()
+	for ok := iter.First(); ok; {
+		key := iter.Key()
+		switch {
+		case bytes.HasSuffix(key, []byte(":data")) && !bytes.Equal(key, dataKey):
+			// Decode gob to our queue type.
+			q := &queue{}
+			dec := gob.NewDecoder(bytes.NewReader(iter.Value()))
+			if err := dec.Decode(q); err != nil {
+				return err
+			}
+
+			prefix := append([]byte(nil), key[:len(key)-len(":data")]...)
+			if err := fn(prefix, q); err != nil {
+				return err
+			}
+		case len(key) >= 9 && key[len(key)-9] == prefixDelimiter:
+			// Skip the rest of the items of this prefix.
+			next := append(append([]byte(nil), key[:len(key)-9]...), prefixDelimiter+1)
+			ok = iter.Seek(next)
+			continue
+		}
+		ok = iter.Next()
+	}
+
+	return iter.Error()
+}
+
 // savePrefixQueue saves the given queue for the given prefix.
 func (pq *PrefixQueue) saveQueue(prefix []byte, q *queue) error {
-	// Encode the queue using gob.
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(q); err != nil {
+	qval, err := encodeQueue(q)
+	if err != nil {
 		return err
 	}
 
 	// Save it to the database.
-	return pq.db.Put(generateKeyPrefixData(prefix), buffer.Bytes(), nil)
+	return pq.db.Put(generateKeyPrefixData(prefix), qval, pq.writeOpts)
+}
+
+// encodeQueue encodes the given queue using gob.
+func encodeQueue(q *queue) ([]byte, error) {
+	var buffer bytes.Buffer
+	enc := gob.NewEncoder(&buffer)
+	if err := enc.Encode(q); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
 
 // save saves the main prefix queue data.
 func (pq *PrefixQueue) save() error {
 	val := make([]byte, 8)
 	binary.BigEndian.PutUint64(val, pq.size)
-	return pq.db.Put(pq.getDataKey(), val, nil)
+	return pq.db.Put(pq.getDataKey(), val, pq.writeOpts)
 }
 
 // getDataKey generates the main prefix queue data key.
@@ -438,13 +741,21 @@ func (pq *PrefixQueue) getItemByPrefixID(prefix []byte, id uint64) (*Item, error
 
 	// Get item from database.
 	item := &Item{
-		ID:  id,
-		Key: generateKeyPrefixID(prefix, id),
+		ID:    id,
+		Key:   generateKeyPrefixID(prefix, id),
+		codec: pq.codec,
+	}
+
+	value, err := pq.db.Get(item.Key, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	if item.Value, err = pq.db.Get(item.Key, nil); err != nil {
+	rec, err := pq.format.decode(value)
+	if err != nil {
 		return nil, err
 	}
+	item.Value = rec.value
 
 	return item, nil
 }
@@ -1,10 +1,18 @@
 package goque
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 func TestPrefixQueueClose(t *testing.T) {
@@ -52,6 +60,52 @@ func TestPrefixQueueDrop(t *testing.T) {
 	}
 }
 
+func TestPrefixQueuePurge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString(fmt.Sprintf("prefix %d", i%3), fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = pq.Purge(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	if _, err = os.Stat(filepath.Join(file, "GOQUE")); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.EnqueueString("prefix 1", "value")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 1 {
+		t.Errorf("Expected ID to be 1, got %d", item.ID)
+	}
+
+	pq.Close()
+	pq, err = OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+}
+
 func TestPrefixQueueIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	prq, err := OpenPriorityQueue(file, ASC)
@@ -61,7 +115,7 @@ func TestPrefixQueueIncompatibleType(t *testing.T) {
 	defer prq.Drop()
 	prq.Close()
 
-	if _, err = OpenPrefixQueue(file); err != ErrIncompatibleType {
+	if _, err = OpenPrefixQueue(file); !errors.Is(err, ErrIncompatibleType) {
 		t.Error("Expected priority queue to return ErrIncompatibleTypes when opening goquePriorityQueue")
 	}
 }
@@ -221,6 +275,198 @@ func TestPrefixQueuePeekByID(t *testing.T) {
 	}
 }
 
+func TestPrefixQueuePeekByOffset(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString("prefix", fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+		if _, err = pq.EnqueueString("other", fmt.Sprintf("other value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Offsets are counted from the head of the prefix.
+	for i := 0; i < 2; i++ {
+		if _, err = pq.DequeueString("prefix"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	compStr := "value for item 5"
+
+	peekItem, err := pq.PeekByOffset([]byte("prefix"), 2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if peekItem.ID != 5 || string(peekItem.Prefix) != "prefix" {
+		t.Errorf("Expected item 5 of prefix 'prefix', got item %d of prefix '%s'", peekItem.ID, peekItem.Prefix)
+	}
+
+	if _, err = pq.PeekByOffset([]byte("prefix"), 8); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %v", err)
+	}
+
+	if _, err = pq.PeekByOffset([]byte("missing"), 0); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if pq.Length() != 18 {
+		t.Errorf("Expected queue length of 18, got %d", pq.Length())
+	}
+}
+
+func TestPrefixQueueDequeueBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString("prefix", fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+		if _, err = pq.EnqueueString("other", fmt.Sprintf("other value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := pq.DequeueBatch([]byte("prefix"), 4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 4 {
+		t.Errorf("Expected 4 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", i+1)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+		if string(item.Prefix) != "prefix" {
+			t.Errorf("Expected prefix to be 'prefix', got '%s'", item.Prefix)
+		}
+	}
+
+	if pq.Length() != 16 {
+		t.Errorf("Expected queue length of 16, got %d", pq.Length())
+	}
+
+	// The next item of the prefix follows the batch.
+	item, err := pq.DequeueString("prefix")
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ID != 5 {
+		t.Errorf("Expected ID to be 5, got %d", item.ID)
+	}
+
+	// Fewer items are returned once the prefix drains.
+	items, err = pq.DequeueBatch([]byte("prefix"), 10)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 5 {
+		t.Errorf("Expected 5 items, got %d", len(items))
+	}
+
+	if _, err = pq.DequeueBatch([]byte("prefix"), 10); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if _, err = pq.DequeueBatch([]byte("missing"), 10); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// The other prefix is left untouched, including across a reopen.
+	pq.Close()
+	pq, err = OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", pq.Length())
+	}
+
+	item, err = pq.DequeueString("other")
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "other value for item 1" {
+		t.Errorf("Expected string to be 'other value for item 1', got '%s'", item.ToString())
+	}
+}
+
+// writeCountingDB counts the batches written to a database.
+type writeCountingDB struct {
+	database
+	writes int
+}
+
+func (db *writeCountingDB) Write(batch *leveldb.Batch, wo *opt.WriteOptions) error {
+	db.writes++
+	return db.database.Write(batch, wo)
+}
+
+func TestPrefixQueueDequeueBatchNone(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.EnqueueString("prefix", "value"); err != nil {
+		t.Error(err)
+	}
+
+	db := &writeCountingDB{database: pq.db}
+	pq.db = db
+
+	// Asking for no items writes nothing.
+	items, err := pq.DequeueBatch([]byte("prefix"), 0)
+	if err != nil {
+		t.Error(err)
+	}
+	if len(items) != 0 {
+		t.Errorf("Expected no items, got %d", len(items))
+	}
+	if db.writes != 0 {
+		t.Errorf("Expected no writes, got %d", db.writes)
+	}
+
+	// A batch is removed using a single write.
+	if items, err = pq.DequeueBatch([]byte("prefix"), 10); err != nil {
+		t.Error(err)
+	}
+	if len(items) != 1 || items[0].ToString() != "value" {
+		t.Errorf("Expected the one item, got %d items", len(items))
+	}
+	if db.writes != 1 {
+		t.Errorf("Expected 1 write, got %d", db.writes)
+	}
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+}
+
 func TestPrefixQueueUpdate(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPrefixQueue(file)
@@ -579,3 +825,187 @@ func BenchmarkPrefixQueueDequeue(b *testing.B) {
 		_, _ = pq.Dequeue([]byte("prefix"))
 	}
 }
+
+func TestPrefixQueuePrefixes(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for _, prefix := range []string{"b", "a", "c", "b"} {
+		if _, err = pq.EnqueueString(prefix, "value"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// A drained prefix should be left out.
+	if _, err = pq.DequeueString("c"); err != nil {
+		t.Error(err)
+	}
+
+	prefixes, err := pq.Prefixes()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(prefixes) != 2 || string(prefixes[0]) != "a" || string(prefixes[1]) != "b" {
+		t.Errorf("Expected prefixes [a b], got %q", prefixes)
+	}
+}
+
+func TestPrefixQueueDequeueRoundRobin(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	if _, err = pq.DequeueRoundRobin(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for _, prefix := range []string{"a", "a", "a", "b"} {
+		if _, err = pq.EnqueueString(prefix, prefix+" value"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	var order []string
+	for i := 0; i < 2; i++ {
+		item, err := pq.DequeueRoundRobin()
+		if err != nil {
+			t.Error(err)
+		}
+		order = append(order, string(item.Prefix))
+	}
+
+	// A prefix added later should join the rotation.
+	if _, err = pq.EnqueueString("c", "c value"); err != nil {
+		t.Error(err)
+	}
+
+	for {
+		item, err := pq.DequeueRoundRobin()
+		if err == ErrEmpty {
+			break
+		} else if err != nil {
+			t.Error(err)
+			break
+		}
+
+		if item.ToString() != string(item.Prefix)+" value" {
+			t.Errorf("Expected string to be '%s value', got '%s'", item.Prefix, item.ToString())
+		}
+		order = append(order, string(item.Prefix))
+	}
+
+	compOrder := []string{"a", "b", "c", "a", "a"}
+
+	if fmt.Sprint(order) != fmt.Sprint(compOrder) {
+		t.Errorf("Expected prefixes to be served in order %v, got %v", compOrder, order)
+	}
+}
+
+func TestPrefixQueueRecordMagicValue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	// Plain values starting like an encoded record are kept as given.
+	values := [][]byte{{0xff, 'g', 'q', 0, 'x', 'y'}, {0xff, 'g', 'x', 0, 0, 'x', 'y'}}
+	for _, value := range values {
+		if _, err = pq.Enqueue([]byte("prefix"), value); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, value := range values {
+		item, err := pq.Dequeue([]byte("prefix"))
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(item.Value, value) {
+			t.Errorf("Expected value to be %v, got %v", value, item.Value)
+		}
+	}
+}
+
+// readCountingDB counts the keys visited by the iterators of a database.
+type readCountingDB struct {
+	database
+	reads int
+}
+
+func (db *readCountingDB) NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator {
+	return &readCountingIterator{Iterator: db.database.NewIterator(slice, ro), db: db}
+}
+
+// readCountingIterator counts the keys it visits for its database.
+type readCountingIterator struct {
+	iterator.Iterator
+	db *readCountingDB
+}
+
+func (iter *readCountingIterator) count(ok bool) bool {
+	if ok {
+		iter.db.reads++
+	}
+	return ok
+}
+
+func (iter *readCountingIterator) First() bool { return iter.count(iter.Iterator.First()) }
+
+func (iter *readCountingIterator) Next() bool { return iter.count(iter.Iterator.Next()) }
+
+func (iter *readCountingIterator) Seek(key []byte) bool { return iter.count(iter.Iterator.Seek(key)) }
+
+func TestPrefixQueuePrefixesSkipItems(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	// Prefixes sorting right next to each other, each with many items.
+	names := []string{"a", "a\x01", "a:", "ab", "b"}
+	for _, prefix := range names {
+		for i := 0; i < 100; i++ {
+			if _, err = pq.EnqueueString(prefix, "value"); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	db := &readCountingDB{database: pq.db}
+	pq.db = db
+
+	prefixes, err := pq.Prefixes()
+	if err != nil {
+		t.Error(err)
+	}
+	found := make(map[string]bool)
+	for _, prefix := range prefixes {
+		found[string(prefix)] = true
+	}
+	for _, prefix := range names {
+		if !found[prefix] {
+			t.Errorf("Expected prefix %q, got %q", prefix, prefixes)
+		}
+	}
+	if len(prefixes) != len(names) {
+		t.Errorf("Expected %d prefixes, got %q", len(names), prefixes)
+	}
+
+	// Each prefix reads its first item and queue data, rather than
+	// every item.
+	if max := 2*len(names) + 1; db.reads > max {
+		t.Errorf("Expected at most %d keys read, got %d", max, db.reads)
+	}
+}
@@ -1,13 +1,15 @@
 package goque
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
@@ -24,57 +26,103 @@ const (
 )
 
 // priorityLevel holds the head and tail position of a priority
-// level within the queue.
+// level within the queue, along with the number of holes left
+// between them by items moved to another level.
 type priorityLevel struct {
-	head uint64
-	tail uint64
+	head  uint64
+	tail  uint64
+	holes uint64
 }
 
 // length returns the total number of items in this priority level.
 func (pl *priorityLevel) length() uint64 {
-	return pl.tail - pl.head
+	return pl.tail - pl.head - pl.holes
 }
 
 // PriorityQueue is a standard FIFO (first in, first out) queue with
 // priority levels.
 type PriorityQueue struct {
 	sync.RWMutex
-	DataDir  string
-	db       *leveldb.DB
-	order    order
-	levels   [256]*priorityLevel
-	curLevel uint8
-	isOpen   bool
+	DataDir   string
+	db        database
+	order     order
+	levels    [256]*priorityLevel
+	curLevel  uint8
+	enqueued  uint64
+	dequeued  uint64
+	counted   time.Time
+	isOpen    bool
+	codec     Codec
+	format    recordFormat
+	writeOpts *opt.WriteOptions
+	sched     schedulerState
+	aging     time.Duration
+	nextAge   time.Time
 }
 
 // OpenPriorityQueue opens a priority queue if one exists at the given
 // directory. If one does not already exist, a new priority queue is
 // created.
 func OpenPriorityQueue(dataDir string, order order) (*PriorityQueue, error) {
+	return OpenPriorityQueueWithOptions(dataDir, order, nil)
+}
+
+// OpenPriorityQueueWithOptions opens a priority queue if one exists at
+// the given directory using the given options. If one does not already
+// exist, a new priority queue is created.
+func OpenPriorityQueueWithOptions(dataDir string, order order, opts *Options) (*PriorityQueue, error) {
+	return openPriorityQueue(context.Background(), dataDir, order, opts, nil)
+}
+
+// OpenPriorityQueueContext opens a priority queue like
+// OpenPriorityQueue. If the data directory is locked by another
+// process, opening is retried with backoff until the context is done,
+// at which point the lock error is returned.
+func OpenPriorityQueueContext(ctx context.Context, dataDir string, order order) (*PriorityQueue, error) {
+	return openPriorityQueue(ctx, dataDir, order, nil, nil)
+}
+
+// OpenPriorityQueueWithLevelOptions opens a priority queue like
+// OpenPriorityQueue, using the given LevelDB options to tune the
+// underlying database. As for OpenQueueWithLevelOptions, the Comparer
+// and ReadOnly options can not be overridden.
+func OpenPriorityQueueWithLevelOptions(dataDir string, order order, lopts *opt.Options) (*PriorityQueue, error) {
+	return openPriorityQueue(context.Background(), dataDir, order, nil, levelOptions(lopts))
+}
+
+// openPriorityQueue opens a priority queue using the given context,
+// options and LevelDB options, which may be nil.
+func openPriorityQueue(ctx context.Context, dataDir string, order order, opts *Options, lopts *opt.Options) (*PriorityQueue, error) {
 	var err error
+	opts.registerGobTypes()
 
 	// Create a new PriorityQueue.
 	pq := &PriorityQueue{
-		DataDir: dataDir,
-		db:      &leveldb.DB{},
-		order:   order,
-		isOpen:  false,
+		DataDir:   dataDir,
+		db:        levelDB{&leveldb.DB{}},
+		order:     order,
+		counted:   time.Now(),
+		isOpen:    false,
+		codec:     opts.codec(),
+		format:    newRecordFormat(opts),
+		writeOpts: opts.writeOptions(),
+		aging:     opts.agingInterval(),
+	}
+	if s := opts.scheduler(); s != nil {
+		pq.sched = s.newState()
 	}
 
 	// Open database for the priority queue.
-	pq.db, err = leveldb.OpenFile(dataDir, nil)
+	db, err := openDB(ctx, dataDir, lopts)
 	if err != nil {
 		return pq, err
 	}
+	pq.db = levelDB{db}
 
 	// Check if this Goque type can open the requested data directory.
-	ok, err := checkGoqueType(dataDir, goquePriorityQueue)
-	if err != nil {
+	if err = checkGoqueType(dataDir, TypePriorityQueue, pq.codec, false, pq.writeOpts.Sync); err != nil {
 		return pq, err
 	}
-	if !ok {
-		return pq, ErrIncompatibleType
-	}
 
 	// Set isOpen and return.
 	pq.isOpen = true
@@ -100,15 +148,21 @@ func (pq *PriorityQueue) Enqueue(priority uint8, value []byte) (*PriorityItem, e
 		Priority: priority,
 		Key:      pq.generateKey(priority, level.tail+1),
 		Value:    value,
+		codec:    pq.codec,
 	}
 
 	// Add it to the priority queue.
-	if err := pq.db.Put(item.Key, item.Value, nil); err != nil {
+	b, err := pq.format.encode(&record{value: item.Value, enqueuedAt: pq.levelTime()})
+	if err != nil {
+		return nil, err
+	}
+	if err := pq.db.Put(item.Key, b, pq.writeOpts); err != nil {
 		return nil, err
 	}
 
-	// Increment tail position.
+	// Increment tail position and enqueued count.
 	level.tail++
+	pq.enqueued++
 
 	// If this priority level is more important than the curLevel.
 	if pq.cmpAsc(priority) || pq.cmpDesc(priority) {
@@ -125,21 +179,20 @@ func (pq *PriorityQueue) EnqueueString(priority uint8, value string) (*PriorityI
 }
 
 // EnqueueObject is a helper function for Enqueue that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the priority queue, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (pq *PriorityQueue) EnqueueObject(priority uint8, value interface{}) (*PriorityItem, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(value); err != nil {
+	b, err := pq.codec.Encode(value)
+	if err != nil {
 		return nil, err
 	}
 
-	return pq.Enqueue(priority, buffer.Bytes())
+	return pq.Enqueue(priority, b)
 }
 
 // EnqueueObjectAsJSON is a helper function for Enqueue that accepts
@@ -157,6 +210,8 @@ func (pq *PriorityQueue) EnqueueObjectAsJSON(priority uint8, value interface{})
 }
 
 // Dequeue removes the next item in the priority queue and returns it.
+// The item is taken from the most important priority level holding
+// items, unless the priority queue was opened with a Scheduler.
 func (pq *PriorityQueue) Dequeue() (*PriorityItem, error) {
 	pq.Lock()
 	defer pq.Unlock()
@@ -166,25 +221,34 @@ func (pq *PriorityQueue) Dequeue() (*PriorityItem, error) {
 		return nil, ErrDBClosed
 	}
 
+	// Promote any items which have waited long enough.
+	if err := pq.ageDue(time.Now()); err != nil {
+		return nil, err
+	}
+
 	// Try to get the next item.
-	item, err := pq.getNextItem()
+	item, err := pq.getScheduledItem()
 	if err != nil {
 		return nil, err
 	}
 
 	// Remove this item from the priority queue.
-	if err = pq.db.Delete(item.Key, nil); err != nil {
+	if err = pq.removeHead(item); err != nil {
 		return nil, err
 	}
 
-	// Increment head position.
-	pq.levels[pq.curLevel].head++
+	// Update the scheduling state.
+	if pq.sched != nil {
+		pq.sched.dequeued(pq, item.Priority)
+	}
 
 	return item, nil
 }
 
 // DequeueByPriority removes the next item in the given priority level
-// and returns it.
+// and returns it, leaving the other priority levels untouched. Items
+// within a level are removed in FIFO order, and ErrEmpty is returned
+// if the level holds no items.
 func (pq *PriorityQueue) DequeueByPriority(priority uint8) (*PriorityItem, error) {
 	pq.Lock()
 	defer pq.Unlock()
@@ -201,17 +265,15 @@ func (pq *PriorityQueue) DequeueByPriority(priority uint8) (*PriorityItem, error
 	}
 
 	// Remove this item from the priority queue.
-	if err = pq.db.Delete(item.Key, nil); err != nil {
+	if err = pq.removeHead(item); err != nil {
 		return nil, err
 	}
 
-	// Increment head position.
-	pq.levels[priority].head++
-
 	return item, nil
 }
 
-// Peek returns the next item in the priority queue without removing it.
+// Peek returns the next item in the priority queue without removing it,
+// which is the item Dequeue would return next.
 func (pq *PriorityQueue) Peek() (*PriorityItem, error) {
 	pq.RLock()
 	defer pq.RUnlock()
@@ -221,11 +283,27 @@ func (pq *PriorityQueue) Peek() (*PriorityItem, error) {
 		return nil, ErrDBClosed
 	}
 
-	return pq.getNextItem()
+	return pq.getScheduledItem()
+}
+
+// PeekByPriority returns the next item in the given priority level
+// without removing it, or ErrEmpty if the level holds no items.
+func (pq *PriorityQueue) PeekByPriority(priority uint8) (*PriorityItem, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
 }
 
 // PeekByOffset returns the item located at the given offset,
-// starting from the head of the queue, without removing it.
+// starting from the head of the queue, without removing it. Items are
+// counted in the order they would be dequeued, by priority level and
+// then by position within each level.
 func (pq *PriorityQueue) PeekByOffset(offset uint64) (*PriorityItem, error) {
 	pq.RLock()
 	defer pq.RUnlock()
@@ -236,13 +314,13 @@ func (pq *PriorityQueue) PeekByOffset(offset uint64) (*PriorityItem, error) {
 	}
 
 	// Check if queue is empty.
-	if pq.Length() == 0 {
+	if pq.length() == 0 {
 		return nil, ErrEmpty
 	}
 
 	// If the offset is within the current priority level.
 	if pq.levels[pq.curLevel].length() >= offset+1 {
-		return pq.getItemByPriorityID(pq.curLevel, pq.levels[pq.curLevel].head+offset+1)
+		return pq.getItemByLevelOffset(pq.curLevel, offset)
 	}
 
 	return pq.findOffset(offset)
@@ -284,10 +362,26 @@ func (pq *PriorityQueue) Update(priority uint8, id uint64, newValue []byte) (*Pr
 		Priority: priority,
 		Key:      pq.generateKey(priority, id),
 		Value:    newValue,
+		codec:    pq.codec,
+	}
+
+	// Keep the time the item was added to its priority level, which
+	// aging is based on, and make sure the ID is not a hole.
+	rec := &record{value: item.Value}
+	if pq.aging > 0 || pq.levels[priority].holes > 0 {
+		oldItem, err := pq.getItemByPriorityID(priority, id)
+		if err != nil {
+			return nil, err
+		}
+		rec.enqueuedAt = oldItem.enqueuedAt
 	}
 
 	// Update this item in the queue.
-	if err := pq.db.Put(item.Key, item.Value, nil); err != nil {
+	b, err := pq.format.encode(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := pq.db.Put(item.Key, b, pq.writeOpts); err != nil {
 		return nil, err
 	}
 
@@ -301,20 +395,19 @@ func (pq *PriorityQueue) UpdateString(priority uint8, id uint64, newValue string
 }
 
 // UpdateObject is a helper function for Update that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the priority queue, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (pq *PriorityQueue) UpdateObject(priority uint8, id uint64, newValue interface{}) (*PriorityItem, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(newValue); err != nil {
+	b, err := pq.codec.Encode(newValue)
+	if err != nil {
 		return nil, err
 	}
-	return pq.Update(priority, id, buffer.Bytes())
+	return pq.Update(priority, id, b)
 }
 
 // UpdateObjectAsJSON is a helper function for Update that accepts
@@ -331,21 +424,181 @@ func (pq *PriorityQueue) UpdateObjectAsJSON(priority uint8, id uint64, newValue
 	return pq.Update(priority, id, jsonBytes)
 }
 
+// UpdatePriority moves the item with the given ID and priority to the
+// tail of the new priority level, keeping its value and the time it
+// was added to its old level, which aging is based on. The moved item
+// gets a new ID in its new level, while every other item keeps its ID,
+// so moving an item from the middle of a level leaves a hole there, as
+// for Queue.DeleteByID. Moving the item at the tail of a level to the
+// same level does nothing.
+func (pq *PriorityQueue) UpdatePriority(priority uint8, id uint64, newPriority uint8) (*PriorityItem, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Get the item being moved.
+	oldItem, err := pq.getItemByPriorityID(priority, id)
+	if err != nil {
+		return nil, err
+	}
+
+	level := pq.levels[priority]
+	if newPriority == priority && id == level.tail {
+		return oldItem, nil
+	}
+
+	// Get the stored record, so each of its fields is kept.
+	value, err := pq.db.Get(oldItem.Key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove the item from its old priority level.
+	head, tail, holes, err := pq.levelRemovalState(priority, id)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(oldItem.Key)
+	if holes != level.holes {
+		pq.putHoles(batch, priority, holes)
+	}
+
+	// Add the item to the tail of the new priority level.
+	newTail := pq.levels[newPriority].tail
+	if newPriority == priority {
+		newTail = tail
+	}
+
+	item := &PriorityItem{
+		ID:         newTail + 1,
+		Priority:   newPriority,
+		Key:        pq.generateKey(newPriority, newTail+1),
+		Value:      oldItem.Value,
+		codec:      pq.codec,
+		enqueuedAt: oldItem.enqueuedAt,
+	}
+	batch.Put(item.Key, value)
+
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return nil, err
+	}
+
+	// Update the positions of both priority levels.
+	level.head, level.tail, level.holes = head, tail, holes
+	pq.levels[newPriority].tail = item.ID
+
+	// If the new priority level is more important than the curLevel.
+	if pq.cmpAsc(newPriority) || pq.cmpDesc(newPriority) {
+		pq.curLevel = newPriority
+	}
+
+	return item, nil
+}
+
 // Length returns the total number of items in the priority queue.
 func (pq *PriorityQueue) Length() uint64 {
 	pq.RLock()
 	defer pq.RUnlock()
 
+	return pq.length()
+}
+
+// LengthByLevel returns the number of items in the given priority
+// level.
+func (pq *PriorityQueue) LengthByLevel(priority uint8) uint64 {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0
+	}
+
+	return pq.levels[priority].length()
+}
+
+// LengthByPriorityRange returns the total number of items in the
+// priority levels from lo through hi, inclusive, such as to report on a
+// tier of levels. The counts are read from the positions of the levels
+// kept in memory, so the database is not read. ErrOutOfBounds is
+// returned if lo is greater than hi.
+func (pq *PriorityQueue) LengthByPriorityRange(lo, hi uint8) (uint64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	if lo > hi {
+		return 0, ErrOutOfBounds
+	}
+
 	var length uint64
-	for _, v := range pq.levels {
-		length += v.length()
+	for p := int(lo); p <= int(hi); p++ {
+		length += pq.levels[p].length()
 	}
 
-	return length
+	return length, nil
+}
+
+// Purge removes every item from the priority queue using a single
+// LevelDB write, keeping the priority queue open. Items added afterwards
+// start again from an ID of 1 in each priority level.
+func (pq *PriorityQueue) Purge() error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Remove every item from the priority queue, along with the number
+	// of holes of each priority level.
+	batch := new(leveldb.Batch)
+	for i := 0; i <= 255; i++ {
+		if err := deleteRange(pq.db, batch, util.BytesPrefix(pq.generatePrefix(uint8(i)))); err != nil {
+			return err
+		}
+	}
+	if err := deleteRange(pq.db, batch, util.BytesPrefix(internalKey("holes"))); err != nil {
+		return err
+	}
+
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return err
+	}
+
+	// Reset head, tail and holes of each priority level
+	// and the current priority level.
+	for i := 0; i <= 255; i++ {
+		pq.levels[uint8(i)].head = 0
+		pq.levels[uint8(i)].tail = 0
+		pq.levels[uint8(i)].holes = 0
+	}
+	pq.resetCurrentLevel()
+	pq.nextAge = time.Time{}
+
+	return nil
 }
 
-// Close closes the LevelDB database of the priority queue.
+// Close closes the LevelDB database of the priority queue, flushing
+// its writes to disk first if it was opened with the NoSync option.
 func (pq *PriorityQueue) Close() error {
+	return pq.CloseContext(context.Background())
+}
+
+// CloseContext closes the LevelDB database of the priority queue. See
+// Queue.CloseContext for how writes are flushed first.
+func (pq *PriorityQueue) CloseContext(ctx context.Context) error {
 	pq.Lock()
 	defer pq.Unlock()
 
@@ -354,16 +607,22 @@ func (pq *PriorityQueue) Close() error {
 		return nil
 	}
 
+	// Flush any writes which were not synced.
+	if err := flushContext(ctx, pq.db, pq.writeOpts.Sync); err != nil {
+		return err
+	}
+
 	// Close the LevelDB database.
 	if err := pq.db.Close(); err != nil {
 		return err
 	}
 
-	// Reset head and tail of each priority level
+	// Reset head, tail and holes of each priority level
 	// and set isOpen to false.
 	for i := 0; i <= 255; i++ {
 		pq.levels[uint8(i)].head = 0
 		pq.levels[uint8(i)].tail = 0
+		pq.levels[uint8(i)].holes = 0
 	}
 	pq.isOpen = false
 
@@ -379,6 +638,41 @@ func (pq *PriorityQueue) Drop() error {
 	return os.RemoveAll(pq.DataDir)
 }
 
+// SetOrder changes which priority level of the priority queue is the
+// most important, so later calls to Dequeue and Peek take items in the
+// given order. Items are stored by priority level either way, so no
+// data is rewritten. The order is not stored, so the priority queue
+// must be opened with the new order from then on.
+//
+// Iterators created before the change keep walking the items in the
+// order they were created with.
+func (pq *PriorityQueue) SetOrder(order order) error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if the order is valid.
+	if order != ASC && order != DESC {
+		return ErrInvalidOrder
+	}
+
+	// Find the most important priority level holding items in the new
+	// order.
+	pq.order = order
+	pq.resetCurrentLevel()
+	for i := 0; i <= 255; i++ {
+		if (pq.cmpAsc(uint8(i)) || pq.cmpDesc(uint8(i))) && pq.levels[uint8(i)].length() > 0 {
+			pq.curLevel = uint8(i)
+		}
+	}
+
+	return nil
+}
+
 // cmpAsc returns wehther the given priority level is higher than the
 // current priority level based on ascending order.
 func (pq *PriorityQueue) cmpAsc(priority uint8) bool {
@@ -401,6 +695,19 @@ func (pq *PriorityQueue) resetCurrentLevel() {
 	}
 }
 
+// length returns the total number of items in the priority queue.
+// The priority queue must be locked by the caller.
+func (pq *PriorityQueue) length() uint64 {
+	var length uint64
+	for _, v := range pq.levels {
+		if v != nil {
+			length += v.length()
+		}
+	}
+
+	return length
+}
+
 // findOffset finds the given offset from the current queue position
 // based on priority order.
 func (pq *PriorityQueue) findOffset(offset uint64) (*PriorityItem, error) {
@@ -447,7 +754,7 @@ func (pq *PriorityQueue) findOffset(offset uint64) (*PriorityItem, error) {
 
 			// If the offset is within the current priority level.
 			if length+newLength >= offset+1 {
-				return pq.getItemByPriorityID(curLevel, offset-length+1)
+				return pq.getItemByLevelOffset(curLevel, offset-length)
 			}
 
 			length += newLength
@@ -482,6 +789,38 @@ func (pq *PriorityQueue) getNextItem() (*PriorityItem, error) {
 	return pq.getItemByPriorityID(pq.curLevel, pq.levels[pq.curLevel].head+1)
 }
 
+// getScheduledItem returns the next item to dequeue, as chosen by the
+// scheduler of the priority queue if it has one.
+func (pq *PriorityQueue) getScheduledItem() (*PriorityItem, error) {
+	if pq.sched == nil {
+		return pq.getNextItem()
+	}
+
+	priority, ok := pq.sched.next(pq)
+	if !ok {
+		return nil, ErrEmpty
+	}
+
+	return pq.getItemByPriorityID(priority, pq.levels[priority].head+1)
+}
+
+// forEachLevel calls fn with each priority level, from the most
+// important to the least important.
+func (pq *PriorityQueue) forEachLevel(fn func(priority uint8)) {
+	for i := 0; i <= 255; i++ {
+		fn(pq.levelAt(i))
+	}
+}
+
+// levelAt returns the priority level which is i levels less important
+// than the most important level.
+func (pq *PriorityQueue) levelAt(i int) uint8 {
+	if pq.order == DESC {
+		return uint8(255 - i)
+	}
+	return uint8(i)
+}
+
 // getItemByID returns an item, if found, for the given ID.
 func (pq *PriorityQueue) getItemByPriorityID(priority uint8, id uint64) (*PriorityItem, error) {
 	// Check if empty or out of bounds.
@@ -492,15 +831,181 @@ func (pq *PriorityQueue) getItemByPriorityID(priority uint8, id uint64) (*Priori
 	}
 
 	// Get item from database.
-	var err error
-	item := &PriorityItem{ID: id, Priority: priority, Key: pq.generateKey(priority, id)}
-	if item.Value, err = pq.db.Get(item.Key, nil); err != nil {
+	item := &PriorityItem{ID: id, Priority: priority, Key: pq.generateKey(priority, id), codec: pq.codec}
+	value, err := pq.db.Get(item.Key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrOutOfBounds
+	} else if err != nil {
 		return nil, err
 	}
 
+	rec, err := pq.format.decode(value)
+	if err != nil {
+		return nil, err
+	}
+	item.Value = rec.value
+	item.enqueuedAt = rec.enqueuedAt
+
 	return item, nil
 }
 
+// getItemByLevelOffset returns the item located at the given offset
+// from the head of the given priority level, skipping over any holes.
+func (pq *PriorityQueue) getItemByLevelOffset(priority uint8, offset uint64) (*PriorityItem, error) {
+	// Without any holes the item can be looked up directly.
+	level := pq.levels[priority]
+	if level.holes == 0 {
+		return pq.getItemByPriorityID(priority, level.head+offset+1)
+	}
+
+	iter := pq.db.NewIterator(&util.Range{
+		Start: pq.generateKey(priority, level.head+1),
+		Limit: pq.generateKey(priority, level.tail+1),
+	}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if offset > 0 {
+			offset--
+			continue
+		}
+
+		rec, err := pq.format.decode(append([]byte(nil), iter.Value()...))
+		if err != nil {
+			return nil, err
+		}
+
+		return &PriorityItem{
+			ID:         keyToID(iter.Key()[2:]),
+			Priority:   priority,
+			Key:        append([]byte(nil), iter.Key()...),
+			Value:      rec.value,
+			codec:      pq.codec,
+			enqueuedAt: rec.enqueuedAt,
+		}, nil
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return nil, ErrOutOfBounds
+}
+
+// removeHead removes the given item, which must be the next item of its
+// priority level, and moves the head of the level past it.
+func (pq *PriorityQueue) removeHead(item *PriorityItem) error {
+	level := pq.levels[item.Priority]
+	head, holes, err := pq.advanceLevel(item.Priority, level.head, level.holes)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	if holes != level.holes {
+		pq.putHoles(batch, item.Priority, holes)
+	}
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return err
+	}
+
+	// Update head position and increment dequeued count.
+	level.head, level.holes = head, holes
+	pq.dequeued++
+
+	return nil
+}
+
+// advanceLevel returns the head position and number of holes of the
+// given priority level once the item directly after the given head
+// position has been removed. See Queue.advanceHead.
+func (pq *PriorityQueue) advanceLevel(priority uint8, head, holes uint64) (uint64, uint64, error) {
+	// Without any holes the next item directly follows.
+	level := pq.levels[priority]
+	if holes == 0 {
+		return head + 1, 0, nil
+	}
+
+	// Otherwise seek to the next stored item.
+	iter := pq.db.NewIterator(&util.Range{
+		Start: pq.generateKey(priority, head+2),
+		Limit: pq.generateKey(priority, level.tail+1),
+	}, nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		if err := iter.Error(); err != nil {
+			return 0, 0, err
+		}
+		return level.tail, 0, nil
+	}
+
+	next := keyToID(iter.Key()[2:])
+	return next - 1, holes - (next - head - 2), nil
+}
+
+// retreatLevel returns the tail position and number of holes of the
+// given priority level once the item at the given tail position has
+// been removed. See Queue.retreatTail.
+func (pq *PriorityQueue) retreatLevel(priority uint8, tail, holes uint64) (uint64, uint64, error) {
+	// Without any holes the previous item directly precedes.
+	level := pq.levels[priority]
+	if holes == 0 {
+		return tail - 1, 0, nil
+	}
+
+	// Otherwise seek to the previous stored item.
+	iter := pq.db.NewIterator(&util.Range{
+		Start: pq.generateKey(priority, level.head+1),
+		Limit: pq.generateKey(priority, tail),
+	}, nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		if err := iter.Error(); err != nil {
+			return 0, 0, err
+		}
+		return level.head, 0, nil
+	}
+
+	prev := keyToID(iter.Key()[2:])
+	return prev, holes - (tail - prev - 1), nil
+}
+
+// levelRemovalState returns the head and tail positions and number of
+// holes of the given priority level once the stored item with the given
+// ID has been removed from it.
+func (pq *PriorityQueue) levelRemovalState(priority uint8, id uint64) (uint64, uint64, uint64, error) {
+	level := pq.levels[priority]
+	switch id {
+	case level.head + 1:
+		head, holes, err := pq.advanceLevel(priority, level.head, level.holes)
+		return head, level.tail, holes, err
+	case level.tail:
+		tail, holes, err := pq.retreatLevel(priority, level.tail, level.holes)
+		return level.head, tail, holes, err
+	default:
+		return level.head, level.tail, level.holes + 1, nil
+	}
+}
+
+// putHoles adds the number of holes left between the head and tail of
+// the given priority level by moved items to the given batch.
+func (pq *PriorityQueue) putHoles(batch *leveldb.Batch, priority uint8, holes uint64) {
+	if holes == 0 {
+		batch.Delete(holesKey(priority))
+		return
+	}
+	batch.Put(holesKey(priority), appendUint64(nil, holes))
+}
+
+// holesKey returns the key storing the number of holes of the given
+// priority level. The keys of every level share the prefix
+// internalKey("holes").
+func holesKey(priority uint8) []byte {
+	return append(internalKey("holes"), priority)
+}
+
 // generatePrefix creates the key prefix for the given priority level.
 func (pq *PriorityQueue) generatePrefix(level uint8) []byte {
 	// priority + prefixSep = 1 + 1 = 2
@@ -559,5 +1064,22 @@ func (pq *PriorityQueue) init() error {
 		iter.Release()
 	}
 
-	return nil
+	// Get the number of holes of each priority level holding items.
+	prefix := internalKey("holes")
+	iter := pq.db.NewIterator(util.BytesPrefix(prefix), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		key := iter.Key()
+		if len(key) != len(prefix)+1 || len(iter.Value()) != 8 {
+			continue
+		}
+
+		pl := pq.levels[key[len(prefix)]]
+		if holes := binary.BigEndian.Uint64(iter.Value()); holes < pl.tail-pl.head {
+			pl.holes = holes
+		}
+	}
+
+	return iter.Error()
 }
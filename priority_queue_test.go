@@ -1,9 +1,11 @@
 package goque
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -57,6 +59,52 @@ func TestPriorityQueueDrop(t *testing.T) {
 	}
 }
 
+func TestPriorityQueuePurge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString(uint8(i%3), fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = pq.Purge(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", pq.Length())
+	}
+
+	if _, err = os.Stat(filepath.Join(file, "GOQUE")); err != nil {
+		t.Error(err)
+	}
+
+	item, err := pq.EnqueueString(2, "value")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 1 {
+		t.Errorf("Expected ID to be 1, got %d", item.ID)
+	}
+
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", pq.Length())
+	}
+}
+
 func TestPriorityQueueIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
@@ -66,7 +114,7 @@ func TestPriorityQueueIncompatibleType(t *testing.T) {
 	defer q.Drop()
 	q.Close()
 
-	if _, err = OpenPriorityQueue(file, ASC); err != ErrIncompatibleType {
+	if _, err = OpenPriorityQueue(file, ASC); !errors.Is(err, ErrIncompatibleType) {
 		t.Error("Expected priority queue to return ErrIncompatibleTypes when opening Queue")
 	}
 }
@@ -92,6 +140,61 @@ func TestPriorityQueueEnqueue(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueLengthByLevel(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= p+1; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	for p := 0; p <= 4; p++ {
+		if pq.LengthByLevel(uint8(p)) != uint64(p+1) {
+			t.Errorf("Expected level %d length of %d, got %d", p, p+1, pq.LengthByLevel(uint8(p)))
+		}
+	}
+
+	if pq.LengthByLevel(5) != 0 {
+		t.Errorf("Expected level 5 length of 0, got %d", pq.LengthByLevel(5))
+	}
+
+	if length, err := pq.LengthByPriorityRange(1, 3); err != nil || length != 9 {
+		t.Errorf("Expected levels 1 through 3 length of 9, got %d, %v", length, err)
+	}
+
+	if length, err := pq.LengthByPriorityRange(0, 255); err != nil || length != 15 {
+		t.Errorf("Expected levels 0 through 255 length of 15, got %d, %v", length, err)
+	}
+
+	if _, err := pq.LengthByPriorityRange(3, 1); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	if pq.Length() != 15 {
+		t.Errorf("Expected queue length of 15, got %d", pq.Length())
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.LengthByLevel(0) != 0 {
+		t.Errorf("Expected level 0 length of 0, got %d", pq.LengthByLevel(0))
+	}
+
+	if pq.Length() != 14 {
+		t.Errorf("Expected queue length of 14, got %d", pq.Length())
+	}
+}
+
 func TestPriorityQueueDequeueAsc(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
@@ -172,6 +275,193 @@ func TestPriorityQueueDequeueDesc(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueSetOrder(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for level %d", p)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.Priority != 0 {
+		t.Errorf("Expected priority level to be 0, got %d", deqItem.Priority)
+	}
+
+	if err = pq.SetOrder(DESC); err != nil {
+		t.Error(err)
+	}
+
+	for p := 4; p >= 1; p-- {
+		deqItem, err = pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.Priority != uint8(p) {
+			t.Errorf("Expected priority level to be %d, got %d", p, deqItem.Priority)
+		}
+	}
+
+	if err = pq.SetOrder(order(2)); err != ErrInvalidOrder {
+		t.Errorf("Expected to get invalid order error, got %v", err)
+	}
+}
+
+func TestPriorityQueueWeightedScheduler(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	opts := &Options{Scheduler: WeightedScheduler{Weights: map[uint8]uint32{0: 3, 1: 1}}}
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, opts)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 1; p++ {
+		for i := 1; i <= 6; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	var counts [2]int
+	for i := 0; i < 8; i++ {
+		peekItem, err := pq.Peek()
+		if err != nil {
+			t.Error(err)
+		}
+
+		deqItem, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if peekItem.Priority != deqItem.Priority || peekItem.ID != deqItem.ID {
+			t.Errorf("Expected peeked item %d:%d to be dequeued, got %d:%d", peekItem.Priority, peekItem.ID, deqItem.Priority, deqItem.ID)
+		}
+		counts[deqItem.Priority]++
+	}
+
+	if counts[0] != 6 || counts[1] != 2 {
+		t.Errorf("Expected 6 items of level 0 and 2 of level 1, got %d and %d", counts[0], counts[1])
+	}
+
+	// Once level 0 is empty, the remaining items come from level 1
+	// in FIFO order.
+	for i := 3; i <= 6; i++ {
+		deqItem, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+		if deqItem.Priority != 1 || deqItem.ToString() != compStr {
+			t.Errorf("Expected item '%s' of level 1, got '%s' of level %d", compStr, deqItem.ToString(), deqItem.Priority)
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestPriorityQueueWeightedSchedulerDesc(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	opts := &Options{Scheduler: WeightedScheduler{Weights: map[uint8]uint32{255: 2}}}
+	pq, err := OpenPriorityQueueWithOptions(file, DESC, opts)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for _, p := range []uint8{0, 255} {
+		for i := 1; i <= 3; i++ {
+			if _, err = pq.EnqueueString(p, fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	// Level 255 is the most important and has twice the weight of
+	// level 0, which has the default weight.
+	expected := []uint8{255, 0, 255, 255, 0, 0}
+	for i, p := range expected {
+		deqItem, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.Priority != p {
+			t.Errorf("Expected item %d to have priority %d, got %d", i, p, deqItem.Priority)
+		}
+	}
+}
+
+func TestPriorityQueuePeekByPriority(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if _, err = pq.DequeueByPriority(3); err != nil {
+		t.Error(err)
+	}
+
+	peekItem, err := pq.PeekByPriority(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+
+	if peekItem.Priority != 3 {
+		t.Errorf("Expected priority level to be 3, got %d", peekItem.Priority)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if pq.LengthByLevel(3) != 9 {
+		t.Errorf("Expected level length of 9, got %d", pq.LengthByLevel(3))
+	}
+
+	// Peeking should not change the next item of the queue.
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.Priority != 0 {
+		t.Errorf("Expected priority level to be 0, got %d", deqItem.Priority)
+	}
+
+	if _, err = pq.PeekByPriority(7); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
 func TestPriorityQueueDequeueByPriority(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
@@ -512,6 +802,48 @@ func TestPriorityQueuePeekByOffsetAsc(t *testing.T) {
 	}
 }
 
+func TestPriorityQueuePeekByOffsetAfterDequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.DequeueByPriority(2); err != nil {
+			t.Error(err)
+		}
+	}
+
+	compStr := "value for item 6"
+
+	peekItem, err := pq.PeekByOffset(22)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.Priority != 2 {
+		t.Errorf("Expected priority level to be 2, got %d", peekItem.Priority)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if _, err = pq.PeekByOffset(47); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %v", err)
+	}
+}
+
 func TestPriorityQueuePeekByOffsetDesc(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, DESC)
@@ -933,6 +1265,250 @@ func TestPriorityQueueUpdateOutOfBounds(t *testing.T) {
 	}
 }
 
+func TestPriorityQueueUpdatePriority(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 10; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	updatedItem, err := pq.UpdatePriority(3, 5, 0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if updatedItem.Priority != 0 {
+		t.Errorf("Expected priority level to be 0, got %d", updatedItem.Priority)
+	}
+
+	if updatedItem.ID != 11 {
+		t.Errorf("Expected ID to be 11, got %d", updatedItem.ID)
+	}
+
+	compStr := "value for item 5"
+
+	if updatedItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, updatedItem.ToString())
+	}
+
+	if pq.Length() != 50 {
+		t.Errorf("Expected queue length of 50, got %d", pq.Length())
+	}
+
+	peekItem, err := pq.PeekByPriorityID(0, 11)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	for i := 1; i <= 10; i++ {
+		if i == 5 {
+			continue
+		}
+
+		deqItem, err := pq.DequeueByPriority(3)
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+
+	if _, err = pq.DequeueByPriority(3); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if _, err = pq.UpdatePriority(3, 5, 0); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if _, err = pq.UpdatePriority(4, 11, 0); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %v", err)
+	}
+}
+
+func TestPriorityQueueUpdatePriorityHoles(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString(3, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, id := range []uint64{5, 7} {
+		if _, err = pq.UpdatePriority(3, id, 0); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The other items keep their IDs, leaving holes behind.
+	peekItem, err := pq.PeekByPriorityID(3, 6)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != "value for item 6" {
+		t.Errorf("Expected string to be 'value for item 6', got '%s'", peekItem.ToString())
+	}
+
+	if _, err = pq.PeekByPriorityID(3, 5); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %v", err)
+	}
+
+	if _, err = pq.Update(3, 7, []byte("new value")); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %v", err)
+	}
+
+	if pq.LengthByLevel(3) != 8 {
+		t.Errorf("Expected level length of 8, got %d", pq.LengthByLevel(3))
+	}
+
+	// Offsets skip over the holes.
+	peekItem, err = pq.PeekByOffset(6)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != "value for item 6" {
+		t.Errorf("Expected string to be 'value for item 6', got '%s'", peekItem.ToString())
+	}
+
+	// The holes are kept when the priority queue is reopened or rebuilt.
+	pq.Close()
+	pq, err = OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Rebuild(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 10 || pq.LengthByLevel(3) != 8 {
+		t.Errorf("Expected lengths of 10 and 8, got %d and %d", pq.Length(), pq.LengthByLevel(3))
+	}
+
+	for _, i := range []int{5, 7, 1, 2, 3, 4, 6, 8, 9, 10} {
+		deqItem, err := pq.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestPriorityQueueUpdatePriorityEnqueuedAt(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueueWithOptions(file, ASC, &Options{AgingInterval: time.Hour})
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	item, err := pq.EnqueueString(5, "value for item 1")
+	if err != nil {
+		t.Error(err)
+	}
+
+	oldItem, err := pq.PeekByPriorityID(5, item.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	// The item keeps the time it was first added, which aging uses.
+	updatedItem, err := pq.UpdatePriority(5, item.ID, 3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	peekItem, err := pq.PeekByPriorityID(3, updatedItem.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !peekItem.enqueuedAt.Equal(oldItem.enqueuedAt) {
+		t.Errorf("Expected enqueue time to be %v, got %v", oldItem.enqueuedAt, peekItem.enqueuedAt)
+	}
+}
+
+func TestPriorityQueueUpdatePriorityHigherPriority(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = pq.EnqueueString(5, fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = pq.UpdatePriority(5, 10, 2); err != nil {
+		t.Error(err)
+	}
+
+	deqItem, err := pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 10"
+
+	if deqItem.Priority != 2 {
+		t.Errorf("Expected priority level to be 2, got %d", deqItem.Priority)
+	}
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	deqItem, err = pq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 1"
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+}
+
 func TestPriorityQueueHigherPriorityAsc(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
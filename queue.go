@@ -2,84 +2,325 @@ package goque
 
 import (
 	"bytes"
-	"encoding/gob"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/storage"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // Queue is a standard FIFO (first in, first out) queue.
 type Queue struct {
 	sync.RWMutex
-	DataDir string
-	db      *leveldb.DB
-	head    uint64
-	tail    uint64
-	isOpen  bool
+	DataDir   string
+	db        database
+	head      uint64
+	tail      uint64
+	holes     uint64
+	enqueued  uint64
+	dequeued  uint64
+	counted   time.Time
+	isOpen    bool
+	readOnly  bool
+	maxLength uint64
+	receipt   Receipt
+	leaseAt   time.Time
+	retries   uint32
+	dlq       *Queue
+	codec     Codec
+	format    recordFormat
+	writeOpts *opt.WriteOptions
+	hooks     *queueHooks
+	indexer   func(*Item) []byte
+	tracer    Tracer
+	streams   uint64
+	streaming map[uint64]bool
+	async     asyncWorker
+	watchers  watchers
+	waitCh    chan struct{}
+	mem       storage.Storage
+	seq       uint64
+	flusher   *flusher
 }
 
 // OpenQueue opens a queue if one exists at the given directory. If one
 // does not already exist, a new queue is created.
 func OpenQueue(dataDir string) (*Queue, error) {
+	return OpenQueueWithOptions(dataDir, nil)
+}
+
+// OpenQueueWithOptions opens a queue if one exists at the given
+// directory using the given options. If one does not already exist, a
+// new queue is created.
+func OpenQueueWithOptions(dataDir string, opts *Options) (*Queue, error) {
+	return openQueue(context.Background(), dataDir, opts, nil)
+}
+
+// OpenQueueContext opens a queue like OpenQueue. If the data directory
+// is locked by another process, opening is retried with backoff until
+// the context is done, at which point the lock error is returned.
+func OpenQueueContext(ctx context.Context, dataDir string) (*Queue, error) {
+	return openQueue(ctx, dataDir, nil, nil)
+}
+
+// OpenQueueReadOnly opens the existing queue at the given directory
+// without allowing any changes to it. Methods which would change the
+// queue, such as Enqueue, Dequeue, Update and Drop, return
+// ErrReadOnly.
+//
+// Any number of processes can open a queue read-only at the same time,
+// but not while it is opened for writing.
+func OpenQueueReadOnly(dataDir string) (*Queue, error) {
+	return openQueue(context.Background(), dataDir, nil, &opt.Options{ReadOnly: true})
+}
+
+// OpenQueueWithLevelOptions opens a queue like OpenQueue, using the
+// given LevelDB options to tune the underlying database, such as its
+// block cache, write buffer and filter policy.
+//
+// The Comparer and ReadOnly options can not be overridden. Items are
+// ordered by their keys, so the default byte-wise comparer is always
+// used, and OpenQueueReadOnly must be used to open a queue read-only.
+func OpenQueueWithLevelOptions(dataDir string, lopts *opt.Options) (*Queue, error) {
+	return openQueue(context.Background(), dataDir, nil, levelOptions(lopts))
+}
+
+// openQueue opens a queue using the given context, options and LevelDB
+// options, which may be nil.
+func openQueue(ctx context.Context, dataDir string, opts *Options, lopts *opt.Options) (*Queue, error) {
 	var err error
+	readOnly := lopts.GetReadOnly()
 
 	// Create a new Queue.
-	q := &Queue{
-		DataDir: dataDir,
-		db:      &leveldb.DB{},
-		head:    0,
-		tail:    0,
-		isOpen:  false,
-	}
+	q := newQueue(dataDir, opts, readOnly)
 
 	// Open database for the queue.
-	q.db, err = leveldb.OpenFile(dataDir, nil)
+	db, err := openDB(ctx, dataDir, lopts)
 	if err != nil {
 		return q, err
 	}
+	q.db = levelDB{db}
 
 	// Check if this Goque type can open the requested data directory.
-	ok, err := checkGoqueType(dataDir, goqueQueue)
-	if err != nil {
+	if err = checkGoqueType(dataDir, TypeQueue, q.codec, readOnly, q.writeOpts.Sync); err != nil {
 		return q, err
 	}
-	if !ok {
-		return q, ErrIncompatibleType
-	}
 
 	// Set isOpen and return.
 	q.isOpen = true
-	return q, q.init()
+	if err := q.init(); err != nil {
+		return q, err
+	}
+	q.flusher.start(q)
+	return q, nil
+}
+
+// queueSeq counts the queues created, giving each its seq, which orders
+// queues sharing a data directory when locking them together.
+var queueSeq uint64
+
+// newQueue returns a new Queue which is not open yet, using the given
+// options, which may be nil.
+func newQueue(dataDir string, opts *Options, readOnly bool) *Queue {
+	opts.registerGobTypes()
+	retries, dlq := opts.deadLetter()
+	return &Queue{
+		DataDir:   dataDir,
+		db:        levelDB{&leveldb.DB{}},
+		head:      0,
+		tail:      0,
+		isOpen:    false,
+		readOnly:  readOnly,
+		maxLength: opts.maxLength(),
+		counted:   time.Now(),
+		retries:   retries,
+		dlq:       dlq,
+		codec:     opts.codec(),
+		format:    newRecordFormat(opts),
+		writeOpts: opts.writeOptions(),
+		hooks:     newQueueHooks(opts),
+		indexer:   opts.indexer(),
+		tracer:    opts.tracer(),
+		streaming: make(map[uint64]bool),
+		seq:       atomic.AddUint64(&queueSeq, 1),
+		flusher:   newFlusher(opts),
+	}
 }
 
-// Enqueue adds an item to the queue.
+// Enqueue adds an item to the queue. If the queue was opened with a
+// MaxLength and is full, ErrFull is returned.
 func (q *Queue) Enqueue(value []byte) (*Item, error) {
+	return q.trace(context.Background(), "goque.Enqueue", func(context.Context) (*Item, error) {
+		q.Lock()
+		defer q.unlock()
+
+		return q.enqueue(&record{value: value})
+	})
+}
+
+// EnqueueWait adds an item to the queue. If the queue is full,
+// EnqueueWait blocks until there is room for the item or the given
+// context is done, in which case the context error is returned.
+func (q *Queue) EnqueueWait(ctx context.Context, value []byte) (*Item, error) {
+	return q.trace(ctx, "goque.EnqueueWait", func(ctx context.Context) (*Item, error) {
+		for {
+			q.Lock()
+			item, err := q.enqueue(&record{value: value})
+			if err != ErrFull {
+				q.unlock()
+				return item, err
+			}
+
+			// The queue is full, so park until the next change. Another
+			// goroutine may still take the freed room first, in which
+			// case we simply wait again.
+			waitCh := q.waitChan()
+			q.unlock()
+
+			select {
+			case <-waitCh:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	})
+}
+
+// EnqueueIfUnder adds an item to the queue only if it holds fewer than
+// maxLen items, returning true if it did. Otherwise false is returned
+// and nothing is written. The length is checked and the item written
+// while the queue is locked, so concurrent producers never take the
+// queue past maxLen. Unlike the MaxLength option, the limit only
+// applies to this call.
+func (q *Queue) EnqueueIfUnder(value []byte, maxLen uint64) (*Item, bool, error) {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	// Check if queue is closed.
 	if !q.isOpen {
-		return nil, ErrDBClosed
+		return nil, false, ErrDBClosed
 	}
 
-	// Create new Item.
-	item := &Item{
-		ID:    q.tail + 1,
-		Key:   idToKey(q.tail + 1),
-		Value: value,
+	if q.Length() >= maxLen {
+		return nil, false, nil
 	}
 
-	// Add it to the queue.
-	if err := q.db.Put(item.Key, item.Value, nil); err != nil {
-		return nil, err
+	item, err := q.enqueue(&record{value: value})
+	if err != nil {
+		return nil, false, err
 	}
 
-	// Increment tail position.
-	q.tail++
+	return item, true, nil
+}
 
-	return item, nil
+// EnqueueWithTTL adds an item to the queue that expires once the given
+// duration has passed. A ttl of zero or less adds an item that never
+// expires.
+//
+// Expired items are skipped and removed by Dequeue and DequeueBatch,
+// and skipped by Peek. Until they are removed, expired items are still
+// included by Length and PeekByOffset. Use ExpireOldItems to remove
+// them all at once.
+func (q *Queue) EnqueueWithTTL(value []byte, ttl time.Duration) (*Item, error) {
+	rec := &record{value: value}
+	if ttl > 0 {
+		rec.expiresAt = time.Now().Add(ttl)
+	}
+
+	return q.trace(context.Background(), "goque.EnqueueWithTTL", func(context.Context) (*Item, error) {
+		q.Lock()
+		defer q.unlock()
+
+		return q.enqueue(rec)
+	})
+}
+
+// EnqueueAt adds an item to the queue which is not visible until the
+// given time. Until then, Dequeue, DequeueBatch and Peek skip over the
+// item, while items which are visible keep their FIFO order. Items
+// which are not visible yet are still included by Length and
+// PeekByOffset.
+//
+// Finding the next visible item means reading past every item in front
+// of it which is not visible yet, so queues holding a large number of
+// delayed items at their head are slower to dequeue from.
+func (q *Queue) EnqueueAt(value []byte, visibleAt time.Time) (*Item, error) {
+	return q.trace(context.Background(), "goque.EnqueueAt", func(context.Context) (*Item, error) {
+		q.Lock()
+		defer q.unlock()
+
+		return q.enqueue(&record{value: value, visibleAt: visibleAt})
+	})
+}
+
+// EnqueueIn adds an item to the queue which is not visible until the
+// given delay has passed. See EnqueueAt for how such items are handled.
+func (q *Queue) EnqueueIn(value []byte, delay time.Duration) (*Item, error) {
+	return q.EnqueueAt(value, time.Now().Add(delay))
+}
+
+// NextVisibleAt returns the time at which the next item of the queue
+// becomes visible, so callers can wait until then rather than polling.
+// If an item is visible already, the current time is returned. The
+// returned bool is false if the queue holds no live items, or is
+// closed.
+func (q *Queue) NextVisibleAt() (time.Time, bool) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return time.Time{}, false
+	}
+
+	return q.nextVisibleAt(time.Now())
+}
+
+// wakeAt returns the earliest time at which an item may become ready
+// to be dequeued without a change to the queue, either as the next item
+// becomes visible or as the earliest visibility timeout of the items in
+// flight passes. The queue must be locked by the caller.
+func (q *Queue) wakeAt(now time.Time) (time.Time, bool) {
+	next, ok := q.nextVisibleAt(now)
+	if !q.leaseAt.IsZero() && (!ok || q.leaseAt.Before(next)) {
+		next, ok = q.leaseAt, true
+	}
+	return next, ok
+}
+
+// nextVisibleAt returns the time at which the next item of the queue
+// becomes visible as of now, as returned by NextVisibleAt. The queue
+// must be locked by the caller.
+func (q *Queue) nextVisibleAt(now time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+	err := q.forEach(q.head+1, func(i *Item) bool {
+		if i.expired(now) {
+			return true
+		}
+
+		if i.visible(now) {
+			next, found = now, true
+			return false
+		}
+
+		if !found || i.visibleAt.Before(next) {
+			next, found = i.visibleAt, true
+		}
+		return true
+	})
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return next, found
 }
 
 // EnqueueString is a helper function for Enqueue that accepts a
@@ -89,26 +330,27 @@ func (q *Queue) EnqueueString(value string) (*Item, error) {
 }
 
 // EnqueueObject is a helper function for Enqueue that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the queue, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (q *Queue) EnqueueObject(value interface{}) (*Item, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(value); err != nil {
+	b, err := q.codec.Encode(value)
+	if err != nil {
 		return nil, err
 	}
 
-	return q.Enqueue(buffer.Bytes())
+	return q.Enqueue(b)
 }
 
 // EnqueueObjectAsJSON is a helper function for Enqueue that accepts
 // any value type, which is then encoded into a JSON byte slice using
-// encoding/json.
+// encoding/json. The Value of the item holds the JSON bytes, though
+// they are stored in a record along with the time the item was
+// enqueued, like the value of any other queue item.
 //
 // Use this function to handle encoding of complex types.
 func (q *Queue) EnqueueObjectAsJSON(value interface{}) (*Item, error) {
@@ -120,34 +362,254 @@ func (q *Queue) EnqueueObjectAsJSON(value interface{}) (*Item, error) {
 	return q.Enqueue(jsonBytes)
 }
 
-// Dequeue removes the next item in the queue and returns it.
-func (q *Queue) Dequeue() (*Item, error) {
+// EnqueueBatch adds the given values to the queue using a single
+// LevelDB write. Either all of the items are added or none are, and
+// ErrFull is returned if the queue does not have room for all of them.
+//
+// The returned items are in the same order as the given values.
+func (q *Queue) EnqueueBatch(values [][]byte) ([]*Item, error) {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	// Check if queue is closed.
 	if !q.isOpen {
 		return nil, ErrDBClosed
 	}
 
-	// Try to get the next item in the queue.
-	item, err := q.getItemByID(q.head + 1)
-	if err != nil {
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Check if the queue has room for every item.
+	if q.maxLength > 0 && q.Length()+uint64(len(values)) > q.maxLength {
+		return nil, ErrFull
+	}
+
+	// Create the new Items and add them to the batch.
+	batch := new(leveldb.Batch)
+	items := make([]*Item, len(values))
+	now := time.Now()
+	for i, value := range values {
+		rec := &record{value: value, enqueuedAt: now}
+		items[i] = newItem(q.tail+uint64(i)+1, rec, q.codec)
+
+		b, err := q.format.encode(rec)
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(items[i].Key, b)
+		q.indexItem(batch, items[i])
+	}
+
+	// Add them to the queue.
+	if err := q.db.Write(batch, q.writeOpts); err != nil {
 		return nil, err
 	}
 
-	// Remove this item from the queue.
-	if err := q.db.Delete(item.Key, nil); err != nil {
+	// Increment tail position and enqueued count.
+	q.tail += uint64(len(items))
+	q.enqueued += uint64(len(items))
+	q.added(items...)
+
+	// Wake up any goroutines waiting for an item.
+	q.notifyWaiters()
+
+	return items, nil
+}
+
+// EnqueueObjectBatch is a helper function for EnqueueBatch that
+// accepts values of any type, which are then encoded into byte slices
+// using the codec of the queue, which is encoding/gob by default.
+//
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
+// package works. Because of this, you should only use this function
+// to encode simple types.
+func (q *Queue) EnqueueObjectBatch(values []interface{}) ([]*Item, error) {
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		b, err := q.codec.Encode(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+	}
+
+	return q.EnqueueBatch(encoded)
+}
+
+// Dequeue removes the next item in the queue and returns it. Items
+// which are not visible yet, added using EnqueueAt or EnqueueIn, are
+// skipped and stay in place. The chunks of an item added using
+// EnqueueReader stay stored until the reader returned by its ValueReader
+// method is closed, or the queue is closed.
+func (q *Queue) Dequeue() (*Item, error) {
+	return q.trace(context.Background(), "goque.Dequeue", func(context.Context) (*Item, error) {
+		q.Lock()
+		defer q.unlock()
+
+		return q.dequeue(nil)
+	})
+}
+
+// DequeueIf removes the next item in the queue and returns it only if
+// the given predicate returns true for it. Otherwise ErrNotMatched is
+// returned and the queue is left untouched. The item is found, the
+// predicate called and the item removed while the queue is locked, so
+// no other goroutine can take the item in between. The predicate must
+// not use the queue itself.
+func (q *Queue) DequeueIf(pred func(*Item) bool) (*Item, error) {
+	return q.trace(context.Background(), "goque.DequeueIf", func(context.Context) (*Item, error) {
+		q.Lock()
+		defer q.unlock()
+
+		return q.dequeue(func(item *Item, batch *leveldb.Batch) error {
+			if !pred(item) {
+				return ErrNotMatched
+			}
+			return nil
+		})
+	})
+}
+
+// DequeueIfID removes the next item in the queue and returns it only if
+// its ID is the given ID, such as that of an item returned by an
+// earlier Peek. Otherwise ErrConflict is returned and the queue is left
+// untouched. The ID is compared and the item removed while the queue is
+// locked, so a consumer can make sure the head has not changed since
+// it was peeked before taking it.
+func (q *Queue) DequeueIfID(expectedHeadID uint64) (*Item, error) {
+	return q.trace(context.Background(), "goque.DequeueIfID", func(context.Context) (*Item, error) {
+		q.Lock()
+		defer q.unlock()
+
+		return q.dequeue(func(item *Item, batch *leveldb.Batch) error {
+			if item.ID != expectedHeadID {
+				return ErrConflict
+			}
+			return nil
+		})
+	})
+}
+
+// DequeueWait removes the next item in the queue and returns it. If
+// the queue is empty, DequeueWait blocks until an item is enqueued, an
+// item added using EnqueueAt or EnqueueIn becomes visible, the
+// visibility timeout of an item in flight passes, or the given context
+// is done, in which case the context error is returned.
+func (q *Queue) DequeueWait(ctx context.Context) (*Item, error) {
+	return q.trace(ctx, "goque.DequeueWait", func(ctx context.Context) (*Item, error) {
+		for {
+			q.Lock()
+			item, err := q.dequeue(nil)
+			if err != ErrEmpty {
+				q.unlock()
+				return item, err
+			}
+
+			// The queue is empty, so park until the next enqueue, or
+			// until a delayed item becomes visible or an item in
+			// flight is reclaimed. Another goroutine may still take
+			// that item first, in which case we simply wait again.
+			waitCh := q.waitChan()
+			var timer *time.Timer
+			var wakeCh <-chan time.Time
+			if next, ok := q.wakeAt(time.Now()); ok {
+				timer = time.NewTimer(time.Until(next))
+				wakeCh = timer.C
+			}
+			q.unlock()
+
+			select {
+			case <-waitCh:
+			case <-wakeCh:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			if err != ErrEmpty {
+				return nil, err
+			}
+		}
+	})
+}
+
+// WaitEmpty blocks until the queue holds no items, returning right away
+// if it is empty already, or until the given context is done, in which
+// case the context error is returned. As for Length, items which are
+// not visible yet still count, while items in flight do not. If the
+// queue is closed, ErrDBClosed is returned.
+func (q *Queue) WaitEmpty(ctx context.Context) error {
+	for {
+		q.Lock()
+
+		// Check if queue is closed.
+		if !q.isOpen {
+			q.Unlock()
+			return ErrDBClosed
+		}
+
+		if q.Length() == 0 {
+			q.Unlock()
+			return nil
+		}
+
+		// The queue holds items, so park until the next change, which
+		// may be the last item being removed.
+		waitCh := q.waitChan()
+		q.Unlock()
+
+		select {
+		case <-waitCh:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// DequeueBatch removes up to max items from the head of the queue
+// using a single LevelDB write and returns them in dequeue order.
+//
+// Fewer than max items are returned if the queue does not hold that
+// many, and ErrEmpty is returned if the queue is empty. As for Dequeue,
+// items which are not visible yet are skipped.
+func (q *Queue) DequeueBatch(max int) ([]*Item, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Check if queue is empty.
+	if q.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	items, err := q.dequeueReady(max, nil)
+	if err != nil {
 		return nil, err
 	}
 
-	// Increment head position.
-	q.head++
+	// Check if only expired or delayed items were found.
+	if len(items) == 0 && max > 0 {
+		return nil, ErrEmpty
+	}
 
-	return item, nil
+	return items, nil
 }
 
-// Peek returns the next item in the queue without removing it.
+// Peek returns the next item in the queue without removing it,
+// skipping any expired items and items which are not visible yet.
 func (q *Queue) Peek() (*Item, error) {
 	q.RLock()
 	defer q.RUnlock()
@@ -157,7 +619,80 @@ func (q *Queue) Peek() (*Item, error) {
 		return nil, ErrDBClosed
 	}
 
-	return q.getItemByID(q.head + 1)
+	// Try to get the next item in the queue.
+	now := time.Now()
+	item, err := q.getItemByID(q.head + 1)
+	if err != nil || item.ready(now) {
+		return item, err
+	}
+
+	// The next item has expired or is not visible yet, so find the
+	// first ready item. Expired items are left in place for the next
+	// dequeue to remove.
+	item = nil
+	err = q.forEach(q.head+1, func(i *Item) bool {
+		if !i.ready(now) {
+			return true
+		}
+		item = i
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrEmpty
+	}
+
+	return item, nil
+}
+
+// PeekMatch returns the first item in the queue, from the head, for
+// which the given predicate returns true, without removing it. If no
+// item matches, ErrNotMatched is returned, or ErrEmpty if the queue is
+// empty. As for Peek, expired items and items which are not visible yet
+// are skipped.
+//
+// The items are read from a snapshot of the database, and the
+// predicate is called without the queue being locked, so it may use
+// the queue itself.
+func (q *Queue) PeekMatch(pred func(*Item) bool) (*Item, error) {
+	q.RLock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.RUnlock()
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is empty.
+	if q.Length() == 0 {
+		q.RUnlock()
+		return nil, ErrEmpty
+	}
+
+	codec, format := q.codec, q.format
+	si := newSnapshotIterator(q.db, []*util.Range{{Start: idToKey(q.head + 1), Limit: idToKey(q.tail + 1)}}, false)
+	q.RUnlock()
+	defer si.release()
+
+	now := time.Now()
+	for si.next() {
+		rec, err := format.decode(si.value())
+		if err != nil {
+			return nil, err
+		}
+
+		item := newItem(keyToID(si.key()), rec, codec)
+		if item.ready(now) && pred(item) {
+			return item, nil
+		}
+	}
+	if si.err != nil {
+		return nil, si.err
+	}
+
+	return nil, ErrNotMatched
 }
 
 // PeekByOffset returns the item located at the given offset,
@@ -171,7 +706,36 @@ func (q *Queue) PeekByOffset(offset uint64) (*Item, error) {
 		return nil, ErrDBClosed
 	}
 
-	return q.getItemByID(q.head + offset + 1)
+	// Without any holes the item can be looked up directly.
+	if q.holes == 0 {
+		return q.getItemByID(q.head + offset + 1)
+	}
+
+	// Check if queue is empty or the offset is out of bounds.
+	if q.Length() == 0 {
+		return nil, ErrEmpty
+	} else if offset >= q.Length() {
+		return nil, ErrOutOfBounds
+	}
+
+	// Otherwise skip over the holes left by removed items.
+	var item *Item
+	err := q.forEach(q.head+1, func(i *Item) bool {
+		if offset == 0 {
+			item = i
+			return false
+		}
+		offset--
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrOutOfBounds
+	}
+
+	return item, nil
 }
 
 // PeekByID returns the item with the given ID without removing it.
@@ -187,34 +751,247 @@ func (q *Queue) PeekByID(id uint64) (*Item, error) {
 	return q.getItemByID(id)
 }
 
+// PeekTail returns the item at the tail of the queue, which is the last
+// item added, without removing it. Like PeekByOffset, the item is
+// returned even if it has expired or is not visible yet.
+func (q *Queue) PeekTail() (*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return q.getItemByID(q.tail)
+}
+
+// HeadAge returns how long the item at the head of the queue, which has
+// waited the longest, has been in the queue, such as to alert on stuck
+// consumers. Only the head item is read. It counts even if it has
+// expired or is not visible yet. ErrEmpty is returned if the queue is
+// empty. Items added by earlier versions of goque have no EnqueuedAt,
+// for which an age of zero is returned.
+func (q *Queue) HeadAge() (time.Duration, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	item, err := q.getItemByID(q.head + 1)
+	if err != nil {
+		return 0, err
+	}
+	if item.EnqueuedAt.IsZero() {
+		return 0, nil
+	}
+
+	return time.Since(item.EnqueuedAt), nil
+}
+
+// DeleteByID removes the item with the given ID from the queue, wherever
+// it is. Items removed from the middle of the queue leave a hole, which
+// is skipped by Dequeue and Peek and not counted by Length or
+// PeekByOffset. ErrOutOfBounds is returned if the queue does not hold
+// the item, such as when it was already dequeued.
+func (q *Queue) DeleteByID(id uint64) error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	// Check if item exists in queue.
+	if id <= q.head || id > q.tail {
+		return ErrOutOfBounds
+	}
+	item, err := q.getItem(id)
+	if err != nil {
+		return err
+	}
+
+	head, tail, holes, err := q.removalState(id)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	q.unindexItem(batch, item)
+	dropChunks(batch, item.chunks)
+	if err := q.dropUniqueKey(batch, id, item.uniqueKey); err != nil {
+		return err
+	}
+
+	return q.writeState(batch, head, tail, holes)
+}
+
 // Update updates an item in the queue without changing its position.
 func (q *Queue) Update(id uint64, newValue []byte) (*Item, error) {
+	_, item, err := q.UpdateAndGet(id, newValue)
+	return item, err
+}
+
+// UpdateAndGet updates an item in the queue without changing its
+// position, returning the item as it was before the update along with
+// the updated item. The previous value is read and the new value
+// written while the queue is locked, so no concurrent update is lost.
+func (q *Queue) UpdateAndGet(id uint64, newValue []byte) (*Item, *Item, error) {
+	return q.update(id, func(item *Item) error {
+		item.Value = newValue
+		return nil
+	})
+}
+
+// UpdateIf updates an item in the queue without changing its position,
+// but only if its current value is equal to expected. Otherwise
+// ErrConflict is returned and the item is left untouched. The value is
+// compared and the new value written while the queue is locked, so
+// concurrent workers can use UpdateIf for optimistic updates, reading
+// the item and retrying on ErrConflict.
+func (q *Queue) UpdateIf(id uint64, expected []byte, newValue []byte) (*Item, error) {
+	_, item, err := q.update(id, func(item *Item) error {
+		if !bytes.Equal(item.Value, expected) {
+			return ErrConflict
+		}
+		item.Value = newValue
+		return nil
+	})
+	return item, err
+}
+
+// UpdateObjectIf is a helper function for UpdateIf which updates the
+// item to the given value, encoded using the codec of the queue, only
+// if the given predicate returns true for the current item, which it
+// can decode using Item.ToObject. Otherwise ErrConflict is returned.
+// The predicate is called while the queue is locked, so it must not
+// use the queue itself.
+func (q *Queue) UpdateObjectIf(id uint64, pred func(*Item) bool, newValue interface{}) (*Item, error) {
+	b, err := q.codec.Encode(newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	_, item, err := q.update(id, func(item *Item) error {
+		if !pred(item) {
+			return ErrConflict
+		}
+		item.Value = b
+		return nil
+	})
+	return item, err
+}
+
+// update updates the item with the given ID using the given function,
+// which is called with a copy of the current item to change, returning
+// the item as it was before the update along with the updated item. If
+// the function returns an error, the item is left untouched. The
+// function always replaces the value, so the chunks of a streamed value
+// are removed.
+func (q *Queue) update(id uint64, fn func(*Item) error) (*Item, *Item, error) {
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	// Check if queue is closed.
 	if !q.isOpen {
-		return nil, ErrDBClosed
+		return nil, nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, nil, ErrReadOnly
 	}
 
 	// Check if item exists in queue.
 	if id <= q.head || id > q.tail {
-		return nil, ErrOutOfBounds
+		return nil, nil, ErrOutOfBounds
 	}
 
-	// Create new Item.
-	item := &Item{
-		ID:    id,
-		Key:   idToKey(id),
-		Value: newValue,
+	// Get the current item, keeping its record fields.
+	old, err := q.getItem(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	item := *old
+	if err := fn(&item); err != nil {
+		return nil, nil, err
 	}
 
-	// Update this item in the queue.
-	if err := q.db.Put(item.Key, item.Value, nil); err != nil {
-		return nil, err
+	// Update this item in the queue, along with its index entry.
+	item.chunks = nil
+	b, err := q.format.encode(item.record())
+	if err != nil {
+		return nil, nil, err
+	}
+	batch := new(leveldb.Batch)
+	q.unindexItem(batch, old)
+	q.detachChunks(batch, old)
+	batch.Put(item.Key, b)
+	q.indexItem(batch, &item)
+	if err := q.db.Write(batch, q.writeOpts); err != nil {
+		return nil, nil, err
 	}
 
-	return item, nil
+	return old, &item, nil
+}
+
+// UpdateBatch replaces the values of the items with the given IDs
+// without changing their positions, using a single LevelDB write. If
+// the queue does not hold any of the items, ErrOutOfBounds is returned
+// and nothing is updated. The record fields of each item, such as its
+// metadata and expiry, are kept, as they are by Update.
+func (q *Queue) UpdateBatch(updates map[uint64][]byte) error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	batch := new(leveldb.Batch)
+	for id, value := range updates {
+		// Check if item exists in queue.
+		if id <= q.head || id > q.tail {
+			return ErrOutOfBounds
+		}
+		old, err := q.getItem(id)
+		if err != nil {
+			return err
+		}
+
+		// Replace its value, removing the chunks of a streamed value.
+		item := *old
+		item.Value, item.chunks = value, nil
+		b, err := q.format.encode(item.record())
+		if err != nil {
+			return err
+		}
+		q.unindexItem(batch, old)
+		dropChunks(batch, old.chunks)
+		batch.Put(item.Key, b)
+		q.indexItem(batch, &item)
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+	return q.db.Write(batch, q.writeOpts)
 }
 
 // UpdateString is a helper function for Update that accepts a value
@@ -224,20 +1001,19 @@ func (q *Queue) UpdateString(id uint64, newValue string) (*Item, error) {
 }
 
 // UpdateObject is a helper function for Update that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the queue, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (q *Queue) UpdateObject(id uint64, newValue interface{}) (*Item, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(newValue); err != nil {
+	b, err := q.codec.Encode(newValue)
+	if err != nil {
 		return nil, err
 	}
-	return q.Update(id, buffer.Bytes())
+	return q.Update(id, b)
 }
 
 // UpdateObjectAsJSON is a helper function for Update that accepts
@@ -256,42 +1032,538 @@ func (q *Queue) UpdateObjectAsJSON(id uint64, newValue interface{}) (*Item, erro
 
 // Length returns the total number of items in the queue.
 func (q *Queue) Length() uint64 {
-	return q.tail - q.head
+	return q.tail - q.head - q.holes
+}
+
+// ExpireOldItems removes every expired item from the queue using a
+// single LevelDB write and returns the number of items removed.
+func (q *Queue) ExpireOldItems() (int, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	// Find the expired items, keeping track of the remaining ones.
+	now := time.Now()
+	batch := new(leveldb.Batch)
+	var first, last, live uint64
+	var dropErr error
+	err := q.forEach(q.head+1, func(item *Item) bool {
+		if item.expired(now) {
+			batch.Delete(item.Key)
+			q.unindexItem(batch, item)
+			dropChunks(batch, item.chunks)
+			dropErr = q.dropUniqueKey(batch, item.ID, item.uniqueKey)
+			return dropErr == nil
+		}
+
+		if live == 0 {
+			first = item.ID
+		}
+		last = item.ID
+		live++
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if dropErr != nil {
+		return 0, dropErr
+	}
+
+	removed := int(q.Length() - live)
+	if removed == 0 {
+		return 0, nil
+	}
+
+	// Set the head and tail around the remaining items.
+	head, tail, holes := q.tail, q.tail, uint64(0)
+	if live > 0 {
+		head, tail, holes = first-1, last, last-first+1-live
+	}
+
+	// Remove the expired items from the queue.
+	if err := q.writeState(batch, head, tail, holes); err != nil {
+		return 0, err
+	}
+
+	return removed, nil
+}
+
+// Purge removes every item from the queue using a single LevelDB
+// write, keeping the queue open. Items in flight are removed as well.
+// Items added afterwards start again from an ID of 1.
+func (q *Queue) Purge() error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	// Remove every item and reset the head and tail positions.
+	batch := new(leveldb.Batch)
+	if err := deleteRange(q.db, batch, itemRange); err != nil {
+		return err
+	}
+	if err := deleteRange(q.db, batch, inFlightRange); err != nil {
+		return err
+	}
+	if err := deleteRange(q.db, batch, uniqueRange); err != nil {
+		return err
+	}
+	if err := deleteRange(q.db, batch, indexRange); err != nil {
+		return err
+	}
+	if err := q.dropAllChunks(batch); err != nil {
+		return err
+	}
+	q.leaseAt = time.Time{}
+
+	return q.writeState(batch, 0, 0, 0)
 }
 
-// Close closes the LevelDB database of the queue.
+// Close closes the LevelDB database of the queue, flushing its writes
+// to disk first if it was opened with the NoSync option.
 func (q *Queue) Close() error {
+	return q.CloseContext(context.Background())
+}
+
+// CloseContext closes the LevelDB database of the queue, once the
+// operations submitted using EnqueueAsync and DequeueAsync before it
+// have finished.
+//
+// If the queue was opened with the NoSync option, its writes are flushed
+// to disk first. If ctx is done before the flush completes, ctx.Err()
+// is returned and the queue is left open and usable, with the flush
+// carrying on in the background, so Close can be called again later.
+func (q *Queue) CloseContext(ctx context.Context) error {
+	// Let the asynchronous operations submitted so far finish.
+	q.async.wait()
+
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	// Check if queue is already closed.
 	if !q.isOpen {
 		return nil
 	}
 
+	// Remove the chunks of streamed values whose items were removed.
+	if !q.readOnly {
+		if err := q.dropDetached(); err != nil {
+			return err
+		}
+	}
+
+	// Flush any writes which were not synced.
+	if err := flushContext(ctx, q.db, q.readOnly || q.writeOpts.Sync); err != nil {
+		return err
+	}
+
 	// Close the LevelDB database.
 	if err := q.db.Close(); err != nil {
 		return err
 	}
 
+	// An in-memory queue can not be opened again, so free its data.
+	if q.mem != nil {
+		if err := dropStorage(q.mem); err != nil {
+			return err
+		}
+		q.mem = nil
+	}
+
 	// Reset queue head and tail and set
 	// isOpen to false.
 	q.head = 0
 	q.tail = 0
+	q.holes = 0
 	q.isOpen = false
+	q.flusher.stop()
+
+	// Wake up any waiting goroutines so they see the queue is closed.
+	q.notifyWaiters()
+	q.watchers.closeAll()
 
 	return nil
 }
 
 // Drop closes and deletes the LevelDB database of the queue.
 func (q *Queue) Drop() error {
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
 	if err := q.Close(); err != nil {
 		return err
 	}
 
+	// A queue within a namespace only removes its own keys.
+	if ns, ok := q.db.(*namespace); ok {
+		return ns.drop(q.writeOpts)
+	}
+
 	return os.RemoveAll(q.DataDir)
 }
 
+// enqueue adds the given record to the queue as a new item. The
+// queue must be locked by the caller.
+func (q *Queue) enqueue(rec *record) (*Item, error) {
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Check if queue is full.
+	if q.maxLength > 0 && q.Length() >= q.maxLength {
+		return nil, ErrFull
+	}
+
+	// Create new Item, stamped with the time it is added.
+	if rec.enqueuedAt.IsZero() {
+		rec.enqueuedAt = time.Now()
+	}
+	batch := new(leveldb.Batch)
+
+	// Copy the chunks of a streamed value held by another database,
+	// such as one moved to a dead-letter queue.
+	if rec.chunks != nil && rec.chunks.src != q.db {
+		ref, err := q.copyChunks(batch, rec.chunks)
+		if err != nil {
+			return nil, err
+		}
+		rec.chunks = ref
+	}
+	item := newItem(q.tail+1, rec, q.codec)
+
+	// Add it to the queue.
+	b, err := q.format.encode(rec)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(item.Key, b)
+	q.indexItem(batch, item)
+
+	// Index the deduplication key of the item along with it.
+	if rec.uniqueKey != nil {
+		batch.Put(uniqueIndexKey(rec.uniqueKey), appendUint64(nil, item.ID))
+	}
+
+	if err := q.db.Write(batch, q.writeOpts); err != nil {
+		return nil, err
+	}
+
+	// Increment tail position and enqueued count.
+	q.tail++
+	q.enqueued++
+	q.added(item)
+
+	// Wake up any goroutines waiting for an item.
+	q.notifyWaiters()
+
+	return item, nil
+}
+
+// dequeue removes the next item in the queue and returns it, removing
+// any expired items in front of it. If take is not nil, it is called
+// with the item and the batch removing it before the batch is written,
+// so it can add its own changes to the same write. The queue must be
+// locked by the caller.
+func (q *Queue) dequeue(take func(*Item, *leveldb.Batch) error) (*Item, error) {
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	items, err := q.dequeueReady(1, take)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(items) == 0 {
+		return nil, ErrEmpty
+	}
+
+	return items[0], nil
+}
+
+// dequeueReady removes up to max ready items from the queue in order
+// using a single LevelDB write, and returns them. Expired items found
+// along the way are removed as well, while items which are not visible
+// yet are skipped and kept in place. If take is not nil, it is called
+// with each ready item and the batch before the batch is written. The
+// queue must be locked by the caller.
+func (q *Queue) dequeueReady(max int, take func(*Item, *leveldb.Batch) error) ([]*Item, error) {
+	now := time.Now()
+
+	// Return items whose visibility timeout passed to the queue first.
+	if err := q.reclaimDue(now); err != nil {
+		return nil, err
+	}
+
+	batch := new(leveldb.Batch)
+
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(q.head + 1), Limit: itemRange.Limit}, nil)
+	defer iter.Release()
+
+	// Walk the items, remembering the first and last items kept.
+	var items []*Item
+	var removed, first, last uint64
+	kept := false
+	for iter.Next() {
+		id := keyToID(iter.Key())
+
+		// Once enough items are found, the rest of the queue is kept.
+		if len(items) >= max {
+			if !kept {
+				first, kept = id, true
+			}
+			last = q.tail
+			break
+		}
+
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+
+		rec, err := q.format.decode(value)
+		if err != nil {
+			return nil, err
+		}
+		item := newItem(id, rec, q.codec)
+
+		if item.expired(now) || item.visible(now) {
+			// Removed items no longer hold their deduplication key.
+			if err := q.dropUniqueKey(batch, id, item.uniqueKey); err != nil {
+				return nil, err
+			}
+			item.uniqueKey = nil
+		}
+
+		switch {
+		case item.expired(now):
+			// Expired items are removed along the way.
+		case item.visible(now):
+			if take != nil {
+				if err := take(item, batch); err != nil {
+					return nil, err
+				}
+			}
+			items = append(items, item)
+		default:
+			// Items which are not visible yet stay in place.
+			if !kept {
+				first, kept = id, true
+			}
+			last = id
+			continue
+		}
+
+		batch.Delete(item.Key)
+		q.unindexItem(batch, item)
+		if item.expired(now) {
+			dropChunks(batch, item.chunks)
+		}
+		removed++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	// Set the head and tail around the remaining items.
+	head, tail, holes := q.tail, q.tail, uint64(0)
+	if remaining := q.Length() - removed; remaining > 0 {
+		head, tail = first-1, last
+		holes = tail - head - remaining
+	}
+
+	// Remove these items from the queue and update the positions.
+	q.detachChunks(batch, items...)
+	if err := q.writeState(batch, head, tail, holes); err != nil {
+		return nil, err
+	}
+	q.dequeued += uint64(len(items))
+	q.hooks.dequeued(items...)
+
+	return items, nil
+}
+
+// advanceHead returns the head position and number of holes of the
+// queue once the item directly after the given head position has been
+// removed.
+func (q *Queue) advanceHead(head, holes uint64) (uint64, uint64, error) {
+	// Without any holes the next item directly follows.
+	if holes == 0 {
+		return head + 1, 0, nil
+	}
+
+	// Otherwise seek to the next stored item.
+	next, err := q.seekItem(head + 2)
+	if err != nil {
+		return 0, 0, err
+	}
+	if next == 0 {
+		return q.tail, 0, nil
+	}
+
+	return next - 1, holes - (next - head - 2), nil
+}
+
+// seekItem returns the ID of the first item stored at or after the given
+// ID, or zero if there is none. Rather than looking up each ID in turn,
+// it seeks straight past any run of holes, so it takes a single LevelDB
+// seek however many items were deleted.
+func (q *Queue) seekItem(id uint64) (uint64, error) {
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(id), Limit: itemRange.Limit}, nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		return 0, iter.Error()
+	}
+	return keyToID(iter.Key()), nil
+}
+
+// retreatTail returns the tail position and number of holes of the
+// queue once the item at the given tail position has been removed.
+func (q *Queue) retreatTail(tail, holes uint64) (uint64, uint64, error) {
+	// Without any holes the previous item directly precedes.
+	if holes == 0 {
+		return tail - 1, 0, nil
+	}
+
+	// Otherwise seek to the previous stored item.
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(q.head + 1), Limit: idToKey(tail)}, nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		if err := iter.Error(); err != nil {
+			return 0, 0, err
+		}
+		return q.head, 0, nil
+	}
+
+	prev := keyToID(iter.Key())
+	return prev, holes - (tail - prev - 1), nil
+}
+
+// removalState returns the head and tail positions and number of holes
+// of the queue once the stored item with the given ID has been removed.
+func (q *Queue) removalState(id uint64) (uint64, uint64, uint64, error) {
+	switch id {
+	case q.head + 1:
+		head, holes, err := q.advanceHead(q.head, q.holes)
+		return head, q.tail, holes, err
+	case q.tail:
+		tail, holes, err := q.retreatTail(q.tail, q.holes)
+		return q.head, tail, holes, err
+	default:
+		return q.head, q.tail, q.holes + 1, nil
+	}
+}
+
+// writeState writes the given batch to the database and then sets the
+// head and tail positions and number of holes of the queue, waking up
+// any goroutines waiting for a change.
+func (q *Queue) writeState(batch *leveldb.Batch, head, tail, holes uint64) error {
+	if holes != q.holes {
+		q.putHoles(batch, holes)
+	}
+
+	if batch.Len() > 0 {
+		if err := q.db.Write(batch, q.writeOpts); err != nil {
+			return err
+		}
+	}
+
+	q.setState(head, tail, holes)
+	return nil
+}
+
+// setState sets the head and tail positions and number of holes of the
+// queue once they have been written.
+func (q *Queue) setState(head, tail, holes uint64) {
+	q.head, q.tail, q.holes = head, tail, holes
+
+	// Wake up any goroutines waiting for room in the queue.
+	q.notifyWaiters()
+}
+
+// putHoles adds the number of holes left between the head and tail of
+// the queue by removed items to the given batch.
+func (q *Queue) putHoles(batch *leveldb.Batch, holes uint64) {
+	if holes == 0 {
+		batch.Delete(internalKey("holes"))
+		return
+	}
+	batch.Put(internalKey("holes"), appendUint64(nil, holes))
+}
+
+// forEach calls fn for each item stored in the queue, in order,
+// starting from the given ID until fn returns false.
+func (q *Queue) forEach(id uint64, fn func(*Item) bool) error {
+	iter := q.db.NewIterator(&util.Range{Start: idToKey(id), Limit: itemRange.Limit}, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+
+		rec, err := q.format.decode(value)
+		if err != nil {
+			return err
+		}
+
+		if !fn(newItem(keyToID(iter.Key()), rec, q.codec)) {
+			break
+		}
+	}
+
+	return iter.Error()
+}
+
+// waitChan returns the channel that is closed on the next change to
+// the queue. The queue must be locked by the caller.
+func (q *Queue) waitChan() <-chan struct{} {
+	if q.waitCh == nil {
+		q.waitCh = make(chan struct{})
+	}
+	return q.waitCh
+}
+
+// notifyWaiters wakes up every goroutine waiting on the current wait
+// channel. The queue must be locked by the caller.
+func (q *Queue) notifyWaiters() {
+	if q.waitCh != nil {
+		close(q.waitCh)
+		q.waitCh = nil
+	}
+}
+
 // getItemByID returns an item, if found, for the given ID.
 func (q *Queue) getItemByID(id uint64) (*Item, error) {
 	// Check if empty or out of bounds.
@@ -301,20 +1573,32 @@ func (q *Queue) getItemByID(id uint64) (*Item, error) {
 		return nil, ErrOutOfBounds
 	}
 
+	return q.getItem(id)
+}
+
+// getItem returns the item stored with the given ID, without checking
+// the bounds of the queue.
+func (q *Queue) getItem(id uint64) (*Item, error) {
 	// Get item from database.
-	var err error
-	item := &Item{ID: id, Key: idToKey(id)}
-	if item.Value, err = q.db.Get(item.Key, nil); err != nil {
+	value, err := q.db.Get(idToKey(id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrOutOfBounds
+	} else if err != nil {
 		return nil, err
 	}
 
-	return item, nil
+	rec, err := q.format.decode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return newItem(id, rec, q.codec), nil
 }
 
 // init initializes the queue data.
 func (q *Queue) init() error {
 	// Create a new LevelDB Iterator.
-	iter := q.db.NewIterator(nil, nil)
+	iter := q.db.NewIterator(itemRange, nil)
 	defer iter.Release()
 
 	// Set queue head to the first item.
@@ -327,5 +1611,51 @@ func (q *Queue) init() error {
 		q.tail = keyToID(iter.Key())
 	}
 
-	return iter.Error()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Streamed values read their chunks from the queue database.
+	q.format.chunks = q.db
+
+	// Remove the chunks of streamed values left by a queue which was not
+	// closed.
+	if !q.readOnly {
+		if err := q.dropDetached(); err != nil {
+			return err
+		}
+	}
+
+	// Get the last stream ID given to a streamed value.
+	streams, err := q.db.Get(chunkSeqKey, nil)
+	if err == nil {
+		q.streams = binary.BigEndian.Uint64(streams)
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	// Get the last receipt given for an item in flight.
+	receipt, err := q.db.Get(receiptKey, nil)
+	if err == nil {
+		q.receipt = Receipt(binary.BigEndian.Uint64(receipt))
+	} else if err != leveldb.ErrNotFound {
+		return err
+	}
+
+	// Find the earliest visibility timeout of the items in flight. No
+	// timeout has passed as of the zero time, so nothing is reclaimed.
+	if _, err := q.reclaim(time.Time{}); err != nil {
+		return err
+	}
+
+	// Get the number of holes left by removed items.
+	holes, err := q.db.Get(internalKey("holes"), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	q.holes = binary.BigEndian.Uint64(holes)
+	return nil
 }
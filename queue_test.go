@@ -1,10 +1,19 @@
 package goque
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/syndtr/goleveldb/leveldb/comparer"
+	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 )
 
 func TestQueueClose(t *testing.T) {
@@ -52,21 +61,33 @@ func TestQueueDrop(t *testing.T) {
 	}
 }
 
-func TestQueueIncompatibleType(t *testing.T) {
-	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
-	pq, err := OpenPriorityQueue(file, ASC)
-	if err != nil {
-		t.Error(err)
-	}
-	defer pq.Drop()
-	pq.Close()
+func TestQueueGoqueFile(t *testing.T) {
+	for _, noSync := range []bool{false, true} {
+		file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+		q, err := OpenQueueWithOptions(file, &Options{NoSync: noSync})
+		if err != nil {
+			t.Error(err)
+		}
 
-	if _, err = OpenQueue(file); err != ErrIncompatibleType {
-		t.Error("Expected priority queue to return ErrIncompatibleTypes when opening goquePriorityQueue")
+		b, err := os.ReadFile(filepath.Join(file, "GOQUE"))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !bytes.Equal(b, []byte{byte(TypeQueue), GobCodec.ID()}) {
+			t.Errorf("Expected GOQUE file to hold the queue type and codec, got %v", b)
+		}
+
+		// The temporary file should have been renamed into place.
+		if _, err = os.Stat(filepath.Join(file, "GOQUE.tmp")); !os.IsNotExist(err) {
+			t.Errorf("Expected temporary GOQUE file to not exist, got %v", err)
+		}
+
+		q.Drop()
 	}
 }
 
-func TestQueueEnqueue(t *testing.T) {
+func TestQueuePurge(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -80,90 +101,93 @@ func TestQueueEnqueue(t *testing.T) {
 		}
 	}
 
-	if q.Length() != 10 {
-		t.Errorf("Expected queue size of 10, got %d", q.Length())
-	}
-}
-
-func TestQueueDequeue(t *testing.T) {
-	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
-	q, err := OpenQueue(file)
-	if err != nil {
+	if err = q.Purge(); err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
 
-	for i := 1; i <= 10; i++ {
-		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
-			t.Error(err)
-		}
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
 	}
 
-	if q.Length() != 10 {
-		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	if _, err = os.Stat(filepath.Join(file, "GOQUE")); err != nil {
+		t.Error(err)
 	}
 
-	deqItem, err := q.Dequeue()
+	item, err := q.EnqueueString("value")
 	if err != nil {
 		t.Error(err)
 	}
 
-	if q.Length() != 9 {
-		t.Errorf("Expected queue length of 9, got %d", q.Length())
+	if item.ID != 1 {
+		t.Errorf("Expected ID to be 1, got %d", item.ID)
 	}
 
-	compStr := "value for item 1"
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
 
-	if deqItem.ToString() != compStr {
-		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
 	}
 }
 
-func TestQueueEncodeDecodePointerJSON(t *testing.T) {
+func TestQueueIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
-	q, err := OpenQueue(file)
+	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
+	defer pq.Drop()
+	pq.Close()
 
-	type subObject struct {
-		Value *int
+	if _, err = OpenQueue(file); !errors.Is(err, ErrIncompatibleType) {
+		t.Error("Expected priority queue to return ErrIncompatibleTypes when opening goquePriorityQueue")
 	}
 
-	type object struct {
-		Value     int
-		SubObject subObject
+	// The error names both of the types.
+	var typeErr *IncompatibleTypeError
+	if !errors.As(err, &typeErr) {
+		t.Errorf("Expected to get an *IncompatibleTypeError, got %T", err)
+	} else if typeErr.Stored != TypePriorityQueue || typeErr.Requested != TypeQueue {
+		t.Errorf("Expected stored priority and requested queue types, got %s and %s", typeErr.Stored, typeErr.Requested)
 	}
 
-	val := 0
-	obj := object{
-		Value: 0,
-		SubObject: subObject{
-			Value: &val,
-		},
-	}
+	compStr := "goque: Stored type priority is incompatible with opener type queue"
 
-	if _, err = q.EnqueueObjectAsJSON(obj); err != nil {
-		t.Error(err)
+	if err.Error() != compStr {
+		t.Errorf("Expected error message '%s', got '%s'", compStr, err.Error())
 	}
+}
 
-	item, err := q.Dequeue()
+func TestQueueOpenContext(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
 
-	var itemObj object
-	if err := item.ToObjectFromJSON(&itemObj); err != nil {
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		q.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	q2, err := OpenQueueContext(ctx, file)
+	if err != nil {
 		t.Error(err)
 	}
+	defer q2.Drop()
 
-	if *itemObj.SubObject.Value != 0 {
-		t.Errorf("Expected object subobject value to be '0', got '%v'", *itemObj.SubObject.Value)
+	if _, err = q2.EnqueueString("value"); err != nil {
+		t.Error(err)
 	}
 }
 
-func TestQueuePeek(t *testing.T) {
+func TestQueueOpenContextTimeout(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -171,77 +195,86 @@ func TestQueuePeek(t *testing.T) {
 	}
 	defer q.Drop()
 
-	compStr := "value for item"
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
 
-	if _, err = q.EnqueueString(compStr); err != nil {
-		t.Error(err)
+	if _, err = OpenQueueContext(ctx, file); err == nil || !isLockError(err) {
+		t.Errorf("Expected to get lock error, got %v", err)
 	}
+}
 
-	peekItem, err := q.Peek()
+func TestQueueOpenContextIncompatibleType(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, ASC)
 	if err != nil {
 		t.Error(err)
 	}
+	defer pq.Drop()
 
-	if peekItem.ToString() != compStr {
-		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
-	}
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		pq.Close()
+	}()
 
-	if q.Length() != 1 {
-		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err = OpenQueueContext(ctx, file); !errors.Is(err, ErrIncompatibleType) {
+		t.Errorf("Expected to get incompatible type error, got %v", err)
 	}
 }
 
-func TestQueuePeekByOffset(t *testing.T) {
+func TestQueueOpenWithLevelOptions(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
-	q, err := OpenQueue(file)
+	lopts := &opt.Options{
+		BlockCacheCapacity: 16 * opt.MiB,
+		Filter:             filter.NewBloomFilter(10),
+		ReadOnly:           true,
+		Comparer:           comparer.DefaultComparer,
+	}
+
+	q, err := OpenQueueWithLevelOptions(file, lopts)
 	if err != nil {
 		t.Error(err)
 	}
 	defer q.Drop()
 
+	// The caller's options should not be changed.
+	if !lopts.ReadOnly || lopts.Comparer == nil {
+		t.Errorf("Expected LevelDB options to be unchanged, got %+v", lopts)
+	}
+
+	// ReadOnly can not be overridden, so the queue should be writable.
 	for i := 1; i <= 10; i++ {
 		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
 			t.Error(err)
 		}
 	}
 
-	compStrFirst := "value for item 1"
-	compStrLast := "value for item 10"
-	compStr := "value for item 4"
-
-	peekFirstItem, err := q.PeekByOffset(0)
+	deqItem, err := q.Dequeue()
 	if err != nil {
 		t.Error(err)
 	}
 
-	if peekFirstItem.ToString() != compStrFirst {
-		t.Errorf("Expected string to be '%s', got '%s'", compStrFirst, peekFirstItem.ToString())
-	}
-
-	peekLastItem, err := q.PeekByOffset(9)
-	if err != nil {
-		t.Error(err)
-	}
+	compStr := "value for item 1"
 
-	if peekLastItem.ToString() != compStrLast {
-		t.Errorf("Expected string to be '%s', got '%s'", compStrLast, peekLastItem.ToString())
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
 	}
 
-	peekItem, err := q.PeekByOffset(3)
+	// The queue should open again using the default options.
+	q.Close()
+	q, err = OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if peekItem.ToString() != compStr {
-		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
-	}
-
-	if q.Length() != 10 {
-		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	if q.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", q.Length())
 	}
 }
 
-func TestQueuePeekByID(t *testing.T) {
+func TestQueueReadOnly(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -254,69 +287,74 @@ func TestQueuePeekByID(t *testing.T) {
 			t.Error(err)
 		}
 	}
+	q.Close()
 
-	compStr := "value for item 3"
+	// Readers should not create the GOQUE file.
+	if err = os.Remove(filepath.Join(file, "GOQUE")); err != nil {
+		t.Error(err)
+	}
 
-	peekItem, err := q.PeekByID(3)
+	roq, err := OpenQueueReadOnly(file)
 	if err != nil {
 		t.Error(err)
 	}
+	defer roq.Close()
 
-	if peekItem.ToString() != compStr {
-		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	roq2, err := OpenQueueReadOnly(file)
+	if err != nil {
+		t.Error(err)
 	}
+	defer roq2.Close()
 
-	if q.Length() != 10 {
-		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	if roq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", roq.Length())
 	}
-}
 
-func TestQueueUpdate(t *testing.T) {
-	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
-	q, err := OpenQueue(file)
+	peekItem, err := roq2.PeekByID(3)
 	if err != nil {
 		t.Error(err)
 	}
-	defer q.Drop()
 
-	for i := 1; i <= 10; i++ {
-		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
-			t.Error(err)
-		}
+	compStr := "value for item 3"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
 	}
 
-	item, err := q.PeekByID(3)
-	if err != nil {
-		t.Error(err)
+	it := roq.NewIterator()
+	defer it.Release()
+
+	var count int
+	for it.Next() {
+		count++
 	}
 
-	oldCompStr := "value for item 3"
-	newCompStr := "new value for item 3"
+	if count != 10 {
+		t.Errorf("Expected to iterate over 10 items, got %d", count)
+	}
 
-	if item.ToString() != oldCompStr {
-		t.Errorf("Expected string to be '%s', got '%s'", oldCompStr, item.ToString())
+	if _, err = roq.EnqueueString("value"); err != ErrReadOnly {
+		t.Errorf("Expected to get read-only error, got %v", err)
 	}
 
-	updatedItem, err := q.Update(item.ID, []byte(newCompStr))
-	if err != nil {
-		t.Error(err)
+	if _, err = roq.Dequeue(); err != ErrReadOnly {
+		t.Errorf("Expected to get read-only error, got %v", err)
 	}
 
-	if updatedItem.ToString() != newCompStr {
-		t.Errorf("Expected current item value to be '%s', got '%s'", newCompStr, item.ToString())
+	if _, err = roq.UpdateString(1, "new value"); err != ErrReadOnly {
+		t.Errorf("Expected to get read-only error, got %v", err)
 	}
 
-	newItem, err := q.PeekByID(3)
-	if err != nil {
-		t.Error(err)
+	if err = roq.Drop(); err != ErrReadOnly {
+		t.Errorf("Expected to get read-only error, got %v", err)
 	}
 
-	if newItem.ToString() != newCompStr {
-		t.Errorf("Expected new item value to be '%s', got '%s'", newCompStr, item.ToString())
+	if _, err = os.Stat(filepath.Join(file, "GOQUE")); !os.IsNotExist(err) {
+		t.Errorf("Expected GOQUE file to not exist, got %v", err)
 	}
 }
 
-func TestQueueUpdateString(t *testing.T) {
+func TestQueueEnqueue(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -330,38 +368,60 @@ func TestQueueUpdateString(t *testing.T) {
 		}
 	}
 
-	item, err := q.PeekByID(3)
+	if q.Length() != 10 {
+		t.Errorf("Expected queue size of 10, got %d", q.Length())
+	}
+}
+
+func TestQueueEnqueueBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
+	defer q.Drop()
 
-	oldCompStr := "value for item 3"
-	newCompStr := "new value for item 3"
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
 
-	if item.ToString() != oldCompStr {
-		t.Errorf("Expected string to be '%s', got '%s'", oldCompStr, item.ToString())
+	var values [][]byte
+	for i := 2; i <= 10; i++ {
+		values = append(values, []byte(fmt.Sprintf("value for item %d", i)))
 	}
 
-	updatedItem, err := q.UpdateString(item.ID, newCompStr)
+	items, err := q.EnqueueBatch(values)
 	if err != nil {
 		t.Error(err)
 	}
 
-	if updatedItem.ToString() != newCompStr {
-		t.Errorf("Expected current item value to be '%s', got '%s'", newCompStr, item.ToString())
+	if len(items) != 9 {
+		t.Errorf("Expected 9 items, got %d", len(items))
 	}
 
-	newItem, err := q.PeekByID(3)
-	if err != nil {
-		t.Error(err)
+	if items[0].ID != 2 || items[8].ID != 10 {
+		t.Errorf("Expected item IDs 2 through 10, got %d through %d", items[0].ID, items[8].ID)
 	}
 
-	if newItem.ToString() != newCompStr {
-		t.Errorf("Expected new item value to be '%s', got '%s'", newCompStr, item.ToString())
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	for i := 1; i <= 10; i++ {
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		deqItem, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
 	}
 }
 
-func TestQueueUpdateObject(t *testing.T) {
+func TestQueueEnqueueObjectBatch(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -373,10 +433,13 @@ func TestQueueUpdateObject(t *testing.T) {
 		Value int
 	}
 
+	var values []interface{}
 	for i := 1; i <= 10; i++ {
-		if _, err = q.EnqueueObject(object{i}); err != nil {
-			t.Error(err)
-		}
+		values = append(values, object{i})
+	}
+
+	if _, err = q.EnqueueObjectBatch(values); err != nil {
+		t.Error(err)
 	}
 
 	item, err := q.PeekByID(3)
@@ -384,46 +447,36 @@ func TestQueueUpdateObject(t *testing.T) {
 		t.Error(err)
 	}
 
-	oldCompObj := object{3}
-	newCompObj := object{33}
-
 	var obj object
 	if err := item.ToObject(&obj); err != nil {
 		t.Error(err)
 	}
 
-	if obj != oldCompObj {
-		t.Errorf("Expected object to be '%+v', got '%+v'", oldCompObj, obj)
+	if obj.Value != 3 {
+		t.Errorf("Expected object value to be 3, got %d", obj.Value)
 	}
+}
 
-	updatedItem, err := q.UpdateObject(item.ID, newCompObj)
+func TestQueueEnqueueBatchClosed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
+	defer q.Drop()
 
-	if err := updatedItem.ToObject(&obj); err != nil {
-		t.Error(err)
-	}
-
-	if obj != newCompObj {
-		t.Errorf("Expected current object to be '%+v', got '%+v'", newCompObj, obj)
-	}
-
-	newItem, err := q.PeekByID(3)
-	if err != nil {
-		t.Error(err)
-	}
+	q.Close()
 
-	if err := newItem.ToObject(&obj); err != nil {
-		t.Error(err)
+	if _, err = q.EnqueueBatch([][]byte{[]byte("value")}); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
 	}
 
-	if obj != newCompObj {
-		t.Errorf("Expected new object to be '%+v', got '%+v'", newCompObj, obj)
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
 	}
 }
 
-func TestQueueUpdateObjectAsJSON(t *testing.T) {
+func TestQueueDequeue(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -431,85 +484,1394 @@ func TestQueueUpdateObjectAsJSON(t *testing.T) {
 	}
 	defer q.Drop()
 
-	type subObject struct {
-		Value *int
-	}
-
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", q.Length())
+	}
+
+	compStr := "value for item 1"
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+}
+
+func TestQueueDequeueIf(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// The head is left in place if it does not match.
+	_, err = q.DequeueIf(func(item *Item) bool {
+		return item.ToString() == "value for item 2"
+	})
+	if err != ErrNotMatched {
+		t.Errorf("Expected to get not matched error, got %v", err)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	item, err := q.DequeueIf(func(item *Item) bool {
+		return item.ToString() == "value for item 1"
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.DequeueIf(func(*Item) bool { return true }); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueDequeueIfID(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	head, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Another consumer takes the head in the meantime.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.DequeueIfID(head.ID); err != ErrConflict {
+		t.Errorf("Expected to get conflict error, got %v", err)
+	}
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	item, err := q.DequeueIfID(2)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 2" {
+		t.Errorf("Expected string to be 'value for item 2', got '%s'", item.ToString())
+	}
+
+	if _, err = q.DequeueIfID(3); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueDequeueBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := q.DequeueBatch(4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 4 {
+		t.Errorf("Expected 4 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", i+1)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if q.Length() != 6 {
+		t.Errorf("Expected queue length of 6, got %d", q.Length())
+	}
+
+	items, err = q.DequeueBatch(10)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 6 {
+		t.Errorf("Expected 6 items, got %d", len(items))
+	}
+
+	if _, err = q.DequeueBatch(10); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueEncodeDecodePointerJSON(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	type subObject struct {
+		Value *int
+	}
+
+	type object struct {
+		Value     int
+		SubObject subObject
+	}
+
+	val := 0
+	obj := object{
+		Value: 0,
+		SubObject: subObject{
+			Value: &val,
+		},
+	}
+
+	if _, err = q.EnqueueObjectAsJSON(obj); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var itemObj object
+	if err := item.ToObjectFromJSON(&itemObj); err != nil {
+		t.Error(err)
+	}
+
+	if *itemObj.SubObject.Value != 0 {
+		t.Errorf("Expected object subobject value to be '0', got '%v'", *itemObj.SubObject.Value)
+	}
+}
+
+func TestQueueMixedObjectEncodings(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	type object struct {
+		Value int
+	}
+
+	if _, err = q.EnqueueObject(object{1}); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.EnqueueObjectAsJSON(object{2}); err != nil {
+		t.Error(err)
+	}
+
+	gobItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var obj object
+	if err := gobItem.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Value != 1 {
+		t.Errorf("Expected object value to be 1, got %d", obj.Value)
+	}
+
+	jsonItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := `{"Value":2}`
+
+	if jsonItem.ToString() != compStr {
+		t.Errorf("Expected stored JSON to be '%s', got '%s'", compStr, jsonItem.ToString())
+	}
+
+	if err := jsonItem.ToObjectFromJSON(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Value != 2 {
+		t.Errorf("Expected object value to be 2, got %d", obj.Value)
+	}
+}
+
+func TestQueuePeek(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	compStr := "value for item"
+
+	if _, err = q.EnqueueString(compStr); err != nil {
+		t.Error(err)
+	}
+
+	peekItem, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
+
+func TestQueuePeekMatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.PeekMatch(func(*Item) bool { return true }); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.PeekMatch(func(item *Item) bool {
+		return item.ID > 3
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 4"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+
+	_, err = q.PeekMatch(func(item *Item) bool {
+		return item.ToString() == "value for item 6"
+	})
+	if err != ErrNotMatched {
+		t.Errorf("Expected to get not matched error, got %v", err)
+	}
+}
+
+func TestQueuePeekByOffset(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	compStrFirst := "value for item 1"
+	compStrLast := "value for item 10"
+	compStr := "value for item 4"
+
+	peekFirstItem, err := q.PeekByOffset(0)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekFirstItem.ToString() != compStrFirst {
+		t.Errorf("Expected string to be '%s', got '%s'", compStrFirst, peekFirstItem.ToString())
+	}
+
+	peekLastItem, err := q.PeekByOffset(9)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekLastItem.ToString() != compStrLast {
+		t.Errorf("Expected string to be '%s', got '%s'", compStrLast, peekLastItem.ToString())
+	}
+
+	peekItem, err := q.PeekByOffset(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+}
+
+func TestQueuePeekByID(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	compStr := "value for item 3"
+
+	peekItem, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+}
+
+func TestQueueHeadAge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.HeadAge(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, err = q.EnqueueString("value for item 2"); err != nil {
+		t.Error(err)
+	}
+
+	age, err := q.HeadAge()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if age < 20*time.Millisecond || age > time.Minute {
+		t.Errorf("Expected head age of at least 20ms, got %v", age)
+	}
+
+	// The age should be that of the new head once the old one is gone.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	newAge, err := q.HeadAge()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newAge >= age {
+		t.Errorf("Expected head age below %v, got %v", age, newAge)
+	}
+}
+
+func TestQueuePeekTail(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.PeekTail(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	compStr := "value for item 10"
+
+	peekItem, err := q.PeekTail()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+}
+
+func TestQueueUpdate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	oldCompStr := "value for item 3"
+	newCompStr := "new value for item 3"
+
+	if item.ToString() != oldCompStr {
+		t.Errorf("Expected string to be '%s', got '%s'", oldCompStr, item.ToString())
+	}
+
+	updatedItem, err := q.Update(item.ID, []byte(newCompStr))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if updatedItem.ToString() != newCompStr {
+		t.Errorf("Expected current item value to be '%s', got '%s'", newCompStr, item.ToString())
+	}
+
+	newItem, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != newCompStr {
+		t.Errorf("Expected new item value to be '%s', got '%s'", newCompStr, item.ToString())
+	}
+}
+
+func TestQueueUpdateAndGet(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	oldCompStr := "value for item 3"
+	newCompStr := "new value for item 3"
+
+	oldItem, updatedItem, err := q.UpdateAndGet(3, []byte(newCompStr))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if oldItem.ToString() != oldCompStr {
+		t.Errorf("Expected old item value to be '%s', got '%s'", oldCompStr, oldItem.ToString())
+	}
+
+	if updatedItem.ToString() != newCompStr {
+		t.Errorf("Expected current item value to be '%s', got '%s'", newCompStr, updatedItem.ToString())
+	}
+
+	newItem, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != newCompStr {
+		t.Errorf("Expected new item value to be '%s', got '%s'", newCompStr, newItem.ToString())
+	}
+
+	if _, _, err = q.UpdateAndGet(11, []byte(newCompStr)); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+}
+
+func TestQueueUpdateIf(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.UpdateIf(1, []byte("other value"), []byte("new value")); err != ErrConflict {
+		t.Errorf("Expected to get conflict error, got %v", err)
+	}
+
+	item, err := q.UpdateIf(1, []byte("value for item 1"), []byte("new value"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "new value" {
+		t.Errorf("Expected string to be 'new value', got '%s'", item.ToString())
+	}
+
+	// The expected value is now out of date.
+	if _, err = q.UpdateIf(1, []byte("value for item 1"), []byte("newer value")); err != ErrConflict {
+		t.Errorf("Expected to get conflict error, got %v", err)
+	}
+
+	item, err = q.PeekByID(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "new value" {
+		t.Errorf("Expected string to be 'new value', got '%s'", item.ToString())
+	}
+
+	if _, err = q.UpdateIf(2, nil, []byte("new value")); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+}
+
+func TestQueueUpdateObjectIf(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	type object struct {
+		Version int
+	}
+
+	if _, err = q.EnqueueObject(object{Version: 1}); err != nil {
+		t.Error(err)
+	}
+
+	// versionIs returns a predicate matching the given version.
+	versionIs := func(version int) func(*Item) bool {
+		return func(item *Item) bool {
+			var obj object
+			if err := item.ToObject(&obj); err != nil {
+				t.Error(err)
+			}
+			return obj.Version == version
+		}
+	}
+
+	if _, err = q.UpdateObjectIf(1, versionIs(2), object{Version: 3}); err != ErrConflict {
+		t.Errorf("Expected to get conflict error, got %v", err)
+	}
+
+	item, err := q.UpdateObjectIf(1, versionIs(1), object{Version: 2})
+	if err != nil {
+		t.Error(err)
+	}
+
+	var obj object
+	if err = item.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj.Version != 2 {
+		t.Errorf("Expected version to be 2, got %d", obj.Version)
+	}
+}
+
+func TestQueueUpdateBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	// Nothing is updated if any item is missing.
+	err = q.UpdateBatch(map[uint64][]byte{2: []byte("new value 2"), 1: []byte("new value 1")})
+	if err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+	item, err := q.PeekByID(2)
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "value for item 2" {
+		t.Errorf("Expected value for item 2, got %s", item.ToString())
+	}
+
+	if err = q.UpdateBatch(map[uint64][]byte{2: []byte("new value 2"), 4: []byte("new value 4")}); err != nil {
+		t.Error(err)
+	}
+
+	for i := 2; i <= 5; i++ {
+		compStr := fmt.Sprintf("value for item %d", i)
+		if i%2 == 0 {
+			compStr = fmt.Sprintf("new value %d", i)
+		}
+
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestQueueUpdateString(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	oldCompStr := "value for item 3"
+	newCompStr := "new value for item 3"
+
+	if item.ToString() != oldCompStr {
+		t.Errorf("Expected string to be '%s', got '%s'", oldCompStr, item.ToString())
+	}
+
+	updatedItem, err := q.UpdateString(item.ID, newCompStr)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if updatedItem.ToString() != newCompStr {
+		t.Errorf("Expected current item value to be '%s', got '%s'", newCompStr, item.ToString())
+	}
+
+	newItem, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != newCompStr {
+		t.Errorf("Expected new item value to be '%s', got '%s'", newCompStr, item.ToString())
+	}
+}
+
+func TestQueueUpdateObject(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	type object struct {
+		Value int
+	}
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueObject(object{i}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	oldCompObj := object{3}
+	newCompObj := object{33}
+
+	var obj object
+	if err := item.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj != oldCompObj {
+		t.Errorf("Expected object to be '%+v', got '%+v'", oldCompObj, obj)
+	}
+
+	updatedItem, err := q.UpdateObject(item.ID, newCompObj)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := updatedItem.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj != newCompObj {
+		t.Errorf("Expected current object to be '%+v', got '%+v'", newCompObj, obj)
+	}
+
+	newItem, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := newItem.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj != newCompObj {
+		t.Errorf("Expected new object to be '%+v', got '%+v'", newCompObj, obj)
+	}
+}
+
+func TestQueueUpdateObjectAsJSON(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	type subObject struct {
+		Value *int
+	}
+
 	type object struct {
 		Value     int
 		SubObject subObject
 	}
 
-	for i := 1; i <= 10; i++ {
-		obj := object{
-			Value: i,
-			SubObject: subObject{
-				Value: &i,
-			},
-		}
+	for i := 1; i <= 10; i++ {
+		obj := object{
+			Value: i,
+			SubObject: subObject{
+				Value: &i,
+			},
+		}
+
+		if _, err = q.EnqueueObjectAsJSON(obj); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	oldCompObjVal := 3
+	oldCompObj := object{
+		Value: 3,
+		SubObject: subObject{
+			Value: &oldCompObjVal,
+		},
+	}
+	newCompObjVal := 33
+	newCompObj := object{
+		Value: 33,
+		SubObject: subObject{
+			Value: &newCompObjVal,
+		},
+	}
+
+	var obj object
+	if err := item.ToObjectFromJSON(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if *obj.SubObject.Value != *oldCompObj.SubObject.Value {
+		t.Errorf("Expected object subobject value to be '%+v', got '%+v'", *oldCompObj.SubObject.Value, *obj.SubObject.Value)
+	}
+
+	updatedItem, err := q.UpdateObjectAsJSON(item.ID, newCompObj)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := updatedItem.ToObjectFromJSON(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if *obj.SubObject.Value != *newCompObj.SubObject.Value {
+		t.Errorf("Expected current object subobject value to be '%+v', got '%+v'", *newCompObj.SubObject.Value, *obj.SubObject.Value)
+	}
+
+	newItem, err := q.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := newItem.ToObjectFromJSON(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if *obj.SubObject.Value != *newCompObj.SubObject.Value {
+		t.Errorf("Expected current object subobject value to be '%+v', got '%+v'", *newCompObj.SubObject.Value, *obj.SubObject.Value)
+	}
+}
+
+func TestQueueUpdateOutOfBounds(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", q.Length())
+	}
+
+	if _, err = q.Update(deqItem.ID, []byte(`new value`)); err != ErrOutOfBounds {
+		t.Errorf("Expected to get queue out of bounds error, got %s", err.Error())
+	}
+
+	if _, err = q.Update(deqItem.ID+1, []byte(`new value`)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQueueDequeueWait(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	compStr := "value for item"
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := q.EnqueueString(compStr); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	deqItem, err := q.DequeueWait(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+}
+
+func TestQueueDequeueWaitDelayed(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// The only item becomes visible while DequeueWait is parked.
+	compStr := "value for item"
+	if _, err = q.EnqueueIn([]byte(compStr), 100*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	deqItem, err := q.DequeueWait(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if deqItem != nil && deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+}
+
+func TestQueueDequeueWaitCancel(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = q.DequeueWait(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected to get context deadline exceeded error, got %v", err)
+	}
+}
+
+func TestQueueWaitEmpty(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// An empty queue should return right away.
+	if err = q.WaitEmpty(ctx); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	go func() {
+		for i := 1; i <= 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+			if _, err := q.Dequeue(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	if err = q.WaitEmpty(ctx); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+
+	if _, err = q.EnqueueString("value for item 4"); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err = q.WaitEmpty(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Expected to get context deadline exceeded error, got %v", err)
+	}
+}
+
+func TestQueueEnqueueIfUnder(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// Concurrent producers should never take the queue past the limit.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	added := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, ok, err := q.EnqueueIfUnder([]byte("value"), 25)
+				if err != nil {
+					t.Error(err)
+				}
+				if ok {
+					mu.Lock()
+					added++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if added != 25 {
+		t.Errorf("Expected 25 items to be added, got %d", added)
+	}
+
+	if q.Length() != 25 {
+		t.Errorf("Expected queue length of 25, got %d", q.Length())
+	}
+
+	item, ok, err := q.EnqueueIfUnder([]byte("value"), 25)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ok || item != nil {
+		t.Errorf("Expected no item to be added, got %v and %v", item, ok)
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if _, ok, err = q.EnqueueIfUnder([]byte("value"), 25); err != nil || !ok {
+		t.Errorf("Expected item to be added, got %v and %v", ok, err)
+	}
+}
+
+func TestQueueMaxLength(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{MaxLength: 5})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.EnqueueString("value for item 6"); err != ErrFull {
+		t.Errorf("Expected to get queue full error, got %v", err)
+	}
+
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.EnqueueBatch([][]byte{[]byte("value for item 6"), []byte("value for item 7")}); err != ErrFull {
+		t.Errorf("Expected to get queue full error, got %v", err)
+	}
+
+	if _, err = q.EnqueueString("value for item 6"); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+}
+
+func TestQueueEnqueueWait(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{MaxLength: 1})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
 
-		if _, err = q.EnqueueObjectAsJSON(obj); err != nil {
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		if _, err := q.Dequeue(); err != nil {
 			t.Error(err)
 		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	item, err := q.EnqueueWait(ctx, []byte("value for item 2"))
+	if err != nil {
+		t.Error(err)
 	}
 
-	item, err := q.PeekByID(3)
+	if item.ID != 2 {
+		t.Errorf("Expected ID to be 2, got %d", item.ID)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = q.EnqueueWait(ctx, []byte("value for item 3")); err != context.DeadlineExceeded {
+		t.Errorf("Expected to get context deadline exceeded error, got %v", err)
+	}
+}
+
+func TestQueueEnqueueWithTTL(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
 	if err != nil {
 		t.Error(err)
 	}
+	defer q.Drop()
 
-	oldCompObjVal := 3
-	oldCompObj := object{
-		Value: 3,
-		SubObject: subObject{
-			Value: &oldCompObjVal,
-		},
+	if _, err = q.EnqueueWithTTL([]byte("expiring value"), 10*time.Millisecond); err != nil {
+		t.Error(err)
 	}
-	newCompObjVal := 33
-	newCompObj := object{
-		Value: 33,
-		SubObject: subObject{
-			Value: &newCompObjVal,
-		},
+
+	compStr := "value for item"
+
+	if _, err = q.EnqueueWithTTL([]byte(compStr), time.Hour); err != nil {
+		t.Error(err)
 	}
 
-	var obj object
-	if err := item.ToObjectFromJSON(&obj); err != nil {
+	time.Sleep(20 * time.Millisecond)
+
+	peekItem, err := q.Peek()
+	if err != nil {
 		t.Error(err)
 	}
 
-	if *obj.SubObject.Value != *oldCompObj.SubObject.Value {
-		t.Errorf("Expected object subobject value to be '%+v', got '%+v'", *oldCompObj.SubObject.Value, *obj.SubObject.Value)
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
 	}
 
-	updatedItem, err := q.UpdateObjectAsJSON(item.ID, newCompObj)
+	deqItem, err := q.Dequeue()
 	if err != nil {
 		t.Error(err)
 	}
 
-	if err := updatedItem.ToObjectFromJSON(&obj); err != nil {
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueEnqueueAt(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
 		t.Error(err)
 	}
+	defer q.Drop()
 
-	if *obj.SubObject.Value != *newCompObj.SubObject.Value {
-		t.Errorf("Expected current object subobject value to be '%+v', got '%+v'", *newCompObj.SubObject.Value, *obj.SubObject.Value)
+	if _, ok := q.NextVisibleAt(); ok {
+		t.Error("Expected no next visible time for an empty queue")
 	}
 
-	newItem, err := q.PeekByID(3)
+	visibleAt := time.Now().Add(time.Hour)
+	if _, err = q.EnqueueAt([]byte("delayed value"), visibleAt); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.EnqueueIn([]byte("short delay value"), 50*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	next, ok := q.NextVisibleAt()
+	if !ok || !next.Before(visibleAt) {
+		t.Errorf("Expected next visible time before %v, got %v", visibleAt, next)
+	}
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+
+	peekItem, err := q.Peek()
 	if err != nil {
 		t.Error(err)
 	}
 
-	if err := newItem.ToObjectFromJSON(&obj); err != nil {
+	compStr := "value for item 1"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if next, ok = q.NextVisibleAt(); !ok || next.After(time.Now()) {
+		t.Errorf("Expected an item to be visible now, got %v", next)
+	}
+
+	// Visible items should be dequeued in FIFO order.
+	items, err := q.DequeueBatch(2)
+	if err != nil {
 		t.Error(err)
 	}
 
-	if *obj.SubObject.Value != *newCompObj.SubObject.Value {
-		t.Errorf("Expected current object subobject value to be '%+v', got '%+v'", *newCompObj.SubObject.Value, *obj.SubObject.Value)
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", i+1)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	for _, compStr := range []string{"short delay value", "value for item 3"} {
+		deqItem, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// The delayed item should be kept across a restart.
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	if next, ok = q.NextVisibleAt(); !ok || !next.Equal(visibleAt) {
+		t.Errorf("Expected next visible time of %v, got %v", visibleAt, next)
+	}
+
+	if _, err = q.EnqueueString("value for item 4"); err != nil {
+		t.Error(err)
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 4"
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
 	}
 }
 
-func TestQueueUpdateOutOfBounds(t *testing.T) {
+func TestQueueExpireOldItems(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	q, err := OpenQueue(file)
 	if err != nil {
@@ -518,31 +1880,69 @@ func TestQueueUpdateOutOfBounds(t *testing.T) {
 	defer q.Drop()
 
 	for i := 1; i <= 10; i++ {
-		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+		ttl := time.Hour
+		if i%2 == 0 {
+			ttl = 10 * time.Millisecond
+		}
+
+		if _, err = q.EnqueueWithTTL([]byte(fmt.Sprintf("value for item %d", i)), ttl); err != nil {
 			t.Error(err)
 		}
 	}
 
-	if q.Length() != 10 {
-		t.Errorf("Expected queue length of 10, got %d", q.Length())
-	}
+	time.Sleep(20 * time.Millisecond)
 
-	deqItem, err := q.Dequeue()
+	removed, err := q.ExpireOldItems()
 	if err != nil {
 		t.Error(err)
 	}
 
-	if q.Length() != 9 {
-		t.Errorf("Expected queue length of 9, got %d", q.Length())
+	if removed != 5 {
+		t.Errorf("Expected 5 items to be removed, got %d", removed)
 	}
 
-	if _, err = q.Update(deqItem.ID, []byte(`new value`)); err != ErrOutOfBounds {
-		t.Errorf("Expected to get queue out of bounds error, got %s", err.Error())
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
 	}
 
-	if _, err = q.Update(deqItem.ID+1, []byte(`new value`)); err != nil {
+	peekItem, err := q.PeekByOffset(2)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 5"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	// Reopen the queue to make sure the holes are remembered.
+	q.Close()
+	if q, err = OpenQueue(file); err != nil {
 		t.Error(err)
 	}
+	defer q.Close()
+
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+
+	for i := 1; i <= 9; i += 2 {
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		deqItem, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
 }
 
 func TestQueueEmpty(t *testing.T) {
@@ -629,3 +2029,125 @@ func BenchmarkQueueDequeue(b *testing.B) {
 		_, _ = q.Dequeue()
 	}
 }
+
+func BenchmarkQueueDequeueSparse(b *testing.B) {
+	// Open test database
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{NoSync: true})
+	if err != nil {
+		b.Error(err)
+	}
+	defer q.Drop()
+
+	// Fill with dummy data, deleting all but one in every 100 items so
+	// each Dequeue has to skip a run of 99 holes.
+	const gap = 100
+	values := make([][]byte, gap)
+	for i := range values {
+		values[i] = []byte("value")
+	}
+	for n := 0; n < b.N; n++ {
+		items, err := q.EnqueueBatch(values)
+		if err != nil {
+			b.Error(err)
+		}
+		for _, item := range items[:gap-1] {
+			if err = q.DeleteByID(item.ID); err != nil {
+				b.Error(err)
+			}
+		}
+	}
+
+	// Start benchmark
+	b.ResetTimer()
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		_, _ = q.Dequeue()
+	}
+}
+
+func TestQueueDeleteByID(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, id := range []uint64{3, 1, 5} {
+		if err = q.DeleteByID(id); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = q.DeleteByID(3); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	// Offsets should only count the remaining items.
+	peekItem, err := q.PeekByOffset(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 4"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	for _, i := range []int{2, 4} {
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueRecordMagicValue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	// Plain values starting like an encoded record are kept as given.
+	values := [][]byte{{0xff, 'g', 'q', 0, 'x', 'y'}, {0xff, 'g', 'x', 0, 0, 'x', 'y'}}
+	for _, value := range values {
+		if _, err = q.Enqueue(value); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, value := range values {
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(item.Value, value) {
+			t.Errorf("Expected value to be %v, got %v", value, item.Value)
+		}
+	}
+}
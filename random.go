@@ -0,0 +1,145 @@
+package goque
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// randomProbes is the number of random IDs tried when picking a random
+// item before falling back to reading every item.
+const randomProbes = 16
+
+// random is the source of random numbers used to pick random items. A
+// rand.Rand is not safe for concurrent use, so it is locked.
+var random = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// PeekRandom returns a random ready item of the queue without removing
+// it, where every ready item is equally likely to be picked. ErrEmpty is
+// returned if the queue holds no ready items.
+//
+// Deleted items leave holes among the IDs of a queue, and expired or
+// delayed items can not be picked, so a random ID between the head and
+// the tail is tried for up to 16 times, which keeps every ready item
+// equally likely while usually reading a single item. If every try
+// misses, such as when most IDs are holes, one item is picked from all
+// of the ready items instead, reading every item of the queue.
+func (q *Queue) PeekRandom() (*Item, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	return q.randomItem(time.Now())
+}
+
+// DequeueRandom removes a random ready item of the queue and returns
+// it. See PeekRandom for how the item is picked.
+func (q *Queue) DequeueRandom() (*Item, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Return items whose visibility timeout passed to the queue first.
+	now := time.Now()
+	if err := q.reclaimDue(now); err != nil {
+		return nil, err
+	}
+
+	item, err := q.randomItem(now)
+	if err != nil {
+		return nil, err
+	}
+
+	head, tail, holes, err := q.removalState(item.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	q.unindexItem(batch, item)
+	q.detachChunks(batch, item)
+	if err := q.dropUniqueKey(batch, item.ID, item.uniqueKey); err != nil {
+		return nil, err
+	}
+	item.uniqueKey = nil
+
+	if err := q.writeState(batch, head, tail, holes); err != nil {
+		return nil, err
+	}
+	q.dequeued++
+	q.hooks.dequeued(item)
+
+	return item, nil
+}
+
+// randomItem returns a random item of the queue which is ready at the
+// given time. The queue must be locked by the caller.
+func (q *Queue) randomItem(now time.Time) (*Item, error) {
+	if q.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Try random IDs, rejecting holes and items which are not ready.
+	for i := 0; i < randomProbes; i++ {
+		id := q.head + 1 + randomUint64n(q.tail-q.head)
+		item, err := q.getItem(id)
+		if err == ErrOutOfBounds {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if item.ready(now) {
+			return item, nil
+		}
+	}
+
+	// Pick one of the ready items using reservoir sampling, so only one
+	// pass is needed.
+	var item *Item
+	n := uint64(0)
+	err := q.forEach(q.head+1, func(i *Item) bool {
+		if !i.ready(now) {
+			return true
+		}
+		n++
+		if randomUint64n(n) == 0 {
+			item = i
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrEmpty
+	}
+
+	return item, nil
+}
+
+// randomUint64n returns a random number in [0, n).
+func randomUint64n(n uint64) uint64 {
+	random.Lock()
+	defer random.Unlock()
+
+	return uint64(random.Int63n(int64(n)))
+}
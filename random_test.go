@@ -0,0 +1,83 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueRandom(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.PeekRandom(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Leave holes among the IDs.
+	for _, id := range []uint64{2, 3, 5, 7, 8} {
+		if err = q.DeleteByID(id); err != nil {
+			t.Error(err)
+		}
+	}
+
+	live := map[uint64]bool{1: true, 4: true, 6: true, 9: true, 10: true}
+
+	for i := 0; i < 20; i++ {
+		item, err := q.PeekRandom()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !live[item.ID] {
+			t.Errorf("Expected a live item, got ID %d", item.ID)
+		}
+	}
+
+	if q.Length() != 5 {
+		t.Errorf("Expected queue length of 5, got %d", q.Length())
+	}
+
+	for i := 0; i < 5; i++ {
+		item, err := q.DequeueRandom()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if !live[item.ID] {
+			t.Errorf("Expected a live item, got ID %d", item.ID)
+		}
+		delete(live, item.ID)
+
+		compStr := fmt.Sprintf("value for item %d", item.ID)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = q.DequeueRandom(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// Items which are not visible yet should never be picked.
+	if _, err = q.EnqueueIn([]byte("delayed value"), time.Hour); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.PeekRandom(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
@@ -0,0 +1,30 @@
+package goque
+
+import "context"
+
+// Limiter paces operations, such as a *rate.Limiter from
+// golang.org/x/time/rate. It is kept this small so goque does not
+// depend on any rate limiting package.
+type Limiter interface {
+	// Wait blocks until an operation may go ahead or the given context
+	// is done, in which case it returns an error.
+	Wait(ctx context.Context) error
+}
+
+// DequeueRate waits for the given limiter to allow an operation and
+// then removes the next item in the queue and returns it, so consumers
+// sharing the limiter dequeue no faster than it allows. If ctx is done
+// before then, the error of the limiter is returned and the queue is
+// left untouched. The limiter is only used outside the lock of the
+// queue, so it can be shared by any number of goroutines as long as it
+// is safe for concurrent use itself, as *rate.Limiter is.
+//
+// The wait is spent even if the queue turns out to be empty, in which
+// case ErrEmpty is returned.
+func (q *Queue) DequeueRate(ctx context.Context, limiter Limiter) (*Item, error) {
+	if err := limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	return q.Dequeue()
+}
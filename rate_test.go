@@ -0,0 +1,70 @@
+package goque
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type testLimiter struct {
+	interval time.Duration
+	waits    int
+}
+
+func (l *testLimiter) Wait(ctx context.Context) error {
+	l.waits++
+
+	select {
+	case <-time.After(l.interval):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func TestQueueDequeueRate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	limiter := &testLimiter{interval: 10 * time.Millisecond}
+
+	item, err := q.DequeueRate(context.Background(), limiter)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if limiter.waits != 1 {
+		t.Errorf("Expected limiter to be waited on once, got %d", limiter.waits)
+	}
+
+	// A context done before the limiter allows the dequeue should leave
+	// the queue untouched.
+	limiter.interval = time.Hour
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err = q.DequeueRate(ctx, limiter); err != context.DeadlineExceeded {
+		t.Errorf("Expected to get context deadline exceeded error, got %v", err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
@@ -0,0 +1,248 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Rebuild derives the head and tail positions of the queue and its
+// number of holes again from the items stored in its database,
+// correcting any drift from the stored keys, such as after the files
+// of the database were copied by hand. Afterwards, Length reports the
+// number of items found. Rebuild is safe to call at any time, and
+// changes nothing if the positions were already correct.
+//
+// Unlike OpenQueueWithRepair, Rebuild does not recover a corrupted
+// database, only the bookkeeping of a readable one.
+func (q *Queue) Rebuild() error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	return q.rebuild()
+}
+
+// rebuild sets the head and tail positions of the queue around its
+// first and last stored items, counting the holes between them. The
+// queue must be locked by the caller.
+func (q *Queue) rebuild() error {
+	iter := q.db.NewIterator(itemRange, nil)
+	defer iter.Release()
+
+	var first, last, n uint64
+	for iter.Next() {
+		id := keyToID(iter.Key())
+		if n == 0 {
+			first = id
+		}
+		last = id
+		n++
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// An empty queue starts again from an ID of 1.
+	var head, tail uint64
+	if n > 0 {
+		head, tail = first-1, last
+	}
+
+	return q.writeState(new(leveldb.Batch), head, tail, tail-head-n)
+}
+
+// Rebuild derives the head and tail positions of the stack and its
+// number of holes again from the items stored in its database. See
+// Queue.Rebuild for details.
+func (s *Stack) Rebuild() error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	iter := s.db.NewIterator(itemRange, nil)
+	defer iter.Release()
+
+	var first, last, n uint64
+	for iter.Next() {
+		id := keyToID(iter.Key())
+		if n == 0 {
+			first = id
+		}
+		last = id
+		n++
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// An empty stack starts again from an ID of 1.
+	var head, tail uint64
+	if n > 0 {
+		head, tail = last, first-1
+	}
+
+	return s.writeState(new(leveldb.Batch), head, tail, head-tail-n)
+}
+
+// Rebuild derives the head and tail positions of each priority level
+// again from the items stored in the database of the priority queue,
+// the same way they are found when it is opened, and counts the items
+// of each level to find its number of holes, writing those using a
+// single LevelDB write. See Queue.Rebuild for details.
+func (pq *PriorityQueue) Rebuild() error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	if err := pq.init(); err != nil {
+		return err
+	}
+
+	// Count the items stored in each priority level, replacing every
+	// stored number of holes.
+	batch := new(leveldb.Batch)
+	if err := deleteRange(pq.db, batch, util.BytesPrefix(internalKey("holes"))); err != nil {
+		return err
+	}
+	holes := make([]uint64, 256)
+	for i, level := range pq.levels {
+		var count uint64
+		iter := pq.db.NewIterator(util.BytesPrefix(pq.generatePrefix(uint8(i))), nil)
+		for iter.Next() {
+			count++
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return err
+		}
+
+		holes[i] = level.tail - level.head - count
+		if holes[i] > 0 {
+			pq.putHoles(batch, uint8(i), holes[i])
+		}
+	}
+
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return err
+	}
+
+	for i, level := range pq.levels {
+		level.holes = holes[i]
+	}
+
+	return nil
+}
+
+// Rebuild derives the head and tail positions of the queue of each
+// prefix, and the length of the prefix queue, again from the items
+// stored in its database, writing them using a single LevelDB write.
+// Prefixes without any items are kept, with their head moved to their
+// tail. See Queue.Rebuild for details.
+func (pq *PrefixQueue) Rebuild() error {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Find the first and last items of each prefix, along with the
+	// stored positions of each prefix.
+	queues := make(map[string]*queue)
+	stored := make(map[string]*queue)
+	var prefixes []string
+	var size uint64
+	iter := pq.db.NewIterator(nil, nil)
+	dataKey := pq.getDataKey()
+	for iter.Next() {
+		key := iter.Key()
+		if bytes.Equal(key, dataKey) {
+			continue
+		}
+
+		// Item keys hold the prefix, a delimiter and the 8 byte ID.
+		if len(key) >= 9 && key[len(key)-9] == prefixDelimiter {
+			prefix, id := string(key[:len(key)-9]), keyToID(key[len(key)-8:])
+			size++
+
+			// The items of each prefix are walked in order of their IDs.
+			q, ok := queues[prefix]
+			if !ok {
+				q = &queue{Head: id - 1}
+				queues[prefix] = q
+			}
+			q.Tail = id
+			continue
+		}
+
+		if bytes.HasSuffix(key, []byte(":data")) {
+			q := &queue{}
+			if err := gob.NewDecoder(bytes.NewReader(iter.Value())).Decode(q); err != nil {
+				iter.Release()
+				return err
+			}
+			prefix := string(key[:len(key)-len(":data")])
+			stored[prefix] = q
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Prefixes without any items are kept empty, and prefixes whose
+	// positions were lost are added.
+	for _, prefix := range prefixes {
+		if _, ok := queues[prefix]; !ok {
+			queues[prefix] = &queue{Head: stored[prefix].Tail, Tail: stored[prefix].Tail}
+		}
+	}
+	for prefix := range queues {
+		if _, ok := stored[prefix]; !ok {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	// Store the positions of every prefix along with the length.
+	batch := new(leveldb.Batch)
+	for _, prefix := range prefixes {
+		var buffer bytes.Buffer
+		if err := gob.NewEncoder(&buffer).Encode(queues[prefix]); err != nil {
+			return err
+		}
+		batch.Put(generateKeyPrefixData([]byte(prefix)), buffer.Bytes())
+	}
+	batch.Put(dataKey, appendUint64(nil, size))
+
+	if err := pq.db.Write(batch, pq.writeOpts); err != nil {
+		return err
+	}
+
+	// Reset the round-robin order, which is found again when needed.
+	pq.size = size
+	pq.rr = nil
+
+	return nil
+}
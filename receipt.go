@@ -0,0 +1,369 @@
+package goque
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// A Receipt identifies one delivery of an item taken from a queue using
+// DequeueWithReceipt or DequeueWithVisibility. Receipts are never
+// reused by a queue, and remain valid across restarts, so they can be
+// stored along with the work being done for an item.
+type Receipt uint64
+
+// receiptKey holds the last receipt given by a queue.
+var receiptKey = internalKey("receipt")
+
+// inFlightPrefix starts the key of every item in flight, followed by
+// the receipt of its delivery.
+var inFlightPrefix = internalKey("inflight:")
+
+// inFlightRange is the key range holding every item in flight.
+var inFlightRange = util.BytesPrefix(inFlightPrefix)
+
+// inFlightKey returns the key holding the item in flight with the
+// given receipt. The stored value is the 8 byte ID the item had in the
+// queue, the 8 byte visibility deadline of the delivery as Unix
+// nanoseconds, or 0 if it has none, and then the stored record.
+func inFlightKey(receipt Receipt) []byte {
+	return appendUint64(append([]byte(nil), inFlightPrefix...), uint64(receipt))
+}
+
+// DequeueWithReceipt removes the next item in the queue and returns it
+// along with a receipt, for at-least-once processing. The item is no
+// longer visible in the queue, and does not count towards its length,
+// but is kept in flight until it is acknowledged using Ack, or returned
+// to the queue using Nack. Items in flight are stored in the database,
+// so they survive a restart.
+//
+// The Attempts field of the returned item counts how many times it has
+// been delivered using DequeueWithReceipt, including this delivery.
+func (q *Queue) DequeueWithReceipt() (*Item, Receipt, error) {
+	q.Lock()
+	defer q.unlock()
+
+	return q.dequeueInFlight(time.Time{})
+}
+
+// DequeueWithVisibility removes the next item in the queue and returns
+// it along with a receipt, hiding the item for the given timeout. If
+// the item is not removed using Delete before the timeout passes, such
+// as when the process crashes while handling it, it is returned to the
+// head of the queue so it can be delivered again. The item can also be
+// acknowledged or returned early using Ack and Nack.
+//
+// Items whose timeout passed are returned to the queue by the next
+// dequeue, or by calling ReclaimExpired. They are put back in front of
+// the queue in order of delivery, unless there is no room left before
+// its first item, in which case they are added to its tail instead.
+func (q *Queue) DequeueWithVisibility(timeout time.Duration) (*Item, Receipt, error) {
+	q.Lock()
+	defer q.unlock()
+
+	return q.dequeueInFlight(time.Now().Add(timeout))
+}
+
+// dequeueInFlight removes the next item in the queue and keeps it in
+// flight with a new receipt, until the given deadline if it is not
+// zero. The queue must be locked by the caller.
+func (q *Queue) dequeueInFlight(deadline time.Time) (*Item, Receipt, error) {
+	var nanos uint64
+	if !deadline.IsZero() {
+		nanos = uint64(deadline.UnixNano())
+	}
+
+	receipt := q.receipt + 1
+	item, err := q.dequeue(func(item *Item, batch *leveldb.Batch) error {
+		item.Attempts++
+		item.inFlight = true
+
+		// Keep the item in flight using the same write removing it.
+		b, err := q.format.encode(item.record())
+		if err != nil {
+			return err
+		}
+		value := appendUint64(appendUint64(nil, item.ID), nanos)
+		batch.Put(inFlightKey(receipt), append(value, b...))
+		batch.Put(receiptKey, appendUint64(nil, uint64(receipt)))
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q.receipt = receipt
+	if !deadline.IsZero() && (q.leaseAt.IsZero() || deadline.Before(q.leaseAt)) {
+		q.leaseAt = deadline
+	}
+	return item, receipt, nil
+}
+
+// Ack acknowledges that the item delivered with the given receipt has
+// been processed, removing it for good. ErrUnknownReceipt is returned
+// if no item is in flight with the receipt, such as when it was already
+// acknowledged.
+func (q *Queue) Ack(receipt Receipt) error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	// Make sure the item is in flight.
+	_, rec, err := q.getInFlight(receipt)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(inFlightKey(receipt))
+	dropChunks(batch, rec.chunks)
+	return q.db.Write(batch, q.writeOpts)
+}
+
+// Nack reports that the item delivered with the given receipt could not
+// be processed. The item is added back to the tail of the queue, with
+// a new ID, so it can be delivered again.
+//
+// If the queue was opened with the MaxRetries option and the item has
+// now been nacked more than that many times, it is instead moved to
+// the tail of the DeadLetterQueue, or removed if that option is not
+// set. When the dead-letter queue uses a different database, the item
+// is first added to it and then removed from the queue, so a crash in
+// between leaves it in both.
+//
+// ErrUnknownReceipt is returned if no item is in flight with the
+// receipt, and ErrFull if the item can not be moved because the
+// dead-letter queue is full.
+func (q *Queue) Nack(receipt Receipt) error {
+	unlock := q.lockDeadLetter()
+	defer unlock()
+
+	// Check if either queue is closed.
+	if !q.isOpen || q.dlq != nil && !q.dlq.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	_, rec, err := q.getInFlight(receipt)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(inFlightKey(receipt))
+
+	// Check if the item should be given up on.
+	if q.retries > 0 && rec.attempts > q.retries {
+		if q.dlq != nil && q.dlq.db != q.db {
+			dropChunks(batch, rec.chunks)
+			if _, err := q.dlq.enqueue(rec); err != nil {
+				return err
+			}
+			return q.db.Write(batch, q.writeOpts)
+		}
+
+		if q.dlq == nil {
+			dropChunks(batch, rec.chunks)
+			return q.db.Write(batch, q.writeOpts)
+		}
+
+		// Within a single database, move the item using one write.
+		return q.dlq.requeue(rec, batch)
+	}
+
+	return q.requeue(rec, batch)
+}
+
+// requeue adds the given record to the tail of the queue along with
+// the changes in the given batch, using a single write. Requeued items
+// were already counted towards the length of the queue, so they are
+// added even if the queue is full. The queue must be locked by the
+// caller.
+func (q *Queue) requeue(rec *record, batch *leveldb.Batch) error {
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	b, err := q.format.encode(rec)
+	if err != nil {
+		return err
+	}
+	item := newItem(q.tail+1, rec, q.codec)
+	batch.Put(item.Key, b)
+	q.indexItem(batch, item)
+
+	if err := q.writeState(batch, q.head, item.ID, q.holes); err != nil {
+		return err
+	}
+	q.enqueued++
+	q.added(item)
+
+	return nil
+}
+
+// Delete removes the item delivered with the given receipt for good,
+// the same as Ack. Once the visibility timeout of the delivery has
+// passed, the item may be returned to the queue at any time, after
+// which ErrUnknownReceipt is returned.
+func (q *Queue) Delete(receipt Receipt) error {
+	return q.Ack(receipt)
+}
+
+// ReclaimExpired returns every item in flight whose visibility timeout
+// has passed to the head of the queue, and returns how many items were
+// returned. This is also done by the next dequeue, so calling it is
+// only needed to make the items visible to Peek or Length sooner.
+func (q *Queue) ReclaimExpired() (int, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	return q.reclaim(time.Now())
+}
+
+// reclaimDue returns the items in flight whose visibility timeout has
+// passed to the queue, if there may be any. The queue must be locked by
+// the caller.
+func (q *Queue) reclaimDue(now time.Time) error {
+	if q.leaseAt.IsZero() || q.leaseAt.After(now) {
+		return nil
+	}
+
+	_, err := q.reclaim(now)
+	return err
+}
+
+// reclaim returns the items in flight whose visibility timeout has
+// passed to the head of the queue using a single write, and remembers
+// the earliest timeout of the items left in flight. The queue must be
+// locked by the caller.
+func (q *Queue) reclaim(now time.Time) (int, error) {
+	iter := q.db.NewIterator(inFlightRange, nil)
+	defer iter.Release()
+
+	// Find the expired items in order of delivery. Records are put back
+	// as they were stored, so they do not need to be decoded.
+	var keys, records [][]byte
+	var leaseAt time.Time
+	for iter.Next() {
+		value := iter.Value()
+		if len(value) < 16 {
+			continue
+		}
+
+		nanos := binary.BigEndian.Uint64(value[8:16])
+		if nanos == 0 {
+			continue
+		}
+
+		deadline := time.Unix(0, int64(nanos))
+		if deadline.After(now) {
+			if leaseAt.IsZero() || deadline.Before(leaseAt) {
+				leaseAt = deadline
+			}
+			continue
+		}
+
+		keys = append(keys, append([]byte(nil), iter.Key()...))
+		records = append(records, append([]byte(nil), value[16:]...))
+	}
+	if err := iter.Error(); err != nil {
+		return 0, err
+	}
+
+	if len(keys) > 0 {
+		// Put the items in front of the queue if there is room for all
+		// of them, or after its tail otherwise.
+		n := uint64(len(keys))
+		head, tail := q.head, q.tail
+		first := tail + 1
+		if q.Length() > 0 && head >= n {
+			head -= n
+			first = head + 1
+		} else {
+			tail += n
+		}
+
+		batch := new(leveldb.Batch)
+		items := make([]*Item, 0, len(keys))
+		for i := range keys {
+			id := first + uint64(i)
+			batch.Delete(keys[i])
+			batch.Put(idToKey(id), records[i])
+
+			rec, err := q.format.decode(records[i])
+			if err != nil {
+				return 0, err
+			}
+			item := newItem(id, rec, q.codec)
+			q.indexItem(batch, item)
+			items = append(items, item)
+		}
+
+		if err := q.writeState(batch, head, tail, q.holes); err != nil {
+			return 0, err
+		}
+		q.enqueued += n
+		q.added(items...)
+	}
+
+	q.leaseAt = leaseAt
+	return len(keys), nil
+}
+
+// getInFlight returns the ID and record of the item in flight with the
+// given receipt.
+func (q *Queue) getInFlight(receipt Receipt) (uint64, *record, error) {
+	value, err := q.db.Get(inFlightKey(receipt), nil)
+	if err == leveldb.ErrNotFound {
+		return 0, nil, ErrUnknownReceipt
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	if len(value) < 16 {
+		return 0, nil, ErrUnknownReceipt
+	}
+
+	rec, err := q.format.decode(value[16:])
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return binary.BigEndian.Uint64(value[:8]), rec, nil
+}
+
+// lockDeadLetter locks the queue along with its dead-letter queue, if
+// any, and returns a function unlocking them.
+func (q *Queue) lockDeadLetter() func() {
+	if q.dlq == nil {
+		q.Lock()
+		return q.unlock
+	}
+	return lockQueues(q, q.dlq)
+}
@@ -0,0 +1,415 @@
+package goque
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueDequeueWithReceipt(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, receipt, err := q.DequeueWithReceipt()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if item.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", item.Attempts)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	if err = q.Ack(receipt); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Ack(receipt); err != ErrUnknownReceipt {
+		t.Errorf("Expected to get unknown receipt error, got %v", err)
+	}
+
+	// A nacked item should be added back to the tail.
+	item, receipt, err = q.DequeueWithReceipt()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Nack(receipt); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	if err = q.Nack(receipt); err != ErrUnknownReceipt {
+		t.Errorf("Expected to get unknown receipt error, got %v", err)
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 3"
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+
+	item, _, err = q.DequeueWithReceipt()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 2"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if item.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", item.Attempts)
+	}
+
+	if _, _, err = q.DequeueWithReceipt(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueReceiptReopen(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 2; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	_, receipt, err := q.DequeueWithReceipt()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Items in flight should survive a restart.
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	_, receipt2, err := q.DequeueWithReceipt()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if receipt2 == receipt {
+		t.Errorf("Expected a new receipt, got %d again", receipt)
+	}
+
+	if err = q.Nack(receipt); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Ack(receipt2); err != nil {
+		t.Error(err)
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if item.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", item.Attempts)
+	}
+}
+
+func TestQueueDeadLetter(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	dlq, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer dlq.Drop()
+
+	file2 := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file2, &Options{MaxRetries: 2, DeadLetterQueue: dlq})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("failing value"); err != nil {
+		t.Error(err)
+	}
+
+	// The item should be retried twice before being given up on.
+	for i := 1; i <= 3; i++ {
+		item, receipt, err := q.DequeueWithReceipt()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if item.Attempts != uint32(i) {
+			t.Errorf("Expected %d attempts, got %d", i, item.Attempts)
+		}
+
+		if err = q.Nack(receipt); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if q.Length() != 0 {
+		t.Errorf("Expected queue length of 0, got %d", q.Length())
+	}
+
+	if dlq.Length() != 1 {
+		t.Errorf("Expected dead-letter queue length of 1, got %d", dlq.Length())
+	}
+
+	item, err := dlq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "failing value"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if item.Attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", item.Attempts)
+	}
+}
+
+func TestQueueMaxRetries(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{MaxRetries: 1})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("failing value"); err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		_, receipt, err := q.DequeueWithReceipt()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if err = q.Nack(receipt); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Without a dead-letter queue, the item should be removed.
+	if _, _, err = q.DequeueWithReceipt(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestQueueDequeueWithVisibility(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// A deleted item should not come back.
+	_, receipt, err := q.DequeueWithVisibility(time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Delete(receipt); err != nil {
+		t.Error(err)
+	}
+
+	// An item which is not deleted in time should be returned to the head.
+	item, receipt, err := q.DequeueWithVisibility(50 * time.Millisecond)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	item, receipt2, err := q.DequeueWithVisibility(time.Hour)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	if item.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", item.Attempts)
+	}
+
+	if err = q.Delete(receipt); err != ErrUnknownReceipt {
+		t.Errorf("Expected to get unknown receipt error, got %v", err)
+	}
+
+	if err = q.Delete(receipt2); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
+
+func TestQueueReclaimExpired(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 4; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, _, err = q.DequeueWithVisibility(50 * time.Millisecond); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, _, err = q.DequeueWithVisibility(time.Hour); err != nil {
+		t.Error(err)
+	}
+
+	// Leases should survive a restart.
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	n, err := q.ReclaimExpired()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 0 {
+		t.Errorf("Expected 0 reclaimed items, got %d", n)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	n, err = q.ReclaimExpired()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if n != 2 {
+		t.Errorf("Expected 2 reclaimed items, got %d", n)
+	}
+
+	if q.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", q.Length())
+	}
+
+	// The reclaimed items should be back in front in their original order.
+	for _, i := range []int{1, 2, 4} {
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
+func TestQueueDequeueWaitVisibility(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	compStr := "value for item"
+	if _, err = q.EnqueueString(compStr); err != nil {
+		t.Error(err)
+	}
+
+	// The only item is in flight while DequeueWait is parked, and is
+	// reclaimed once its visibility timeout passes.
+	if _, _, err = q.DequeueWithVisibility(100 * time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	item, err := q.DequeueWait(ctx)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item != nil && item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
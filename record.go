@@ -0,0 +1,474 @@
+package goque
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"hash/crc32"
+	"sort"
+	"time"
+)
+
+// recordMagic marks a stored value as an encoded record rather than a
+// plain item value.
+//
+// Stacks, priority queues and prefix queues store values that do not
+// need any of the extra record fields exactly as given, so only their
+// items using a feature such as a TTL pay for the record header. Queues
+// stamp every item with the time it was enqueued, so every value
+// written by a Queue is stored as a record. Plain values which happen
+// to start with the magic are stored in a record without any fields
+// instead.
+//
+// Databases written by older versions of this package remain readable,
+// as values without the magic are read as plain item values. Older
+// versions do not know about records, however, and read the header of
+// a record as part of the item value.
+//
+// The magic starts with 0xFF followed by bytes below 0x80. That
+// sequence is never produced by encoding/gob, encoding/json or valid
+// UTF-8 text, so plain values written by the helper functions of this
+// package cannot be mistaken for a record.
+var recordMagic = []byte{0xff, 'g', 'q'}
+
+// recordMagicExt marks an encoded record using flags beyond the first
+// eight, which are then stored as two bytes. Records which only use the
+// first eight flags keep using recordMagic and a single byte, so they
+// stay readable by older versions of this package.
+var recordMagicExt = []byte{0xff, 'g', 'x'}
+
+// The record flags, describing which optional fields are present in an
+// encoded record.
+const (
+	recordExpiry uint16 = 1 << iota
+	recordCompressed
+	recordEncrypted
+	recordAttempts
+	recordVisibleAt
+	recordUniqueKey
+	recordEnqueuedAt
+	recordMeta
+	recordChunked
+	recordChecksum
+)
+
+// checksumTable is the CRC32C table used for the checksums of stored
+// values.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// record holds an item value along with its optional fields.
+//
+// An encoded record has the following layout, with optional fields
+// appearing in the order of their flags:
+//
+//	[0:3]  recordMagic, or recordMagicExt
+//	[3]    flags, or for recordMagicExt, [3:5] the big-endian flags
+//	[...]  expiry as Unix nanoseconds, if recordExpiry is set
+//	[...]  Compression of the value, if recordCompressed is set
+//	[...]  4 byte delivery attempts, if recordAttempts is set
+//	[...]  visibility time as Unix nanoseconds, if recordVisibleAt is
+//	       set
+//	[...]  4 byte length followed by the deduplication key, if
+//	       recordUniqueKey is set
+//	[...]  enqueue time as Unix nanoseconds, if recordEnqueuedAt is
+//	       set
+//	[...]  4 byte number of metadata entries, each a 4 byte length
+//	       followed by the key and a 4 byte length followed by the
+//	       value, if recordMeta is set
+//	[...]  8 byte stream ID, 4 byte number of chunks and 8 byte size of
+//	       a streamed value, if recordChunked is set, in which case the
+//	       item value is empty
+//	[...]  4 byte big-endian CRC32C of the rest of the record, being
+//	       the stored item value, if recordChecksum is set
+//	[...]  item value, compressed if recordCompressed is set and then
+//	       sealed using the cipher with a random nonce prepended if
+//	       recordEncrypted is set
+type record struct {
+	expiresAt time.Time
+	visibleAt time.Time
+	attempts  uint32
+	uniqueKey []byte
+	value     []byte
+
+	// enqueuedAt is the time the item was added, or for an item of a
+	// priority queue, the time it was added to its priority level.
+	enqueuedAt time.Time
+
+	meta map[string]string
+
+	// chunks refers to the chunks holding a streamed value.
+	chunks *chunkRef
+}
+
+// flags returns the flags describing the optional fields of the record.
+func (r *record) flags() uint16 {
+	var flags uint16
+	if !r.expiresAt.IsZero() {
+		flags |= recordExpiry
+	}
+	if r.attempts > 0 {
+		flags |= recordAttempts
+	}
+	if !r.visibleAt.IsZero() {
+		flags |= recordVisibleAt
+	}
+	if r.uniqueKey != nil {
+		flags |= recordUniqueKey
+	}
+	if !r.enqueuedAt.IsZero() {
+		flags |= recordEnqueuedAt
+	}
+	if len(r.meta) > 0 {
+		flags |= recordMeta
+	}
+	if r.chunks != nil {
+		flags |= recordChunked
+	}
+	return flags
+}
+
+// recordFormat describes how the records of a data structure are
+// stored, based on the options it was opened with.
+type recordFormat struct {
+	compression Compression
+	cipher      cipher.AEAD
+	maxBytes    int
+	checksum    bool
+
+	// chunks is the database holding the chunks of streamed values.
+	chunks database
+}
+
+// newRecordFormat returns the recordFormat to use for the given
+// options.
+func newRecordFormat(opts *Options) recordFormat {
+	if opts == nil {
+		return recordFormat{}
+	}
+	return recordFormat{
+		compression: opts.Compression,
+		cipher:      opts.Cipher,
+		maxBytes:    opts.MaxItemBytes,
+		checksum:    opts.Checksum,
+	}
+}
+
+// encode returns the stored representation of the record. A record
+// without any optional fields is stored as its plain value, unless the
+// value starts with recordMagic or recordMagicExt.
+func (f recordFormat) encode(r *record) ([]byte, error) {
+	flags := r.flags()
+	value := r.value
+
+	// Compress the value, unless that does not make it smaller.
+	if f.compression != CompressNone {
+		compressed, err := f.compression.compress(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(compressed)+1 < len(value) {
+			flags |= recordCompressed
+			value = compressed
+		}
+	}
+
+	// Seal the value, so it is encrypted and authenticated.
+	if f.cipher != nil {
+		sealed, err := f.seal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		flags |= recordEncrypted
+		value = sealed
+	}
+
+	// Check if the stored value is too large.
+	if f.maxBytes > 0 && len(value) > f.maxBytes {
+		return nil, ErrItemTooLarge
+	}
+
+	if f.checksum {
+		flags |= recordChecksum
+	}
+
+	// Store the plain value, unless it would be mistaken for a record,
+	// in which case it is stored in a record without any fields.
+	if flags == 0 && !bytes.HasPrefix(value, recordMagic) && !bytes.HasPrefix(value, recordMagicExt) {
+		return value, nil
+	}
+
+	// recordMagic + flags = 3 + 1 = 4
+	b := make([]byte, 4, 62+len(r.uniqueKey)+len(value))
+	copy(b, recordMagic)
+	b[3] = byte(flags)
+	if flags > 0xff {
+		copy(b, recordMagicExt)
+		b = append(b[:3], byte(flags>>8), byte(flags))
+	}
+
+	if flags&recordExpiry != 0 {
+		b = appendUint64(b, uint64(r.expiresAt.UnixNano()))
+	}
+
+	if flags&recordCompressed != 0 {
+		b = append(b, byte(f.compression))
+	}
+
+	if flags&recordAttempts != 0 {
+		b = appendUint32(b, r.attempts)
+	}
+
+	if flags&recordVisibleAt != 0 {
+		b = appendUint64(b, uint64(r.visibleAt.UnixNano()))
+	}
+
+	if flags&recordUniqueKey != 0 {
+		b = appendUint32(b, uint32(len(r.uniqueKey)))
+		b = append(b, r.uniqueKey...)
+	}
+
+	if flags&recordEnqueuedAt != 0 {
+		b = appendUint64(b, uint64(r.enqueuedAt.UnixNano()))
+	}
+
+	if flags&recordMeta != 0 {
+		b = appendMeta(b, r.meta)
+	}
+
+	if flags&recordChunked != 0 {
+		b = appendUint64(b, r.chunks.stream)
+		b = appendUint32(b, r.chunks.count)
+		b = appendUint64(b, uint64(r.chunks.size))
+	}
+
+	if flags&recordChecksum != 0 {
+		b = appendUint32(b, crc32.Checksum(value, checksumTable))
+	}
+
+	return append(b, value...), nil
+}
+
+// decode decodes the given stored value. Values which are not an
+// encoded record are returned as a record holding only that value.
+func (f recordFormat) decode(b []byte) (*record, error) {
+	// recordMagic + flags = 3 + 1 = 4
+	if len(b) < 4 {
+		return &record{value: b}, nil
+	}
+
+	r := &record{}
+	var flags uint16
+	var rest []byte
+	switch {
+	case bytes.Equal(b[:3], recordMagic):
+		flags, rest = uint16(b[3]), b[4:]
+	case bytes.Equal(b[:3], recordMagicExt) && len(b) >= 5:
+		flags, rest = binary.BigEndian.Uint16(b[3:5]), b[5:]
+	default:
+		return &record{value: b}, nil
+	}
+
+	if flags&recordExpiry != 0 {
+		if len(rest) < 8 {
+			return &record{value: b}, nil
+		}
+		r.expiresAt = time.Unix(0, int64(binary.BigEndian.Uint64(rest[:8])))
+		rest = rest[8:]
+	}
+
+	compression := CompressNone
+	if flags&recordCompressed != 0 {
+		if len(rest) < 1 {
+			return &record{value: b}, nil
+		}
+		compression = Compression(rest[0])
+		rest = rest[1:]
+	}
+
+	if flags&recordAttempts != 0 {
+		if len(rest) < 4 {
+			return &record{value: b}, nil
+		}
+		r.attempts = binary.BigEndian.Uint32(rest[:4])
+		rest = rest[4:]
+	}
+
+	if flags&recordVisibleAt != 0 {
+		if len(rest) < 8 {
+			return &record{value: b}, nil
+		}
+		r.visibleAt = time.Unix(0, int64(binary.BigEndian.Uint64(rest[:8])))
+		rest = rest[8:]
+	}
+
+	if flags&recordUniqueKey != 0 {
+		if len(rest) < 4 || uint64(len(rest)-4) < uint64(binary.BigEndian.Uint32(rest[:4])) {
+			return &record{value: b}, nil
+		}
+		n := 4 + int(binary.BigEndian.Uint32(rest[:4]))
+		r.uniqueKey = rest[4:n]
+		rest = rest[n:]
+	}
+
+	if flags&recordEnqueuedAt != 0 {
+		if len(rest) < 8 {
+			return &record{value: b}, nil
+		}
+		r.enqueuedAt = time.Unix(0, int64(binary.BigEndian.Uint64(rest[:8])))
+		rest = rest[8:]
+	}
+
+	if flags&recordMeta != 0 {
+		meta, n, ok := readMeta(rest)
+		if !ok {
+			return &record{value: b}, nil
+		}
+		r.meta = meta
+		rest = rest[n:]
+	}
+
+	if flags&recordChunked != 0 {
+		if len(rest) < 20 {
+			return &record{value: b}, nil
+		}
+		r.chunks = &chunkRef{
+			stream:   binary.BigEndian.Uint64(rest[:8]),
+			count:    binary.BigEndian.Uint32(rest[8:12]),
+			size:     int64(binary.BigEndian.Uint64(rest[12:20])),
+			checksum: flags&recordChecksum != 0,
+			src:      f.chunks,
+			format:   f,
+		}
+		rest = rest[20:]
+	}
+
+	// Verify the stored value before opening it, so corruption is not
+	// mistaken for a value which can not be decrypted.
+	if flags&recordChecksum != 0 {
+		if len(rest) < 4 {
+			return nil, ErrChecksumMismatch
+		}
+		sum := binary.BigEndian.Uint32(rest[:4])
+		rest = rest[4:]
+		if crc32.Checksum(rest, checksumTable) != sum {
+			return nil, ErrChecksumMismatch
+		}
+	}
+
+	// Values are compressed before being sealed, so open them first.
+	if flags&recordEncrypted != 0 {
+		value, err := f.open(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = value
+	}
+
+	if compression != CompressNone {
+		value, err := compression.decompress(rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = value
+	}
+
+	r.value = rest
+	return r, nil
+}
+
+// seal encrypts and authenticates the given value using the cipher of
+// the format, prepending the random nonce used.
+func (f recordFormat) seal(value []byte) ([]byte, error) {
+	nonce := make([]byte, f.cipher.NonceSize(), f.cipher.NonceSize()+len(value)+f.cipher.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return f.cipher.Seal(nonce, nonce, value, nil), nil
+}
+
+// open returns the value sealed using seal, or ErrDecryption if it can
+// not be opened using the cipher of the format.
+func (f recordFormat) open(b []byte) ([]byte, error) {
+	if f.cipher == nil || len(b) < f.cipher.NonceSize() {
+		return nil, ErrDecryption
+	}
+
+	nonce, sealed := b[:f.cipher.NonceSize()], b[f.cipher.NonceSize():]
+	value, err := f.cipher.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return value, nil
+}
+
+// appendUint32 appends the big-endian encoding of v to b.
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendUint64 appends the big-endian encoding of v to b.
+func appendUint64(b []byte, v uint64) []byte {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// appendMeta appends the encoding of the given item metadata to b, with
+// its entries sorted by key so equal metadata is always encoded the
+// same way.
+func appendMeta(b []byte, meta map[string]string) []byte {
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	b = appendUint32(b, uint32(len(keys)))
+	for _, k := range keys {
+		b = appendUint32(b, uint32(len(k)))
+		b = append(b, k...)
+		b = appendUint32(b, uint32(len(meta[k])))
+		b = append(b, meta[k]...)
+	}
+	return b
+}
+
+// readMeta decodes the item metadata at the start of b, returning it
+// along with the number of bytes read. ok is false if b is too short to
+// hold the metadata.
+func readMeta(b []byte) (meta map[string]string, n int, ok bool) {
+	// readString reads a length prefixed string at offset n.
+	readString := func() (string, bool) {
+		if len(b)-n < 4 || uint64(len(b)-n-4) < uint64(binary.BigEndian.Uint32(b[n:])) {
+			return "", false
+		}
+		l := int(binary.BigEndian.Uint32(b[n:]))
+		s := string(b[n+4 : n+4+l])
+		n += 4 + l
+		return s, true
+	}
+
+	if len(b) < 4 {
+		return nil, 0, false
+	}
+	count := binary.BigEndian.Uint32(b)
+	n = 4
+
+	meta = make(map[string]string)
+	for i := uint32(0); i < count; i++ {
+		k, ok := readString()
+		if !ok {
+			return nil, 0, false
+		}
+		v, ok := readString()
+		if !ok {
+			return nil, 0, false
+		}
+		meta[k] = v
+	}
+	return meta, n, true
+}
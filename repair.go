@@ -0,0 +1,48 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
+)
+
+// OpenQueueWithRepair opens a queue like OpenQueue. If its LevelDB
+// database is found to be corrupted, such as after a hard crash, it is
+// recovered using leveldb.RecoverFile, which salvages every item which
+// can still be read, and the positions of the queue are derived again
+// from the items left. The Length of the returned queue is the number
+// of items recovered.
+//
+// A recovered queue can hold items which were removed just before the
+// crash, and can lose items behind the corruption, so it should be
+// checked before being trusted again. Errors other than corruption are
+// returned as they are by OpenQueue.
+func OpenQueueWithRepair(dataDir string) (*Queue, error) {
+	q, err := OpenQueue(dataDir)
+	if err == nil || !errors.IsCorrupted(err) {
+		return q, err
+	}
+
+	// The corruption may have been found after the database was opened.
+	if q.isOpen {
+		q.db.Close()
+		q.isOpen = false
+	}
+
+	// Salvage what can still be read.
+	db, err := leveldb.RecoverFile(dataDir, nil)
+	if err != nil {
+		return q, err
+	}
+	q.db = levelDB{db}
+
+	// Check if this Goque type can open the requested data directory.
+	if err = checkGoqueType(dataDir, TypeQueue, q.codec, false, q.writeOpts.Sync); err != nil {
+		return q, err
+	}
+
+	q.isOpen = true
+	if err := q.init(); err != nil {
+		return q, err
+	}
+	return q, q.rebuild()
+}
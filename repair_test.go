@@ -0,0 +1,190 @@
+package goque
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueueOpenWithRepair(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	q.Close()
+
+	// Corrupt the manifest of the database.
+	manifests, err := filepath.Glob(filepath.Join(file, "MANIFEST-*"))
+	if err != nil || len(manifests) == 0 {
+		t.Errorf("Expected a manifest, got %v", err)
+	}
+	for _, m := range manifests {
+		if err = os.WriteFile(m, []byte("corrupted manifest"), 0644); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = OpenQueue(file); err == nil {
+		t.Error("Expected opening a corrupted queue to fail")
+	}
+
+	q, err = OpenQueueWithRepair(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", q.Length())
+	}
+
+	deqItem, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if deqItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+	}
+}
+
+func TestQueueRebuild(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Let the positions drift from the stored keys.
+	if err = q.db.Delete(idToKey(1), nil); err != nil {
+		t.Error(err)
+	}
+	if err = q.db.Delete(idToKey(3), nil); err != nil {
+		t.Error(err)
+	}
+	q.tail = 8
+
+	if err = q.Rebuild(); err != nil {
+		t.Error(err)
+	}
+
+	if q.head != 1 || q.tail != 5 || q.holes != 1 {
+		t.Errorf("Expected head 1, tail 5 and 1 hole, got %d, %d and %d", q.head, q.tail, q.holes)
+	}
+
+	if q.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", q.Length())
+	}
+}
+
+func TestStackRebuild(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 5; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.db.Delete(idToKey(5), nil); err != nil {
+		t.Error(err)
+	}
+	if err = s.db.Delete(idToKey(2), nil); err != nil {
+		t.Error(err)
+	}
+
+	if err = s.Rebuild(); err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected stack length of 3, got %d", s.Length())
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 4"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestPrefixQueueRebuild(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = pq.EnqueueString("prefix", fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = pq.EnqueueString("other", "value for item 1"); err != nil {
+		t.Error(err)
+	}
+	if _, err = pq.DequeueString("other"); err != nil {
+		t.Error(err)
+	}
+
+	// Lose the first item along with the stored positions.
+	if err = pq.db.Delete(generateKeyPrefixID([]byte("prefix"), 1), nil); err != nil {
+		t.Error(err)
+	}
+	if err = pq.db.Delete(generateKeyPrefixData([]byte("prefix")), nil); err != nil {
+		t.Error(err)
+	}
+
+	if err = pq.Rebuild(); err != nil {
+		t.Error(err)
+	}
+
+	if pq.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", pq.Length())
+	}
+
+	item, err := pq.DequeueString("prefix")
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 2"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	// Prefixes without items are kept empty.
+	if _, err = pq.DequeueString("other"); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+}
@@ -0,0 +1,130 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// frontReserve is the number of IDs made free in front of the head of a
+// queue when RequeueFront finds none.
+const frontReserve = 1024
+
+// RequeueFront adds an item to the head of the queue, so the next
+// Dequeue returns it, for example to retry an item straight away after
+// a transient failure. Items added to the front this way are returned
+// in LIFO order, the most recent one first.
+//
+// While the tail of a queue grows into higher IDs, each item removed
+// from its head leaves a lower ID unused, and RequeueFront gives the
+// new item the ID directly in front of the head. That ID is always free
+// right after a Dequeue. Only if no ID is free in front of the head,
+// which happens before any item has been dequeued, are the items of the
+// queue renumbered to make room, which changes their IDs and rewrites
+// every item using a single LevelDB write.
+func (q *Queue) RequeueFront(value []byte) (*Item, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	// Check if queue is full.
+	if q.maxLength > 0 && q.Length() >= q.maxLength {
+		return nil, ErrFull
+	}
+
+	// Make room in front of the head if needed.
+	batch := new(leveldb.Batch)
+	head, tail := q.head, q.tail
+	if head == 0 && q.Length() > 0 {
+		if err := q.shiftIDs(batch, frontReserve); err != nil {
+			return nil, err
+		}
+		head, tail = head+frontReserve, tail+frontReserve
+	}
+
+	// Add the item directly in front of the head. An empty queue has
+	// its head at its tail, so the item becomes the tail as well.
+	rec := &record{value: value, enqueuedAt: time.Now()}
+	if head == 0 {
+		tail++
+	} else {
+		head--
+	}
+	item := newItem(head+1, rec, q.codec)
+
+	b, err := q.format.encode(rec)
+	if err != nil {
+		return nil, err
+	}
+	batch.Put(item.Key, b)
+	q.indexItem(batch, item)
+
+	if err := q.writeState(batch, head, tail, q.holes); err != nil {
+		return nil, err
+	}
+	q.enqueued++
+	q.added(item)
+
+	return item, nil
+}
+
+// shiftIDs adds the changes moving every item of the queue to an ID n
+// higher to the batch, keeping any deduplication keys pointing at their
+// items. The queue must be locked by the caller.
+func (q *Queue) shiftIDs(batch *leveldb.Batch, n uint64) error {
+	iter := q.db.NewIterator(itemRange, nil)
+	defer iter.Release()
+
+	// Move the items from the tail down, so each new key is free when
+	// it is written.
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		id := keyToID(iter.Key())
+		value := append([]byte(nil), iter.Value()...)
+		batch.Delete(idToKey(id))
+		batch.Put(idToKey(id+n), value)
+
+		rec, err := q.format.decode(value)
+		if err != nil {
+			return err
+		}
+		q.reindexRecord(batch, rec, id, id+n)
+		if rec.uniqueKey != nil {
+			current, err := q.db.Get(uniqueIndexKey(rec.uniqueKey), nil)
+			if err != nil && err != leveldb.ErrNotFound {
+				return err
+			}
+			if err == nil && keyToID(current) == id {
+				batch.Put(uniqueIndexKey(rec.uniqueKey), appendUint64(nil, id+n))
+			}
+		}
+	}
+
+	return iter.Error()
+}
+
+// RequeueBack adds an item to the tail of the queue which is not
+// visible until the given delay has passed, the usual way to retry a
+// failed item later without serving it again straight away. Until then
+// the item is counted by Length but skipped by Dequeue, as for
+// EnqueueIn. A delay of zero or less adds an item which is visible
+// straight away.
+func (q *Queue) RequeueBack(value []byte, delay time.Duration) (*Item, error) {
+	rec := &record{value: value}
+	if delay > 0 {
+		rec.visibleAt = time.Now().Add(delay)
+	}
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.enqueue(rec)
+}
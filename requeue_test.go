@@ -0,0 +1,170 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueRequeueFront(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	// The ID of the dequeued item is reused.
+	item, err = q.RequeueFront(item.Value)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 1 {
+		t.Errorf("Expected ID to be 1, got %d", item.ID)
+	}
+
+	// Without a free ID, the items are renumbered.
+	if _, err = q.RequeueFront([]byte("retried value")); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 4 {
+		t.Errorf("Expected queue length of 4, got %d", q.Length())
+	}
+
+	expected := []string{"retried value", "value for item 1", "value for item 2", "value for item 3"}
+	for _, compStr := range expected {
+		deqItem, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		if deqItem.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, deqItem.ToString())
+		}
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	// An empty queue gets the item as its only item.
+	if _, err = q.RequeueFront([]byte("retried value")); err != nil {
+		t.Error(err)
+	}
+
+	item, err = q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "retried value" {
+		t.Errorf("Expected string to be 'retried value', got '%s'", item.ToString())
+	}
+}
+
+func TestQueueRequeueFrontUnique(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, _, err = q.EnqueueUnique([]byte("key"), []byte("value for item 1")); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.RequeueFront([]byte("retried value")); err != nil {
+		t.Error(err)
+	}
+
+	// The deduplication key follows its renumbered item.
+	item, added, err := q.EnqueueUnique([]byte("key"), []byte("value for item 2"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if added {
+		t.Error("Expected item with the same key not to be added")
+	}
+
+	if item == nil || item.ToString() != "value for item 1" || item.ID != 1+frontReserve {
+		t.Errorf("Expected existing item with ID %d to be returned, got %+v", 1+frontReserve, item)
+	}
+
+	// Reopening finds the same positions.
+	if err = q.Close(); err != nil {
+		t.Error(err)
+	}
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	item, err = q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "retried value" {
+		t.Errorf("Expected string to be 'retried value', got '%s'", item.ToString())
+	}
+}
+
+func TestQueueRequeueBack(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.RequeueBack([]byte("retried value"), 50*time.Millisecond); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ToString() != "retried value" {
+		t.Errorf("Expected string to be 'retried value', got '%s'", item.ToString())
+	}
+
+	// Without a delay the item is visible straight away.
+	if _, err = q.RequeueBack([]byte("retried value"), 0); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+}
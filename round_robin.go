@@ -0,0 +1,89 @@
+package goque
+
+// roundRobin holds the order in which DequeueRoundRobin serves the
+// prefixes of a prefix queue. Prefixes are kept until they are found
+// empty, so draining a prefix through other methods needs no
+// bookkeeping. A nil *roundRobin has not been loaded yet.
+type roundRobin struct {
+	prefixes []string
+	active   map[string]bool
+	next     int
+}
+
+// add adds the given prefix to the end of the order, unless it is
+// already in it.
+func (rr *roundRobin) add(prefix []byte) {
+	if rr == nil || rr.active[string(prefix)] {
+		return
+	}
+	rr.active[string(prefix)] = true
+	rr.prefixes = append(rr.prefixes, string(prefix))
+}
+
+// remove removes the prefix at the given position from the order.
+func (rr *roundRobin) remove(i int) {
+	delete(rr.active, rr.prefixes[i])
+	rr.prefixes = append(rr.prefixes[:i], rr.prefixes[i+1:]...)
+}
+
+// DequeueRoundRobin removes the next item of the next prefix holding
+// items and returns it, taking one item from each prefix in turn
+// rather than draining one prefix first. Prefixes are served in byte
+// order, followed by newly added prefixes in the order they were first
+// added, wrapping around once every prefix was served. ErrEmpty is
+// returned only if no prefix holds any items.
+//
+// The position within the order is kept in memory, so it starts again
+// from the first prefix when the prefix queue is reopened or purged.
+func (pq *PrefixQueue) DequeueRoundRobin() (*PrefixItem, error) {
+	pq.Lock()
+	defer pq.Unlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Find the prefixes holding items the first time around.
+	if pq.rr == nil {
+		rr := &roundRobin{active: make(map[string]bool)}
+		err := pq.forEachQueue(func(prefix []byte, q *queue) error {
+			if q.Length() > 0 {
+				rr.add(prefix)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		pq.rr = rr
+	}
+
+	rr := pq.rr
+	for len(rr.prefixes) > 0 {
+		if rr.next >= len(rr.prefixes) {
+			rr.next = 0
+		}
+		prefix := []byte(rr.prefixes[rr.next])
+
+		// Drop prefixes which have been drained.
+		item, err := pq.dequeue(prefix)
+		if err == ErrEmpty || err == ErrOutOfBounds {
+			rr.remove(rr.next)
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		rr.next++
+		return &PrefixItem{
+			ID:     item.ID,
+			Prefix: prefix,
+			Key:    item.Key,
+			Value:  item.Value,
+			codec:  pq.codec,
+		}, nil
+	}
+
+	return nil, ErrEmpty
+}
@@ -0,0 +1,111 @@
+package goque
+
+// Scheduler chooses which priority level Dequeue takes the next item of
+// a PriorityQueue from. A nil Scheduler, the default, always takes the
+// next item from the most important priority level holding items.
+type Scheduler interface {
+	// newState returns the scheduling state of a newly opened priority
+	// queue.
+	newState() schedulerState
+}
+
+// schedulerState is the scheduling state of a single priority queue.
+// It is only used while the priority queue is locked.
+type schedulerState interface {
+	// next returns the priority level the next item should be dequeued
+	// from, without changing the state. ok is false if the priority
+	// queue is empty.
+	next(pq *PriorityQueue) (priority uint8, ok bool)
+
+	// dequeued updates the state once an item has been dequeued from
+	// the given priority level, as returned by next.
+	dequeued(pq *PriorityQueue, priority uint8)
+}
+
+// WeightedScheduler serves the priority levels of a PriorityQueue in
+// proportion to their weights rather than strictly draining the most
+// important level first, so less important levels are never starved.
+// For example, weights of 3 for level 0 and 1 for level 1 dequeue three
+// items of level 0 for every item of level 1 while both hold items.
+//
+// Only levels holding items take part, so an empty level does not
+// slow down the others. Levels without a weight, or with a weight of
+// zero, have a weight of 1. Items within a level are still dequeued in
+// FIFO order, and ties go to the more important level.
+//
+// The scheduling state is not stored, so it starts over each time the
+// priority queue is opened.
+type WeightedScheduler struct {
+	Weights map[uint8]uint32
+}
+
+// newState returns the scheduling state for the weights.
+func (ws WeightedScheduler) newState() schedulerState {
+	s := &weightedState{}
+	for i := range s.weights {
+		s.weights[i] = 1
+	}
+	for priority, weight := range ws.Weights {
+		if weight > 0 {
+			s.weights[priority] = int64(weight)
+		}
+	}
+	return s
+}
+
+// weightedState implements smooth weighted round-robin scheduling over
+// the priority levels holding items. Each time an item is dequeued,
+// every such level gains its weight in credit, and the level served
+// gives up the total weight of all of them.
+type weightedState struct {
+	weights [256]int64
+	credit  [256]int64
+}
+
+// next returns the level holding items with the most credit once this
+// round of credit is added.
+func (s *weightedState) next(pq *PriorityQueue) (uint8, bool) {
+	var best uint8
+	var bestCredit int64
+	found := false
+
+	pq.forEachLevel(func(priority uint8) {
+		if pq.levels[priority].length() == 0 {
+			return
+		}
+
+		credit := s.credit[priority] + s.weights[priority]
+		if !found || credit > bestCredit {
+			best, bestCredit, found = priority, credit, true
+		}
+	})
+
+	return best, found
+}
+
+// dequeued adds this round of credit to the levels holding items and
+// charges the given level for being served.
+func (s *weightedState) dequeued(pq *PriorityQueue, priority uint8) {
+	var total int64
+
+	for i := range s.credit {
+		// The level served is counted even if it is now empty.
+		if pq.levels[i].length() == 0 && uint8(i) != priority {
+			s.credit[i] = 0
+			continue
+		}
+
+		s.credit[i] += s.weights[i]
+		total += s.weights[i]
+	}
+
+	s.credit[priority] -= total
+}
+
+// scheduler returns the scheduler to use for the options.
+func (o *Options) scheduler() Scheduler {
+	if o == nil {
+		return nil
+	}
+	return o.Scheduler
+}
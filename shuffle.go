@@ -0,0 +1,78 @@
+package goque
+
+import (
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// Shuffle puts the items in the queue in a random order using a single
+// LevelDB write, leaving its length, head and tail untouched. The IDs
+// held by the queue stay the same but are handed out among its items at
+// random, so an ID kept from before then no longer refers to the same
+// item. It is meant for testing and offline replays rather than queues
+// in use. As every item is read and rewritten within one write,
+// shuffling a large queue needs memory for all of its items.
+func (q *Queue) Shuffle() error {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		return ErrReadOnly
+	}
+
+	iter := q.db.NewIterator(itemRange, nil)
+	defer iter.Release()
+
+	var ids []uint64
+	var values [][]byte
+	for iter.Next() {
+		ids = append(ids, keyToID(iter.Key()))
+		values = append(values, append([]byte(nil), iter.Value()...))
+	}
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	random.Lock()
+	perm := random.Perm(len(ids))
+	random.Unlock()
+
+	// Remove every index entry before adding them back under the new
+	// IDs, as an item may take the ID of another item with the same
+	// index key.
+	batch := new(leveldb.Batch)
+	recs := make([]*record, len(values))
+	for i, value := range values {
+		rec, err := q.format.decode(value)
+		if err != nil {
+			return err
+		}
+		recs[i] = rec
+		q.unindexItem(batch, newItem(ids[i], rec, q.codec))
+	}
+
+	// Store each item under the ID at its place in the permutation.
+	for i, rec := range recs {
+		id := ids[perm[i]]
+		batch.Put(idToKey(id), values[i])
+		q.indexItem(batch, newItem(id, rec, q.codec))
+
+		// Point the deduplication key of the item at its new ID.
+		if rec.uniqueKey != nil {
+			current, err := q.db.Get(uniqueIndexKey(rec.uniqueKey), nil)
+			if err != nil && err != leveldb.ErrNotFound {
+				return err
+			}
+			if err == nil && keyToID(current) == ids[i] {
+				batch.Put(uniqueIndexKey(rec.uniqueKey), appendUint64(nil, id))
+			}
+		}
+	}
+
+	return q.writeState(batch, q.head, q.tail, q.holes)
+}
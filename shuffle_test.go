@@ -0,0 +1,101 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueShuffle(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 50; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if err = q.DeleteByID(10); err != nil {
+		t.Error(err)
+	}
+	if _, _, err = q.EnqueueUnique([]byte("unique"), []byte("unique value")); err != nil {
+		t.Error(err)
+	}
+
+	if err = q.Shuffle(); err != nil {
+		t.Error(err)
+	}
+
+	if q.Length() != 50 {
+		t.Errorf("Expected queue length of 50, got %d", q.Length())
+	}
+
+	// Every live item should still be there exactly once.
+	seen := make(map[string]bool)
+	moved := false
+	for i := 0; i < 50; i++ {
+		item, err := q.Dequeue()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if seen[item.ToString()] {
+			t.Errorf("Expected '%s' to be dequeued once", item.ToString())
+		}
+		seen[item.ToString()] = true
+
+		if item.ToString() != fmt.Sprintf("value for item %d", item.ID) {
+			moved = true
+		}
+	}
+
+	if !moved {
+		t.Error("Expected items to be shuffled")
+	}
+
+	if !seen["unique value"] || seen["value for item 10"] {
+		t.Error("Expected the live items to be shuffled")
+	}
+
+	// The deduplication key should have been released by its new ID.
+	if _, added, err := q.EnqueueUnique([]byte("unique"), []byte("unique value")); err != nil || !added {
+		t.Errorf("Expected unique item to be added again, got %v and %v", added, err)
+	}
+}
+
+func TestQueueShuffleIndex(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueueWithOptions(file, &Options{Indexer: func(item *Item) []byte {
+		return item.Value[:1]
+	}})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 20; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("%c%d", 'a'+i%2, i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = q.Shuffle(); err != nil {
+		t.Error(err)
+	}
+
+	for _, key := range []string{"a", "b"} {
+		items, err := q.LookupByIndex([]byte(key))
+		if err != nil {
+			t.Error(err)
+		}
+
+		if len(items) != 10 {
+			t.Errorf("Expected 10 items for index key '%s', got %d", key, len(items))
+		}
+	}
+}
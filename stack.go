@@ -1,59 +1,105 @@
 package goque
 
 import (
-	"bytes"
-	"encoding/gob"
+	"context"
+	"encoding/binary"
 	"encoding/json"
 	"os"
 	"sync"
+	"time"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 // Stack is a standard LIFO (last in, first out) stack.
 type Stack struct {
 	sync.RWMutex
-	DataDir string
-	db      *leveldb.DB
-	head    uint64
-	tail    uint64
-	isOpen  bool
+	DataDir   string
+	db        database
+	head      uint64
+	tail      uint64
+	holes     uint64
+	pushed    uint64
+	popped    uint64
+	counted   time.Time
+	isOpen    bool
+	codec     Codec
+	format    recordFormat
+	writeOpts *opt.WriteOptions
 }
 
 // OpenStack opens a stack if one exists at the given directory. If one
 // does not already exist, a new stack is created.
 func OpenStack(dataDir string) (*Stack, error) {
+	return OpenStackWithOptions(dataDir, nil)
+}
+
+// OpenStackWithOptions opens a stack if one exists at the given
+// directory using the given options. If one does not already exist, a
+// new stack is created.
+func OpenStackWithOptions(dataDir string, opts *Options) (*Stack, error) {
+	return openStack(context.Background(), dataDir, opts, nil)
+}
+
+// OpenStackContext opens a stack like OpenStack. If the data directory
+// is locked by another process, opening is retried with backoff until
+// the context is done, at which point the lock error is returned.
+func OpenStackContext(ctx context.Context, dataDir string) (*Stack, error) {
+	return openStack(ctx, dataDir, nil, nil)
+}
+
+// OpenStackWithLevelOptions opens a stack like OpenStack, using the
+// given LevelDB options to tune the underlying database. As for
+// OpenQueueWithLevelOptions, the Comparer and ReadOnly options can not
+// be overridden.
+func OpenStackWithLevelOptions(dataDir string, lopts *opt.Options) (*Stack, error) {
+	return openStack(context.Background(), dataDir, nil, levelOptions(lopts))
+}
+
+// openStack opens a stack using the given context, options and LevelDB
+// options, which may be nil.
+func openStack(ctx context.Context, dataDir string, opts *Options, lopts *opt.Options) (*Stack, error) {
 	var err error
 
 	// Create a new Stack.
-	s := &Stack{
-		DataDir: dataDir,
-		db:      &leveldb.DB{},
-		head:    0,
-		tail:    0,
-		isOpen:  false,
-	}
+	s := newStack(dataDir, opts)
 
 	// Open database for the stack.
-	s.db, err = leveldb.OpenFile(dataDir, nil)
+	db, err := openDB(ctx, dataDir, lopts)
 	if err != nil {
 		return s, err
 	}
+	s.db = levelDB{db}
 
 	// Check if this Goque type can open the requested data directory.
-	ok, err := checkGoqueType(dataDir, goqueStack)
-	if err != nil {
+	if err = checkGoqueType(dataDir, TypeStack, s.codec, false, s.writeOpts.Sync); err != nil {
 		return s, err
 	}
-	if !ok {
-		return s, ErrIncompatibleType
-	}
 
 	// Set isOpen and return.
 	s.isOpen = true
 	return s, s.init()
 }
 
+// newStack returns a new Stack which is not open yet, using the given
+// options, which may be nil.
+func newStack(dataDir string, opts *Options) *Stack {
+	opts.registerGobTypes()
+	return &Stack{
+		DataDir:   dataDir,
+		db:        levelDB{&leveldb.DB{}},
+		head:      0,
+		tail:      0,
+		counted:   time.Now(),
+		isOpen:    false,
+		codec:     opts.codec(),
+		format:    newRecordFormat(opts),
+		writeOpts: opts.writeOptions(),
+	}
+}
+
 // Push adds an item to the stack.
 func (s *Stack) Push(value []byte) (*Item, error) {
 	s.Lock()
@@ -69,15 +115,21 @@ func (s *Stack) Push(value []byte) (*Item, error) {
 		ID:    s.head + 1,
 		Key:   idToKey(s.head + 1),
 		Value: value,
+		codec: s.codec,
 	}
 
 	// Add it to the stack.
-	if err := s.db.Put(item.Key, item.Value, nil); err != nil {
+	b, err := s.format.encode(&record{value: item.Value})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Put(item.Key, b, s.writeOpts); err != nil {
 		return nil, err
 	}
 
-	// Increment head position.
+	// Increment head position and pushed count.
 	s.head++
+	s.pushed++
 
 	return item, nil
 }
@@ -89,21 +141,20 @@ func (s *Stack) PushString(value string) (*Item, error) {
 }
 
 // PushObject is a helper function for Push that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the stack, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (s *Stack) PushObject(value interface{}) (*Item, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(value); err != nil {
+	b, err := s.codec.Encode(value)
+	if err != nil {
 		return nil, err
 	}
 
-	return s.Push(buffer.Bytes())
+	return s.Push(b)
 }
 
 // PushObjectAsJSON is a helper function for Push that accepts any
@@ -120,8 +171,81 @@ func (s *Stack) PushObjectAsJSON(value interface{}) (*Item, error) {
 	return s.Push(jsonBytes)
 }
 
+// PushBatch adds the given values to the stack using a single
+// LevelDB write. Either all of the items are added or none are.
+//
+// The returned items are in the same order as the given values, so
+// the last value given ends up at the top of the stack.
+func (s *Stack) PushBatch(values [][]byte) ([]*Item, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Create the new Items and add them to the batch.
+	batch := new(leveldb.Batch)
+	items := make([]*Item, len(values))
+	for i, value := range values {
+		id := s.head + uint64(i) + 1
+		items[i] = &Item{
+			ID:    id,
+			Key:   idToKey(id),
+			Value: value,
+			codec: s.codec,
+		}
+
+		b, err := s.format.encode(&record{value: value})
+		if err != nil {
+			return nil, err
+		}
+		batch.Put(items[i].Key, b)
+	}
+
+	// Add them to the stack.
+	if err := s.db.Write(batch, s.writeOpts); err != nil {
+		return nil, err
+	}
+
+	// Increment head position and pushed count.
+	s.head += uint64(len(items))
+	s.pushed += uint64(len(items))
+
+	return items, nil
+}
+
+// PushObjectBatch is a helper function for PushBatch that accepts
+// values of any type, which are then encoded into byte slices using
+// the codec of the stack, which is encoding/gob by default.
+//
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
+// package works. Because of this, you should only use this function
+// to encode simple types.
+func (s *Stack) PushObjectBatch(values []interface{}) ([]*Item, error) {
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		b, err := s.codec.Encode(value)
+		if err != nil {
+			return nil, err
+		}
+		encoded[i] = b
+	}
+
+	return s.PushBatch(encoded)
+}
+
 // Pop removes the next item in the stack and returns it.
 func (s *Stack) Pop() (*Item, error) {
+	return s.pop(nil)
+}
+
+// pop removes the next item in the stack and returns it. If check is
+// not nil, it is called with the item before it is removed, and the
+// item is left in place if it returns an error.
+func (s *Stack) pop(check func(*Item) error) (*Item, error) {
 	s.Lock()
 	defer s.Unlock()
 
@@ -135,18 +259,139 @@ func (s *Stack) Pop() (*Item, error) {
 	if err != nil {
 		return nil, err
 	}
+	if check != nil {
+		if err := check(item); err != nil {
+			return nil, err
+		}
+	}
+
+	// Remove this item from the stack, moving the head down to the
+	// next stored item.
+	head, holes, err := s.lowerHead(s.head, s.holes)
+	if err != nil {
+		return nil, err
+	}
 
-	// Remove this item from the stack.
-	if err := s.db.Delete(item.Key, nil); err != nil {
+	batch := new(leveldb.Batch)
+	batch.Delete(item.Key)
+	if err := s.writeState(batch, head, s.tail, holes); err != nil {
 		return nil, err
 	}
 
-	// Decrement head position.
-	s.head--
+	// Increment popped count.
+	s.popped++
 
 	return item, nil
 }
 
+// PopBatch removes up to max items from the top of the stack using a
+// single LevelDB write and returns them in pop order.
+//
+// Fewer than max items are returned if the stack does not hold that
+// many, and ErrEmpty is returned if the stack is empty.
+func (s *Stack) PopBatch(max int) ([]*Item, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if stack is empty.
+	if s.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Determine how many items to remove.
+	var n uint64
+	if max > 0 {
+		n = uint64(max)
+	}
+	if n > s.Length() {
+		n = s.Length()
+	}
+
+	// Get the next items in the stack and add them to the batch,
+	// finding the next stored item below them.
+	batch := new(leveldb.Batch)
+	items := make([]*Item, 0, n)
+	head := s.tail
+	err := s.forEach(func(item *Item) bool {
+		if uint64(len(items)) == n {
+			head = item.ID
+			return false
+		}
+
+		items = append(items, item)
+		batch.Delete(item.Key)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Remove these items from the stack.
+	holes := uint64(0)
+	if head != s.tail {
+		holes = head - s.tail - (s.Length() - n)
+	}
+	if err := s.writeState(batch, head, s.tail, holes); err != nil {
+		return nil, err
+	}
+
+	// Increment popped count.
+	s.popped += n
+
+	return items, nil
+}
+
+// PopN removes up to n items from the top of the stack using a single
+// LevelDB write and returns them in pop order, the same as PopBatch.
+func (s *Stack) PopN(n int) ([]*Item, error) {
+	return s.PopBatch(n)
+}
+
+// PeekN returns up to n items from the top of the stack in pop order
+// without removing them.
+//
+// Fewer than n items are returned if the stack does not hold that
+// many, and ErrEmpty is returned if the stack is empty.
+func (s *Stack) PeekN(n int) ([]*Item, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, ErrDBClosed
+	}
+
+	// Check if stack is empty.
+	if s.Length() == 0 {
+		return nil, ErrEmpty
+	}
+
+	// Determine how many items to read.
+	var count uint64
+	if n > 0 {
+		count = uint64(n)
+	}
+	if count > s.Length() {
+		count = s.Length()
+	}
+
+	items := make([]*Item, 0, count)
+	err := s.forEach(func(item *Item) bool {
+		items = append(items, item)
+		return uint64(len(items)) < count
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
 // Peek returns the next item in the stack without removing it.
 func (s *Stack) Peek() (*Item, error) {
 	s.RLock()
@@ -171,7 +416,36 @@ func (s *Stack) PeekByOffset(offset uint64) (*Item, error) {
 		return nil, ErrDBClosed
 	}
 
-	return s.getItemByID(s.head - offset)
+	// Without any holes the item can be looked up directly.
+	if s.holes == 0 {
+		return s.getItemByID(s.head - offset)
+	}
+
+	// Check if stack is empty or the offset is out of bounds.
+	if s.Length() == 0 {
+		return nil, ErrEmpty
+	} else if offset >= s.Length() {
+		return nil, ErrOutOfBounds
+	}
+
+	// Otherwise skip over the holes left by removed items.
+	var item *Item
+	err := s.forEach(func(i *Item) bool {
+		if offset == 0 {
+			item = i
+			return false
+		}
+		offset--
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if item == nil {
+		return nil, ErrOutOfBounds
+	}
+
+	return item, nil
 }
 
 // PeekByID returns the item with the given ID without removing it.
@@ -201,22 +475,114 @@ func (s *Stack) Update(id uint64, newValue []byte) (*Item, error) {
 	if id > s.head || id <= s.tail {
 		return nil, ErrOutOfBounds
 	}
+	if s.holes > 0 {
+		ok, err := s.db.Has(idToKey(id), nil)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, ErrOutOfBounds
+		}
+	}
 
 	// Create new Item.
 	item := &Item{
 		ID:    id,
 		Key:   idToKey(id),
 		Value: newValue,
+		codec: s.codec,
 	}
 
 	// Update this item in the stack.
-	if err := s.db.Put(item.Key, item.Value, nil); err != nil {
+	if err := s.put(item); err != nil {
 		return nil, err
 	}
 
 	return item, nil
 }
 
+// UpdateAndGet updates an item in the stack without changing its
+// position, returning the item as it was before the update along with
+// the updated item. The previous value is read and the new value
+// written while the stack is locked, so no concurrent update is lost.
+func (s *Stack) UpdateAndGet(id uint64, newValue []byte) (*Item, *Item, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return nil, nil, ErrDBClosed
+	}
+
+	// Get the current item.
+	old, err := s.getItemByID(id)
+	if err == ErrEmpty {
+		return nil, nil, ErrOutOfBounds
+	} else if err != nil {
+		return nil, nil, err
+	}
+	item := *old
+	item.Value = newValue
+
+	// Update this item in the stack.
+	if err := s.put(&item); err != nil {
+		return nil, nil, err
+	}
+
+	return old, &item, nil
+}
+
+// put stores the value of the given item in the stack.
+func (s *Stack) put(item *Item) error {
+	b, err := s.format.encode(&record{value: item.Value})
+	if err != nil {
+		return err
+	}
+	return s.db.Put(item.Key, b, s.writeOpts)
+}
+
+// UpdateBatch replaces the values of the items with the given IDs
+// without changing their positions, using a single LevelDB write. If
+// the stack does not hold any of the items, ErrOutOfBounds is returned
+// and nothing is updated.
+func (s *Stack) UpdateBatch(updates map[uint64][]byte) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	batch := new(leveldb.Batch)
+	for id, value := range updates {
+		// Check if item exists in stack.
+		if id > s.head || id <= s.tail {
+			return ErrOutOfBounds
+		}
+		if s.holes > 0 {
+			ok, err := s.db.Has(idToKey(id), nil)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return ErrOutOfBounds
+			}
+		}
+
+		b, err := s.format.encode(&record{value: value})
+		if err != nil {
+			return err
+		}
+		batch.Put(idToKey(id), b)
+	}
+
+	if batch.Len() == 0 {
+		return nil
+	}
+	return s.db.Write(batch, s.writeOpts)
+}
+
 // UpdateString is a helper function for Update that accepts a value
 // as a string rather than a byte slice.
 func (s *Stack) UpdateString(id uint64, newValue string) (*Item, error) {
@@ -224,20 +590,19 @@ func (s *Stack) UpdateString(id uint64, newValue string) (*Item, error) {
 }
 
 // UpdateObject is a helper function for Update that accepts any
-// value type, which is then encoded into a byte slice using
-// encoding/gob.
+// value type, which is then encoded into a byte slice using the codec
+// of the stack, which is encoding/gob by default.
 //
-// Objects containing pointers with zero values will decode to nil
-// when using this function. This is due to how the encoding/gob
+// When using encoding/gob, objects containing pointers with zero
+// values will decode to nil. This is due to how the encoding/gob
 // package works. Because of this, you should only use this function
 // to encode simple types.
 func (s *Stack) UpdateObject(id uint64, newValue interface{}) (*Item, error) {
-	var buffer bytes.Buffer
-	enc := gob.NewEncoder(&buffer)
-	if err := enc.Encode(newValue); err != nil {
+	b, err := s.codec.Encode(newValue)
+	if err != nil {
 		return nil, err
 	}
-	return s.Update(id, buffer.Bytes())
+	return s.Update(id, b)
 }
 
 // UpdateObjectAsJSON is a helper function for Update that accepts
@@ -256,11 +621,40 @@ func (s *Stack) UpdateObjectAsJSON(id uint64, newValue interface{}) (*Item, erro
 
 // Length returns the total number of items in the stack.
 func (s *Stack) Length() uint64 {
-	return s.head - s.tail
+	return s.head - s.tail - s.holes
 }
 
-// Close closes the LevelDB database of the stack.
+// Purge removes every item from the stack using a single LevelDB
+// write, keeping the stack open. Items added afterwards start again
+// from an ID of 1.
+func (s *Stack) Purge() error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	// Remove every item from the stack.
+	batch := new(leveldb.Batch)
+	if err := deleteRange(s.db, batch, itemRange); err != nil {
+		return err
+	}
+
+	// Reset stack head and tail.
+	return s.writeState(batch, 0, 0, 0)
+}
+
+// Close closes the LevelDB database of the stack, flushing its writes
+// to disk first if it was opened with the NoSync option.
 func (s *Stack) Close() error {
+	return s.CloseContext(context.Background())
+}
+
+// CloseContext closes the LevelDB database of the stack. See
+// Queue.CloseContext for how writes are flushed first.
+func (s *Stack) CloseContext(ctx context.Context) error {
 	s.Lock()
 	defer s.Unlock()
 
@@ -269,6 +663,11 @@ func (s *Stack) Close() error {
 		return nil
 	}
 
+	// Flush any writes which were not synced.
+	if err := flushContext(ctx, s.db, s.writeOpts.Sync); err != nil {
+		return err
+	}
+
 	// Close the LevelDB database.
 	if err := s.db.Close(); err != nil {
 		return err
@@ -278,6 +677,7 @@ func (s *Stack) Close() error {
 	// isOpen to false.
 	s.head = 0
 	s.tail = 0
+	s.holes = 0
 	s.isOpen = false
 
 	return nil
@@ -289,6 +689,11 @@ func (s *Stack) Drop() error {
 		return err
 	}
 
+	// A stack within a namespace only removes its own keys.
+	if ns, ok := s.db.(*namespace); ok {
+		return ns.drop(s.writeOpts)
+	}
+
 	return os.RemoveAll(s.DataDir)
 }
 
@@ -302,19 +707,25 @@ func (s *Stack) getItemByID(id uint64) (*Item, error) {
 	}
 
 	// Get item from database.
-	var err error
-	item := &Item{ID: id, Key: idToKey(id)}
-	if item.Value, err = s.db.Get(item.Key, nil); err != nil {
+	value, err := s.db.Get(idToKey(id), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, ErrOutOfBounds
+	} else if err != nil {
 		return nil, err
 	}
 
-	return item, nil
+	rec, err := s.format.decode(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return newItem(id, rec, s.codec), nil
 }
 
 // init initializes the stack data.
 func (s *Stack) init() error {
 	// Create a new LevelDB Iterator.
-	iter := s.db.NewIterator(nil, nil)
+	iter := s.db.NewIterator(itemRange, nil)
 	defer iter.Release()
 
 	// Set stack head to the last item.
@@ -327,5 +738,157 @@ func (s *Stack) init() error {
 		s.tail = keyToID(iter.Key()) - 1
 	}
 
+	if err := iter.Error(); err != nil {
+		return err
+	}
+
+	// Get the number of holes left by removed items.
+	holes, err := s.db.Get(internalKey("holes"), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	s.holes = binary.BigEndian.Uint64(holes)
+	return nil
+}
+
+// DeleteByID removes the item with the given ID from the stack, wherever
+// it is. Items removed from the middle of the stack leave a hole, which
+// is skipped by Pop and Peek and not counted by Length or PeekByOffset.
+// ErrOutOfBounds is returned if the stack does not hold the item.
+func (s *Stack) DeleteByID(id uint64) error {
+	s.Lock()
+	defer s.Unlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return ErrDBClosed
+	}
+
+	// Check if item exists in stack.
+	if id > s.head || id <= s.tail {
+		return ErrOutOfBounds
+	}
+	ok, err := s.db.Has(idToKey(id), nil)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrOutOfBounds
+	}
+
+	head, tail, holes, err := s.removalState(id)
+	if err != nil {
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete(idToKey(id))
+	return s.writeState(batch, head, tail, holes)
+}
+
+// lowerHead returns the head position and number of holes of the
+// stack once the item at the given head position has been removed.
+func (s *Stack) lowerHead(head, holes uint64) (uint64, uint64, error) {
+	// Without any holes the next item is directly below.
+	if holes == 0 {
+		return head - 1, 0, nil
+	}
+
+	// Otherwise seek to the next stored item below.
+	iter := s.db.NewIterator(&util.Range{Start: idToKey(s.tail + 1), Limit: idToKey(head)}, nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		if err := iter.Error(); err != nil {
+			return 0, 0, err
+		}
+		return s.tail, 0, nil
+	}
+
+	next := keyToID(iter.Key())
+	return next, holes - (head - next - 1), nil
+}
+
+// raiseTail returns the tail position and number of holes of the stack
+// once the item directly above the given tail position has been
+// removed.
+func (s *Stack) raiseTail(tail, holes uint64) (uint64, uint64, error) {
+	// Without any holes the previous item is directly above.
+	if holes == 0 {
+		return tail + 1, 0, nil
+	}
+
+	// Otherwise seek to the previous stored item above.
+	iter := s.db.NewIterator(&util.Range{Start: idToKey(tail + 2), Limit: idToKey(s.head + 1)}, nil)
+	defer iter.Release()
+
+	if !iter.First() {
+		if err := iter.Error(); err != nil {
+			return 0, 0, err
+		}
+		return s.head, 0, nil
+	}
+
+	prev := keyToID(iter.Key())
+	return prev - 1, holes - (prev - tail - 2), nil
+}
+
+// removalState returns the head and tail positions and number of holes
+// of the stack once the stored item with the given ID has been removed.
+func (s *Stack) removalState(id uint64) (uint64, uint64, uint64, error) {
+	switch id {
+	case s.head:
+		head, holes, err := s.lowerHead(s.head, s.holes)
+		return head, s.tail, holes, err
+	case s.tail + 1:
+		tail, holes, err := s.raiseTail(s.tail, s.holes)
+		return s.head, tail, holes, err
+	default:
+		return s.head, s.tail, s.holes + 1, nil
+	}
+}
+
+// writeState writes the given batch along with the number of holes,
+// and then sets the head and tail positions and number of holes of the
+// stack.
+func (s *Stack) writeState(batch *leveldb.Batch, head, tail, holes uint64) error {
+	if holes != s.holes {
+		if holes == 0 {
+			batch.Delete(internalKey("holes"))
+		} else {
+			batch.Put(internalKey("holes"), appendUint64(nil, holes))
+		}
+	}
+
+	if batch.Len() > 0 {
+		if err := s.db.Write(batch, s.writeOpts); err != nil {
+			return err
+		}
+	}
+
+	s.head, s.tail, s.holes = head, tail, holes
+	return nil
+}
+
+// forEach calls fn for each item stored in the stack, from the top of
+// the stack down, until fn returns false.
+func (s *Stack) forEach(fn func(*Item) bool) error {
+	iter := s.db.NewIterator(&util.Range{Start: idToKey(s.tail + 1), Limit: idToKey(s.head + 1)}, nil)
+	defer iter.Release()
+
+	for ok := iter.Last(); ok; ok = iter.Prev() {
+		rec, err := s.format.decode(append([]byte(nil), iter.Value()...))
+		if err != nil {
+			return err
+		}
+
+		if !fn(newItem(keyToID(iter.Key()), rec, s.codec)) {
+			break
+		}
+	}
+
 	return iter.Error()
 }
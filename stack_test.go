@@ -1,8 +1,11 @@
 package goque
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -52,6 +55,52 @@ func TestStackDrop(t *testing.T) {
 	}
 }
 
+func TestStackPurge(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.Purge(); err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s.Length())
+	}
+
+	if _, err = os.Stat(filepath.Join(file, "GOQUE")); err != nil {
+		t.Error(err)
+	}
+
+	item, err := s.PushString("value")
+	if err != nil {
+		t.Error(err)
+	}
+
+	if item.ID != 1 {
+		t.Errorf("Expected ID to be 1, got %d", item.ID)
+	}
+
+	s.Close()
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 1 {
+		t.Errorf("Expected stack length of 1, got %d", s.Length())
+	}
+}
+
 func TestStackIncompatibleType(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	pq, err := OpenPriorityQueue(file, ASC)
@@ -61,7 +110,7 @@ func TestStackIncompatibleType(t *testing.T) {
 	defer pq.Drop()
 	pq.Close()
 
-	if _, err = OpenStack(file); err != ErrIncompatibleType {
+	if _, err = OpenStack(file); !errors.Is(err, ErrIncompatibleType) {
 		t.Error("Expected stack to return ErrIncompatibleTypes when opening goquePriorityQueue")
 	}
 }
@@ -85,6 +134,39 @@ func TestStackPush(t *testing.T) {
 	}
 }
 
+func TestStackPushBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	var values [][]byte
+	for i := 1; i <= 10; i++ {
+		values = append(values, []byte(fmt.Sprintf("value for item %d", i)))
+	}
+
+	if _, err = s.PushBatch(values); err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 10 {
+		t.Errorf("Expected stack length of 10, got %d", s.Length())
+	}
+
+	popItem, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 10"
+
+	if popItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, popItem.ToString())
+	}
+}
+
 func TestStackPop(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	s, err := OpenStack(file)
@@ -163,6 +245,105 @@ func TestStackPushPopPointerJSON(t *testing.T) {
 	}
 }
 
+func TestStackPopBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := s.PopBatch(4)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 4 {
+		t.Errorf("Expected 4 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", 10-i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if s.Length() != 6 {
+		t.Errorf("Expected stack length of 6, got %d", s.Length())
+	}
+
+	peekItem, err := s.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 6"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+}
+
+func TestStackPeekN(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	if _, err = s.PeekN(3); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	for i := 1; i <= 5; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	items, err := s.PeekN(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 3 {
+		t.Errorf("Expected 3 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", 5-i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if s.Length() != 5 {
+		t.Errorf("Expected stack length of 5, got %d", s.Length())
+	}
+
+	// Popping more items than the stack holds should drain it.
+	items, err = s.PopN(10)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 5 {
+		t.Errorf("Expected 5 items, got %d", len(items))
+	}
+
+	if s.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s.Length())
+	}
+}
+
 func TestStackPeek(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	s, err := OpenStack(file)
@@ -316,6 +497,84 @@ func TestStackUpdate(t *testing.T) {
 	}
 }
 
+func TestStackUpdateAndGet(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	oldCompStr := "value for item 3"
+	newCompStr := "new value for item 3"
+
+	oldItem, updatedItem, err := s.UpdateAndGet(3, []byte(newCompStr))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if oldItem.ToString() != oldCompStr {
+		t.Errorf("Expected old item value to be '%s', got '%s'", oldCompStr, oldItem.ToString())
+	}
+
+	if updatedItem.ToString() != newCompStr {
+		t.Errorf("Expected current item value to be '%s', got '%s'", newCompStr, updatedItem.ToString())
+	}
+
+	newItem, err := s.PeekByID(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.ToString() != newCompStr {
+		t.Errorf("Expected new item value to be '%s', got '%s'", newCompStr, newItem.ToString())
+	}
+
+	if _, _, err = s.UpdateAndGet(11, []byte(newCompStr)); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+}
+
+func TestStackUpdateBatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.UpdateBatch(map[uint64][]byte{1: []byte("new value 1"), 4: []byte("new value 4")}); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	if err = s.UpdateBatch(map[uint64][]byte{1: []byte("new value 1"), 3: []byte("new value 3")}); err != nil {
+		t.Error(err)
+	}
+
+	for _, compStr := range []string{"new value 3", "value for item 2", "new value 1"} {
+		item, err := s.Pop()
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+}
+
 func TestStackUpdateString(t *testing.T) {
 	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
 	s, err := OpenStack(file)
@@ -629,3 +888,117 @@ func BenchmarkStackPop(b *testing.B) {
 		_, _ = s.Pop()
 	}
 }
+
+func TestStackDeleteByID(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 6; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, id := range []uint64{5, 3, 1} {
+		if err = s.DeleteByID(id); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = s.DeleteByID(5); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	// The holes should be kept across a restart.
+	s.Close()
+	s, err = OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if s.Length() != 3 {
+		t.Errorf("Expected stack length of 3, got %d", s.Length())
+	}
+
+	// Offsets should only count the remaining items.
+	peekItem, err := s.PeekByOffset(1)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 4"
+
+	if peekItem.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.ToString())
+	}
+
+	if _, err = s.Update(3, []byte("new value")); err != ErrOutOfBounds {
+		t.Errorf("Expected to get out of bounds error, got %v", err)
+	}
+
+	item, err := s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr = "value for item 6"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+
+	items, err := s.PopBatch(5)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(items) != 2 {
+		t.Errorf("Expected 2 items, got %d", len(items))
+	}
+
+	for i, item := range items {
+		compStr := fmt.Sprintf("value for item %d", 4-2*i)
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if s.Length() != 0 {
+		t.Errorf("Expected stack length of 0, got %d", s.Length())
+	}
+
+	if _, err = s.Pop(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+}
+
+func TestStackRecordMagicValue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	// Plain values starting like an encoded record are kept as given.
+	values := [][]byte{{0xff, 'g', 'q', 0, 'x', 'y'}, {0xff, 'g', 'x', 0, 0, 'x', 'y'}}
+	for _, value := range values {
+		if _, err = s.Push(value); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for i := len(values) - 1; i >= 0; i-- {
+		item, err := s.Pop()
+		if err != nil {
+			t.Error(err)
+		}
+		if !bytes.Equal(item.Value, values[i]) {
+			t.Errorf("Expected value to be %v, got %v", values[i], item.Value)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package goque
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// Stats holds operational metrics of a stack or queue, as returned by
+// the Stats method of each structure.
+type Stats struct {
+	// Length is the number of items currently held.
+	Length uint64
+
+	// EnqueuedCount and DequeuedCount are the total number of items
+	// added and removed since the structure was opened, or since
+	// ResetStats was last called. For a stack, these count pushed and
+	// popped items.
+	EnqueuedCount uint64
+	DequeuedCount uint64
+
+	// HeadID is the ID of the item which would be removed next, and
+	// TailID the ID of the item at the other end. Both are zero when
+	// there are no items. For a priority queue, these are IDs within
+	// the most important priority level holding items. For a prefix
+	// queue, where IDs are given within each prefix, both are zero.
+	HeadID uint64
+	TailID uint64
+
+	// DiskSize is the approximate size in bytes of the files within
+	// the data directory.
+	DiskSize int64
+
+	// LevelLengths holds the number of items in each non-empty
+	// priority level of a priority queue.
+	LevelLengths map[uint8]uint64
+
+	// PrefixLengths holds the number of items for each non-empty
+	// prefix of a prefix queue.
+	PrefixLengths map[string]uint64
+}
+
+// Stats returns operational metrics of the queue. The zero Stats is
+// returned if the queue is closed.
+func (q *Queue) Stats() Stats {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return Stats{}
+	}
+
+	stats := Stats{
+		Length:        q.Length(),
+		EnqueuedCount: q.enqueued,
+		DequeuedCount: q.dequeued,
+	}
+	if q.head < q.tail {
+		stats.HeadID, stats.TailID = q.head+1, q.tail
+	}
+
+	// The size is only approximate, so ignore any error.
+	stats.DiskSize, _ = dirSize(q.DataDir)
+
+	return stats
+}
+
+// Stats returns operational metrics of the stack. The zero Stats is
+// returned if the stack is closed.
+func (s *Stack) Stats() Stats {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return Stats{}
+	}
+
+	stats := Stats{
+		Length:        s.Length(),
+		EnqueuedCount: s.pushed,
+		DequeuedCount: s.popped,
+	}
+	if s.tail < s.head {
+		stats.HeadID, stats.TailID = s.head, s.tail+1
+	}
+
+	// The size is only approximate, so ignore any error.
+	stats.DiskSize, _ = dirSize(s.DataDir)
+
+	return stats
+}
+
+// Stats returns operational metrics of the priority queue, including
+// the length of each priority level. The zero Stats is returned if the
+// queue is closed.
+func (pq *PriorityQueue) Stats() Stats {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return Stats{}
+	}
+
+	stats := Stats{
+		Length:        pq.length(),
+		EnqueuedCount: pq.enqueued,
+		DequeuedCount: pq.dequeued,
+		LevelLengths:  make(map[uint8]uint64),
+	}
+
+	for i := 0; i <= 255; i++ {
+		priority := uint8(i)
+		if pq.order == DESC {
+			priority = uint8(255 - i)
+		}
+
+		level := pq.levels[priority]
+		if level.length() == 0 {
+			continue
+		}
+
+		// Report the IDs of the most important non-empty level.
+		if len(stats.LevelLengths) == 0 {
+			stats.HeadID, stats.TailID = level.head+1, level.tail
+		}
+		stats.LevelLengths[priority] = level.length()
+	}
+
+	// The size is only approximate, so ignore any error.
+	stats.DiskSize, _ = dirSize(pq.DataDir)
+
+	return stats
+}
+
+// Stats returns operational metrics of the prefix queue, including the
+// length of each prefix. The zero Stats is returned if the queue is
+// closed.
+func (pq *PrefixQueue) Stats() Stats {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return Stats{}
+	}
+
+	stats := Stats{
+		Length:        pq.size,
+		EnqueuedCount: pq.enqueued,
+		DequeuedCount: pq.dequeued,
+		PrefixLengths: make(map[string]uint64),
+	}
+
+	pq.forEachQueue(func(prefix []byte, q *queue) error {
+		if q.Length() > 0 {
+			stats.PrefixLengths[string(prefix)] = q.Length()
+		}
+		return nil
+	})
+
+	// The size is only approximate, so ignore any error.
+	stats.DiskSize, _ = dirSize(pq.DataDir)
+
+	return stats
+}
+
+// DiskSize returns the total size in bytes of the files within the data
+// directory of the queue. Removed items keep taking up space until
+// LevelDB compacts the files holding them, so the size is measured
+// before compaction. DiskSize only reads the file sizes, and does not
+// trigger a compaction.
+func (q *Queue) DiskSize() (int64, error) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return dirSize(q.DataDir)
+}
+
+// DiskSize returns the total size in bytes of the files within the data
+// directory of the stack, measured as described for Queue.DiskSize.
+func (s *Stack) DiskSize() (int64, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return dirSize(s.DataDir)
+}
+
+// DiskSize returns the total size in bytes of the files within the data
+// directory of the priority queue, measured as described for
+// Queue.DiskSize.
+func (pq *PriorityQueue) DiskSize() (int64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return dirSize(pq.DataDir)
+}
+
+// DiskSize returns the total size in bytes of the files within the data
+// directory of the prefix queue, measured as described for
+// Queue.DiskSize.
+func (pq *PrefixQueue) DiskSize() (int64, error) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, ErrDBClosed
+	}
+
+	return dirSize(pq.DataDir)
+}
+
+// dirSize returns the total size of the regular files within the given
+// directory and its subdirectories. Files removed while walking the
+// directory, as LevelDB does when compacting, are skipped.
+func dirSize(dir string) (int64, error) {
+	// In-memory structures have no data directory.
+	if dir == "" {
+		return 0, nil
+	}
+
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) && path != dir {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		size += info.Size()
+		return nil
+	})
+
+	return size, err
+}
+
+// ThroughputStats returns the average number of items enqueued and
+// dequeued per second since the queue was opened, or since ResetStats
+// was last called, so a monitoring loop calling both in turn gets the
+// rates over each of its intervals. Zero rates are returned if the
+// queue is closed.
+func (q *Queue) ThroughputStats() (enqPerSec, deqPerSec float64) {
+	q.RLock()
+	defer q.RUnlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return 0, 0
+	}
+
+	return throughput(q.enqueued, q.dequeued, q.counted)
+}
+
+// ResetStats zeroes the enqueued and dequeued counts of the queue,
+// reported by Stats and used by ThroughputStats, and starts counting
+// again from now.
+func (q *Queue) ResetStats() {
+	q.Lock()
+	defer q.Unlock()
+
+	q.enqueued, q.dequeued, q.counted = 0, 0, time.Now()
+}
+
+// ThroughputStats returns the average number of items pushed and
+// popped per second since the stack was opened, or since ResetStats
+// was last called. Zero rates are returned if the stack is closed.
+func (s *Stack) ThroughputStats() (pushPerSec, popPerSec float64) {
+	s.RLock()
+	defer s.RUnlock()
+
+	// Check if stack is closed.
+	if !s.isOpen {
+		return 0, 0
+	}
+
+	return throughput(s.pushed, s.popped, s.counted)
+}
+
+// ResetStats zeroes the pushed and popped counts of the stack, reported
+// by Stats and used by ThroughputStats, and starts counting again from
+// now.
+func (s *Stack) ResetStats() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.pushed, s.popped, s.counted = 0, 0, time.Now()
+}
+
+// ThroughputStats returns the average number of items enqueued and
+// dequeued per second since the priority queue was opened, or since
+// ResetStats was last called. Zero rates are returned if the queue is
+// closed.
+func (pq *PriorityQueue) ThroughputStats() (enqPerSec, deqPerSec float64) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, 0
+	}
+
+	return throughput(pq.enqueued, pq.dequeued, pq.counted)
+}
+
+// ResetStats zeroes the enqueued and dequeued counts of the priority
+// queue, reported by Stats and used by ThroughputStats, and starts
+// counting again from now.
+func (pq *PriorityQueue) ResetStats() {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.enqueued, pq.dequeued, pq.counted = 0, 0, time.Now()
+}
+
+// ThroughputStats returns the average number of items enqueued and
+// dequeued per second since the prefix queue was opened, or since
+// ResetStats was last called. Zero rates are returned if the queue is
+// closed.
+func (pq *PrefixQueue) ThroughputStats() (enqPerSec, deqPerSec float64) {
+	pq.RLock()
+	defer pq.RUnlock()
+
+	// Check if queue is closed.
+	if !pq.isOpen {
+		return 0, 0
+	}
+
+	return throughput(pq.enqueued, pq.dequeued, pq.counted)
+}
+
+// ResetStats zeroes the enqueued and dequeued counts of the prefix
+// queue, reported by Stats and used by ThroughputStats, and starts
+// counting again from now.
+func (pq *PrefixQueue) ResetStats() {
+	pq.Lock()
+	defer pq.Unlock()
+
+	pq.enqueued, pq.dequeued, pq.counted = 0, 0, time.Now()
+}
+
+// throughput returns the given counts per second since the given time.
+func throughput(added, removed uint64, since time.Time) (float64, float64) {
+	elapsed := time.Since(since).Seconds()
+	if elapsed <= 0 {
+		return 0, 0
+	}
+	return float64(added) / elapsed, float64(removed) / elapsed
+}
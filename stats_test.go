@@ -0,0 +1,270 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = q.DequeueBatch(3); err != nil {
+		t.Error(err)
+	}
+
+	stats := q.Stats()
+	if stats.Length != 7 {
+		t.Errorf("Expected length of 7, got %d", stats.Length)
+	}
+
+	if stats.EnqueuedCount != 10 || stats.DequeuedCount != 3 {
+		t.Errorf("Expected counts of 10 and 3, got %d and %d", stats.EnqueuedCount, stats.DequeuedCount)
+	}
+
+	if stats.HeadID != 4 || stats.TailID != 10 {
+		t.Errorf("Expected head and tail IDs of 4 and 10, got %d and %d", stats.HeadID, stats.TailID)
+	}
+
+	if stats.DiskSize <= 0 {
+		t.Errorf("Expected a positive disk size, got %d", stats.DiskSize)
+	}
+
+	// Counters start again when reopened.
+	q.Close()
+	if stats = q.Stats(); stats.Length != 0 || stats.DiskSize != 0 {
+		t.Errorf("Expected zero stats when closed, got %+v", stats)
+	}
+
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	stats = q.Stats()
+	if stats.Length != 7 || stats.EnqueuedCount != 0 || stats.DequeuedCount != 0 {
+		t.Errorf("Expected length 7 and zero counts, got %+v", stats)
+	}
+}
+
+func TestStackStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = s.PushString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = s.Pop(); err != nil {
+		t.Error(err)
+	}
+
+	stats := s.Stats()
+	if stats.Length != 9 {
+		t.Errorf("Expected length of 9, got %d", stats.Length)
+	}
+
+	if stats.EnqueuedCount != 10 || stats.DequeuedCount != 1 {
+		t.Errorf("Expected counts of 10 and 1, got %d and %d", stats.EnqueuedCount, stats.DequeuedCount)
+	}
+
+	if stats.HeadID != 9 || stats.TailID != 1 {
+		t.Errorf("Expected head and tail IDs of 9 and 1, got %d and %d", stats.HeadID, stats.TailID)
+	}
+}
+
+func TestPriorityQueueStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPriorityQueue(file, DESC)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for p := 0; p <= 4; p++ {
+		for i := 1; i <= 3; i++ {
+			if _, err = pq.EnqueueString(uint8(p), fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if _, err = pq.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	stats := pq.Stats()
+	if stats.Length != 14 {
+		t.Errorf("Expected length of 14, got %d", stats.Length)
+	}
+
+	if stats.EnqueuedCount != 15 || stats.DequeuedCount != 1 {
+		t.Errorf("Expected counts of 15 and 1, got %d and %d", stats.EnqueuedCount, stats.DequeuedCount)
+	}
+
+	if stats.HeadID != 2 || stats.TailID != 3 {
+		t.Errorf("Expected head and tail IDs of 2 and 3, got %d and %d", stats.HeadID, stats.TailID)
+	}
+
+	if len(stats.LevelLengths) != 5 || stats.LevelLengths[4] != 2 || stats.LevelLengths[0] != 3 {
+		t.Errorf("Expected 5 level lengths, got %v", stats.LevelLengths)
+	}
+}
+
+func TestPrefixQueueStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	pq, err := OpenPrefixQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer pq.Drop()
+
+	for _, prefix := range []string{"a", "b", "c"} {
+		for i := 1; i <= 3; i++ {
+			if _, err = pq.EnqueueString(prefix, fmt.Sprintf("value for item %d", i)); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err = pq.DequeueString("b"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if _, err = pq.DequeueString("c"); err != nil {
+		t.Error(err)
+	}
+
+	stats := pq.Stats()
+	if stats.Length != 5 {
+		t.Errorf("Expected length of 5, got %d", stats.Length)
+	}
+
+	if stats.EnqueuedCount != 9 || stats.DequeuedCount != 4 {
+		t.Errorf("Expected counts of 9 and 4, got %d and %d", stats.EnqueuedCount, stats.DequeuedCount)
+	}
+
+	if len(stats.PrefixLengths) != 2 || stats.PrefixLengths["a"] != 3 || stats.PrefixLengths["c"] != 2 {
+		t.Errorf("Expected prefix lengths for a and c, got %v", stats.PrefixLengths)
+	}
+}
+
+func TestQueueDiskSize(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	before, err := q.DiskSize()
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 100; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	after, err := q.DiskSize()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if after <= before {
+		t.Errorf("Expected disk size to grow from %d, got %d", before, after)
+	}
+
+	q.Close()
+	if _, err = q.DiskSize(); err != ErrDBClosed {
+		t.Errorf("Expected to get database closed error, got %v", err)
+	}
+}
+
+func TestQueueThroughputStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	enqPerSec, deqPerSec := q.ThroughputStats()
+
+	if enqPerSec <= 0 || deqPerSec <= 0 || enqPerSec <= deqPerSec {
+		t.Errorf("Expected enqueue rate above a positive dequeue rate, got %f and %f", enqPerSec, deqPerSec)
+	}
+
+	q.ResetStats()
+
+	enqPerSec, deqPerSec = q.ThroughputStats()
+
+	if enqPerSec != 0 || deqPerSec != 0 {
+		t.Errorf("Expected rates of 0 after reset, got %f and %f", enqPerSec, deqPerSec)
+	}
+
+	stats := q.Stats()
+
+	if stats.EnqueuedCount != 0 || stats.DequeuedCount != 0 {
+		t.Errorf("Expected counts of 0 after reset, got %d and %d", stats.EnqueuedCount, stats.DequeuedCount)
+	}
+
+	if stats.Length != 9 {
+		t.Errorf("Expected queue length of 9, got %d", stats.Length)
+	}
+}
+
+func TestStackThroughputStats(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	s, err := OpenStack(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer s.Drop()
+
+	if _, err = s.PushString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	pushPerSec, popPerSec := s.ThroughputStats()
+
+	if pushPerSec <= 0 || popPerSec != 0 {
+		t.Errorf("Expected a positive push rate and no pops, got %f and %f", pushPerSec, popPerSec)
+	}
+
+	s.ResetStats()
+
+	if pushPerSec, _ = s.ThroughputStats(); pushPerSec != 0 {
+		t.Errorf("Expected push rate of 0 after reset, got %f", pushPerSec)
+	}
+}
@@ -0,0 +1,44 @@
+package goque
+
+import "context"
+
+// Tracer starts a span around each traced operation of a queue, such as
+// to record them using OpenTelemetry, which the
+// github.com/beeker1121/goque/tracing package adapts to this interface.
+// It is kept this small so goque does not depend on any tracing
+// library.
+type Tracer interface {
+	// Start starts a span for the given operation, such as
+	// "goque.Enqueue", as a child of any span within the given context.
+	// It returns a context holding the new span, which the operation
+	// runs with, so spans started within it become its children.
+	Start(ctx context.Context, operation string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End ends the span, recording the ID of the item the operation
+	// added or removed, which is zero if it failed, and its error.
+	End(id uint64, err error)
+}
+
+// trace calls fn within a span of the given operation if the queue has
+// a tracer, passing it the context holding the span, or simply calls fn
+// with the given context otherwise. The span is started before and
+// ended after fn, so fn must lock and unlock the queue itself.
+func (q *Queue) trace(ctx context.Context, operation string, fn func(ctx context.Context) (*Item, error)) (*Item, error) {
+	if q.tracer == nil {
+		return fn(ctx)
+	}
+
+	ctx, span := q.tracer.Start(ctx, operation)
+	item, err := fn(ctx)
+
+	var id uint64
+	if item != nil {
+		id = item.ID
+	}
+	span.End(id, err)
+
+	return item, err
+}
@@ -0,0 +1,90 @@
+package goque
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSpan struct {
+	tracer    *testTracer
+	operation string
+}
+
+func (s *testSpan) End(id uint64, err error) {
+	s.tracer.Lock()
+	defer s.tracer.Unlock()
+
+	s.tracer.ended = append(s.tracer.ended, fmt.Sprintf("%s %d %v", s.operation, id, err))
+}
+
+type testTracer struct {
+	sync.Mutex
+	ended []string
+}
+
+func (t *testTracer) Start(ctx context.Context, operation string) (context.Context, Span) {
+	return ctx, &testSpan{tracer: t, operation: operation}
+}
+
+func TestQueueTracer(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	tracer := &testTracer{}
+	q, err := OpenQueueWithOptions(file, &Options{Tracer: tracer})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.EnqueueString("value for item 2"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.DequeueIfID(3); err != ErrConflict {
+		t.Errorf("Expected to get conflict error, got %v", err)
+	}
+
+	if _, err = q.DequeueIfID(2); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = q.DequeueWait(ctx); err != context.Canceled {
+		t.Errorf("Expected to get canceled error, got %v", err)
+	}
+
+	expected := []string{
+		"goque.Enqueue 1 <nil>",
+		"goque.Dequeue 1 <nil>",
+		"goque.Enqueue 2 <nil>",
+		"goque.DequeueIfID 0 goque: Item value does not match expected value",
+		"goque.DequeueIfID 2 <nil>",
+		"goque.Dequeue 0 goque: Stack or queue is empty",
+		"goque.DequeueWait 0 context canceled",
+	}
+
+	if len(tracer.ended) != len(expected) {
+		t.Errorf("Expected %d spans, got %d", len(expected), len(tracer.ended))
+	}
+
+	for i := 0; i < len(expected) && i < len(tracer.ended); i++ {
+		if tracer.ended[i] != expected[i] {
+			t.Errorf("Expected span to be '%s', got '%s'", expected[i], tracer.ended[i])
+		}
+	}
+}
@@ -0,0 +1,59 @@
+// Package tracing adapts an OpenTelemetry tracer to the goque.Tracer
+// interface, so queue operations can be traced by setting the Tracer
+// option.
+//
+// It is a separate module, so programs using goque without
+// OpenTelemetry do not depend on it.
+package tracing
+
+import (
+	"context"
+
+	"github.com/beeker1121/goque"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// IDKey is the attribute key of the ID of the item an operation added or
+// removed.
+const IDKey = attribute.Key("goque.item.id")
+
+// New returns a goque.Tracer starting spans using the given tracer. For
+// example:
+//
+//	q, err := goque.OpenQueueWithOptions("data_dir", &goque.Options{
+//		Tracer: tracing.New(otel.Tracer("jobs")),
+//	})
+func New(tracer trace.Tracer) goque.Tracer {
+	return otelTracer{tracer: tracer}
+}
+
+// otelTracer is a goque.Tracer using an OpenTelemetry tracer.
+type otelTracer struct {
+	tracer trace.Tracer
+}
+
+// Start starts an OpenTelemetry span for the given operation, returning
+// the context holding it.
+func (t otelTracer) Start(ctx context.Context, operation string) (context.Context, goque.Span) {
+	ctx, span := t.tracer.Start(ctx, operation, trace.WithSpanKind(trace.SpanKindInternal))
+	return ctx, otelSpan{span: span}
+}
+
+// otelSpan is a goque.Span ending an OpenTelemetry span.
+type otelSpan struct {
+	span trace.Span
+}
+
+// End records the item ID or the error of the operation and ends the
+// span.
+func (s otelSpan) End(id uint64, err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	} else {
+		s.span.SetAttributes(IDKey.Int64(int64(id)))
+	}
+	s.span.End()
+}
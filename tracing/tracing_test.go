@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/beeker1121/goque"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := goque.OpenQueueWithOptions(file, &goque.Options{Tracer: New(provider.Tracer("test"))})
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = q.Dequeue(); err != goque.ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Errorf("Expected 3 spans, got %d", len(spans))
+		return
+	}
+
+	for i, name := range []string{"goque.Enqueue", "goque.Dequeue", "goque.Dequeue"} {
+		if spans[i].Name() != name {
+			t.Errorf("Expected span name to be '%s', got '%s'", name, spans[i].Name())
+		}
+	}
+
+	attrs := spans[1].Attributes()
+	if len(attrs) != 1 || attrs[0].Key != IDKey || attrs[0].Value.AsInt64() != 1 {
+		t.Errorf("Expected span to record item ID 1, got %v", attrs)
+	}
+
+	if spans[2].Status().Code != codes.Error {
+		t.Errorf("Expected span status to be an error, got %v", spans[2].Status().Code)
+	}
+}
+
+func TestTracerContext(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	// Spans started within the operation are its children.
+	ctx, span := New(provider.Tracer("test")).Start(context.Background(), "goque.Dequeue")
+	_, child := provider.Tracer("test").Start(ctx, "child")
+	child.End()
+	span.End(1, nil)
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Errorf("Expected 2 spans, got %d", len(spans))
+		return
+	}
+
+	if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() {
+		t.Errorf("Expected child span to have parent %v, got %v", spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+	}
+
+	if !trace.SpanContextFromContext(ctx).Equal(spans[1].SpanContext()) {
+		t.Errorf("Expected context to hold the operation span")
+	}
+}
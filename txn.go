@@ -0,0 +1,281 @@
+package goque
+
+import (
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Txn is a transaction on a Queue, created using Queue.Begin. The
+// items it enqueues and dequeues are only buffered until Commit, which
+// applies all of them using a single LevelDB write, while Rollback
+// discards them. Reads within the transaction see its own pending
+// changes.
+//
+// The queue stays locked for the lifetime of the transaction, so other
+// goroutines using the queue block until it is committed or rolled
+// back. The goroutine using the transaction must not use the queue
+// itself until then. A Txn must not be used concurrently.
+type Txn struct {
+	q        *Queue
+	batch    *leveldb.Batch
+	head     uint64
+	tail     uint64
+	removed  map[uint64]bool
+	pending  []*Item
+	dequeued []*Item
+	done     bool
+}
+
+// Begin starts a transaction on the queue, locking the queue until the
+// transaction is committed or rolled back.
+func (q *Queue) Begin() (*Txn, error) {
+	q.Lock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		q.unlock()
+		return nil, ErrDBClosed
+	}
+
+	// Check if queue is read-only.
+	if q.readOnly {
+		q.unlock()
+		return nil, ErrReadOnly
+	}
+
+	// Return items whose visibility timeout passed to the queue first.
+	if err := q.reclaimDue(time.Now()); err != nil {
+		q.unlock()
+		return nil, err
+	}
+
+	return &Txn{
+		q:       q,
+		batch:   new(leveldb.Batch),
+		head:    q.head,
+		tail:    q.tail,
+		removed: make(map[uint64]bool),
+	}, nil
+}
+
+// Enqueue adds an item to the tail of the queue once the transaction is
+// committed, returning the item as it will be stored.
+func (tx *Txn) Enqueue(value []byte) (*Item, error) {
+	// Check if transaction is done.
+	if tx.done {
+		return nil, ErrTxnDone
+	}
+
+	// Check if queue is full.
+	if tx.q.maxLength > 0 && tx.Length() >= tx.q.maxLength {
+		return nil, ErrFull
+	}
+
+	rec := &record{value: value, enqueuedAt: time.Now()}
+	item := newItem(tx.tail+1, rec, tx.q.codec)
+
+	b, err := tx.q.format.encode(rec)
+	if err != nil {
+		return nil, err
+	}
+	tx.batch.Put(item.Key, b)
+	tx.q.indexItem(tx.batch, item)
+
+	tx.tail++
+	tx.pending = append(tx.pending, item)
+
+	return item, nil
+}
+
+// EnqueueString is a helper function for Enqueue that accepts a value
+// as a string rather than a byte slice.
+func (tx *Txn) EnqueueString(value string) (*Item, error) {
+	return tx.Enqueue([]byte(value))
+}
+
+// Dequeue removes the next item in the queue once the transaction is
+// committed and returns it, including items enqueued within the
+// transaction. As for Queue.Dequeue, expired items are removed along
+// the way and items which are not visible yet are skipped.
+func (tx *Txn) Dequeue() (*Item, error) {
+	// Check if transaction is done.
+	if tx.done {
+		return nil, ErrTxnDone
+	}
+
+	return tx.next(true)
+}
+
+// Peek returns the item Dequeue would return next without removing it.
+func (tx *Txn) Peek() (*Item, error) {
+	// Check if transaction is done.
+	if tx.done {
+		return nil, ErrTxnDone
+	}
+
+	return tx.next(false)
+}
+
+// Length returns the number of items the queue will hold once the
+// transaction is committed.
+func (tx *Txn) Length() uint64 {
+	return tx.q.Length() + uint64(len(tx.pending)) - uint64(len(tx.removed))
+}
+
+// Commit applies the changes of the transaction to the queue using a
+// single LevelDB write, and unlocks the queue.
+func (tx *Txn) Commit() error {
+	// Check if transaction is done.
+	if tx.done {
+		return ErrTxnDone
+	}
+	tx.done = true
+
+	q := tx.q
+	defer q.unlock()
+
+	// Move the head past the items removed from the front, along with
+	// any holes behind them, and the tail back past those removed from
+	// the end.
+	head, tail := q.head, tx.tail
+	for head < tail {
+		id := head + 1
+		if tx.removed[id] {
+			head++
+			continue
+		}
+		if id > q.tail || q.holes == 0 {
+			break
+		}
+
+		// Seek past the holes to the next stored item, which is still
+		// stored even if the transaction removes it.
+		next, err := q.seekItem(id)
+		if err != nil {
+			return err
+		}
+		if next == id {
+			break
+		}
+		if next == 0 || next > q.tail {
+			next = q.tail + 1
+		}
+		head = next - 1
+	}
+	for tail > head && tx.removed[tail] {
+		tail--
+	}
+	holes := tail - head - tx.Length()
+
+	q.detachChunks(tx.batch, tx.dequeued...)
+	if err := q.writeState(tx.batch, head, tail, holes); err != nil {
+		return err
+	}
+	q.enqueued += uint64(len(tx.pending))
+	q.dequeued += uint64(len(tx.dequeued))
+	q.added(tx.pending...)
+	q.hooks.dequeued(tx.dequeued...)
+
+	return nil
+}
+
+// Rollback discards the changes of the transaction and unlocks the
+// queue. Calling Rollback once the transaction is committed returns
+// ErrTxnDone, so it can be deferred to roll back on any early return.
+func (tx *Txn) Rollback() error {
+	// Check if transaction is done.
+	if tx.done {
+		return ErrTxnDone
+	}
+	tx.done = true
+
+	tx.q.unlock()
+	return nil
+}
+
+// next returns the next ready item in the queue, including pending
+// items, removing it and any expired items in front of it if remove is
+// true.
+func (tx *Txn) next(remove bool) (*Item, error) {
+	q := tx.q
+	now := time.Now()
+
+	// Look through the stored items first, skipping those already
+	// removed within the transaction.
+	if tx.head < q.tail {
+		iter := q.db.NewIterator(&util.Range{Start: idToKey(tx.head + 1), Limit: idToKey(q.tail + 1)}, nil)
+		defer iter.Release()
+
+		for iter.Next() {
+			id := keyToID(iter.Key())
+			if tx.removed[id] {
+				continue
+			}
+
+			rec, err := q.format.decode(append([]byte(nil), iter.Value()...))
+			if err != nil {
+				return nil, err
+			}
+			item := newItem(id, rec, q.codec)
+
+			switch {
+			case item.expired(now):
+				if remove {
+					if err := tx.remove(item); err != nil {
+						return nil, err
+					}
+					dropChunks(tx.batch, item.chunks)
+				}
+			case item.visible(now):
+				if remove {
+					if err := tx.remove(item); err != nil {
+						return nil, err
+					}
+					tx.dequeued = append(tx.dequeued, item)
+				}
+				return item, nil
+			}
+		}
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Then through the items enqueued within the transaction.
+	for _, item := range tx.pending {
+		if tx.removed[item.ID] {
+			continue
+		}
+
+		if remove {
+			if err := tx.remove(item); err != nil {
+				return nil, err
+			}
+			tx.dequeued = append(tx.dequeued, item)
+		}
+		return item, nil
+	}
+
+	return nil, ErrEmpty
+}
+
+// remove adds the removal of the given item to the transaction, leaving
+// the chunks of its streamed value, if any, to the caller.
+func (tx *Txn) remove(item *Item) error {
+	tx.batch.Delete(item.Key)
+	tx.q.unindexItem(tx.batch, item)
+	if err := tx.q.dropUniqueKey(tx.batch, item.ID, item.uniqueKey); err != nil {
+		return err
+	}
+	item.uniqueKey = nil
+	tx.removed[item.ID] = true
+
+	// Start looking for the next item after those already removed.
+	for tx.head < tx.tail && tx.removed[tx.head+1] {
+		tx.head++
+	}
+
+	return nil
+}
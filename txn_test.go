@@ -0,0 +1,190 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueTxnCommit(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	tx, err := q.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = tx.EnqueueString("value for item 4"); err != nil {
+		t.Error(err)
+	}
+
+	// Dequeue past the stored items into the pending one.
+	for i := 1; i <= 4; i++ {
+		item, err := tx.Dequeue()
+		if err != nil {
+			t.Error(err)
+		}
+
+		compStr := fmt.Sprintf("value for item %d", i)
+
+		if item.ToString() != compStr {
+			t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+		}
+	}
+
+	if _, err = tx.Dequeue(); err != ErrEmpty {
+		t.Errorf("Expected to get empty error, got %v", err)
+	}
+
+	if _, err = tx.EnqueueString("value for item 5"); err != nil {
+		t.Error(err)
+	}
+
+	if tx.Length() != 1 {
+		t.Errorf("Expected transaction length of 1, got %d", tx.Length())
+	}
+
+	// Nothing changes until the transaction is committed.
+	if q.head != 0 || q.tail != 3 {
+		t.Errorf("Expected head 0 and tail 3, got %d and %d", q.head, q.tail)
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	if err = tx.Commit(); err != ErrTxnDone {
+		t.Errorf("Expected to get transaction done error, got %v", err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 5"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestQueueTxnCommitHoles(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// Leave a run of holes between items 2 and 9.
+	for id := uint64(3); id <= 8; id++ {
+		if err = q.DeleteByID(id); err != nil {
+			t.Error(err)
+		}
+	}
+
+	tx, err := q.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+
+	for i := 1; i <= 2; i++ {
+		if _, err = tx.Dequeue(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		t.Error(err)
+	}
+
+	// The head moves past the holes to the next stored item.
+	if q.head != 8 || q.tail != 10 {
+		t.Errorf("Expected head 8 and tail 10, got %d and %d", q.head, q.tail)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 9"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
+
+func TestQueueTxnRollback(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	if _, err = q.EnqueueString("value for item 1"); err != nil {
+		t.Error(err)
+	}
+
+	tx, err := q.Begin()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, err = tx.Dequeue(); err != nil {
+		t.Error(err)
+	}
+	if _, err = tx.EnqueueString("value for item 2"); err != nil {
+		t.Error(err)
+	}
+
+	if err = tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = tx.EnqueueString("value for item 3"); err != ErrTxnDone {
+		t.Errorf("Expected to get transaction done error, got %v", err)
+	}
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+
+	item, err := q.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 1"
+
+	if item.ToString() != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+	}
+}
@@ -0,0 +1,237 @@
+package goque
+
+// TypedItem represents an entry in either a typed stack or typed
+// queue, holding the decoded value of the stored item.
+type TypedItem[T any] struct {
+	ID    uint64
+	Key   []byte
+	Value T
+}
+
+// newTypedItem decodes the given item into a TypedItem of type T.
+func newTypedItem[T any](item *Item) (*TypedItem[T], error) {
+	ti := &TypedItem[T]{
+		ID:  item.ID,
+		Key: item.Key,
+	}
+
+	if err := item.ToObject(&ti.Value); err != nil {
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+// TypedQueue is a standard FIFO (first in, first out) queue holding
+// values of type T.
+//
+// Values are encoded using encoding/gob, exactly like the
+// EnqueueObject method of Queue, so a TypedQueue and a Queue can open
+// the same data directory.
+type TypedQueue[T any] struct {
+	q *Queue
+}
+
+// OpenTypedQueue opens a typed queue if one exists at the given
+// directory. If one does not already exist, a new typed queue is
+// created.
+func OpenTypedQueue[T any](dataDir string) (*TypedQueue[T], error) {
+	q, err := OpenQueue(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedQueue[T]{q: q}, nil
+}
+
+// Enqueue adds an item to the typed queue.
+func (tq *TypedQueue[T]) Enqueue(value T) (*TypedItem[T], error) {
+	item, err := tq.q.EnqueueObject(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedItem[T]{ID: item.ID, Key: item.Key, Value: value}, nil
+}
+
+// Dequeue removes the next item in the typed queue and returns it. The
+// item is decoded before it is removed, so an item which can not be
+// decoded into a T is left in place and the decoding error returned.
+func (tq *TypedQueue[T]) Dequeue() (*TypedItem[T], error) {
+	var ti *TypedItem[T]
+	var decodeErr error
+	_, err := tq.q.DequeueIf(func(item *Item) bool {
+		ti, decodeErr = newTypedItem[T](item)
+		return decodeErr == nil
+	})
+	if err == ErrNotMatched && decodeErr != nil {
+		return nil, decodeErr
+	} else if err != nil {
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+// Peek returns the next item in the typed queue without removing it.
+func (tq *TypedQueue[T]) Peek() (*TypedItem[T], error) {
+	item, err := tq.q.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	return newTypedItem[T](item)
+}
+
+// PeekByOffset returns the item located at the given offset,
+// starting from the head of the typed queue, without removing it.
+func (tq *TypedQueue[T]) PeekByOffset(offset uint64) (*TypedItem[T], error) {
+	item, err := tq.q.PeekByOffset(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTypedItem[T](item)
+}
+
+// PeekByID returns the item with the given ID without removing it.
+func (tq *TypedQueue[T]) PeekByID(id uint64) (*TypedItem[T], error) {
+	item, err := tq.q.PeekByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTypedItem[T](item)
+}
+
+// Update updates an item in the typed queue without changing its
+// position.
+func (tq *TypedQueue[T]) Update(id uint64, newValue T) (*TypedItem[T], error) {
+	item, err := tq.q.UpdateObject(id, newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedItem[T]{ID: item.ID, Key: item.Key, Value: newValue}, nil
+}
+
+// Length returns the total number of items in the typed queue.
+func (tq *TypedQueue[T]) Length() uint64 {
+	return tq.q.Length()
+}
+
+// Close closes the LevelDB database of the typed queue.
+func (tq *TypedQueue[T]) Close() error {
+	return tq.q.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the typed queue.
+func (tq *TypedQueue[T]) Drop() error {
+	return tq.q.Drop()
+}
+
+// TypedStack is a standard LIFO (last in, first out) stack holding
+// values of type T.
+//
+// Values are encoded using encoding/gob, exactly like the PushObject
+// method of Stack, so a TypedStack and a Stack can open the same data
+// directory.
+type TypedStack[T any] struct {
+	s *Stack
+}
+
+// OpenTypedStack opens a typed stack if one exists at the given
+// directory. If one does not already exist, a new typed stack is
+// created.
+func OpenTypedStack[T any](dataDir string) (*TypedStack[T], error) {
+	s, err := OpenStack(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedStack[T]{s: s}, nil
+}
+
+// Push adds an item to the typed stack.
+func (ts *TypedStack[T]) Push(value T) (*TypedItem[T], error) {
+	item, err := ts.s.PushObject(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedItem[T]{ID: item.ID, Key: item.Key, Value: value}, nil
+}
+
+// Pop removes the next item in the typed stack and returns it. The item
+// is decoded before it is removed, so an item which can not be decoded
+// into a T is left in place and the decoding error returned.
+func (ts *TypedStack[T]) Pop() (*TypedItem[T], error) {
+	var ti *TypedItem[T]
+	_, err := ts.s.pop(func(item *Item) error {
+		var err error
+		ti, err = newTypedItem[T](item)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ti, nil
+}
+
+// Peek returns the next item in the typed stack without removing it.
+func (ts *TypedStack[T]) Peek() (*TypedItem[T], error) {
+	item, err := ts.s.Peek()
+	if err != nil {
+		return nil, err
+	}
+
+	return newTypedItem[T](item)
+}
+
+// PeekByOffset returns the item located at the given offset,
+// starting from the head of the typed stack, without removing it.
+func (ts *TypedStack[T]) PeekByOffset(offset uint64) (*TypedItem[T], error) {
+	item, err := ts.s.PeekByOffset(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTypedItem[T](item)
+}
+
+// PeekByID returns the item with the given ID without removing it.
+func (ts *TypedStack[T]) PeekByID(id uint64) (*TypedItem[T], error) {
+	item, err := ts.s.PeekByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return newTypedItem[T](item)
+}
+
+// Update updates an item in the typed stack without changing its
+// position.
+func (ts *TypedStack[T]) Update(id uint64, newValue T) (*TypedItem[T], error) {
+	item, err := ts.s.UpdateObject(id, newValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TypedItem[T]{ID: item.ID, Key: item.Key, Value: newValue}, nil
+}
+
+// Length returns the total number of items in the typed stack.
+func (ts *TypedStack[T]) Length() uint64 {
+	return ts.s.Length()
+}
+
+// Close closes the LevelDB database of the typed stack.
+func (ts *TypedStack[T]) Close() error {
+	return ts.s.Close()
+}
+
+// Drop closes and deletes the LevelDB database of the typed stack.
+func (ts *TypedStack[T]) Drop() error {
+	return ts.s.Drop()
+}
@@ -0,0 +1,225 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type typedObject struct {
+	Name  string
+	Value int
+}
+
+func TestTypedQueueEnqueueDequeue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	tq, err := OpenTypedQueue[typedObject](file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer tq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = tq.Enqueue(typedObject{Name: "item", Value: i}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if tq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", tq.Length())
+	}
+
+	deqItem, err := tq.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compObj := typedObject{Name: "item", Value: 1}
+
+	if deqItem.Value != compObj {
+		t.Errorf("Expected object to be '%+v', got '%+v'", compObj, deqItem.Value)
+	}
+
+	if tq.Length() != 9 {
+		t.Errorf("Expected queue length of 9, got %d", tq.Length())
+	}
+}
+
+func TestTypedQueuePeekAndUpdate(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	tq, err := OpenTypedQueue[typedObject](file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer tq.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = tq.Enqueue(typedObject{Name: "item", Value: i}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	peekItem, err := tq.PeekByOffset(3)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if peekItem.Value.Value != 4 {
+		t.Errorf("Expected object value to be 4, got %d", peekItem.Value.Value)
+	}
+
+	newCompObj := typedObject{Name: "updated", Value: 44}
+
+	if _, err = tq.Update(peekItem.ID, newCompObj); err != nil {
+		t.Error(err)
+	}
+
+	newItem, err := tq.PeekByID(peekItem.ID)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if newItem.Value != newCompObj {
+		t.Errorf("Expected object to be '%+v', got '%+v'", newCompObj, newItem.Value)
+	}
+
+	if tq.Length() != 10 {
+		t.Errorf("Expected queue length of 10, got %d", tq.Length())
+	}
+}
+
+func TestTypedQueueCompatibleWithQueue(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	tq, err := OpenTypedQueue[typedObject](file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	compObj := typedObject{Name: "item", Value: 1}
+
+	if _, err = tq.Enqueue(compObj); err != nil {
+		t.Error(err)
+	}
+	tq.Close()
+
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	item, err := q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+
+	var obj typedObject
+	if err := item.ToObject(&obj); err != nil {
+		t.Error(err)
+	}
+
+	if obj != compObj {
+		t.Errorf("Expected object to be '%+v', got '%+v'", compObj, obj)
+	}
+}
+
+func TestTypedStackPushPop(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	ts, err := OpenTypedStack[string](file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer ts.Drop()
+
+	for i := 1; i <= 10; i++ {
+		if _, err = ts.Push(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	peekItem, err := ts.Peek()
+	if err != nil {
+		t.Error(err)
+	}
+
+	compStr := "value for item 10"
+
+	if peekItem.Value != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, peekItem.Value)
+	}
+
+	popItem, err := ts.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+
+	if popItem.Value != compStr {
+		t.Errorf("Expected string to be '%s', got '%s'", compStr, popItem.Value)
+	}
+
+	if ts.Length() != 9 {
+		t.Errorf("Expected stack length of 9, got %d", ts.Length())
+	}
+}
+
+func TestTypedQueueDequeueDecodeError(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	tq, err := OpenTypedQueue[typedObject](file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer tq.Drop()
+
+	// A value which is not gob encoded can not be decoded.
+	if _, err = tq.q.EnqueueString("not gob"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = tq.Dequeue(); err == nil {
+		t.Error("Expected to get decoding error")
+	}
+
+	// The item is left in place for the caller to deal with.
+	if tq.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", tq.Length())
+	}
+
+	item, err := tq.q.Dequeue()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "not gob" {
+		t.Errorf("Expected string to be 'not gob', got '%s'", item.ToString())
+	}
+}
+
+func TestTypedStackPopDecodeError(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	ts, err := OpenTypedStack[typedObject](file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer ts.Drop()
+
+	// A value which is not gob encoded can not be decoded.
+	if _, err = ts.s.PushString("not gob"); err != nil {
+		t.Error(err)
+	}
+
+	if _, err = ts.Pop(); err == nil {
+		t.Error("Expected to get decoding error")
+	}
+
+	// The item is left in place for the caller to deal with.
+	if ts.Length() != 1 {
+		t.Errorf("Expected stack length of 1, got %d", ts.Length())
+	}
+
+	item, err := ts.s.Pop()
+	if err != nil {
+		t.Error(err)
+	}
+	if item.ToString() != "not gob" {
+		t.Errorf("Expected string to be 'not gob', got '%s'", item.ToString())
+	}
+}
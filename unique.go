@@ -0,0 +1,114 @@
+package goque
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// uniquePrefix starts the key of every deduplication key in the
+// index of a queue, followed by the deduplication key itself.
+var uniquePrefix = internalKey("unique:")
+
+// uniqueRange is the key range holding the index of deduplication
+// keys.
+var uniqueRange = util.BytesPrefix(uniquePrefix)
+
+// uniqueIndexKey returns the index key of the given deduplication key.
+// The stored value is the 8 byte ID of the item holding it.
+func uniqueIndexKey(key []byte) []byte {
+	return append(append([]byte(nil), uniquePrefix...), key...)
+}
+
+// EnqueueUnique adds an item to the queue unless an item with the same
+// deduplication key is still pending, returning whether it was added.
+// If it was not, the pending item is returned instead. Once an item is
+// removed from the queue, such as by Dequeue, its key can be used
+// again.
+//
+// The check and the write happen while the queue is locked, so when
+// several goroutines add an item with the same key at once, only one
+// of them is added.
+func (q *Queue) EnqueueUnique(key []byte, value []byte) (*Item, bool, error) {
+	q.Lock()
+	defer q.unlock()
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		return nil, false, ErrDBClosed
+	}
+
+	// Check if an item with the key is pending.
+	item, err := q.getUnique(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if item != nil {
+		return item, false, nil
+	}
+
+	// Keep empty keys apart from items without a key.
+	key = append([]byte{}, key...)
+
+	item, err = q.enqueue(&record{value: value, uniqueKey: key})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return item, true, nil
+}
+
+// getUnique returns the pending item holding the given deduplication
+// key, or nil if there is none. Index entries left pointing at an item
+// which is gone or has expired are ignored. The queue must be locked by
+// the caller.
+func (q *Queue) getUnique(key []byte) (*Item, error) {
+	value, err := q.db.Get(uniqueIndexKey(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	id := binary.BigEndian.Uint64(value)
+	if id <= q.head || id > q.tail {
+		return nil, nil
+	}
+
+	item, err := q.getItem(id)
+	if err == ErrOutOfBounds {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if item.uniqueKey == nil || !bytes.Equal(item.uniqueKey, key) || item.expired(time.Now()) {
+		return nil, nil
+	}
+
+	return item, nil
+}
+
+// dropUniqueKey adds the removal of the given deduplication key from
+// the index to the batch, if it still points at the item with the given
+// ID. A nil key is ignored.
+func (q *Queue) dropUniqueKey(batch *leveldb.Batch, id uint64, key []byte) error {
+	if key == nil {
+		return nil
+	}
+
+	value, err := q.db.Get(uniqueIndexKey(key), nil)
+	if err == leveldb.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if binary.BigEndian.Uint64(value) == id {
+		batch.Delete(uniqueIndexKey(key))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package goque
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueEnqueueUnique(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	item, ok, err := q.EnqueueUnique([]byte("job-1"), []byte("first"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if !ok {
+		t.Error("Expected item to be added")
+	}
+
+	// A pending key should return the pending item.
+	dupItem, ok, err := q.EnqueueUnique([]byte("job-1"), []byte("second"))
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ok {
+		t.Error("Expected item not to be added")
+	}
+
+	if dupItem.ID != item.ID || dupItem.ToString() != "first" {
+		t.Errorf("Expected pending item %d with value 'first', got %d with '%s'", item.ID, dupItem.ID, dupItem.ToString())
+	}
+
+	if _, ok, err = q.EnqueueUnique([]byte("job-2"), []byte("other")); err != nil || !ok {
+		t.Errorf("Expected item with another key to be added, got %v", err)
+	}
+
+	if q.Length() != 2 {
+		t.Errorf("Expected queue length of 2, got %d", q.Length())
+	}
+
+	// Once dequeued, the key should be usable again, also after reopening.
+	if _, err = q.Dequeue(); err != nil {
+		t.Error(err)
+	}
+
+	q.Close()
+	q, err = OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if _, ok, err = q.EnqueueUnique([]byte("job-1"), []byte("third")); err != nil || !ok {
+		t.Errorf("Expected item to be added again, got %v", err)
+	}
+
+	if _, ok, err = q.EnqueueUnique([]byte("job-2"), []byte("other")); err != nil || ok {
+		t.Errorf("Expected item not to be added, got %v", err)
+	}
+}
+
+func TestQueueEnqueueUniqueConcurrent(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, _, err := q.EnqueueUnique([]byte("job"), []byte("value")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if q.Length() != 1 {
+		t.Errorf("Expected queue length of 1, got %d", q.Length())
+	}
+}
@@ -0,0 +1,92 @@
+package goque
+
+import "sync"
+
+// watchBuffer is the number of items a watcher channel can hold before
+// further items are dropped for that watcher.
+const watchBuffer = 64
+
+// watchers holds the channels of the goroutines watching a queue.
+type watchers struct {
+	mu    sync.Mutex
+	chans map[chan *Item]struct{}
+}
+
+// Watch returns a channel receiving each item added to the queue from
+// now on, without removing it from the queue, along with a function
+// that stops watching and closes the channel. Any number of goroutines
+// can watch a queue at once. The channel is also closed when the queue
+// is closed.
+//
+// Items are sent in the order they are added. Adding an item never
+// waits for a watcher: the channel buffers up to 64 items, and items
+// added while the channel of a watcher is full are dropped for that
+// watcher. A watcher which can not keep up should instead treat each
+// item received as a signal to read the queue.
+func (q *Queue) Watch() (<-chan *Item, func()) {
+	q.RLock()
+	defer q.RUnlock()
+
+	ch := make(chan *Item, watchBuffer)
+
+	// Check if queue is closed.
+	if !q.isOpen {
+		close(ch)
+		return ch, func() {}
+	}
+
+	q.watchers.mu.Lock()
+	if q.watchers.chans == nil {
+		q.watchers.chans = make(map[chan *Item]struct{})
+	}
+	q.watchers.chans[ch] = struct{}{}
+	q.watchers.mu.Unlock()
+
+	return ch, func() { q.watchers.remove(ch) }
+}
+
+// send sends the given items to every watcher which has room for them.
+func (w *watchers) send(items []*Item) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.chans {
+		for _, item := range items {
+			select {
+			case ch <- item:
+			default:
+			}
+		}
+	}
+}
+
+// remove stops sending items to the given channel and closes it, unless
+// that was already done.
+func (w *watchers) remove(ch chan *Item) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.chans[ch]; ok {
+		delete(w.chans, ch)
+		close(ch)
+	}
+}
+
+// closeAll stops sending items to every watcher and closes their
+// channels.
+func (w *watchers) closeAll() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for ch := range w.chans {
+		close(ch)
+	}
+	w.chans = nil
+}
+
+// added records that the given items were added to the queue, for its
+// hooks and watchers. The queue must be locked by the caller.
+func (q *Queue) added(items ...*Item) {
+	q.hooks.enqueued(items...)
+	q.watchers.send(items)
+}
@@ -0,0 +1,65 @@
+package goque
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestQueueWatch(t *testing.T) {
+	file := fmt.Sprintf("test_db_%d", time.Now().UnixNano())
+	q, err := OpenQueue(file)
+	if err != nil {
+		t.Error(err)
+	}
+	defer q.Drop()
+
+	ch1, cancel1 := q.Watch()
+	ch2, cancel2 := q.Watch()
+	defer cancel2()
+
+	for i := 1; i <= 3; i++ {
+		if _, err = q.EnqueueString(fmt.Sprintf("value for item %d", i)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, ch := range []<-chan *Item{ch1, ch2} {
+		for i := 1; i <= 3; i++ {
+			item := <-ch
+			compStr := fmt.Sprintf("value for item %d", i)
+
+			if item.ToString() != compStr {
+				t.Errorf("Expected string to be '%s', got '%s'", compStr, item.ToString())
+			}
+		}
+	}
+
+	// Watching should not remove any items.
+	if q.Length() != 3 {
+		t.Errorf("Expected queue length of 3, got %d", q.Length())
+	}
+
+	cancel1()
+	cancel1()
+
+	if _, ok := <-ch1; ok {
+		t.Error("Expected channel to be closed")
+	}
+
+	// A full watcher should not block enqueues.
+	for i := 0; i < watchBuffer+10; i++ {
+		if _, err = q.EnqueueString("value"); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if len(ch2) != watchBuffer {
+		t.Errorf("Expected %d buffered items, got %d", watchBuffer, len(ch2))
+	}
+
+	q.Close()
+
+	for range ch2 {
+	}
+}